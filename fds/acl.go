@@ -4,6 +4,11 @@ type aclOption struct {
 	ACL string `param:"acl" header:"-"`
 }
 
+type deleteACLOption struct {
+	ACL    string `param:"acl" header:"-"`
+	Action string `param:"action" header:"-"`
+}
+
 // GrantKey is key of Grant
 type GrantKey struct {
 	ID          string `json:"id"`
@@ -19,6 +24,12 @@ const (
 	GrantTypeGroup GrantType = "GROUP"
 )
 
+// Grantee IDs of the groups
+const (
+	GranteeAllUsers           = "ALL_USERS"
+	GranteeAuthenticatedUsers = "AUTHENTICATED_USERS"
+)
+
 // GrantPermission is permission of Grantee
 type GrantPermission string
 
@@ -38,6 +49,34 @@ type Grant struct {
 	Type       GrantType       `json:"type"`
 }
 
+// NewPublicReadGrant returns a grant of READ to everyone
+func NewPublicReadGrant() Grant {
+	return NewGroupGrant(GranteeAllUsers, GrantPermissionRead)
+}
+
+// NewAuthenticatedReadGrant returns a grant of READ to all authenticated users
+func NewAuthenticatedReadGrant() Grant {
+	return NewGroupGrant(GranteeAuthenticatedUsers, GrantPermissionRead)
+}
+
+// NewGroupGrant returns a grant of permission to the group
+func NewGroupGrant(group string, permission GrantPermission) Grant {
+	return Grant{
+		Grantee:    GrantKey{ID: group},
+		Permission: permission,
+		Type:       GrantTypeGroup,
+	}
+}
+
+// NewUserGrant returns a grant of permission to the developer id
+func NewUserGrant(id string, permission GrantPermission) Grant {
+	return Grant{
+		Grantee:    GrantKey{ID: id},
+		Permission: permission,
+		Type:       GrantTypeUser,
+	}
+}
+
 // AccessControlList is access control list
 type AccessControlList struct {
 	Grants []Grant `json:"accessControlList"`
@@ -48,3 +87,28 @@ type AccessControlList struct {
 func (acl *AccessControlList) AddGrant(grant Grant) {
 	acl.Grants = append(acl.Grants, grant)
 }
+
+// RemoveGrant removes the grants of the same grantee, type and permission from ACL
+func (acl *AccessControlList) RemoveGrant(grant Grant) {
+	grants := acl.Grants[:0]
+	for _, g := range acl.Grants {
+		if !g.matches(grant) {
+			grants = append(grants, g)
+		}
+	}
+	acl.Grants = grants
+}
+
+// HasGrant returns true if ACL contains a grant of the same grantee, type and permission
+func (acl *AccessControlList) HasGrant(grant Grant) bool {
+	for _, g := range acl.Grants {
+		if g.matches(grant) {
+			return true
+		}
+	}
+	return false
+}
+
+func (grant Grant) matches(other Grant) bool {
+	return grant.Grantee.ID == other.Grantee.ID && grant.Type == other.Type && grant.Permission == other.Permission
+}
@@ -4,13 +4,106 @@ import (
 	"bytes"
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/base64"
+	"fmt"
+	"hash"
 	"net/http"
 	"net/url"
 	"sort"
 	"strings"
+	"time"
 )
 
+// Signer signs the requests and presigned urls of the Client
+type Signer interface {
+	// SignRequest adds the authorization to header of a request
+	SignRequest(method HTTPMethod, u *url.URL, header http.Header, accessID, accessSecret string) error
+
+	// Presign adds the credential, expiration and signature to the query of u,
+	// header holds the headers which have to be sent along with the url
+	Presign(method HTTPMethod, u *url.URL, header http.Header, expires time.Time, accessID, accessSecret string) error
+}
+
+// GalaxyV2Signer signs with HMAC-SHA1 in the Galaxy-V2 scheme
+type GalaxyV2Signer struct{}
+
+// SignRequest adds the Galaxy-V2 Authorization header
+func (GalaxyV2Signer) SignRequest(method HTTPMethod, u *url.URL, header http.Header, accessID, accessSecret string) error {
+	return signRequest("Galaxy-V2", sha1.New, method, u, header, accessID, accessSecret)
+}
+
+// Presign adds GalaxyAccessKeyId, Expires and Signature to the query of u
+func (GalaxyV2Signer) Presign(method HTTPMethod, u *url.URL, header http.Header, expires time.Time, accessID, accessSecret string) error {
+	return presign(nil, sha1.New, method, u, header, expires, accessID, accessSecret)
+}
+
+// GalaxyV3Signer signs with HMAC-SHA256 in the Galaxy-V3 scheme,
+// the string to sign is the same as Galaxy-V2
+type GalaxyV3Signer struct{}
+
+// SignRequest adds the Galaxy-V3 Authorization header
+func (GalaxyV3Signer) SignRequest(method HTTPMethod, u *url.URL, header http.Header, accessID, accessSecret string) error {
+	return signRequest("Galaxy-V3", sha256.New, method, u, header, accessID, accessSecret)
+}
+
+// Presign adds GalaxyAccessKeyId, Expires, SignAlgorithm and Signature to the query of u
+func (GalaxyV3Signer) Presign(method HTTPMethod, u *url.URL, header http.Header, expires time.Time, accessID, accessSecret string) error {
+	extra := url.Values{HTTPHeaderSignAlgorithm: []string{SignAlgorithmHmacSHA256}}
+	return presign(extra, sha256.New, method, u, header, expires, accessID, accessSecret)
+}
+
+// SignerOf returns the Signer of algorithm, which is one of the SignAlgorithm constants,
+// an empty algorithm is SignAlgorithmHmacSHA1
+func SignerOf(algorithm string) (Signer, error) {
+	switch algorithm {
+	case "", SignAlgorithmHmacSHA1:
+		return GalaxyV2Signer{}, nil
+	case SignAlgorithmHmacSHA256:
+		return GalaxyV3Signer{}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrorSignAlgorithm, algorithm)
+}
+
+// errorSigner fails the requests and presigned urls of a client with an unknown SignAlgorithm
+type errorSigner struct {
+	err error
+}
+
+func (s errorSigner) SignRequest(method HTTPMethod, u *url.URL, header http.Header, accessID, accessSecret string) error {
+	return s.err
+}
+
+func (s errorSigner) Presign(method HTTPMethod, u *url.URL, header http.Header, expires time.Time, accessID, accessSecret string) error {
+	return s.err
+}
+
+func signRequest(scheme string, h func() hash.Hash, method HTTPMethod, u *url.URL, header http.Header, accessID, accessSecret string) error {
+	sig, err := signature(h, accessSecret, method, u.String(), header)
+	if err != nil {
+		return err
+	}
+	header.Add(HTTPHeaderAuthorization, fmt.Sprintf("%s %s:%s", scheme, accessID, sig))
+	return nil
+}
+
+func presign(extra url.Values, h func() hash.Hash, method HTTPMethod, u *url.URL, header http.Header, expires time.Time, accessID, accessSecret string) error {
+	params := u.Query()
+	params.Add(HTTPHeaderGalaxyAccessKeyID, accessID)
+	params.Add(HTTPHeaderExpires, fmt.Sprintf("%d", expires.UnixNano()/int64(time.Millisecond)))
+	for k, v := range extra {
+		params[k] = v
+	}
+	u.RawQuery = params.Encode()
+
+	sig, err := signature(h, accessSecret, method, u.String(), header)
+	if err != nil {
+		return err
+	}
+	u.RawQuery += "&" + HTTPHeaderSignature + "=" + url.QueryEscape(sig)
+	return nil
+}
+
 var subResourceMap = map[string]string{
 	"acl":                "",
 	"quota":              "",
@@ -19,9 +112,12 @@ var subResourceMap = map[string]string{
 	"uploadId":           "",
 	"storageAccessToken": "",
 	"metadata":           "",
+	"cors":               "",
+	"tagging":            "",
+	"versions":           "",
 }
 
-func signature(sk string, method HTTPMethod, url string, header http.Header) (string, error) {
+func signature(hf func() hash.Hash, sk string, method HTTPMethod, url string, header http.Header) (string, error) {
 	var buf bytes.Buffer
 	contentMd5 := header.Get(HTTPHeaderContentMD5)
 	contentType := header.Get(HTTPHeaderContentType)
@@ -48,7 +144,7 @@ func signature(sk string, method HTTPMethod, url string, header http.Header) (st
 		return "", newServerError(err.Error(), -1)
 	}
 	buf.Write(cr)
-	h := hmac.New(sha1.New, []byte(sk))
+	h := hmac.New(hf, []byte(sk))
 	_, err = h.Write(buf.Bytes())
 	if err != nil {
 		return "", newServerError(err.Error(), -1)
@@ -0,0 +1,114 @@
+package fds
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GalaxyV2SignerSignRequest(t *testing.T) {
+	u, _ := url.Parse("https://cnbj0.fds.api.xiaomi.com/bucket/object?uploads=&other=1")
+	header := http.Header{}
+	header.Set(HTTPHeaderContentType, "text/plain")
+	header.Set(HTTPHeaderDate, "Mon, 01 Oct 2018 00:00:00 GMT")
+	header.Set(XiaomiMetaPrefix+"a", "1")
+
+	assert.Nil(t, GalaxyV2Signer{}.SignRequest(HTTPPut, u, header, "ak", "sk"))
+	assert.Equal(t, "Galaxy-V2 ak:Je+2RMrH8gS13n2p2qxlyXckKo8=", header.Get(HTTPHeaderAuthorization))
+}
+
+func Test_GalaxyV2SignerPresign(t *testing.T) {
+	u, _ := url.Parse("https://cnbj0.fds.api.xiaomi.com/bucket/object")
+	expires := time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Nil(t, GalaxyV2Signer{}.Presign(HTTPGet, u, http.Header{}, expires, "ak", "sk"))
+	assert.Equal(t, "Expires=1538352000000&GalaxyAccessKeyId=ak&Signature=KXiv3xIsqT89Tg%2BDeT8gMIe9aQE%3D", u.RawQuery)
+}
+
+func Test_GalaxyV3SignerSignRequest(t *testing.T) {
+	u, _ := url.Parse("https://cnbj0.fds.api.xiaomi.com/bucket/object?uploads=&other=1")
+	header := http.Header{}
+	header.Set(HTTPHeaderContentType, "text/plain")
+	header.Set(HTTPHeaderDate, "Mon, 01 Oct 2018 00:00:00 GMT")
+	header.Set(XiaomiMetaPrefix+"a", "1")
+
+	assert.Nil(t, GalaxyV3Signer{}.SignRequest(HTTPPut, u, header, "ak", "sk"))
+	assert.Equal(t, "Galaxy-V3 ak:cTt7x41ae77XGs8Ry2X5IylOK3t13ljbfITMjLLJHAY=", header.Get(HTTPHeaderAuthorization))
+}
+
+func Test_GalaxyV3SignerPresign(t *testing.T) {
+	u, _ := url.Parse("https://cnbj0.fds.api.xiaomi.com/bucket/object")
+	expires := time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Nil(t, GalaxyV3Signer{}.Presign(HTTPGet, u, http.Header{}, expires, "ak", "sk"))
+	assert.Equal(t, "Expires=1538352000000&GalaxyAccessKeyId=ak&SignAlgorithm=HmacSHA256&Signature=M35ijBvBvijzdDfiZ%2F9pDEj5CGGAWuIwVhuPrHaeAOk%3D", u.RawQuery)
+}
+
+type stubSigner struct{}
+
+func (stubSigner) SignRequest(method HTTPMethod, u *url.URL, header http.Header, accessID, accessSecret string) error {
+	header.Set(HTTPHeaderAuthorization, "Stub "+accessID+":"+string(method)+":"+u.Path)
+	return nil
+}
+
+func (stubSigner) Presign(method HTTPMethod, u *url.URL, header http.Header, expires time.Time, accessID, accessSecret string) error {
+	u.RawQuery = "token=" + accessID
+	return nil
+}
+
+func Test_NewWithSigner(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get(HTTPHeaderAuthorization)
+	}))
+	defer server.Close()
+
+	client := NewWithSigner("ak", "sk", newTestClient(server).Configuration, stubSigner{})
+
+	assert.Nil(t, client.DeleteObject("bucket", "object"))
+	assert.Equal(t, "Stub ak:DELETE:/bucket/object", authorization)
+
+	presigned, err := client.PresignURL(HTTPGet, "bucket", "object", time.Now(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, server.URL+"/bucket/object?token=ak", presigned)
+}
+
+func Test_SignAlgorithm(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get(HTTPHeaderAuthorization)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+	assert.Nil(t, client.DeleteObject("bucket", "object"))
+	assert.True(t, strings.HasPrefix(authorization, "Galaxy-V2 ak:"), authorization)
+
+	client.Configuration.SignAlgorithm = SignAlgorithmHmacSHA256
+	assert.Nil(t, client.DeleteObject("bucket", "object"))
+	assert.True(t, strings.HasPrefix(authorization, "Galaxy-V3 ak:"), authorization)
+
+	// the presigned urls follow the algorithm too
+	conf, _ := NewClientConfiguration("cnbj0.fds.api.xiaomi.com")
+	client = New("ak", "sk", conf)
+	expires := time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+	presigned, err := client.PresignURL(HTTPGet, "bucket", "object", expires, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://cnbj0.fds.api.xiaomi.com/bucket/object?Expires=1538352000000&GalaxyAccessKeyId=ak&Signature=KXiv3xIsqT89Tg%2BDeT8gMIe9aQE%3D", presigned)
+
+	conf.SignAlgorithm = SignAlgorithmHmacSHA256
+	presigned, err = client.PresignURL(HTTPGet, "bucket", "object", expires, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://cnbj0.fds.api.xiaomi.com/bucket/object?Expires=1538352000000&GalaxyAccessKeyId=ak&SignAlgorithm=HmacSHA256&Signature=M35ijBvBvijzdDfiZ%2F9pDEj5CGGAWuIwVhuPrHaeAOk%3D", presigned)
+
+	conf.SignAlgorithm = "HmacMD5"
+	_, err = client.PresignURL(HTTPGet, "bucket", "object", expires, nil)
+	assert.True(t, errors.Is(err, ErrorSignAlgorithm))
+	assert.True(t, errors.Is(client.DeleteObject("bucket", "object"), ErrorSignAlgorithm))
+}
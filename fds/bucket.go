@@ -5,7 +5,9 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"time"
 )
 
 // CreateBucketRequest if request of creating bucket
@@ -40,13 +42,69 @@ func (client *Client) CreateBucketWithContext(ctx context.Context, request *Crea
 	return err
 }
 
-// DoesBucketExist judge whether a bucket exist
+// CreateBucketOptions are the options of CreateBucketWithOptions
+type CreateBucketOptions struct {
+	// OrgID creates the bucket under the organization of it if it is set
+	OrgID string
+
+	// Region creates the bucket in the region rather than the one of the client,
+	// its endpoint is resolved like NewClientForRegionWithResolver does
+	Region Region
+
+	// ACL is set right after the bucket is created, nil keeps the default ACL
+	ACL *AccessControlList
+}
+
+// CreateBucketWithOptions creates bucketName, ErrorBucketAlreadyExists is returned
+// through BucketExistsError if it exists
+func (client *Client) CreateBucketWithOptions(bucketName string, opts *CreateBucketOptions) error {
+	return client.CreateBucketWithOptionsWithContext(context.Background(), bucketName, opts)
+}
+
+// CreateBucketWithOptionsWithContext creates bucketName with context controlling.
+// The bucket is deleted if setting the ACL fails, so that no bucket with the
+// default ACL is left behind.
+func (client *Client) CreateBucketWithOptionsWithContext(ctx context.Context, bucketName string, opts *CreateBucketOptions) error {
+	if opts == nil {
+		opts = &CreateBucketOptions{}
+	}
+	regionClient, err := client.clientForRegion(opts.Region)
+	if err != nil {
+		return err
+	}
+
+	err = regionClient.CreateBucketWithContext(ctx, &CreateBucketRequest{BucketName: bucketName, OrgID: opts.OrgID})
+	if err != nil {
+		return newBucketExistsError(bucketName, err)
+	}
+	if opts.ACL == nil {
+		return nil
+	}
+
+	if err := regionClient.SetBucketACLWithContext(ctx, bucketName, opts.ACL); err != nil {
+		if e := regionClient.DeleteBucketWithContext(context.Background(), bucketName); e != nil {
+			client.logger.Debug(fmt.Sprintf("failed to delete bucket %s: %v", bucketName, e))
+		}
+		return err
+	}
+	return nil
+}
+
+// DoesBucketExist judge whether a bucket exist, false is returned on 404 and
+// other failures such as 403 are returned as error
 func (client *Client) DoesBucketExist(bucketName string) (bool, error) {
-	return client.DoesBucketExitsWithContext(context.Background(), bucketName)
+	return client.DoesBucketExistWithContext(context.Background(), bucketName)
 }
 
 // DoesBucketExitsWithContext judge whether bucket exitst with context controlling
+//
+// Deprecated: use DoesBucketExistWithContext instead
 func (client *Client) DoesBucketExitsWithContext(ctx context.Context, bucketName string) (bool, error) {
+	return client.DoesBucketExistWithContext(ctx, bucketName)
+}
+
+// DoesBucketExistWithContext judge whether a bucket exist with context controlling
+func (client *Client) DoesBucketExistWithContext(ctx context.Context, bucketName string) (bool, error) {
 	req := &clientRequest{
 		BucketName: bucketName,
 		Method:     HTTPHead,
@@ -86,6 +144,107 @@ func (client *Client) DeleteBucketWithContext(ctx context.Context, bucketName st
 	return err
 }
 
+// DeleteBucketProgress is the progress of emptying a bucket, the counts are totals so far
+type DeleteBucketProgress struct {
+	DeletedObjects int
+	FailedObjects  int
+	AbortedUploads int
+}
+
+// DeleteBucketOptions are the options of DeleteBucketWithOptions
+type DeleteBucketOptions struct {
+	// Force aborts the ongoing multipart uploads and deletes the objects of the bucket
+	// page by page in batches of BatchDeleteSize before deleting it
+	Force bool
+
+	// OnProgress is called after each page of uploads aborted and each batch of objects deleted
+	OnProgress func(progress DeleteBucketProgress)
+}
+
+// DeleteBucketWithOptions deletes bucketName, which is emptied first if Force is set
+func (client *Client) DeleteBucketWithOptions(bucketName string, opts *DeleteBucketOptions) error {
+	return client.DeleteBucketWithOptionsWithContext(context.Background(), bucketName, opts)
+}
+
+// DeleteBucketWithOptionsWithContext deletes bucketName with context controlling. Emptying a
+// bucket is done on the client, objects written meanwhile fail the deletion of the bucket and
+// the objects which fail to delete are returned as ErrorBucketNotEmpty before deleting it.
+func (client *Client) DeleteBucketWithOptionsWithContext(ctx context.Context, bucketName string, opts *DeleteBucketOptions) error {
+	if opts == nil {
+		opts = &DeleteBucketOptions{}
+	}
+	if opts.Force {
+		if err := client.emptyBucket(ctx, bucketName, opts.OnProgress); err != nil {
+			return err
+		}
+	}
+	return client.DeleteBucketWithContext(ctx, bucketName)
+}
+
+// emptyBucket aborts the multipart uploads of bucketName and deletes its objects,
+// the uploads go first so that none of them completes into an object afterwards
+func (client *Client) emptyBucket(ctx context.Context, bucketName string, onProgress func(DeleteBucketProgress)) error {
+	progress := DeleteBucketProgress{}
+	report := func() {
+		if onProgress != nil {
+			onProgress(progress)
+		}
+	}
+
+	listing, err := client.ListMultipartUploadsWithContext(ctx, bucketName, "", "", "", 0)
+	for err == nil {
+		for _, upload := range listing.Uploads {
+			err = client.AbortMultipartUploadWithContext(ctx, &InitMultipartUploadResponse{
+				BucketName: bucketName,
+				ObjectName: upload.ObjectName,
+				UploadID:   upload.UploadID,
+			})
+			if err != nil {
+				return err
+			}
+			progress.AbortedUploads++
+		}
+		if len(listing.Uploads) > 0 {
+			report()
+		}
+		if !listing.Truncated {
+			break
+		}
+		listing, err = client.ListMultipartUploadsNextBatchWithContext(ctx, listing)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	batches := make(chan []string)
+	listErr := make(chan error, 1)
+	go func() {
+		defer close(batches)
+		listErr <- client.listObjectNames(ctx, bucketName, "", batches)
+	}()
+
+	for names := range batches {
+		result, err := client.BatchDeleteObjectsWithContext(ctx, &DeleteObjectsRequest{BucketName: bucketName, ObjectNames: names})
+		if err != nil {
+			// the listing stops once ctx is canceled
+			return err
+		}
+		progress.DeletedObjects += len(result.Deleted)
+		progress.FailedObjects += len(result.Failed)
+		report()
+	}
+	if err := <-listErr; err != nil {
+		return err
+	}
+
+	if progress.FailedObjects > 0 {
+		return fmt.Errorf("%w: %d objects failed to delete", ErrorBucketNotEmpty, progress.FailedObjects)
+	}
+	return nil
+}
+
 // GetBucketInfoResponse is result of GetBucketInfo
 type GetBucketInfoResponse struct {
 	AllowOutsideAccess bool   `json:"allowOutsideAccess"`
@@ -267,9 +426,88 @@ func (client *Client) SetBucketACLWithContext(ctx context.Context, bucketName st
 	return err
 }
 
-// LifecycleBaseItem replaces days in action
+// AddBucketGrant adds grants to the ACL of bucket, the existing grants are kept
+func (client *Client) AddBucketGrant(bucketName string, grants ...Grant) error {
+	return client.AddBucketGrantWithContext(context.Background(), bucketName, grants...)
+}
+
+// AddBucketGrantWithContext adds grants to the ACL of bucket with context controlling
+func (client *Client) AddBucketGrantWithContext(ctx context.Context, bucketName string, grants ...Grant) error {
+	acl, err := client.GetBucketACLWithContext(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, grant := range grants {
+		if !acl.HasGrant(grant) {
+			acl.AddGrant(grant)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	return client.SetBucketACLWithContext(ctx, bucketName, acl)
+}
+
+// RemoveBucketGrant removes grants from the ACL of bucket, the other grants are kept
+func (client *Client) RemoveBucketGrant(bucketName string, grants ...Grant) error {
+	return client.RemoveBucketGrantWithContext(context.Background(), bucketName, grants...)
+}
+
+// RemoveBucketGrantWithContext removes grants from the ACL of bucket with context controlling,
+// SetBucketACL only adds grants so the removed ones are sent with the delete action
+func (client *Client) RemoveBucketGrantWithContext(ctx context.Context, bucketName string, grants ...Grant) error {
+	acl, err := client.GetBucketACLWithContext(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+
+	removed := &AccessControlList{Owner: acl.Owner}
+	for _, grant := range grants {
+		if acl.HasGrant(grant) {
+			removed.AddGrant(grant)
+		}
+	}
+	if len(removed.Grants) == 0 {
+		return nil
+	}
+
+	aclBytes, e := json.Marshal(removed)
+	if e != nil {
+		return errors.New("fds client: can't marshal acl")
+	}
+
+	req := &clientRequest{
+		BucketName:         bucketName,
+		Method:             HTTPPut,
+		QueryHeaderOptions: deleteACLOption{Action: "delete"},
+		Data:               bytes.NewReader(aclBytes),
+	}
+
+	resp, err := client.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return err
+}
+
+// LifecycleDateFormat is the layout of Date in LifecycleBaseItem
+const LifecycleDateFormat = "2006-01-02"
+
+// LifecycleBaseItem replaces days or date in action, only one of them could be set
 type LifecycleBaseItem struct {
-	Days float64 `json:"days"`
+	Days float64 `json:"days,omitempty"`
+	Date string  `json:"date,omitempty"`
+}
+
+// NewLifecycleDateItem returns a LifecycleBaseItem taking effect at the date of t
+func NewLifecycleDateItem(t time.Time) LifecycleBaseItem {
+	return LifecycleBaseItem{Date: t.Format(LifecycleDateFormat)}
 }
 
 // LifecycleActionType is enum type of action
@@ -279,7 +517,7 @@ type LifecycleActionType string
 const (
 	Expiration                     LifecycleActionType = "expiration"
 	NonCurrentVersionExpiration    LifecycleActionType = "nonCurrentVersionExpiration"
-	AbortIncompleteMultipartUpload LifecycleActionType = "abortIncompleteMultipartUpload "
+	AbortIncompleteMultipartUpload LifecycleActionType = "abortIncompleteMultipartUpload"
 )
 
 // LifecycleAction is action in LifecycleRule
@@ -293,6 +531,26 @@ type LifecycleRule struct {
 	Action  LifecycleAction `json:"actions"`
 }
 
+// Validate checks every action has either positive days or a valid date
+func (rule *LifecycleRule) Validate() error {
+	for actionType, item := range rule.Action {
+		if item.Date == "" {
+			if item.Days <= 0 {
+				return fmt.Errorf("%w: rule %q %s %v", ErrorLifecycleDaysNotPositive, rule.ID, actionType, item.Days)
+			}
+			continue
+		}
+
+		if item.Days != 0 {
+			return fmt.Errorf("%w: rule %q %s", ErrorLifecycleDaysAndDate, rule.ID, actionType)
+		}
+		if _, err := time.Parse(LifecycleDateFormat, item.Date); err != nil {
+			return fmt.Errorf("%w: rule %q %s %q", ErrorLifecycleDateInvalid, rule.ID, actionType, item.Date)
+		}
+	}
+	return nil
+}
+
 // NewLifecycleRuleFromJSON is a shortcut for translating json string to LifecycleRule.
 // Becuase, constructing a LifecycleRule is too hard
 func NewLifecycleRuleFromJSON(content []byte) (*LifecycleRule, error) {
@@ -306,6 +564,24 @@ type LifecycleConfig struct {
 	Rules []LifecycleRule `json:"rules"`
 }
 
+// Validate checks the rules, IDs of them have to be unique
+func (config *LifecycleConfig) Validate() error {
+	ids := map[string]bool{}
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		if rule.ID != "" {
+			if ids[rule.ID] {
+				return fmt.Errorf("%w: %q", ErrorLifecycleDuplicateRuleID, rule.ID)
+			}
+			ids[rule.ID] = true
+		}
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // NewLifecycleConfigFromJSON is a shortcut for translating json string to LifecycleConfig.
 // Becuase, constructing a LifecycleConfig is too hard
 func NewLifecycleConfigFromJSON(content []byte) (*LifecycleConfig, error) {
@@ -355,6 +631,13 @@ type lifecycleOption struct {
 
 // SetLifecycleConfigWithContext sets LifecycleConfig of bucket with context controlling
 func (client *Client) SetLifecycleConfigWithContext(ctx context.Context, bucketName string, config *LifecycleConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if config.Rules == nil {
+		config = &LifecycleConfig{Rules: []LifecycleRule{}}
+	}
+
 	data, err := json.Marshal(config)
 	if err != nil {
 		return err
@@ -376,6 +659,16 @@ func (client *Client) SetLifecycleConfigWithContext(ctx context.Context, bucketN
 	return err
 }
 
+// DeleteLifecycleConfig removes all the lifecycle rules of bucket
+func (client *Client) DeleteLifecycleConfig(bucketName string) error {
+	return client.DeleteLifecycleConfigWithContext(context.Background(), bucketName)
+}
+
+// DeleteLifecycleConfigWithContext removes all the lifecycle rules of bucket with context controlling
+func (client *Client) DeleteLifecycleConfigWithContext(ctx context.Context, bucketName string) error {
+	return client.SetLifecycleConfigWithContext(ctx, bucketName, &LifecycleConfig{})
+}
+
 // SetLifecycleRule sets LifecycleRule of bucket
 func (client *Client) SetLifecycleRule(bucketName string, rule *LifecycleRule) error {
 	return client.SetLifecycleRuleWithContext(context.Background(), bucketName, rule)
@@ -383,6 +676,10 @@ func (client *Client) SetLifecycleRule(bucketName string, rule *LifecycleRule) e
 
 // SetLifecycleRuleWithContext sets LifecycleRule of bucket with context controlling
 func (client *Client) SetLifecycleRuleWithContext(ctx context.Context, bucketName string, rule *LifecycleRule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+
 	data, err := json.Marshal(rule)
 	if err != nil {
 		return err
@@ -467,3 +764,185 @@ func (client *Client) SetAccessLogWithContext(ctx context.Context, bucketName st
 
 	return err
 }
+
+type corsOption struct {
+	CORS string `param:"cors" header:"-"`
+}
+
+// CORSRule is a cross-origin resource sharing rule of bucket
+type CORSRule struct {
+	ID             string   `json:"id,omitempty"`
+	AllowedOrigins []string `json:"allowedOrigins"`
+	AllowedMethods []string `json:"allowedMethods"`
+	AllowedHeaders []string `json:"allowedHeaders,omitempty"`
+	ExposedHeaders []string `json:"exposedHeaders,omitempty"`
+	MaxAgeSeconds  int      `json:"maxAgeSeconds,omitempty"`
+}
+
+// Validate checks the rule has origins and valid methods
+func (rule *CORSRule) Validate() error {
+	if len(rule.AllowedOrigins) == 0 {
+		return ErrorCORSOriginRequired
+	}
+	if len(rule.AllowedMethods) == 0 {
+		return fmt.Errorf("%w: no method", ErrorCORSMethodInvalid)
+	}
+	for _, method := range rule.AllowedMethods {
+		switch HTTPMethod(method) {
+		case HTTPGet, HTTPPut, HTTPHead, HTTPPost, HTTPDelete:
+		default:
+			return fmt.Errorf("%w: %q", ErrorCORSMethodInvalid, method)
+		}
+	}
+	return nil
+}
+
+// CORSConfig is the CORS config of bucket
+type CORSConfig struct {
+	Rules []CORSRule `json:"rules"`
+}
+
+// Validate checks every rule of the config
+func (config *CORSConfig) Validate() error {
+	for i := range config.Rules {
+		if err := config.Rules[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetBucketCORS returns CORSConfig of bucket
+func (client *Client) GetBucketCORS(bucketName string) (*CORSConfig, error) {
+	return client.GetBucketCORSWithContext(context.Background(), bucketName)
+}
+
+// GetBucketCORSWithContext returns CORSConfig of bucket with context controlling
+func (client *Client) GetBucketCORSWithContext(ctx context.Context, bucketName string) (*CORSConfig, error) {
+	result := &CORSConfig{}
+	req := &clientRequest{
+		BucketName:         bucketName,
+		Method:             HTTPGet,
+		QueryHeaderOptions: corsOption{},
+		Result:             result,
+	}
+
+	resp, err := client.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return result, err
+}
+
+// PutBucketCORS replaces CORSConfig of bucket
+func (client *Client) PutBucketCORS(bucketName string, config *CORSConfig) error {
+	return client.PutBucketCORSWithContext(context.Background(), bucketName, config)
+}
+
+// PutBucketCORSWithContext replaces CORSConfig of bucket with context controlling
+func (client *Client) PutBucketCORSWithContext(ctx context.Context, bucketName string, config *CORSConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	req := &clientRequest{
+		BucketName:         bucketName,
+		Method:             HTTPPut,
+		QueryHeaderOptions: corsOption{},
+		Data:               bytes.NewReader(data),
+	}
+
+	resp, err := client.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return err
+}
+
+// DeleteBucketCORS removes CORSConfig of bucket
+func (client *Client) DeleteBucketCORS(bucketName string) error {
+	return client.DeleteBucketCORSWithContext(context.Background(), bucketName)
+}
+
+// DeleteBucketCORSWithContext removes CORSConfig of bucket with context controlling
+func (client *Client) DeleteBucketCORSWithContext(ctx context.Context, bucketName string) error {
+	req := &clientRequest{
+		BucketName:         bucketName,
+		Method:             HTTPDelete,
+		QueryHeaderOptions: corsOption{},
+	}
+
+	resp, err := client.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return err
+}
+
+// AddBucketCORSRule appends rule to CORSConfig of bucket, the existing rules are kept
+func (client *Client) AddBucketCORSRule(bucketName string, rule CORSRule) error {
+	return client.AddBucketCORSRuleWithContext(context.Background(), bucketName, rule)
+}
+
+// AddBucketCORSRuleWithContext appends rule to CORSConfig of bucket with context controlling
+func (client *Client) AddBucketCORSRuleWithContext(ctx context.Context, bucketName string, rule CORSRule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+
+	config, err := client.GetBucketCORSWithContext(ctx, bucketName)
+	if IsNotFound(err) {
+		config, err = &CORSConfig{}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	config.Rules = append(config.Rules, rule)
+	return client.PutBucketCORSWithContext(ctx, bucketName, config)
+}
+
+// GetBucketTagging returns the tags of bucket
+func (client *Client) GetBucketTagging(bucketName string) (Tags, error) {
+	return client.GetBucketTaggingWithContext(context.Background(), bucketName)
+}
+
+// GetBucketTaggingWithContext returns the tags of bucket with context controlling
+func (client *Client) GetBucketTaggingWithContext(ctx context.Context, bucketName string) (Tags, error) {
+	return client.getTagging(ctx, bucketName, "")
+}
+
+// PutBucketTagging replaces the tags of bucket with tags, at most MaxBucketTags
+func (client *Client) PutBucketTagging(bucketName string, tags Tags) error {
+	return client.PutBucketTaggingWithContext(context.Background(), bucketName, tags)
+}
+
+// PutBucketTaggingWithContext replaces the tags of bucket with tags with context controlling
+func (client *Client) PutBucketTaggingWithContext(ctx context.Context, bucketName string, tags Tags) error {
+	if err := tags.validate(MaxBucketTags); err != nil {
+		return err
+	}
+
+	return client.putTagging(ctx, bucketName, "", tags)
+}
+
+// DeleteBucketTagging removes all tags of bucket
+func (client *Client) DeleteBucketTagging(bucketName string) error {
+	return client.DeleteBucketTaggingWithContext(context.Background(), bucketName)
+}
+
+// DeleteBucketTaggingWithContext removes all tags of bucket with context controlling
+func (client *Client) DeleteBucketTaggingWithContext(ctx context.Context, bucketName string) error {
+	return client.deleteTagging(ctx, bucketName, "")
+}
@@ -0,0 +1,203 @@
+package fds
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bucketTestServer keeps the objects and the multipart uploads of a single bucket,
+// the bucket can only be deleted once both are empty
+type bucketTestServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	created []string
+	acls    map[string]bool
+	objects []string
+	uploads []string
+	deleted bool
+	failACL bool
+}
+
+func newBucketTestServer() *bucketTestServer {
+	s := &bucketTestServer{acls: map[string]bool{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *bucketTestServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := r.URL.Query()
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	names := strings.SplitN(path, "/", 2)
+	switch {
+	case r.Method == http.MethodPut && q["acl"] != nil:
+		if s.failACL {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		s.acls[names[0]] = true
+	case r.Method == http.MethodPut && q["deleteObjects"] != nil:
+		var batch []string
+		json.NewDecoder(r.Body).Decode(&batch)
+		var failed []DeleteObjectError
+		for _, name := range batch {
+			if name == "locked" {
+				failed = append(failed, DeleteObjectError{ObjectName: name, Message: "AccessDenied"})
+				continue
+			}
+			i := sort.SearchStrings(s.objects, name)
+			s.objects = append(s.objects[:i], s.objects[i+1:]...)
+		}
+		if len(failed) > 0 {
+			data, _ := json.Marshal(failed)
+			w.Write(data)
+		}
+	case r.Method == http.MethodPut:
+		for _, name := range s.created {
+			if name == names[0] {
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"errorCode":"BucketAlreadyExists","message":"bucket exists"}`))
+				return
+			}
+		}
+		s.created = append(s.created, names[0])
+	case r.Method == http.MethodGet && q["uploads"] != nil:
+		// a page of a single upload
+		listing := MultipartUploadListing{BucketName: names[0]}
+		start := 0
+		for start < len(s.uploads) && s.uploads[start] <= q.Get("keyMarker") {
+			start++
+		}
+		if start < len(s.uploads) {
+			listing.Uploads = []MultipartUploadSummary{{ObjectName: s.uploads[start], UploadID: "id-" + s.uploads[start]}}
+			listing.Truncated = start+1 < len(s.uploads)
+			listing.NextKeyMarker = s.uploads[start]
+		}
+		data, _ := json.Marshal(listing)
+		w.Write(data)
+	case r.Method == http.MethodGet:
+		listing := ObjectListing{BucketName: names[0]}
+		for _, name := range s.objects {
+			listing.ObjectSummaries = append(listing.ObjectSummaries, ObjectSummary{ObjectName: name})
+		}
+		data, _ := json.Marshal(listing)
+		w.Write(data)
+	case r.Method == http.MethodDelete && q["uploadId"] != nil:
+		i := sort.SearchStrings(s.uploads, names[1])
+		s.uploads = append(s.uploads[:i], s.uploads[i+1:]...)
+	case r.Method == http.MethodDelete:
+		if len(s.objects) > 0 || len(s.uploads) > 0 {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		s.deleted = true
+	}
+	ioutil.ReadAll(r.Body)
+}
+
+func Test_CreateBucketWithOptions(t *testing.T) {
+	server := newBucketTestServer()
+	defer server.Close()
+	client := newTestClient(server.Server)
+
+	acl := &AccessControlList{}
+	acl.AddGrant(Grant{Grantee: GrantKey{ID: "ALL_USERS"}, Permission: GrantPermissionRead, Type: GrantTypeGroup})
+	assert.Nil(t, client.CreateBucketWithOptions("bucket", &CreateBucketOptions{ACL: acl}))
+	assert.Equal(t, []string{"bucket"}, server.created)
+	assert.True(t, server.acls["bucket"])
+
+	err := client.CreateBucketWithOptions("bucket", nil)
+	assert.True(t, errors.Is(err, ErrorBucketAlreadyExists), err)
+	var existsError *BucketExistsError
+	assert.True(t, errors.As(err, &existsError))
+	assert.Equal(t, "bucket", existsError.BucketName)
+	var serverError *ServerError
+	assert.True(t, errors.As(err, &serverError))
+	assert.Equal(t, "BucketAlreadyExists", serverError.ErrorCode)
+
+	// a bucket whose ACL fails to set is not left behind
+	server.failACL = true
+	err = client.CreateBucketWithOptions("other", &CreateBucketOptions{ACL: acl})
+	assert.NotNil(t, err)
+	assert.False(t, server.acls["other"])
+	assert.True(t, server.deleted)
+
+	err = client.CreateBucketWithOptions("bucket", &CreateBucketOptions{Region: "unknown"})
+	assert.True(t, errors.Is(err, ErrorUnknownRegion), err)
+}
+
+func Test_CreateBucketWithOptionsRegion(t *testing.T) {
+	server := newBucketTestServer()
+	defer server.Close()
+	client := newTestClient(server.Server)
+
+	var regions []Region
+	client.Configuration.EndpointResolver = EndpointResolverFunc(func(region Region, internal, cdn bool) string {
+		if cdn {
+			return ""
+		}
+		regions = append(regions, region)
+		return strings.TrimPrefix(server.URL, "http://")
+	})
+	assert.Nil(t, client.CreateBucketWithOptions("bucket", &CreateBucketOptions{Region: "custom"}))
+	assert.Equal(t, []string{"bucket"}, server.created)
+	assert.Equal(t, Region("custom"), regions[0])
+	// the client itself is not moved to the region
+	assert.NotEqual(t, "custom", client.Configuration.RegionName())
+}
+
+func Test_DeleteBucketWithOptionsForce(t *testing.T) {
+	server := newBucketTestServer()
+	defer server.Close()
+	server.objects = []string{"a", "b", "c", "d", "e"}
+	server.uploads = []string{"u1", "u2", "u3"}
+	client := newTestClient(server.Server)
+	client.Configuration.BatchDeleteSize = 2
+
+	// a bucket which is not empty is not deleted without Force
+	err := client.DeleteBucketWithOptions("bucket", nil)
+	assert.NotNil(t, err)
+	assert.False(t, server.deleted)
+
+	var progress []DeleteBucketProgress
+	err = client.DeleteBucketWithOptions("bucket", &DeleteBucketOptions{
+		Force:      true,
+		OnProgress: func(p DeleteBucketProgress) { progress = append(progress, p) },
+	})
+	assert.Nil(t, err)
+	assert.True(t, server.deleted)
+	assert.Empty(t, server.uploads)
+	assert.Empty(t, server.objects)
+	assert.Equal(t, []DeleteBucketProgress{
+		{AbortedUploads: 1},
+		{AbortedUploads: 2},
+		{AbortedUploads: 3},
+		{DeletedObjects: 2, AbortedUploads: 3},
+		{DeletedObjects: 4, AbortedUploads: 3},
+		{DeletedObjects: 5, AbortedUploads: 3},
+	}, progress)
+}
+
+func Test_DeleteBucketWithOptionsForceFailedObjects(t *testing.T) {
+	server := newBucketTestServer()
+	defer server.Close()
+	server.objects = []string{"a", "locked"}
+	client := newTestClient(server.Server)
+
+	err := client.DeleteBucketWithOptions("bucket", &DeleteBucketOptions{Force: true})
+	assert.True(t, errors.Is(err, ErrorBucketNotEmpty), err)
+	assert.False(t, server.deleted)
+	assert.Equal(t, []string{"locked"}, server.objects)
+}
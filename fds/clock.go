@@ -0,0 +1,58 @@
+package fds
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// clock is the source of time of the Client, it is replaced in tests so that
+// retries don't sleep
+type clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// jitterSource returns numbers in [0, 1) to randomize backoffs, it has to be
+// safe for concurrent use
+type jitterSource interface {
+	Float64() float64
+}
+
+// globalJitter uses the global source of math/rand
+type globalJitter struct{}
+
+func (globalJitter) Float64() float64 {
+	return rand.Float64()
+}
+
+// seededJitter is a jitterSource with a fixed seed
+type seededJitter struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newSeededJitter(seed int64) *seededJitter {
+	return &seededJitter{r: rand.New(rand.NewSource(seed))}
+}
+
+func (j *seededJitter) Float64() float64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.r.Float64()
+}
@@ -0,0 +1,66 @@
+package fds
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// clockOffsetResetThreshold is how close to the time of the service the clock has to be
+// to drop the offset, the Date of a response is only accurate to a second
+const clockOffsetResetThreshold = 5 * time.Second
+
+// IsClockSkewed returns true if err is a ServerError of a request rejected for the
+// Date being too far from the time of the service
+func IsClockSkewed(err error) bool {
+	var e *ServerError
+	if !errors.As(err, &e) || e.StatusCode != http.StatusForbidden {
+		return false
+	}
+	return e.ErrorCode == ErrorCodeRequestTimeTooSkewed || strings.Contains(strings.ToLower(e.msg), "skew")
+}
+
+// ClockOffset returns the offset added to the local clock to sign the requests, which is
+// learned from the Date of the responses rejected for a skewed clock, 0 if the clock is in sync
+func (client *Client) ClockOffset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&client.clockOffset))
+}
+
+// now is the time of the service as far as the client knows
+func (client *Client) now() time.Time {
+	return client.clock.Now().Add(client.ClockOffset())
+}
+
+// correctClock updates the clock offset from the Date of response, it returns true if the
+// request is rejected for a skewed clock and sending it again with the new offset may help.
+// The offset is dropped once the local clock is back in sync.
+func (client *Client) correctClock(response *http.Response, err error) bool {
+	if response == nil {
+		return false
+	}
+	date, e := http.ParseTime(response.Header.Get(HTTPHeaderDate))
+	if e != nil {
+		return false
+	}
+
+	measured := date.Sub(client.clock.Now())
+	if IsClockSkewed(err) {
+		previous := time.Duration(atomic.SwapInt64(&client.clockOffset, int64(measured)))
+		client.logger.Debug("clock is skewed from the service by " + measured.String())
+		return absDuration(measured-previous) >= clockOffsetResetThreshold
+	}
+
+	if err == nil && absDuration(measured) < clockOffsetResetThreshold {
+		atomic.StoreInt64(&client.clockOffset, 0)
+	}
+	return false
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
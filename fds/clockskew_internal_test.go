@@ -0,0 +1,77 @@
+package fds
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ClockSkew(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	skew := time.Hour
+	reject := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+
+		now := time.Now().Add(skew)
+		w.Header().Set(HTTPHeaderDate, now.UTC().Format(http.TimeFormat))
+		date, err := time.Parse(time.RFC1123, r.Header.Get(HTTPHeaderDate))
+		if err != nil || reject || absDuration(now.Sub(date)) > 15*time.Minute {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"code":"RequestTimeTooSkewed","message":"request time too skewed"}`))
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+	put := func() error {
+		_, err := client.PutObject(&PutObjectRequest{BucketName: "bucket", ObjectName: "object", Data: strings.NewReader("data")})
+		return err
+	}
+	requests := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		n := len(bodies)
+		bodies = nil
+		return n
+	}
+
+	// the rejected request is sent again with the offset of the Date of the service
+	assert.Nil(t, put())
+	assert.InDelta(t, float64(time.Hour), float64(client.ClockOffset()), float64(2*time.Second))
+	assert.Equal(t, []string{"data", "data"}, bodies)
+	assert.Equal(t, 2, requests())
+
+	// the later requests are signed with the offset
+	assert.Nil(t, put())
+	assert.Equal(t, 1, requests())
+
+	// the offset is dropped once the clock is in sync
+	mu.Lock()
+	skew = 0
+	mu.Unlock()
+	assert.Nil(t, put())
+	assert.Equal(t, 2, requests())
+	assert.Equal(t, time.Duration(0), client.ClockOffset())
+
+	// the request is sent again only once
+	mu.Lock()
+	skew = time.Hour
+	reject = true
+	mu.Unlock()
+	err := put()
+	assert.True(t, IsClockSkewed(err))
+	assert.Equal(t, 2, requests())
+}
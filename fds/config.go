@@ -2,17 +2,24 @@ package fds
 
 import (
 	"bytes"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
 	"strings"
 	"time"
+
+	"golang.org/x/time/rate"
 )
 
 // HTTPTimeout defines HTTP timeout.
 type HTTPTimeout struct {
-	ConnectTimeout   time.Duration
-	ReadWriteTimeout time.Duration
-	HeaderTimeout    time.Duration
-	LongTimeout      time.Duration
-	IdleConnTimeout  time.Duration
+	ConnectTimeout      time.Duration
+	ReadWriteTimeout    time.Duration
+	HeaderTimeout       time.Duration
+	LongTimeout         time.Duration
+	IdleConnTimeout     time.Duration
+	TLSHandshakeTimeout time.Duration
 }
 
 // ClientConfiguration required by FDSClient initialization
@@ -22,12 +29,13 @@ type ClientConfiguration struct {
 
 	Endpoint               string
 	EnableHTTPS            bool
-	EnableCDNForUpload     bool
-	EnableCDNForDownload   bool
+	EnableCDNForUpload     bool // PutObject and UploadPart go to the CDN endpoint
+	EnableCDNForDownload   bool // GetObject goes to the CDN endpoint
 	EnableMd5Calculate     bool
 	Timeout                uint
 	HTTPTimeout            HTTPTimeout
-	MaxConnection          uint
+	MaxConnection          uint // the idle connections kept per host
+	MaxIdleConnection      uint // the idle connections kept across hosts
 	BatchDeleteSize        uint
 	RetryCount             uint
 	RetryInterval          uint
@@ -35,6 +43,85 @@ type ClientConfiguration struct {
 	DownloadBandwidth      uint64
 	UploadBandwidth        uint64
 	HTTPKeepAliveTimeoutMs uint64
+
+	// RequestTimeout bounds every attempt of a request until its response is read, the
+	// body of a streamed GetObject is bounded by BodyIdleTimeout instead once the headers
+	// arrive and sending a request body restarts it, 0 disables it
+	RequestTimeout time.Duration
+
+	// TotalOperationTimeout bounds an API call across its retries like RequestTimeout, sending
+	// a request body restarts it too, so that a large upload making progress is never cut
+	TotalOperationTimeout time.Duration
+
+	// ResponseHeaderTimeout bounds the time to the headers of a streamed response, such as
+	// GetObject and GetObjectMetadata, in place of RequestTimeout if it is shorter, so that a
+	// hung download fails fast. Its body is bounded by BodyIdleTimeout alone, 0 disables it
+	ResponseHeaderTimeout time.Duration
+
+	// BodyIdleTimeout fails a read of the body of a streamed response with ErrorBodyIdleTimeout
+	// once no data arrives for it, a large download which makes progress is never cut.
+	// The Downloader overrides it with its StallTimeout, 0 disables it
+	BodyIdleTimeout time.Duration
+
+	// MaxGetObjectBytes is the largest object read into memory by GetObjectBytes, 0 means no limit
+	MaxGetObjectBytes int64
+
+	// SignAlgorithm is the algorithm of the signatures of the requests and presigned urls,
+	// SignAlgorithmHmacSHA256 signs in the Galaxy-V3 scheme, empty is SignAlgorithmHmacSHA1.
+	// It is ignored by a client of NewWithSigner with a signer
+	SignAlgorithm string
+
+	// RetryPolicy retries failed requests of the Client, nil disables retries
+	RetryPolicy *RetryPolicy
+
+	// RetryBufferSize is the largest body which can not seek read into memory so that its
+	// request can be retried, a larger one is sent once, 0 disables the buffering
+	RetryBufferSize int64
+
+	// ReadRateLimiter limits the GET and HEAD requests, every attempt waits for a token of it.
+	// Setting a limiter to the configurations of several clients limits them together, nil disables it
+	ReadRateLimiter *rate.Limiter
+
+	// WriteRateLimiter limits the other requests like ReadRateLimiter, it can be the same limiter
+	WriteRateLimiter *rate.Limiter
+
+	// HTTPClient sends the requests as-is if it is set, the HTTP settings of the
+	// configuration below are for the client built otherwise
+	HTTPClient *http.Client
+
+	// Transport is the transport of the built client, HTTPTimeout, MaxConnection,
+	// Proxy and TLSConfig are ignored if it is set
+	Transport http.RoundTripper
+
+	// Proxy returns the proxy of a request, the environment variables are used if nil
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// TLSConfig is the TLS configuration such as a custom CA for private endpoints
+	TLSConfig *tls.Config
+
+	// UserAgent is appended to the SDK identifier in the User-Agent header of every request
+	UserAgent string
+
+	// Debug logs the HTTP traffic of the client with Debug of its logger, the
+	// GO_FDS_DEBUG environment variable is used if it is DebugOff
+	Debug DebugLevel
+
+	// EnableInternalEndpoint sends the requests to the internal endpoint of the region
+	EnableInternalEndpoint bool
+
+	// EndpointResolver resolves the endpoints of the requests instead of Endpoint,
+	// the CDN endpoint and the internal endpoint of the region
+	EndpointResolver EndpointResolver
+
+	// TraceProvider starts a span for every operation of the client, nil disables tracing
+	TraceProvider TraceProvider
+
+	// MetricsCollector collects the metrics of the client and the manager, nil disables them
+	MetricsCollector MetricsCollector
+
+	// VirtualHostStyle addresses buckets as bucket.endpoint/object instead of the
+	// path-style endpoint/bucket/object, the CDN endpoint is always path-style
+	VirtualHostStyle bool
 }
 
 // NewClientConfiguration create a usable ClientConfiguration
@@ -64,11 +151,28 @@ func NewClientConfiguration(endpoint string) (*ClientConfiguration, error) {
 	return conf, nil
 }
 
+// NewClientConfigurationWithRegion create a ClientConfiguration of a custom endpoint,
+// such as a FDS-compatible gateway, which is not parsed for the region. GetObject does
+// not use the CDN unless EnableCDNForDownload is set, as the gateway may have none.
+func NewClientConfigurationWithRegion(endpoint, regionName string) *ClientConfiguration {
+	conf := defaultFDSClientConfiguration()
+	conf.Endpoint = endpoint
+	conf.EnableCDNForDownload = false
+	conf.regionName = regionName
+	conf.cdnEndpoint = "cdn." + regionName + URLCDNSuffix
+	return conf
+}
+
 // CDNEndpoint is endpoint of cdn
 func (conf *ClientConfiguration) CDNEndpoint() string {
 	return conf.cdnEndpoint
 }
 
+// SetCDNEndpoint overrides the cdn endpoint, such as a custom download domain
+func (conf *ClientConfiguration) SetCDNEndpoint(endpoint string) {
+	conf.cdnEndpoint = endpoint
+}
+
 // RegionName get region name
 func (conf *ClientConfiguration) RegionName() string {
 	return conf.regionName
@@ -82,12 +186,20 @@ func defaultFDSClientConfiguration() *ClientConfiguration {
 	config.EnableCDNForDownload = true
 	config.EnableMd5Calculate = false
 	config.Timeout = 50
+	config.RequestTimeout = DefaultRequestTimeout
+	config.TotalOperationTimeout = DefaultTotalOperationTimeout
+	config.ResponseHeaderTimeout = DefaultResponseHeaderTimeout
+	config.BodyIdleTimeout = DefaultBodyIdleTimeout
+	config.MaxGetObjectBytes = DefaultMaxGetObjectBytes
+	config.RetryBufferSize = DefaultRetryBufferSize
 	config.HTTPTimeout.ConnectTimeout = time.Second * 30   // 30s
 	config.HTTPTimeout.ReadWriteTimeout = time.Second * 60 // 60s
 	config.HTTPTimeout.HeaderTimeout = time.Second * 60    // 60s
 	config.HTTPTimeout.LongTimeout = time.Second * 300     // 300s
 	config.HTTPTimeout.IdleConnTimeout = time.Second * 50  // 50s
+	config.HTTPTimeout.TLSHandshakeTimeout = time.Second * 10
 	config.MaxConnection = 20
+	config.MaxIdleConnection = 100
 	config.BatchDeleteSize = 1000
 	config.RetryCount = 3
 	config.RetryInterval = 500 // ms
@@ -97,3 +209,44 @@ func defaultFDSClientConfiguration() *ClientConfiguration {
 
 	return &config
 }
+
+// newHTTPClient builds the http.Client of the configuration, whose idle connection pool
+// keeps MaxConnection connections to the endpoint for concurrent part transfers
+func (conf *ClientConfiguration) newHTTPClient() *http.Client {
+	if conf == nil {
+		return &http.Client{}
+	}
+	if conf.HTTPClient != nil {
+		return conf.HTTPClient
+	}
+	if conf.Transport != nil {
+		return &http.Client{Transport: conf.Transport}
+	}
+
+	proxy := conf.Proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	keepAlive := 30 * time.Second
+	if conf.HTTPKeepAliveTimeoutMs > 0 {
+		keepAlive = time.Duration(conf.HTTPKeepAliveTimeoutMs) * time.Millisecond
+	}
+	dialer := &net.Dialer{
+		Timeout:   conf.HTTPTimeout.ConnectTimeout,
+		KeepAlive: keepAlive,
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 proxy,
+			DialContext:           dialer.DialContext,
+			TLSClientConfig:       conf.TLSConfig,
+			TLSHandshakeTimeout:   conf.HTTPTimeout.TLSHandshakeTimeout,
+			ResponseHeaderTimeout: conf.HTTPTimeout.HeaderTimeout,
+			IdleConnTimeout:       conf.HTTPTimeout.IdleConnTimeout,
+			MaxIdleConns:          int(conf.MaxIdleConnection),
+			MaxIdleConnsPerHost:   int(conf.MaxConnection),
+			ExpectContinueTimeout: time.Second,
+			ForceAttemptHTTP2:     true,
+		},
+	}
+}
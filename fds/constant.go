@@ -8,12 +8,14 @@ const (
 	XiaomiMetaPrefix                = "x-xiaomi-meta-"
 	HTTPHeaderGalaxyAccessKeyID     = "GalaxyAccessKeyId"
 	HTTPHeaderSignature             = "Signature"
+	HTTPHeaderSignAlgorithm         = "SignAlgorithm"
 	HTTPHeaderCacheControl          = "Cache-Control"
 	HTTPHeaderContentLength         = "Content-Length"
 	HTTPHeaderContentEncoding       = "Content-Encoding"
 	HTTPHeaderLastModified          = "Last-Modified"
 	HTTPHeaderContentMD5            = "Content-MD5"
 	HTTPHeaderContentType           = "Content-Type"
+	HTTPHeaderContentRange          = "Content-Range"
 	HTTPHeaderLastChecked           = "Last-Checked"
 	HTTPHeaderUploadTime            = "Upload-Time"
 	HTTPHeaderContentMetadataLength = XiaomiMetaPrefix + HTTPHeaderContentLength
@@ -21,8 +23,34 @@ const (
 	HTTPHeaderDate                  = "Date"
 	HTTPHeaderAuthorization         = "Authorization"
 	HTTPHeaderRange                 = "Range"
+	HTTPHeaderIfRange               = "If-Range"
+	HTTPHeaderHost                  = "Host"
+	HTTPHeaderUserAgent             = "User-Agent"
+	HTTPHeaderRequestID             = "x-xiaomi-request-id"
+	HTTPHeaderETag                  = "ETag"
+	HTTPHeaderRetryAfter            = "Retry-After"
+	HTTPHeaderNextAppendPosition    = "x-xiaomi-next-append-position"
+	HTTPHeaderTagging               = "x-xiaomi-tagging"
+	HTTPHeaderRestore               = "x-xiaomi-restore"
+	HTTPHeaderStorageClass          = "x-xiaomi-storage-class"
+	HTTPHeaderSecurityToken         = "x-xiaomi-security-token"
 )
 
+// Sign algorithms
+const (
+	SignAlgorithmHmacSHA1   = "HmacSHA1"
+	SignAlgorithmHmacSHA256 = "HmacSHA256"
+)
+
+// Error codes of reading an archived object which is not restored
+const (
+	ErrorCodeObjectArchived     = "ObjectArchived"
+	ErrorCodeInvalidObjectState = "InvalidObjectState"
+)
+
+// ErrorCodeRequestTimeTooSkewed is the error code of a request whose Date is too far from the time of the service
+const ErrorCodeRequestTimeTooSkewed = "RequestTimeTooSkewed"
+
 // HTTPMethod HTTP request method
 type HTTPMethod string
 
@@ -48,12 +76,17 @@ const (
 	MaxPartSize = 5 * 1024 * 1024 * 1024 // Max part size, 5GB
 	MinPartSize = 100 * 1024             // Min part size, 100KB
 
+	MaxUploadParts = 10000 // Max number of parts in a multipart upload
+
 	FilePermMode = os.FileMode(0664) // Default file permission
 
 	TempFilePrefix = "fds-go-temp-" // Temp file prefix
 
 	DefaultListObjectsMaxKeys = 1000
 
+	DefaultMaxGetObjectBytes = 64 * 1024 * 1024 // Default limit of GetObjectBytes, 64MB
+	DefaultRetryBufferSize   = 8 * 1024 * 1024  // Default limit of the bodies buffered for retries, 8MB
+
 	URLComSuffix = ".fds.api.xiaomi.com"
 	URLNetSuffix = "-fds.api.xiaomi.net"
 	URLCDNSuffix = ".fds.api.mi-img.com"
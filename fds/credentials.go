@@ -0,0 +1,165 @@
+package fds
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// Environment variables of EnvCredentialsProvider
+const (
+	AccessIDEnvironment      = "GO_FDS_ACCESS_KEY_ID"
+	AccessSecretEnvironment  = "GO_FDS_ACCESS_KEY_SECRET"
+	SecurityTokenEnvironment = "GO_FDS_SECURITY_TOKEN"
+)
+
+// Credentials are the access key a request is signed with, SecurityToken is set
+// for the temporary credentials issued by STS
+type Credentials struct {
+	AccessID      string
+	AccessSecret  string
+	SecurityToken string
+}
+
+// CredentialsProvider provides the credentials of a Client, Retrieve is called
+// again only after IsExpired reports true
+type CredentialsProvider interface {
+	Retrieve() (Credentials, error)
+	IsExpired() bool
+}
+
+// AnonymousCredentials is the provider of anonymous clients, whose requests are not
+// signed so that only the public objects can be read
+var AnonymousCredentials CredentialsProvider = anonymousCredentials{}
+
+type anonymousCredentials struct{}
+
+func (anonymousCredentials) Retrieve() (Credentials, error) {
+	return Credentials{}, ErrorCredentialsRequired
+}
+
+func (anonymousCredentials) IsExpired() bool {
+	return false
+}
+
+// StaticCredentialsProvider provides fixed credentials which never expire
+type StaticCredentialsProvider struct {
+	Credentials
+}
+
+// Retrieve returns the credentials
+func (p StaticCredentialsProvider) Retrieve() (Credentials, error) {
+	return p.Credentials, nil
+}
+
+// IsExpired is always false
+func (p StaticCredentialsProvider) IsExpired() bool {
+	return false
+}
+
+// EnvCredentialsProvider reads the credentials from GO_FDS_ACCESS_KEY_ID,
+// GO_FDS_ACCESS_KEY_SECRET and the optional GO_FDS_SECURITY_TOKEN
+type EnvCredentialsProvider struct{}
+
+// Retrieve reads the credentials, ErrorCredentialsNotFound is returned if the key is unset
+func (EnvCredentialsProvider) Retrieve() (Credentials, error) {
+	creds := Credentials{
+		AccessID:      os.Getenv(AccessIDEnvironment),
+		AccessSecret:  os.Getenv(AccessSecretEnvironment),
+		SecurityToken: os.Getenv(SecurityTokenEnvironment),
+	}
+	if creds.AccessID == "" || creds.AccessSecret == "" {
+		return Credentials{}, ErrorCredentialsNotFound
+	}
+	return creds, nil
+}
+
+// IsExpired is always false, the environment is read once by a Client
+func (EnvCredentialsProvider) IsExpired() bool {
+	return false
+}
+
+// RefreshingCredentialsProvider caches the credentials returned by a callback until
+// they are about to expire, concurrent refreshes call the callback only once
+type RefreshingCredentialsProvider struct {
+	refresh     func() (Credentials, time.Time, error)
+	earlyExpiry time.Duration
+	clock       clock
+
+	mu         sync.Mutex
+	creds      Credentials
+	expiration time.Time
+	retrieved  bool
+}
+
+// NewRefreshingCredentialsProvider creates a provider whose refresh returns the credentials
+// along with their expiration, zero for never, they are refreshed earlyExpiry before expiring
+func NewRefreshingCredentialsProvider(refresh func() (Credentials, time.Time, error), earlyExpiry time.Duration) *RefreshingCredentialsProvider {
+	return &RefreshingCredentialsProvider{
+		refresh:     refresh,
+		earlyExpiry: earlyExpiry,
+		clock:       realClock{},
+	}
+}
+
+// Retrieve returns the cached credentials, which are refreshed if they are expired
+func (p *RefreshingCredentialsProvider) Retrieve() (Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.retrieved && !p.expired() {
+		return p.creds, nil
+	}
+
+	creds, expiration, err := p.refresh()
+	if err != nil {
+		return Credentials{}, err
+	}
+	p.creds, p.expiration, p.retrieved = creds, expiration, true
+	return creds, nil
+}
+
+// IsExpired reports whether the credentials have to be refreshed
+func (p *RefreshingCredentialsProvider) IsExpired() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.retrieved || p.expired()
+}
+
+// expired must be called with mu held
+func (p *RefreshingCredentialsProvider) expired() bool {
+	return !p.expiration.IsZero() && !p.clock.Now().Add(p.earlyExpiry).Before(p.expiration)
+}
+
+// credentialsCache keeps the credentials of a provider until they expire, so that
+// the provider is asked once however many requests are signed at the same time
+type credentialsCache struct {
+	provider CredentialsProvider
+
+	mu        sync.Mutex
+	creds     Credentials
+	retrieved bool
+}
+
+func (c *credentialsCache) get() (Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.retrieved && !c.provider.IsExpired() {
+		return c.creds, nil
+	}
+
+	creds, err := c.provider.Retrieve()
+	if err != nil {
+		return Credentials{}, err
+	}
+	c.creds, c.retrieved = creds, true
+	return creds, nil
+}
+
+// credentials returns the credentials to sign with, the access key of the client
+// is used unless it is created with a provider
+func (client *Client) credentials() (Credentials, error) {
+	if client.credentialsCache == nil {
+		return Credentials{AccessID: client.AccessID, AccessSecret: client.AccessSecret}, nil
+	}
+	return client.credentialsCache.get()
+}
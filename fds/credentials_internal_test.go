@@ -0,0 +1,154 @@
+package fds
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCredentialsClient(server *httptest.Server, provider CredentialsProvider) *Client {
+	u, _ := url.Parse(server.URL)
+	conf, _ := NewClientConfiguration(u.Host)
+	conf.EnableHTTPS = false
+	return NewWithCredentialsProvider(provider, conf, nil)
+}
+
+func Test_CredentialsProvider(t *testing.T) {
+	var mu sync.Mutex
+	var authorizations, tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		authorizations = append(authorizations, strings.SplitN(r.Header.Get(HTTPHeaderAuthorization), ":", 2)[0])
+		tokens = append(tokens, r.Header.Get(HTTPHeaderSecurityToken))
+	}))
+	defer server.Close()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	refreshes := 0
+	provider := NewRefreshingCredentialsProvider(func() (Credentials, time.Time, error) {
+		refreshes++
+		id := string(rune('a' + refreshes - 1))
+		return Credentials{AccessID: "ak-" + id, AccessSecret: "sk", SecurityToken: "token-" + id}, clock.Now().Add(time.Hour), nil
+	}, 5*time.Minute)
+	provider.clock = clock
+
+	client := newTestCredentialsClient(server, provider)
+	assert.Nil(t, client.DeleteObject("bucket", "object"))
+	assert.Nil(t, client.DeleteObject("bucket", "object"))
+	clock.Sleep(56 * time.Minute)
+	assert.Nil(t, client.DeleteObject("bucket", "object"))
+
+	assert.Equal(t, 2, refreshes)
+	assert.Equal(t, []string{"Galaxy-V2 ak-a", "Galaxy-V2 ak-a", "Galaxy-V2 ak-b"}, authorizations)
+	assert.Equal(t, []string{"token-a", "token-a", "token-b"}, tokens)
+
+	u, err := client.GeneratePresignedURL(&GeneratePresignedURLRequest{
+		BucketName: "bucket",
+		ObjectName: "object",
+		Method:     HTTPGet,
+		Expiration: start.Add(2 * time.Hour),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "ak-b", u.Query().Get(HTTPHeaderGalaxyAccessKeyID))
+	assert.Equal(t, "token-b", u.Query().Get(HTTPHeaderSecurityToken))
+
+	// the static credentials have no token
+	authorizations, tokens = nil, nil
+	client = newTestCredentialsClient(server, StaticCredentialsProvider{Credentials{AccessID: "ak", AccessSecret: "sk"}})
+	assert.Nil(t, client.DeleteObject("bucket", "object"))
+	assert.Equal(t, []string{"Galaxy-V2 ak"}, authorizations)
+	assert.Equal(t, []string{""}, tokens)
+
+	failure := errors.New("sts is down")
+	client = newTestCredentialsClient(server, NewRefreshingCredentialsProvider(func() (Credentials, time.Time, error) {
+		return Credentials{}, time.Time{}, failure
+	}, 0))
+	assert.True(t, errors.Is(client.DeleteObject("bucket", "object"), failure))
+}
+
+func Test_CredentialsSecurityTokenRedacted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	conf, _ := NewClientConfiguration(u.Host)
+	conf.EnableHTTPS = false
+	conf.Debug = DebugBody
+	client := NewWithCredentialsProvider(StaticCredentialsProvider{Credentials{AccessID: "ak", AccessSecret: "sk", SecurityToken: "secret-token"}}, conf, nil)
+	logger := &recordingLogger{}
+	client.SetLogger(logger)
+
+	assert.Nil(t, client.DeleteObject("bucket", "object"))
+	presigned, err := client.GeneratePresignedURL(&GeneratePresignedURLRequest{
+		BucketName: "bucket",
+		ObjectName: "object",
+		Method:     HTTPGet,
+		Expiration: time.Now().Add(time.Hour),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "secret-token", presigned.Query().Get(HTTPHeaderSecurityToken))
+	resp, err := client.httpClient.Get(presigned.String())
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	logs := strings.Join(logger.debugs, "\n")
+	assert.Contains(t, logs, "k=X-Xiaomi-Security-Token, v=["+debugRedacted+"]")
+	assert.Contains(t, logs, "X-Xiaomi-Security-Token: "+debugRedacted)
+	assert.Contains(t, logs, HTTPHeaderSecurityToken+"="+debugRedacted)
+	assert.NotContains(t, logs, "secret-token")
+}
+
+func Test_RefreshingCredentialsProviderSingleFlight(t *testing.T) {
+	var refreshes int32
+	release := make(chan struct{})
+	provider := NewRefreshingCredentialsProvider(func() (Credentials, time.Time, error) {
+		atomic.AddInt32(&refreshes, 1)
+		<-release
+		return Credentials{AccessID: "ak", AccessSecret: "sk"}, time.Now().Add(time.Hour), nil
+	}, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			creds, err := provider.Retrieve()
+			assert.Nil(t, err)
+			assert.Equal(t, "ak", creds.AccessID)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&refreshes))
+	assert.False(t, provider.IsExpired())
+}
+
+func Test_EnvCredentialsProvider(t *testing.T) {
+	for _, k := range []string{AccessIDEnvironment, AccessSecretEnvironment, SecurityTokenEnvironment} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Unsetenv(k)
+	}
+
+	_, err := EnvCredentialsProvider{}.Retrieve()
+	assert.Equal(t, ErrorCredentialsNotFound, err)
+
+	os.Setenv(AccessIDEnvironment, "ak")
+	os.Setenv(AccessSecretEnvironment, "sk")
+	os.Setenv(SecurityTokenEnvironment, "token")
+	creds, err := EnvCredentialsProvider{}.Retrieve()
+	assert.Nil(t, err)
+	assert.Equal(t, Credentials{AccessID: "ak", AccessSecret: "sk", SecurityToken: "token"}, creds)
+}
@@ -0,0 +1,210 @@
+package fds
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DebugLevel is how much of the HTTP traffic of a Client is logged with Debug of its logger
+type DebugLevel int
+
+// Debug levels
+const (
+	// DebugOff logs nothing of the HTTP traffic
+	DebugOff DebugLevel = iota
+
+	// DebugWire logs the method, URL and headers of every request, and the status,
+	// request ID and latency of every response, Authorization, Signature and the security
+	// token are redacted
+	DebugWire
+
+	// DebugBody also logs up to MaxDebugBodySize bytes of the textual bodies
+	DebugBody
+)
+
+// DebugEnvironment is the environment variable of the debug level, wire or body, which
+// is read when a client is created whose configuration leaves Debug DebugOff
+const DebugEnvironment = "GO_FDS_DEBUG"
+
+// MaxDebugBodySize is the most bytes of a body logged with DebugBody
+const MaxDebugBodySize = 4096
+
+const debugRedacted = "REDACTED"
+
+// debugLevelOf returns the debug level of conf, which falls back to the environment
+func debugLevelOf(conf *ClientConfiguration) DebugLevel {
+	if conf != nil && conf.Debug != DebugOff {
+		return conf.Debug
+	}
+	switch strings.ToLower(os.Getenv(DebugEnvironment)) {
+	case "wire", "1", "true":
+		return DebugWire
+	case "body":
+		return DebugBody
+	}
+	return DebugOff
+}
+
+// debugTransport logs the traffic of the wrapped RoundTripper with the logger of client,
+// so that it covers every request sent by the client, including the ones of the manager
+type debugTransport struct {
+	base   http.RoundTripper
+	client *Client
+	level  DebugLevel
+}
+
+// withDebugTransport returns a copy of httpClient whose transport logs the traffic
+func withDebugTransport(httpClient *http.Client, client *Client, level DebugLevel) *http.Client {
+	c := *httpClient
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.Transport = &debugTransport{base: base, client: client, level: level}
+	return &c
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	logger := t.client.logger
+	u := redactURL(req.URL)
+	logger.Debug(fmt.Sprintf("--> %s %s %s", req.Method, u, formatDebugHeader(req.Header)))
+
+	if t.level >= DebugBody && req.Body != nil && req.Body != http.NoBody && textualContent(req.Header) {
+		req = req.Clone(req.Context())
+		req.Body = newDebugBody(req.Body, func(body string) {
+			logger.Debug(fmt.Sprintf("--> %s %s body: %s", req.Method, u, body))
+		})
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	latency := time.Since(start)
+	if err != nil {
+		logger.Debug(fmt.Sprintf("<-- %s %s error: %v (%v)", req.Method, u, err, latency))
+		return resp, err
+	}
+
+	logger.Debug(fmt.Sprintf("<-- %s %s %d request-id=%s (%v) %s", req.Method, u, resp.StatusCode,
+		resp.Header.Get(HTTPHeaderRequestID), latency, formatDebugHeader(resp.Header)))
+	if t.level >= DebugBody && resp.Body != nil && resp.Body != http.NoBody && textualContent(resp.Header) {
+		resp.Body = newDebugBody(resp.Body, func(body string) {
+			logger.Debug(fmt.Sprintf("<-- %s %s body: %s", req.Method, u, body))
+		})
+	}
+	return resp, nil
+}
+
+// redactURL returns u with the Signature and the security token of a presigned URL redacted
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	secret := false
+	for _, k := range []string{HTTPHeaderSignature, HTTPHeaderSecurityToken} {
+		if query.Get(k) != "" {
+			query.Set(k, debugRedacted)
+			secret = true
+		}
+	}
+	if !secret {
+		return u.String()
+	}
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+// redactedHeader reports whether the header k holds a secret which is never logged
+func redactedHeader(k string) bool {
+	return strings.EqualFold(k, HTTPHeaderAuthorization) || strings.EqualFold(k, HTTPHeaderSecurityToken)
+}
+
+// formatDebugHeader formats h sorted by key with Authorization and the security token redacted
+func formatDebugHeader(h http.Header) string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf strings.Builder
+	buf.WriteString("{")
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		v := strings.Join(h[k], ",")
+		if redactedHeader(k) {
+			v = debugRedacted
+		}
+		buf.WriteString(k + ": " + v)
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// textualContent reports whether the Content-Type of h is text, JSON, XML or a form
+func textualContent(h http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(h.Get(HTTPHeaderContentType))
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") ||
+		mediaType == "application/x-www-form-urlencoded"
+}
+
+// debugBody keeps the first MaxDebugBodySize bytes read from the body and logs them
+// once the body is read to the end or closed
+type debugBody struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	truncated bool
+	once      sync.Once
+	log       func(body string)
+}
+
+func newDebugBody(body io.ReadCloser, log func(body string)) *debugBody {
+	return &debugBody{ReadCloser: body, log: log}
+}
+
+func (b *debugBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if left := MaxDebugBodySize - b.buf.Len(); left > 0 {
+		if n <= left {
+			b.buf.Write(p[:n])
+		} else {
+			b.buf.Write(p[:left])
+			b.truncated = true
+		}
+	} else if n > 0 {
+		b.truncated = true
+	}
+	if err == io.EOF {
+		b.flush()
+	}
+	return n, err
+}
+
+func (b *debugBody) Close() error {
+	b.flush()
+	return b.ReadCloser.Close()
+}
+
+func (b *debugBody) flush() {
+	b.once.Do(func() {
+		body := b.buf.String()
+		if b.truncated {
+			body += "...(truncated)"
+		}
+		b.log(body)
+	})
+}
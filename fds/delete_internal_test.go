@@ -0,0 +1,114 @@
+package fds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newDeleteTestServer serves listing of names and fails to delete the "locked" object
+func newDeleteTestServer(names []string) (*httptest.Server, *[][]string) {
+	var mu sync.Mutex
+	var batches [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.Method == http.MethodGet {
+			maxKeys, _ := strconv.Atoi(q.Get("maxKeys"))
+			start := sort.SearchStrings(names, q.Get("marker"))
+			if start < len(names) && names[start] == q.Get("marker") {
+				start++
+			}
+			listing := ObjectListing{BucketName: "bucket", MaxKeys: maxKeys}
+			for _, name := range names[start:] {
+				if len(listing.ObjectSummaries) == maxKeys {
+					listing.Truncated = true
+					listing.NextMarker = listing.ObjectSummaries[maxKeys-1].ObjectName
+					break
+				}
+				listing.ObjectSummaries = append(listing.ObjectSummaries, ObjectSummary{ObjectName: name})
+			}
+			data, _ := json.Marshal(listing)
+			w.Write(data)
+			return
+		}
+
+		var batch []string
+		json.NewDecoder(r.Body).Decode(&batch)
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+
+		var failed []DeleteObjectError
+		for _, name := range batch {
+			if name == "locked" {
+				failed = append(failed, DeleteObjectError{ObjectName: name, Message: "AccessDenied"})
+			}
+		}
+		if len(failed) > 0 {
+			data, _ := json.Marshal(failed)
+			w.Write(data)
+		}
+	}))
+	return server, &batches
+}
+
+func Test_BatchDeleteObjects(t *testing.T) {
+	server, batches := newDeleteTestServer(nil)
+	defer server.Close()
+	client := newTestClient(server)
+	client.Configuration.BatchDeleteSize = 2
+
+	result, err := client.BatchDeleteObjects(&DeleteObjectsRequest{
+		BucketName:  "bucket",
+		ObjectNames: []string{"a", "locked", "b", "c", "d"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, result.Deleted)
+	assert.Equal(t, []DeleteObjectError{{ObjectName: "locked", Message: "AccessDenied"}}, result.Failed)
+	assert.Equal(t, [][]string{{"a", "locked"}, {"b", "c"}, {"d"}}, *batches)
+}
+
+func Test_BatchDeleteObjectsWithPrefix(t *testing.T) {
+	var names []string
+	for i := 0; i < 7; i++ {
+		names = append(names, fmt.Sprintf("object-%d", i))
+	}
+	names = append(names, "locked")
+	sort.Strings(names)
+
+	server, batches := newDeleteTestServer(names)
+	defer server.Close()
+	client := newTestClient(server)
+	client.Configuration.BatchDeleteSize = 2
+
+	result, err := client.BatchDeleteObjectsWithPrefix("bucket", "", false, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, len(result.Deleted))
+	assert.Equal(t, 1, len(result.Failed))
+	assert.Equal(t, 4, len(*batches))
+}
+
+func Test_DeleteObjectsUsesBatches(t *testing.T) {
+	names := []string{"a", "b", "c", "locked", "d"}
+	sort.Strings(names)
+
+	server, batches := newDeleteTestServer(names)
+	defer server.Close()
+	client := newTestClient(server)
+	client.Configuration.BatchDeleteSize = 2
+
+	assert.Nil(t, client.DeleteObjects("bucket", []string{"a", "b", "c"}, false))
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, *batches)
+
+	*batches = nil
+	assert.Nil(t, client.DeleteObjectsWithPrefixWithContext(context.Background(), "bucket", "", false))
+	assert.Equal(t, [][]string{{"a", "b"}, {"c", "d"}, {"locked"}}, *batches)
+}
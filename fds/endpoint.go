@@ -0,0 +1,157 @@
+package fds
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Region is a region of FDS, such as cnbj1
+type Region string
+
+// Known regions
+const (
+	RegionCNBJ0    Region = "cnbj0"
+	RegionCNBJ1    Region = "cnbj1"
+	RegionCNBJ2    Region = "cnbj2"
+	RegionAWSBJ0   Region = "awsbj0"
+	RegionAWSUSOR0 Region = "awsusor0"
+	RegionAWSSGP0  Region = "awssgp0"
+	RegionAWSDE0   Region = "awsde0"
+)
+
+// knownRegions are the regions which DefaultEndpointResolver resolves
+var knownRegions = map[Region]bool{
+	RegionCNBJ0:    true,
+	RegionCNBJ1:    true,
+	RegionCNBJ2:    true,
+	RegionAWSBJ0:   true,
+	RegionAWSUSOR0: true,
+	RegionAWSSGP0:  true,
+	RegionAWSDE0:   true,
+}
+
+// IsKnownRegion returns true if region is one of the known regions
+func IsKnownRegion(region Region) bool {
+	return knownRegions[region]
+}
+
+// EndpointResolver resolves the endpoint, a host with an optional port, of the requests
+// to region, internal is the endpoint inside the IDC and cdn is the one for downloading
+type EndpointResolver interface {
+	ResolveEndpoint(region Region, internal, cdn bool) string
+}
+
+// EndpointResolverFunc is an EndpointResolver of a function, which overrides the endpoints
+// of private deployments, an empty endpoint falls back to the ones of the configuration
+type EndpointResolverFunc func(region Region, internal, cdn bool) string
+
+// ResolveEndpoint calls f
+func (f EndpointResolverFunc) ResolveEndpoint(region Region, internal, cdn bool) string {
+	return f(region, internal, cdn)
+}
+
+// DefaultEndpointResolver resolves the public, internal and CDN endpoints of the FDS regions
+var DefaultEndpointResolver EndpointResolver = EndpointResolverFunc(func(region Region, internal, cdn bool) string {
+	switch {
+	case cdn:
+		return "cdn." + string(region) + URLCDNSuffix
+	case internal:
+		return string(region) + URLNetSuffix
+	}
+	return string(region) + URLComSuffix
+})
+
+// NewRegionClientConfiguration create a ClientConfiguration of region whose endpoints
+// are resolved by DefaultEndpointResolver
+func NewRegionClientConfiguration(region Region) *ClientConfiguration {
+	conf := defaultFDSClientConfiguration()
+	conf.regionName = string(region)
+	conf.Endpoint = DefaultEndpointResolver.ResolveEndpoint(region, false, false)
+	conf.cdnEndpoint = DefaultEndpointResolver.ResolveEndpoint(region, false, true)
+	return conf
+}
+
+// NewClientForRegion new a FDSClient of a known region which signs with the credentials of
+// provider, a nil provider is an anonymous client. The Downloader and the Uploader of the
+// client send the requests to the region as well.
+func NewClientForRegion(region Region, provider CredentialsProvider) (*Client, error) {
+	return NewClientForRegionWithResolver(region, provider, nil)
+}
+
+// NewClientForRegionWithResolver new a FDSClient of region whose endpoints are resolved by
+// resolver, so that a custom region is allowed if resolver resolves its endpoint. The known
+// regions fall back to DefaultEndpointResolver where resolver returns empty.
+func NewClientForRegionWithResolver(region Region, provider CredentialsProvider, resolver EndpointResolver) (*Client, error) {
+	conf := NewRegionClientConfiguration(region)
+	var endpoint string
+	if resolver != nil {
+		conf.EndpointResolver = resolver
+		endpoint = resolver.ResolveEndpoint(region, false, false)
+	}
+	if endpoint == "" && !IsKnownRegion(region) {
+		return nil, fmt.Errorf("%w: %q", ErrorUnknownRegion, region)
+	}
+	if endpoint != "" {
+		conf.Endpoint = endpoint
+	}
+	return NewWithCredentialsProvider(provider, conf, nil), nil
+}
+
+// endpoint resolves the endpoint of the requests, cdn takes precedence over internal.
+// Without a resolver, or if it returns empty, the CDN endpoint is the one of the
+// configuration and the internal one is of the region, the API endpoint is used if absent.
+func (conf *ClientConfiguration) endpoint(internal, cdn bool) string {
+	if conf.EndpointResolver != nil {
+		if endpoint := conf.EndpointResolver.ResolveEndpoint(Region(conf.regionName), internal, cdn); endpoint != "" {
+			return endpoint
+		}
+	}
+
+	switch {
+	case cdn && conf.cdnEndpoint != "":
+		return conf.cdnEndpoint
+	case cdn:
+	case internal && conf.regionName != "":
+		return conf.regionName + URLNetSuffix
+	}
+	return conf.Endpoint
+}
+
+// clientForRegion returns a client which sends the requests to region and shares the
+// credentials and the connections of client, client itself if region is empty or its own
+func (client *Client) clientForRegion(region Region) (*Client, error) {
+	conf := *client.Configuration
+	if region == "" || string(region) == conf.regionName {
+		return client, nil
+	}
+
+	var endpoint string
+	if conf.EndpointResolver != nil {
+		endpoint = conf.EndpointResolver.ResolveEndpoint(region, false, false)
+	}
+	if endpoint == "" && !IsKnownRegion(region) {
+		return nil, fmt.Errorf("%w: %q", ErrorUnknownRegion, region)
+	}
+	if endpoint == "" {
+		endpoint = DefaultEndpointResolver.ResolveEndpoint(region, false, false)
+	}
+	conf.regionName = string(region)
+	conf.Endpoint = endpoint
+	conf.cdnEndpoint = DefaultEndpointResolver.ResolveEndpoint(region, false, true)
+
+	return &Client{
+		logger:               client.logger,
+		httpClient:           client.httpClient,
+		Configuration:        &conf,
+		AccessID:             client.AccessID,
+		AccessSecret:         client.AccessSecret,
+		anonymous:            client.anonymous,
+		signer:               client.signer,
+		credentialsCache:     client.credentialsCache,
+		clock:                client.clock,
+		jitter:               client.jitter,
+		clockOffset:          atomic.LoadInt64(&client.clockOffset),
+		requestInterceptors:  client.requestInterceptors,
+		responseInterceptors: client.responseInterceptors,
+	}, nil
+}
@@ -1,20 +1,176 @@
 package fds
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
+	"net/http"
+	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // Errors
 var (
-	ErrorEndpoint = errors.New("wrong endpoint")
+	ErrorEndpoint          = errors.New("wrong endpoint")
+	ErrorUnknownRegion     = errors.New("region is unknown, resolve its endpoint with an EndpointResolver")
+	ErrorMetadataNotFound  = errors.New("metadata is not found")
+	ErrorMetadataInvalid   = errors.New("metadata is invalid")
+	ErrorMetadataUnchanged = errors.New("metadata is unchanged")
+	ErrorMetadataImmutable = errors.New("metadata can not change the content headers")
+
+	ErrorCredentialsRequired = errors.New("credentials are required, the client is anonymous")
+	ErrorCredentialsNotFound = errors.New("credentials are not found in the environment")
+	ErrorPresignedURLMethod  = errors.New("presigned url only supports GET, PUT, HEAD and DELETE")
+	ErrorPresignedURLScheme  = errors.New("presigned url only supports http and https")
+	ErrorPresignedURLParam   = errors.New("presigned url params can not be sub resources")
+	ErrorReservedHeader      = errors.New("Authorization, Date and Host headers are reserved")
+	ErrorSignAlgorithm       = errors.New("sign algorithm is not supported")
+
+	ErrorRequestTimeout        = errors.New("request timed out")
+	ErrorTotalOperationTimeout = errors.New("operation timed out across retries")
+	ErrorBodyNotRewindable     = errors.New("request is not retried, its body can not be sent again")
+	ErrorBodyIdleTimeout       = errors.New("no data of the response body arrived in time")
+
+	ErrorBucketAlreadyExists = errors.New("bucket already exists")
+	ErrorBucketNotEmpty      = errors.New("bucket is not empty")
+
+	ErrorCopyPreconditionFailed = errors.New("ETag of the source object does not match")
+	ErrorRangeInvalid           = errors.New("range start can not be larger than end")
+	ErrorObjectChanged          = errors.New("object is changed since it is opened")
+	ErrorObjectTooLarge         = errors.New("object is too large to be read into memory")
+	ErrorNotModified            = errors.New("object is not modified")
+	ErrorPreconditionFailed     = errors.New("precondition of the request failed")
+	ErrorSeekOffsetInvalid      = errors.New("seek offset can not be negative")
+
+	ErrorLifecycleDuplicateRuleID = errors.New("lifecycle rule id is duplicated")
+	ErrorLifecycleDaysNotPositive = errors.New("lifecycle days have to be positive")
+	ErrorLifecycleDaysAndDate     = errors.New("lifecycle days and date can't be both set")
+	ErrorLifecycleDateInvalid     = errors.New("lifecycle date has to be formatted as 2006-01-02")
+
+	ErrorCORSOriginRequired = errors.New("CORS rule requires allowed origins")
+	ErrorCORSMethodInvalid  = errors.New("CORS rule only allows GET, PUT, HEAD, POST and DELETE")
+
+	ErrorTagsTooMany      = errors.New("too many tags")
+	ErrorTagKeyInvalid    = errors.New("tag key has to be 1 to 128 characters")
+	ErrorTagValueTooLong  = errors.New("tag value has to be at most 256 characters")
+	ErrorTagKeyDuplicated = errors.New("tag key is duplicated")
+
+	ErrorUserMetadataKeyInvalid = errors.New("user metadata key has to be lowercase letters, digits, '-', '_' or '.'")
+	ErrorUserMetadataTooLarge   = errors.New("user metadata is too large")
+
+	ErrorRestoreDaysNotPositive = errors.New("restore days have to be positive")
+	ErrorStorageClassInvalid    = errors.New("storage class has to be STANDARD, STANDARD_IA or ARCHIVE")
 )
 
+// MetadataError is returned by the typed getters of ObjectMetadata
+type MetadataError struct {
+	Key   string
+	Value string
+	Err   error
+}
+
+// Error makes MetadataError a string
+func (e *MetadataError) Error() string {
+	return fmt.Sprintf("fds: %s %q: %s", e.Key, e.Value, e.Err)
+}
+
+// Unwrap returns ErrorMetadataNotFound or ErrorMetadataInvalid
+func (e *MetadataError) Unwrap() error {
+	return e.Err
+}
+
+func newMetadataError(key, value string, err error) *MetadataError {
+	return &MetadataError{
+		Key:   key,
+		Value: value,
+		Err:   err,
+	}
+}
+
+// AppendPositionError is returned by AppendObject if the position is not
+// the current length of the object
+type AppendPositionError struct {
+	Position int64
+
+	// NextPosition is the current length of the object, -1 if unknown
+	NextPosition int64
+	Err          error
+}
+
+// Error makes AppendPositionError a string
+func (e *AppendPositionError) Error() string {
+	return fmt.Sprintf("fds: append position %d is not matching %d: %s", e.Position, e.NextPosition, e.Err)
+}
+
+// Unwrap returns the ServerError of the response
+func (e *AppendPositionError) Unwrap() error {
+	return e.Err
+}
+
+func newAppendPositionError(position int64, response *http.Response, err error) *AppendPositionError {
+	next, e := strconv.ParseInt(response.Header.Get(HTTPHeaderNextAppendPosition), 10, 64)
+	if e != nil {
+		next = -1
+	}
+	return &AppendPositionError{
+		Position:     position,
+		NextPosition: next,
+		Err:          err,
+	}
+}
+
+// BucketExistsError is returned by CreateBucketWithOptions if the bucket exists,
+// errors.Is matches it with ErrorBucketAlreadyExists
+type BucketExistsError struct {
+	BucketName string
+	Err        error
+}
+
+// Error makes BucketExistsError a string
+func (e *BucketExistsError) Error() string {
+	return fmt.Sprintf("fds: bucket %s already exists: %s", e.BucketName, e.Err)
+}
+
+// Unwrap returns the ServerError of the response
+func (e *BucketExistsError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrorBucketAlreadyExists
+func (e *BucketExistsError) Is(target error) bool {
+	return target == ErrorBucketAlreadyExists
+}
+
+// newBucketExistsError turns err into a BucketExistsError if it is a 409 or has the
+// error code of an existing bucket, other errors are returned as they are
+func newBucketExistsError(bucketName string, err error) error {
+	var serverError *ServerError
+	if !errors.As(err, &serverError) {
+		return err
+	}
+	switch {
+	case serverError.StatusCode == http.StatusConflict,
+		serverError.ErrorCode == "BucketAlreadyExists",
+		serverError.ErrorCode == "BucketAlreadyOwnedByYou":
+		return &BucketExistsError{BucketName: bucketName, Err: err}
+	}
+	return err
+}
+
 // ServerError is a common structure for FDS client error
 type ServerError struct {
-	code     int
+	// StatusCode is the HTTP status code, -1 if the error is raised by the client
+	StatusCode int
+	ErrorCode  string
+	RequestID  string
+	Bucket     string
+	Object     string
+
 	time     time.Time
 	msg      string
 	funcName string
@@ -22,12 +178,28 @@ type ServerError struct {
 
 // Error makes ServerError a string
 func (e *ServerError) Error() string {
-	return fmt.Sprintf("%s %s Code: [%d] Msg: %s", e.time.Format(time.ANSIC), e.funcName, e.code, e.msg)
+	s := fmt.Sprintf("%s %s Code: [%d] Msg: %s", e.time.Format(time.ANSIC), e.funcName, e.StatusCode, e.msg)
+	if e.RequestID != "" {
+		s += fmt.Sprintf(" RequestID: %s", e.RequestID)
+	}
+	return s
+}
+
+// Unwrap returns ErrorNotModified of 304 and ErrorPreconditionFailed of 412,
+// so that conditional requests can be checked with errors.Is
+func (e *ServerError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusNotModified:
+		return ErrorNotModified
+	case http.StatusPreconditionFailed:
+		return ErrorPreconditionFailed
+	}
+	return nil
 }
 
 // Code is the code of ServerError
 func (e *ServerError) Code() int {
-	return e.code
+	return e.StatusCode
 }
 
 // Message is the msg of ServerError
@@ -41,9 +213,135 @@ func newServerError(msg string, code int) *ServerError {
 	pc, _, _, _ := runtime.Caller(1)
 
 	return &ServerError{
-		code:     code,
-		msg:      msg,
-		time:     time.Now(),
-		funcName: runtime.FuncForPC(pc).Name(),
+		StatusCode: code,
+		msg:        msg,
+		time:       time.Now(),
+		funcName:   runtime.FuncForPC(pc).Name(),
+	}
+}
+
+// newResponseError new a ServerError from a non-2xx response and its body
+func newResponseError(response *http.Response, body []byte) *ServerError {
+	code, msg, requestID := parseErrorBody(body)
+	if msg == "" {
+		msg = fmt.Sprintf("fds: service returned %s", response.Status)
+	}
+	if id := response.Header.Get(HTTPHeaderRequestID); id != "" {
+		requestID = id
+	}
+
+	pc, _, _, _ := runtime.Caller(1)
+	e := &ServerError{
+		StatusCode: response.StatusCode,
+		ErrorCode:  code,
+		RequestID:  requestID,
+		msg:        msg,
+		time:       time.Now(),
+		funcName:   runtime.FuncForPC(pc).Name(),
+	}
+
+	if response.Request != nil && response.Request.URL != nil {
+		path := strings.TrimPrefix(response.Request.URL.Path, "/")
+		names := strings.SplitN(path, "/", 2)
+		e.Bucket = names[0]
+		if len(names) == 2 {
+			e.Object = names[1]
+		}
+	}
+
+	return e
+}
+
+// maxErrorMessageLength is the length a body other than a JSON error is truncated to as the message
+const maxErrorMessageLength = 512
+
+var (
+	htmlTagPattern    = regexp.MustCompile(`(?s)<(script|style).*?</(script|style)>|<[^>]*>`)
+	whitespacePattern = regexp.MustCompile(`\s+`)
+)
+
+// parseErrorBody returns the error code, the message and the request id of the body of a
+// failed request. The code of the JSON error is errorCode or code, which is the status code
+// in some responses. Other bodies, such as the HTML page of a proxy, are the message with
+// the tags and the repeated spaces removed.
+func parseErrorBody(body []byte) (code, message, requestID string) {
+	errorBody := struct {
+		Code      json.RawMessage `json:"code"`
+		ErrorCode string          `json:"errorCode"`
+		Message   string          `json:"message"`
+		RequestID string          `json:"requestId"`
+	}{}
+	if err := json.Unmarshal(body, &errorBody); err == nil {
+		code = errorBody.ErrorCode
+		if code == "" {
+			// a numeric code is the status code
+			json.Unmarshal(errorBody.Code, &code)
+		}
+		message = errorBody.Message
+		if message == "" {
+			message = truncateMessage(string(bytes.TrimSpace(body)))
+		}
+		return code, message, errorBody.RequestID
+	}
+
+	text := string(body)
+	if strings.Contains(text, "<") {
+		text = htmlTagPattern.ReplaceAllString(text, " ")
+		text = html.UnescapeString(text)
+	}
+	return "", truncateMessage(strings.TrimSpace(whitespacePattern.ReplaceAllString(text, " "))), ""
+}
+
+func truncateMessage(s string) string {
+	if len(s) <= maxErrorMessageLength {
+		return s
 	}
+	return strings.ToValidUTF8(s[:maxErrorMessageLength], "") + "..."
+}
+
+func statusCodeOf(err error) int {
+	var e *ServerError
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound returns true if err is a ServerError of 404
+func IsNotFound(err error) bool {
+	return statusCodeOf(err) == http.StatusNotFound
+}
+
+// IsNotModified returns true if err is a ServerError of 304
+func IsNotModified(err error) bool {
+	return statusCodeOf(err) == http.StatusNotModified
+}
+
+// IsPreconditionFailed returns true if err is a ServerError of 412
+func IsPreconditionFailed(err error) bool {
+	return statusCodeOf(err) == http.StatusPreconditionFailed
+}
+
+// IsAccessDenied returns true if err is a ServerError of 401 or 403
+func IsAccessDenied(err error) bool {
+	code := statusCodeOf(err)
+	return code == http.StatusForbidden || code == http.StatusUnauthorized
+}
+
+// IsObjectArchived returns true if err is a ServerError of reading an archived
+// object which is not restored
+func IsObjectArchived(err error) bool {
+	var e *ServerError
+	if !errors.As(err, &e) {
+		return false
+	}
+	if e.StatusCode != http.StatusForbidden && e.StatusCode != http.StatusConflict {
+		return false
+	}
+	return e.ErrorCode == ErrorCodeObjectArchived || e.ErrorCode == ErrorCodeInvalidObjectState
+}
+
+// IsThrottled returns true if err is a ServerError of 429
+func IsThrottled(err error) bool {
+	return statusCodeOf(err) == http.StatusTooManyRequests
 }
@@ -0,0 +1,87 @@
+package fds
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseErrorBody(t *testing.T) {
+	cases := []struct {
+		fixture   string
+		status    int
+		code      string
+		message   string
+		requestID string
+	}{
+		{"access_denied.json", http.StatusForbidden, "AccessDenied", "Access denied, the signature does not match", "3a1f0c9e7b5d4e21"},
+		{"object_archived.json", http.StatusForbidden, ErrorCodeObjectArchived, "The object is archived, restore it before reading", "request-id"},
+		{"internal_error.json", http.StatusInternalServerError, "", "Internal Server Error", "request-id"},
+		{"bad_gateway.html", http.StatusBadGateway, "", "502 Bad Gateway 502 Bad Gateway nginx", "request-id"},
+	}
+
+	var conns int32
+	var status int
+	var body []byte
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/with-id") {
+			w.Header().Set(HTTPHeaderRequestID, "request-id")
+		}
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+	client := newTestClient(server)
+
+	for _, c := range cases {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "errors", c.fixture))
+		assert.Nil(t, err)
+		status, body = c.status, data
+
+		object := "object"
+		if c.requestID != "request-id" {
+			// the request id of the body is used without the header
+			object = "with-id"
+		}
+		_, err = client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: object})
+		var e *ServerError
+		assert.True(t, errors.As(err, &e), c.fixture)
+		assert.Equal(t, c.status, e.StatusCode, c.fixture)
+		assert.Equal(t, c.code, e.ErrorCode, c.fixture)
+		assert.Equal(t, c.message, e.Message(), c.fixture)
+		assert.Equal(t, c.requestID, e.RequestID, c.fixture)
+	}
+
+	// a long body is truncated
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "errors", "stack_trace.txt"))
+	assert.Nil(t, err)
+	status, body = http.StatusServiceUnavailable, data
+	err = client.DeleteObject("bucket", "object")
+	var e *ServerError
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, maxErrorMessageLength+len("..."), len(e.Message()))
+	assert.True(t, strings.HasPrefix(e.Message(), "java.lang.IllegalStateException: storage node is unavailable at com."))
+
+	// a redirect is an error whose body is read as well
+	status, body = http.StatusMovedPermanently, []byte("moved")
+	_, err = client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "object"})
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, "moved", e.Message())
+
+	// the bodies are read to the end, so the connection is reused
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns))
+}
@@ -12,38 +12,133 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/XiaoMi/go-fds/fds/httpparser"
-	"github.com/sirupsen/logrus"
 )
 
 // Client supplies an interface for interaction with FDS
 type Client struct {
-	logger     *logrus.Logger
+	logger     Logger
 	httpClient *http.Client
 
 	Configuration *ClientConfiguration
 	AccessID      string
 	AccessSecret  string
+
+	// anonymous clients send unsigned requests, only public GET and HEAD work
+	anonymous        bool
+	signer           Signer
+	credentialsCache *credentialsCache
+
+	clock  clock
+	jitter jitterSource
+
+	// clockOffset is the nanoseconds added to the clock to sign, accessed atomically
+	clockOffset int64
+
+	requestInterceptors  []RequestInterceptor
+	responseInterceptors []ResponseInterceptor
 }
 
 // New a FDSClient
 func New(accessID, accessSecret string, conf *ClientConfiguration) *Client {
-	client := &Client{}
+	return NewWithSigner(accessID, accessSecret, conf, nil)
+}
+
+// NewWithSigner new a FDSClient which signs with signer, nil signer follows the SignAlgorithm of conf
+func NewWithSigner(accessID, accessSecret string, conf *ClientConfiguration, signer Signer) *Client {
+	client := &Client{signer: signer}
 	client.Configuration = conf
 	client.AccessID = accessID
 	client.AccessSecret = accessSecret
-	client.httpClient = &http.Client{}
-	client.logger = logrus.New()
+	client.httpClient = conf.newHTTPClient()
+	if level := debugLevelOf(conf); level != DebugOff {
+		client.httpClient = withDebugTransport(client.httpClient, client, level)
+	}
+	client.logger = nopLogger{}
+	client.clock = realClock{}
+	client.jitter = globalJitter{}
+
+	return client
+}
 
-	client.logger.SetLevel(logrus.WarnLevel)
+// NewWithCredentialsProvider new a FDSClient which signs with the credentials of provider,
+// nil signer follows the SignAlgorithm of conf, nil provider or AnonymousCredentials is an anonymous client
+func NewWithCredentialsProvider(provider CredentialsProvider, conf *ClientConfiguration, signer Signer) *Client {
+	client := NewWithSigner("", "", conf, signer)
+	if provider == nil || provider == AnonymousCredentials {
+		client.anonymous = true
+		return client
+	}
+	client.credentialsCache = &credentialsCache{provider: provider}
+	return client
+}
 
+// NewAnonymousClient new a FDSClient without credentials for public objects
+func NewAnonymousClient(conf *ClientConfiguration) *Client {
+	client := New("", "", conf)
+	client.anonymous = true
 	return client
 }
 
+func (client *Client) getSigner() Signer {
+	if client.signer != nil {
+		return client.signer
+	}
+
+	var algorithm string
+	if client.Configuration != nil {
+		algorithm = client.Configuration.SignAlgorithm
+	}
+	signer, err := SignerOf(algorithm)
+	if err != nil {
+		return errorSigner{err}
+	}
+	return signer
+}
+
+// IsAnonymous returns true if requests of the client are not signed
+func (client *Client) IsAnonymous() bool {
+	return client.anonymous
+}
+
+// reservedHeaders are set by the client and can not be overridden by a request
+var reservedHeaders = []string{HTTPHeaderAuthorization, HTTPHeaderDate, HTTPHeaderHost}
+
+func isReservedHeader(k string) bool {
+	for _, reserved := range reservedHeaders {
+		if strings.EqualFold(k, reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+type requestHeadersKey struct{}
+
+// WithRequestHeaders returns a context whose requests carry headers, such as a trace ID to
+// tag them, along with the ones of the parent context. The headers of a request given by
+// its options take precedence, the reserved ones are ignored and x-xiaomi-* ones are signed.
+func WithRequestHeaders(ctx context.Context, headers http.Header) context.Context {
+	merged := http.Header{}
+	if parent, ok := ctx.Value(requestHeadersKey{}).(http.Header); ok {
+		for k, v := range parent {
+			merged[k] = v
+		}
+	}
+	for k, v := range headers {
+		merged.Del(k)
+		for _, value := range v {
+			merged.Add(k, value)
+		}
+	}
+	return context.WithValue(ctx, requestHeadersKey{}, merged)
+}
+
 type clientRequest struct {
 	BucketName         string
 	ObjectName         string
@@ -51,9 +146,15 @@ type clientRequest struct {
 	QueryHeaderOptions interface{}
 	Data               io.Reader
 	Result             interface{}
+
+	// NoRetry sends the request once even with a RetryPolicy, for requests which are not idempotent
+	NoRetry bool
+
+	// CDN sends the request to the CDN endpoint
+	CDN bool
 }
 
-// make request
+// make request, which is traced by a span of the TraceProvider and reported to the MetricsCollector
 func (client *Client) do(ctx context.Context, request *clientRequest) (*http.Response, error) {
 	// parse http url query string
 	queryString, e := httpparser.QueryString(request.QueryHeaderOptions)
@@ -63,62 +164,239 @@ func (client *Client) do(ctx context.Context, request *clientRequest) (*http.Res
 
 	query := queryString.Encode()
 
-	u := client.buildRequestURL(request.BucketName, request.ObjectName, query, false)
+	u := client.buildRequestURL(request.BucketName, request.ObjectName, query, request.CDN)
 
 	// parse http header
 	header, e := httpparser.Header(request.QueryHeaderOptions)
 	if e != nil {
 		return nil, e
 	}
+	for _, k := range reservedHeaders {
+		if _, ok := header[k]; ok {
+			return nil, ErrorReservedHeader
+		}
+	}
+
+	policy := client.Configuration.RetryPolicy
+	if request.NoRetry {
+		policy = nil
+	}
 
-	return client.doRequest(ctx, request.Method, u, header, request.Data, request.Result)
+	operation := operationName(request.Method, request.BucketName, request.ObjectName, queryString)
+	ctx, span, end := StartSpan(ctx, client.traceProvider(), "fds."+string(request.Method),
+		Attribute{AttributeBucket, request.BucketName},
+		Attribute{AttributeObject, request.ObjectName},
+		Attribute{AttributeMethod, string(request.Method)})
+	start := time.Now()
+	response, err := client.doRequest(withSpan(context.WithValue(ctx, operationKey{}, operation), span),
+		policy, request.Method, u, header, request.Data, request.Result)
+	client.observeRequest(operation, start, response)
+	if response != nil {
+		span.SetAttributes(Attribute{AttributeStatusCode, response.StatusCode},
+			Attribute{AttributeRequestID, response.Header.Get(HTTPHeaderRequestID)})
+		if response.ContentLength >= 0 {
+			span.SetAttributes(Attribute{AttributeResponseBytes, response.ContentLength})
+		}
+	}
+	end(err)
+	return response, err
 }
 
-func (client *Client) doRequest(ctx context.Context, method HTTPMethod, url *url.URL, header http.Header,
+func (client *Client) doRequest(ctx context.Context, policy *RetryPolicy, method HTTPMethod, url *url.URL, header http.Header,
 	data io.Reader, result interface{}) (*http.Response, error) {
-	methodString := strings.ToUpper(string(method))
-	req := &http.Request{
-		Method:     methodString,
-		URL:        url,
-		Proto:      "HTTP/1.1",
-		ProtoMajor: 1,
-		ProtoMinor: 1,
-		Header:     make(http.Header),
-		Host:       url.Host,
+	if client.anonymous && method != HTTPGet && method != HTTPHead {
+		return nil, ErrorCredentialsRequired
 	}
 
-	// inject context
-	req = req.WithContext(ctx)
+	d := client.totalOperationTimeout(ctx)
+	operationCtx, cancel, operation := withTimeout(ctx, d)
+	response, err := client.doRequestAttempts(withOperationTimeout(operationCtx, operation), policy, method, url, header, data, result)
+	operation.stop()
+	if operation.isExpired() && ctx.Err() == nil {
+		if response != nil {
+			response.Body.Close()
+		}
+		cancel()
+		return nil, fmt.Errorf("%w after %v", ErrorTotalOperationTimeout, d)
+	}
 
-	dataFile := client.doHandleRequestBody(req, data)
-	if dataFile != nil {
-		defer func() {
-			dataFile.Close()
-			os.Remove(dataFile.Name())
-		}()
+	if response == nil {
+		cancel()
+		return nil, err
+	}
+	response.Body = &cancelBody{response.Body, cancel}
+	return response, err
+}
+
+// doRequestAttempts sends the request until it succeeds or policy gives up
+func (client *Client) doRequestAttempts(ctx context.Context, policy *RetryPolicy, method HTTPMethod, url *url.URL, header http.Header,
+	data io.Reader, result interface{}) (*http.Response, error) {
+	if policy != nil {
+		var err error
+		if data, err = retryableBody(data, client.retryBufferSize()); err != nil {
+			return nil, err
+		}
 	}
+	rewind, rewindable := bodyRewinder(data)
+	if !rewindable {
+		if err := client.waitRateLimit(ctx, method); err != nil {
+			return nil, err
+		}
+		response, err := client.doRequestOnce(ctx, 1, method, url, header, data, false, result)
+		if ctx.Err() == nil && policy.shouldRetry(1, response, err) {
+			err = &notRetriedError{err}
+		}
+		return response, err
+	}
+	if closer, ok := data.(io.Closer); ok && policy == nil {
+		// closes the body once it is not sent again, like the transport does
+		defer closer.Close()
+	}
+
+	// corrected is 1 once the request is sent again for a skewed clock, which is not a retry of policy
+	corrected := 0
+	for attempt := 1; ; attempt++ {
+		if err := client.waitRateLimit(ctx, method); err != nil {
+			return nil, err
+		}
+		response, err := client.doRequestOnce(ctx, attempt, method, url, header, data, true, result)
+		if client.correctClock(response, err) && corrected == 0 && ctx.Err() == nil {
+			corrected = 1
+			response.Body.Close()
+			if err := rewind(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if ctx.Err() != nil || !policy.shouldRetry(attempt-corrected, response, err) {
+			return response, err
+		}
+		if response != nil {
+			response.Body.Close()
+		}
+
+		backoff := policy.backoff(attempt-corrected, response, client.clock, client.jitter)
+		spanOf(ctx).AddEvent(EventRetry, Attribute{AttributeAttempt, attempt}, Attribute{AttributeError, err.Error()})
+		client.countRetry(ctx)
+		client.logger.Debug(fmt.Sprintf("attempt %d failed, retry in %v: %v", attempt, backoff, err))
+
+		select {
+		case <-client.clock.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if err := rewind(); err != nil {
+			return nil, err
+		}
+	}
+}
 
+// doRequestOnce sends a single attempt bounded by the request timeout, keepBody prevents
+// data from being closed by the transport so that it can be sent again
+func (client *Client) doRequestOnce(ctx context.Context, attempt int, method HTTPMethod, url *url.URL, header http.Header,
+	data io.Reader, keepBody bool, result interface{}) (*http.Response, error) {
+	d := client.attemptTimeout(ctx, result == nil)
+	attemptCtx, cancel, timeout := withTimeout(withAttempt(ctx, attempt), d)
+	response, err := client.sendRequest(ctx, attemptCtx, timeout, method, url, header, data, keepBody, result)
+	timeout.stop()
+	if timeout.isExpired() && ctx.Err() == nil {
+		if response != nil {
+			response.Body.Close()
+		}
+		cancel()
+		return nil, fmt.Errorf("%w after %v", ErrorRequestTimeout, d)
+	}
+
+	if response == nil {
+		cancel()
+		return nil, err
+	}
+	if idle := client.bodyIdleTimeout(ctx); idle > 0 && result == nil && err == nil {
+		response.Body = newIdleBody(response.Body, idle, cancel)
+	}
+	response.Body = &cancelBody{response.Body, cancel}
+	return response, err
+}
+
+// sendRequest sends a request of attemptCtx, timeout is stopped once the headers of
+// a streamed response, one without result, arrive
+func (client *Client) sendRequest(ctx, attemptCtx context.Context, timeout *timeout, method HTTPMethod, url *url.URL, header http.Header,
+	data io.Reader, keepBody bool, result interface{}) (*http.Response, error) {
+	methodString := strings.ToUpper(string(method))
+	req, err := http.NewRequestWithContext(attemptCtx, methodString, url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL = url
+
+	// the headers of the request go first, so that a Content-MD5 given is not calculated again
+	if extra, ok := ctx.Value(requestHeadersKey{}).(http.Header); ok {
+		for k, values := range extra {
+			if isReservedHeader(k) {
+				continue
+			}
+			for _, v := range values {
+				req.Header.Add(k, v)
+			}
+		}
+	}
 	if header != nil {
 		for k := range header {
 			req.Header.Set(k, header.Get(k))
 		}
 	}
 
+	if req.Header.Get(HTTPHeaderUserAgent) == "" {
+		req.Header.Set(HTTPHeaderUserAgent, client.userAgent())
+	}
+
+	dataFile := client.doHandleRequestBody(req, data, keepBody)
+	if dataFile != nil {
+		defer func() {
+			dataFile.Close()
+			os.Remove(dataFile.Name())
+		}()
+	}
+
 	data = dataFile
+	if req.Body != nil {
+		spanOf(ctx).SetAttributes(Attribute{AttributeRequestBytes, req.ContentLength})
+	}
+	if operation := operationTimeoutOf(ctx); req.Body != nil && (timeout != nil || operation != nil) {
+		req.Body = &progressBody{req.Body, timeout, operation}
+	}
 
-	req.Header.Add(HTTPHeaderContentMD5, "")
-	req.Header.Add(HTTPHeaderDate, time.Now().Format(time.RFC1123))
+	if req.Header.Get(HTTPHeaderContentMD5) == "" {
+		req.Header.Set(HTTPHeaderContentMD5, "")
+	}
+	req.Header.Add(HTTPHeaderDate, client.now().Format(time.RFC1123))
 
-	signature, err := signature(client.AccessSecret, method, url.String(), req.Header)
-	if err != nil {
-		return nil, err
+	if !client.anonymous {
+		creds, err := client.credentials()
+		if err != nil {
+			return nil, err
+		}
+		if creds.SecurityToken != "" {
+			req.Header.Set(HTTPHeaderSecurityToken, creds.SecurityToken)
+		}
+		err = client.getSigner().SignRequest(method, client.signingURL(url), req.Header, creds.AccessID, creds.AccessSecret)
+		if err != nil {
+			return nil, err
+		}
 	}
-	req.Header.Add(HTTPHeaderAuthorization, fmt.Sprintf("Galaxy-V2 %s:%s", client.AccessID, signature))
 
 	for k, v := range req.Header {
+		if redactedHeader(k) {
+			v = []string{debugRedacted}
+		}
 		client.logger.Debug(fmt.Sprintf(" >>> HTTP Header: k=%s, v=%s", k, v))
 	}
-	client.logger.Debug(fmt.Sprintf(" >>> HTTP URL: %s", req.URL.String()))
+	client.logger.Debug(fmt.Sprintf(" >>> HTTP URL: %s", redactURL(req.URL)))
+
+	if err := client.interceptRequest(req); err != nil {
+		return nil, err
+	}
 
 	response, err := client.httpClient.Do(req)
 	if err != nil {
@@ -129,6 +407,15 @@ func (client *Client) doRequest(ctx context.Context, method HTTPMethod, url *url
 		}
 		return nil, err
 	}
+	if result == nil {
+		timeout.stop()
+	}
+	client.countBytes(ctx, req, response)
+
+	if err := client.interceptResponse(response); err != nil {
+		response.Body.Close()
+		return nil, err
+	}
 
 	// check http status
 	statusNeed2Check := []int{http.StatusOK}
@@ -152,6 +439,17 @@ func (client *Client) doRequest(ctx context.Context, method HTTPMethod, url *url
 	return response, err
 }
 
+// sdkUserAgent identifies the SDK in the User-Agent header
+var sdkUserAgent = fmt.Sprintf("go-fds/%s (%s; %s/%s)", Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+// userAgent is the SDK identifier followed by UserAgent of the configuration
+func (client *Client) userAgent() string {
+	if client.Configuration == nil || client.Configuration.UserAgent == "" {
+		return sdkUserAgent
+	}
+	return sdkUserAgent + " " + client.Configuration.UserAgent
+}
+
 func checkResponseStatus(response *http.Response, allowed []int) error {
 	for _, v := range allowed {
 		if response.StatusCode == v {
@@ -159,41 +457,29 @@ func checkResponseStatus(response *http.Response, allowed []int) error {
 		}
 	}
 
-	statusCode := response.StatusCode
-
-	var err error
-	var respBody []byte
-	if statusCode >= 400 && statusCode <= 505 {
-		respBody, err = readResponseBody(response)
-		if err != nil {
-			return err
-		}
-
-		if len(respBody) == 0 {
-			// No error in response body
-			err = fmt.Errorf("fds: server returned without a response body (%s)", response.Status)
-		} else {
-			// clientResponse contains storage service error object, unmarshal
-			err = newServerError(string(respBody), response.StatusCode)
-		}
+	if response.StatusCode < 300 {
+		return nil
+	}
 
-		response.Body = ioutil.NopCloser(bytes.NewReader(respBody))
-	} else if statusCode >= 300 && statusCode <= 307 {
-		err = newServerError(fmt.Sprintf("fds: service returned %s", response.Status), response.StatusCode)
+	// the body is read to the end and closed even if it is not an error of the service,
+	// so that the connection is reused
+	respBody, err := readResponseBody(response)
+	if err != nil {
+		return err
 	}
-	return err
+	response.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	return newResponseError(response, respBody)
 }
 
+// maxErrorBodySize bounds the body of a failed request which is read into memory
+const maxErrorBodySize = 1 << 20
+
 func readResponseBody(resp *http.Response) ([]byte, error) {
 	defer resp.Body.Close()
-	out, err := ioutil.ReadAll(resp.Body)
-	if err == io.EOF {
-		err = nil
-	}
-	return out, err
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
 }
 
-func (client *Client) doHandleRequestBody(req *http.Request, body io.Reader) *os.File {
+func (client *Client) doHandleRequestBody(req *http.Request, body io.Reader, keepBody bool) *os.File {
 	var file *os.File
 	switch v := body.(type) {
 	case *bytes.Buffer:
@@ -207,6 +493,10 @@ func (client *Client) doHandleRequestBody(req *http.Request, body io.Reader) *os
 		req.ContentLength = fileInfo.Size()
 	case *io.LimitedReader:
 		req.ContentLength = int64(v.N)
+	case *io.SectionReader:
+		req.ContentLength = v.Size()
+	case interface{ Len() int }:
+		req.ContentLength = int64(v.Len())
 	}
 
 	req.Header.Set(HTTPHeaderContentLength, strconv.FormatInt(req.ContentLength, 10))
@@ -218,7 +508,7 @@ func (client *Client) doHandleRequestBody(req *http.Request, body io.Reader) *os
 	}
 
 	bodyCloser, ok := body.(io.ReadCloser)
-	if !ok && body != nil {
+	if (!ok || keepBody) && body != nil {
 		bodyCloser = ioutil.NopCloser(body)
 	}
 	req.Body = bodyCloser
@@ -231,10 +521,17 @@ func (client *Client) buildRequestURL(bucketName string, objectName string, para
 	basicURL := client.basicURL(cdn)
 	buf.WriteString(basicURL)
 
-	objectName = url.QueryEscape(objectName)
-	objectName = strings.Replace(objectName, "+", "%20", -1)
+	objectName = escapeObjectName(objectName)
 
 	buf.WriteByte('/')
+	if bucketName != "" && client.virtualHost(cdn) {
+		// the bucket is the leading label of the host
+		buf.WriteString(objectName)
+		u, _ := url.ParseRequestURI(buf.String())
+		u.Host = bucketName + "." + u.Host
+		u.RawQuery = params
+		return u
+	}
 	if bucketName != "" {
 		buf.WriteString(bucketName)
 	}
@@ -252,19 +549,64 @@ func (client *Client) buildRequestURL(bucketName string, objectName string, para
 	return u
 }
 
+// escapeObjectName escapes each segment of objectName between slashes, everything
+// but the unreserved characters of RFC 3986 is escaped, so that the path is decoded
+// to objectName the same way by any server and by the canonical resource of signing
+func escapeObjectName(objectName string) string {
+	const hex = "0123456789ABCDEF"
+	var buf strings.Builder
+	for i := 0; i < len(objectName); i++ {
+		c := objectName[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			buf.WriteByte(c)
+		default:
+			buf.WriteByte('%')
+			buf.WriteByte(hex[c>>4])
+			buf.WriteByte(hex[c&15])
+		}
+	}
+	return buf.String()
+}
+
+func (client *Client) virtualHost(cdn bool) bool {
+	return client.Configuration.VirtualHostStyle && !cdn
+}
+
+// signingURL returns the path-style form of a virtual-host style u, as the
+// canonical resource of signatures is /bucket/object either way
+func (client *Client) signingURL(u *url.URL) *url.URL {
+	endpoint := client.endpoint(false)
+	suffix := "." + endpoint
+	if !client.virtualHost(false) || !strings.HasSuffix(u.Host, suffix) {
+		return u
+	}
+
+	signing := *u
+	signing.Host = endpoint
+	signing.Path = "/" + strings.TrimSuffix(u.Host, suffix)
+	if u.Path != "/" {
+		signing.Path += u.Path
+	}
+	signing.RawPath = ""
+	return &signing
+}
+
 func (client *Client) basicURL(cdn bool) string {
 	var buf bytes.Buffer
 	httpSchema := client.httpSchema()
 	buf.WriteString(fmt.Sprintf("%s://", httpSchema))
-	if cdn {
-		buf.WriteString(client.Configuration.cdnEndpoint)
-	} else {
-		buf.WriteString(client.Configuration.Endpoint)
-	}
+	buf.WriteString(client.endpoint(cdn))
 
 	return buf.String()
 }
 
+// endpoint is the endpoint of the requests, which is the internal one if EnableInternalEndpoint is set
+func (client *Client) endpoint(cdn bool) string {
+	return client.Configuration.endpoint(client.Configuration.EnableInternalEndpoint, cdn)
+}
+
 func (client *Client) httpSchema() string {
 	var httpSchema string
 	if client.Configuration.EnableHTTPS {
@@ -1,11 +1,36 @@
 package fds
 
 import (
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// newTestClient new a client which sends requests to server
+func newTestClient(server *httptest.Server) *Client {
+	u, _ := url.Parse(server.URL)
+	conf, _ := NewClientConfiguration(u.Host)
+	conf.EnableHTTPS = false
+	return New("ak", "sk", conf)
+}
+
 func Test_NewLifecycleConfigFromJSON(t *testing.T) {
 	content := `
 {
@@ -74,3 +99,1743 @@ func Test_NewLifecycleRuleFromJSON(t *testing.T) {
 	assert.False(t, rule.Enabled)
 	assert.Equal(t, float64(164), rule.Action["expiration"].Days)
 }
+
+func Test_ObjectMetadataGetters(t *testing.T) {
+	md := NewObjectMetadata()
+
+	_, err := md.GetContentLength()
+	assert.True(t, errors.Is(err, ErrorMetadataNotFound))
+	_, err = md.GetLastModified()
+	assert.True(t, errors.Is(err, ErrorMetadataNotFound))
+	assert.Empty(t, md.GetETag())
+	assert.Empty(t, md.GetContentType())
+
+	md.Set(HTTPHeaderContentMetadataLength, "abc")
+	_, err = md.GetContentLength()
+	assert.True(t, errors.Is(err, ErrorMetadataInvalid))
+	md.Set(HTTPHeaderContentMetadataLength, "-1")
+	_, err = md.GetContentLength()
+	assert.True(t, errors.Is(err, ErrorMetadataInvalid))
+
+	md.Set(HTTPHeaderLastModified, "yesterday")
+	_, err = md.GetLastModified()
+	assert.True(t, errors.Is(err, ErrorMetadataInvalid))
+
+	md.SetContentLength(11)
+	md.Set(HTTPHeaderLastModified, "Mon, 01 Oct 2018 00:00:00 GMT")
+	md.Set(HTTPHeaderETag, "etag")
+	md.Set(HTTPHeaderContentType, "text/plain")
+
+	length, err := md.GetContentLength()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), length)
+
+	lastModified, err := md.GetLastModified()
+	assert.Nil(t, err)
+	assert.True(t, time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC).Equal(lastModified))
+	md.Set(HTTPHeaderLastModified, "Mon, 01 Oct 2018 08:00:00 +0800")
+	lastModified, err = md.GetLastModified()
+	assert.Nil(t, err)
+	assert.True(t, time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC).Equal(lastModified))
+
+	assert.Equal(t, "etag", md.GetETag())
+	assert.Equal(t, "text/plain", md.GetContentType())
+
+	assert.Empty(t, md.GetContentMD5())
+	assert.Empty(t, md.GetCacheControl())
+	md.Set(HTTPHeaderContentMD5, "md5")
+	md.Set(HTTPHeaderCacheControl, "no-cache")
+	assert.Equal(t, "md5", md.GetContentMD5())
+	assert.Equal(t, "no-cache", md.GetCacheControl())
+}
+
+func Test_ObjectMetadataUserMetadata(t *testing.T) {
+	md := NewObjectMetadata()
+	md.SetContentLength(11)
+	md.Set(XiaomiMetaPrefix+"old", "1")
+	assert.Equal(t, map[string]string{"old": "1"}, md.GetUserMetadata())
+
+	md.SetUserMetadata(map[string]string{"owner": "me", "team": "fds"})
+	assert.Equal(t, map[string]string{"owner": "me", "team": "fds"}, md.GetUserMetadata())
+	assert.Equal(t, "me", md.Get("X-Xiaomi-Meta-Owner"))
+
+	length, err := md.GetContentLength()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), length)
+
+	md.SetUserMetadata(nil)
+	assert.Empty(t, md.GetUserMetadata())
+}
+
+func Test_RequestWithCanceledContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.GetObjectMetadataWithContext(ctx, "bucket", "object")
+	assert.Equal(t, context.Canceled, err)
+
+	_, err = client.DoesBucketExistWithContext(ctx, "bucket")
+	assert.Equal(t, context.Canceled, err)
+}
+
+func Test_AnonymousClient(t *testing.T) {
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get(HTTPHeaderAuthorization))
+		w.Header().Set(HTTPHeaderContentMetadataLength, "3")
+	}))
+	defer server.Close()
+
+	client := NewAnonymousClient(newTestClient(server).Configuration)
+	assert.True(t, client.IsAnonymous())
+
+	_, err := client.GetObjectMetadata("bucket", "object")
+	assert.Nil(t, err)
+	exist, err := client.DoesObjectExist("bucket", "object")
+	assert.Nil(t, err)
+	assert.True(t, exist)
+	assert.Equal(t, []string{"", ""}, authorizations)
+
+	_, err = client.PutObject(&PutObjectRequest{BucketName: "bucket", ObjectName: "object"})
+	assert.Equal(t, ErrorCredentialsRequired, err)
+	assert.Equal(t, ErrorCredentialsRequired, client.DeleteObject("bucket", "object"))
+	_, err = client.GeneratePresignedURL(&GeneratePresignedURLRequest{BucketName: "bucket", ObjectName: "object"})
+	assert.Equal(t, ErrorCredentialsRequired, err)
+	assert.Equal(t, 2, len(authorizations))
+
+	// the writes fail at once without retries
+	clock := &fakeClock{}
+	for _, provider := range []CredentialsProvider{nil, AnonymousCredentials} {
+		client = NewWithCredentialsProvider(provider, newTestClient(server).Configuration, nil)
+		client.Configuration.RetryPolicy = DefaultRetryPolicy()
+		client.clock = clock
+		assert.True(t, client.IsAnonymous())
+
+		_, err = client.ListObjects(&ListObjectsRequest{BucketName: "bucket"})
+		assert.Nil(t, err)
+		body, err := client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "object"})
+		assert.Nil(t, err)
+		body.Close()
+		assert.Equal(t, ErrorCredentialsRequired, client.DeleteObject("bucket", "object"))
+	}
+	assert.Empty(t, clock.waits)
+	assert.Equal(t, []string{"", "", "", "", "", ""}, authorizations)
+}
+
+func Test_ServerError(t *testing.T) {
+	status := http.StatusNotFound
+	body := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HTTPHeaderRequestID, "request-1")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	_, err := client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "a/b"})
+	assert.True(t, IsNotFound(err))
+	assert.False(t, IsAccessDenied(err))
+
+	var e *ServerError
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, http.StatusNotFound, e.StatusCode)
+	assert.Equal(t, "request-1", e.RequestID)
+	assert.Equal(t, "bucket", e.Bucket)
+	assert.Equal(t, "a/b", e.Object)
+
+	status = http.StatusForbidden
+	body = `{"errorCode": "AccessDenied", "message": "no permission"}`
+	err = client.DeleteObject("bucket", "object")
+	assert.True(t, IsAccessDenied(err))
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, "AccessDenied", e.ErrorCode)
+	assert.Equal(t, "no permission", e.Message())
+
+	status = http.StatusTooManyRequests
+	body = "slow down"
+	err = client.DeleteObject("bucket", "object")
+	assert.True(t, IsThrottled(fmt.Errorf("wrapped: %w", err)))
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, "slow down", e.Message())
+
+	assert.False(t, IsNotFound(errors.New("not a server error")))
+}
+
+func Test_PresignURL(t *testing.T) {
+	conf, _ := NewClientConfiguration("cnbj0.fds.api.xiaomi.com")
+	client := New("ak", "sk", conf)
+	expires := time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	u, err := client.PresignURL(HTTPGet, "bucket", "object", expires, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://cnbj0.fds.api.xiaomi.com/bucket/object?Expires=1538352000000&GalaxyAccessKeyId=ak"+
+		"&Signature=KXiv3xIsqT89Tg%2BDeT8gMIe9aQE%3D", u)
+
+	u, err = client.PresignURL(HTTPPut, "bucket", "dir/a b.txt", expires, map[string]string{
+		HTTPHeaderContentType:      "text/plain",
+		XiaomiMetaPrefix + "owner": "alice",
+	})
+	assert.Nil(t, err)
+	parsed, err := url.Parse(u)
+	assert.Nil(t, err)
+	assert.Equal(t, "/bucket/dir/a b.txt", parsed.Path)
+	assert.Equal(t, "ZzQBii2ykWkWxx5frhitN9aUB3I=", parsed.Query().Get(HTTPHeaderSignature))
+
+	u, err = client.PresignURL(HTTPHead, "bucket", "object", expires, nil)
+	assert.Nil(t, err)
+	parsed, _ = url.Parse(u)
+	assert.Equal(t, "5GBob18VVQdXcywg63jo+Hhv6rY=", parsed.Query().Get(HTTPHeaderSignature))
+	_, ok := parsed.Query()["metadata"]
+	assert.True(t, ok)
+
+	_, err = client.PresignURL(HTTPDelete, "bucket", "object", expires, nil)
+	assert.Nil(t, err)
+	_, err = client.PresignURL(HTTPPost, "bucket", "object", expires, nil)
+	assert.Equal(t, ErrorPresignedURLMethod, err)
+}
+
+func Test_ObjectExists(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		switch r.URL.Path {
+		case "/bucket/object":
+			w.Header().Set(HTTPHeaderContentMetadataLength, "42")
+		case "/bucket/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	exist, metadata, err := client.ObjectExists("bucket", "object")
+	assert.Nil(t, err)
+	assert.True(t, exist)
+	length, err := metadata.GetContentLength()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), length)
+
+	exist, metadata, err = client.ObjectExists("bucket", "missing")
+	assert.Nil(t, err)
+	assert.False(t, exist)
+	assert.Nil(t, metadata)
+
+	exist, _, err = client.ObjectExists("bucket", "broken")
+	assert.Equal(t, http.StatusInternalServerError, statusCodeOf(err))
+	assert.False(t, exist)
+}
+
+func Test_GeneratePresignedCDNURL(t *testing.T) {
+	conf, _ := NewClientConfiguration("cnbj0.fds.api.xiaomi.com")
+	client := New("ak", "sk", conf)
+	expires := time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	u, err := client.GeneratePresignedCDNURL("bucket", "image.png", expires, url.Values{"thumb": {"1"}, "w": {"100"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "https", u.Scheme)
+	assert.Equal(t, conf.CDNEndpoint(), u.Host)
+	assert.Equal(t, "1", u.Query().Get("thumb"))
+	assert.Equal(t, "100", u.Query().Get("w"))
+	assert.Equal(t, "Zrm8zuOtB9Mf0WCUm6EK2ueun7A=", u.Query().Get(HTTPHeaderSignature))
+
+	conf.SetCDNEndpoint("download.example.com")
+	u, err = client.GeneratePresignedURL(&GeneratePresignedURLRequest{
+		CDN:        true,
+		BucketName: "bucket",
+		ObjectName: "image.png",
+		Method:     HTTPGet,
+		Expiration: expires,
+		Scheme:     "http",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "http://download.example.com/bucket/image.png", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, "Zrm8zuOtB9Mf0WCUm6EK2ueun7A=", u.Query().Get(HTTPHeaderSignature))
+
+	_, err = client.GeneratePresignedCDNURL("bucket", "image.png", expires, url.Values{"acl": {""}})
+	assert.Equal(t, ErrorPresignedURLParam, err)
+	_, err = client.GeneratePresignedURL(&GeneratePresignedURLRequest{Method: HTTPGet, Scheme: "ftp"})
+	assert.Equal(t, ErrorPresignedURLScheme, err)
+}
+
+func Test_DoesObjectAndBucketExist(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		switch r.URL.Path {
+		case "/bucket", "/bucket/object":
+		case "/missing", "/bucket/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	exist, err := client.DoesObjectExist("bucket", "object")
+	assert.Nil(t, err)
+	assert.True(t, exist)
+	exist, err = client.DoesObjectExist("bucket", "missing")
+	assert.Nil(t, err)
+	assert.False(t, exist)
+	exist, err = client.DoesObjectExist("bucket", "private")
+	assert.True(t, IsAccessDenied(err))
+	assert.False(t, exist)
+
+	exist, err = client.DoesBucketExist("bucket")
+	assert.Nil(t, err)
+	assert.True(t, exist)
+	exist, err = client.DoesBucketExist("missing")
+	assert.Nil(t, err)
+	assert.False(t, exist)
+	exist, err = client.DoesBucketExist("private")
+	assert.True(t, IsAccessDenied(err))
+	assert.False(t, exist)
+}
+
+func Test_RequestHeaders(t *testing.T) {
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header)
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	custom := http.Header{}
+	custom.Set("X-Trace-Id", "trace-1")
+	custom.Set(XiaomiMetaPrefix+"owner", "alice")
+
+	body, err := client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "object", Headers: custom})
+	assert.Nil(t, err)
+	body.Close()
+	_, err = client.PutObject(&PutObjectRequest{BucketName: "bucket", ObjectName: "object", Headers: custom})
+	assert.Nil(t, err)
+	_, err = client.InitMultipartUpload(&InitMultipartUploadRequest{BucketName: "bucket", ObjectName: "object", Headers: custom})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 3, len(headers))
+	for _, h := range headers {
+		assert.Equal(t, "trace-1", h.Get("X-Trace-Id"))
+		assert.Equal(t, "alice", h.Get(XiaomiMetaPrefix+"owner"))
+		assert.Contains(t, h.Get(HTTPHeaderAuthorization), "Galaxy-V2 ak:")
+	}
+
+	for _, k := range []string{"authorization", HTTPHeaderDate, HTTPHeaderHost} {
+		_, err = client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "object", Headers: http.Header{k: {"x"}}})
+		assert.Equal(t, ErrorReservedHeader, err)
+	}
+	assert.Equal(t, 3, len(headers))
+}
+
+func Test_CopyAndMoveObject(t *testing.T) {
+	var requests []string
+	var bodies []string
+	var ifMatches []string
+	sourceETag := "etag"
+	failSetMetadata := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		q := r.URL.Query()
+		if _, ok := q["metadata"]; ok {
+			w.Header().Set(HTTPHeaderETag, "\"etag\"")
+			w.Header().Set(HTTPHeaderContentType, "text/plain")
+			w.Header().Set(XiaomiMetaPrefix+"owner", "alice")
+			w.Header().Set(HTTPHeaderContentMetadataLength, "3")
+		}
+		if _, ok := q["cp"]; ok {
+			ifMatch := r.Header.Get("x-xiaomi-copy-source-if-match")
+			ifMatches = append(ifMatches, ifMatch)
+			if ifMatch != "" && ifMatch != sourceETag {
+				w.WriteHeader(http.StatusPreconditionFailed)
+			}
+		}
+		if _, ok := q["setMetaData"]; ok && failSetMetadata {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	err := client.CopyObjectWithOptions("src", "a", "dst", "b", &CopyOptions{IfMatch: "other"})
+	assert.Equal(t, ErrorCopyPreconditionFailed, err)
+	assert.Equal(t, []string{"GET /src/a?metadata="}, requests)
+
+	requests, bodies = nil, nil
+	err = client.CopyObjectWithOptions("src", "a", "dst", "b", &CopyOptions{IfMatch: "etag", ContentType: "text/html"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"GET /src/a?metadata=", "PUT /dst/b?cp=", "PUT /dst/b?setMetaData="}, requests)
+	assert.JSONEq(t, `{"srcBucketName":"src","srcObjectName":"a"}`, bodies[1])
+	assert.JSONEq(t, `{"rawMeta":{"Content-Type":"text/html","X-Xiaomi-Meta-Owner":"alice"}}`, bodies[2])
+	assert.Equal(t, []string{"etag"}, ifMatches)
+
+	// the source changes after it is checked, the service rejects the copy
+	requests = nil
+	sourceETag = "changed"
+	err = client.CopyObjectWithOptions("src", "a", "dst", "b", &CopyOptions{IfMatch: "etag"})
+	assert.Equal(t, ErrorCopyPreconditionFailed, err)
+	assert.Equal(t, []string{"GET /src/a?metadata=", "PUT /dst/b?cp="}, requests)
+
+	requests, bodies = nil, nil
+	metadata := NewObjectMetadata()
+	metadata.Set(XiaomiMetaPrefix+"owner", "bob")
+	err = client.CopyObjectWithOptions("src", "a", "dst", "b", &CopyOptions{ReplaceMetadata: true, Metadata: metadata})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"PUT /dst/b?cp=", "PUT /dst/b?setMetaData="}, requests)
+	assert.JSONEq(t, `{"rawMeta":{"X-Xiaomi-Meta-Owner":"bob"}}`, bodies[1])
+
+	requests, bodies = nil, nil
+	err = client.CopyObjectWithOptions("src", "a", "dst", "b", &CopyOptions{UserMetadata: UserMetadata{"team": "fds"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"GET /src/a?metadata=", "PUT /dst/b?cp=", "PUT /dst/b?setMetaData="}, requests)
+	assert.JSONEq(t, `{"rawMeta":{"Content-Type":"text/plain","X-Xiaomi-Meta-Team":"fds"}}`, bodies[2])
+
+	err = client.CopyObjectWithOptions("src", "a", "dst", "b", &CopyOptions{UserMetadata: UserMetadata{"Team": "fds"}})
+	assert.True(t, errors.Is(err, ErrorUserMetadataKeyInvalid))
+
+	// the copy is undone if the metadata can not be set
+	requests = nil
+	failSetMetadata = true
+	err = client.CopyObjectWithOptions("src", "a", "dst", "b", &CopyOptions{ReplaceMetadata: true, Metadata: metadata})
+	assert.Equal(t, http.StatusInternalServerError, statusCodeOf(err))
+	assert.Equal(t, []string{"PUT /dst/b?cp=", "PUT /dst/b?setMetaData=", "DELETE /dst/b"}, requests)
+
+	requests = nil
+	assert.Nil(t, client.MoveObject("src", "a", "src", "b", nil))
+	assert.Equal(t, []string{"PUT /src/a?renameTo=b"}, requests)
+
+	requests = nil
+	assert.Nil(t, client.MoveObject("src", "a", "dst", "b", nil))
+	assert.Equal(t, []string{"PUT /dst/b?cp=", "DELETE /src/a"}, requests)
+}
+
+func Test_UpdateObjectMetadata(t *testing.T) {
+	stored := http.Header{}
+	stored.Set(HTTPHeaderContentType, "application/octet-stream")
+	stored.Set(XiaomiMetaPrefix+"owner", "alice")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket/object" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if _, ok := r.URL.Query()["setMetaData"]; ok {
+			data := struct {
+				RawMeta map[string]string `json:"rawMeta"`
+			}{}
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&data))
+			stored = http.Header{}
+			for k, v := range data.RawMeta {
+				stored.Set(k, v)
+			}
+			return
+		}
+		for k := range stored {
+			w.Header().Set(k, stored.Get(k))
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	metadata := NewObjectMetadata()
+	metadata.Set(HTTPHeaderContentType, "image/png")
+	assert.Nil(t, client.UpdateObjectMetadata("bucket", "object", metadata))
+
+	current, err := client.GetObjectMetadata("bucket", "object")
+	assert.Nil(t, err)
+	assert.Equal(t, "image/png", current.GetContentType())
+	assert.Equal(t, "alice", current.Get(XiaomiMetaPrefix+"owner"))
+
+	assert.Equal(t, ErrorMetadataUnchanged, client.UpdateObjectMetadata("bucket", "object", metadata))
+	assert.Equal(t, ErrorMetadataUnchanged, client.UpdateObjectMetadata("bucket", "object", NewObjectMetadata()))
+	assert.True(t, IsNotFound(client.UpdateObjectMetadata("bucket", "missing", metadata)))
+
+	// merge keeps the untouched keys, otherwise the metadata is replaced
+	metadata = NewObjectMetadata()
+	metadata.Set(HTTPHeaderCacheControl, "no-cache")
+	assert.Nil(t, client.SetObjectMetadata(&SetObjectMetadataRequest{BucketName: "bucket", ObjectName: "object", Metadata: metadata, Merge: true}))
+	assert.Equal(t, "image/png", stored.Get(HTTPHeaderContentType))
+	assert.Equal(t, "alice", stored.Get(XiaomiMetaPrefix+"owner"))
+	assert.Equal(t, "no-cache", stored.Get(HTTPHeaderCacheControl))
+
+	assert.Nil(t, client.SetObjectMetadata(&SetObjectMetadataRequest{BucketName: "bucket", ObjectName: "object", Metadata: metadata}))
+	assert.Equal(t, http.Header{HTTPHeaderCacheControl: {"no-cache"}}, stored)
+
+	for _, k := range []string{"content-length", HTTPHeaderContentMetadataLength, HTTPHeaderETag} {
+		immutable := NewObjectMetadata()
+		immutable.Set(k, "1")
+		err = client.SetObjectMetadata(&SetObjectMetadataRequest{BucketName: "bucket", ObjectName: "object", Metadata: immutable, Merge: true})
+		assert.True(t, errors.Is(err, ErrorMetadataImmutable))
+		assert.True(t, errors.Is(client.UpdateObjectMetadata("bucket", "object", immutable), ErrorMetadataImmutable))
+	}
+	assert.Equal(t, http.Header{HTTPHeaderCacheControl: {"no-cache"}}, stored)
+}
+
+func Test_ObjectACL(t *testing.T) {
+	var set *AccessControlList
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := r.URL.Query()["acl"]
+		assert.True(t, ok)
+		if r.Method == http.MethodPut {
+			set = &AccessControlList{}
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(set))
+			return
+		}
+		w.Write([]byte(`{"owner":{"id":"owner"},"accessControlList":[` +
+			`{"grantee":{"id":"owner","displayName":"Owner"},"permission":"FULL_CONTROL","type":"USER"},` +
+			`{"grantee":{"id":"AUTHENTICATED_USERS"},"permission":"READ","type":"GROUP"}]}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	acl, err := client.GetObjectACL(&GetObjectACLRequest{BucketName: "bucket", ObjectName: "object"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(acl.Grants))
+	assert.Equal(t, NewAuthenticatedReadGrant(), acl.Grants[1])
+
+	acl.AddGrant(NewPublicReadGrant())
+	assert.Nil(t, client.SetObjectACL(&SetObjectACLRequest{BucketName: "bucket", ObjectName: "object", ACL: acl}))
+	assert.Equal(t, acl, set)
+	assert.Equal(t, "Owner", set.Grants[0].Grantee.DisplayName)
+	assert.Equal(t, Grant{Grantee: GrantKey{ID: GranteeAllUsers}, Permission: GrantPermissionRead, Type: GrantTypeGroup}, set.Grants[2])
+}
+
+func Test_ObjectGrantRoundTrip(t *testing.T) {
+	stored := &AccessControlList{Owner: Owner{ID: "owner"}}
+	stored.AddGrant(NewUserGrant("owner", GrantPermissionFullControl))
+	puts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/bucket/object", r.URL.Path)
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(stored)
+			return
+		}
+
+		puts++
+		acl := &AccessControlList{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(acl))
+		for _, grant := range acl.Grants {
+			if r.URL.Query().Get("action") == "delete" {
+				stored.RemoveGrant(grant)
+			} else if !stored.HasGrant(grant) {
+				stored.AddGrant(grant)
+			}
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+	get := func() *AccessControlList {
+		acl, err := client.GetObjectACL(&GetObjectACLRequest{BucketName: "bucket", ObjectName: "object"})
+		assert.Nil(t, err)
+		return acl
+	}
+
+	acl := get()
+	acl.AddGrant(NewUserGrant("app", GrantPermissionWrite))
+	assert.Nil(t, client.SetObjectACL(&SetObjectACLRequest{BucketName: "bucket", ObjectName: "object", ACL: acl}))
+	assert.True(t, get().HasGrant(NewUserGrant("app", GrantPermissionWrite)))
+
+	assert.Nil(t, client.RemoveObjectGrant("bucket", "object", NewUserGrant("app", GrantPermissionWrite)))
+	acl = get()
+	assert.False(t, acl.HasGrant(NewUserGrant("app", GrantPermissionWrite)))
+	assert.True(t, acl.HasGrant(NewUserGrant("owner", GrantPermissionFullControl)))
+
+	assert.Nil(t, client.SetObjectPublic("bucket", "object"))
+	assert.True(t, get().HasGrant(NewPublicReadGrant()))
+	assert.Nil(t, client.SetObjectPrivate("bucket", "object"))
+	assert.Equal(t, []Grant{NewUserGrant("owner", GrantPermissionFullControl)}, get().Grants)
+
+	puts = 0
+	assert.Nil(t, client.SetObjectPrivate("bucket", "object"))
+	assert.Nil(t, client.RemoveObjectGrant("bucket", "object", NewUserGrant("app", GrantPermissionWrite)))
+	assert.Equal(t, 0, puts)
+}
+
+func Test_BucketGrants(t *testing.T) {
+	var requests []string
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		if r.Method == http.MethodPut {
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			return
+		}
+		w.Write([]byte(`{"owner":{"id":"owner","displayName":"Owner"},"accessControlList":[` +
+			`{"grantee":{"id":"owner"},"permission":"FULL_CONTROL","type":"USER"},` +
+			`{"grantee":{"id":"ALL_USERS"},"permission":"READ","type":"GROUP"}]}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	assert.Nil(t, client.AddBucketGrant("bucket", NewPublicReadGrant(), NewUserGrant("app", GrantPermissionWrite)))
+	assert.Equal(t, []string{"GET /bucket?acl=", "PUT /bucket?acl="}, requests)
+	assert.JSONEq(t, `{"owner":{"id":"owner","displayName":"Owner"},"accessControlList":[`+
+		`{"grantee":{"id":"owner","displayName":""},"permission":"FULL_CONTROL","type":"USER"},`+
+		`{"grantee":{"id":"ALL_USERS","displayName":""},"permission":"READ","type":"GROUP"},`+
+		`{"grantee":{"id":"app","displayName":""},"permission":"WRITE","type":"USER"}]}`, bodies[0])
+
+	requests, bodies = nil, nil
+	assert.Nil(t, client.AddBucketGrant("bucket", NewPublicReadGrant()))
+	assert.Equal(t, []string{"GET /bucket?acl="}, requests)
+
+	requests, bodies = nil, nil
+	assert.Nil(t, client.RemoveBucketGrant("bucket", NewPublicReadGrant(), NewUserGrant("app", GrantPermissionFullControl)))
+	assert.Equal(t, []string{"GET /bucket?acl=", "PUT /bucket?acl=&action=delete"}, requests)
+	assert.JSONEq(t, `{"owner":{"id":"owner","displayName":"Owner"},"accessControlList":[`+
+		`{"grantee":{"id":"ALL_USERS","displayName":""},"permission":"READ","type":"GROUP"}]}`, bodies[0])
+
+	acl := &AccessControlList{}
+	acl.AddGrant(NewGroupGrant(GranteeAllUsers, GrantPermissionFullControl))
+	acl.AddGrant(NewUserGrant("app", GrantPermissionRead))
+	acl.RemoveGrant(NewUserGrant("app", GrantPermissionRead))
+	assert.Equal(t, []Grant{NewGroupGrant(GranteeAllUsers, GrantPermissionFullControl)}, acl.Grants)
+}
+
+func Test_LifecycleConfigValidate(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, r.URL.RawQuery+" "+string(body))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	rule := func(id string, days float64) LifecycleRule {
+		return LifecycleRule{
+			ID:      id,
+			Prefix:  "tmp/",
+			Enabled: true,
+			Action: LifecycleAction{
+				Expiration:                     LifecycleBaseItem{Days: days},
+				AbortIncompleteMultipartUpload: LifecycleBaseItem{Days: 1},
+			},
+		}
+	}
+
+	err := client.SetLifecycleConfig("bucket", &LifecycleConfig{Rules: []LifecycleRule{rule("1", 7), rule("1", 3)}})
+	assert.True(t, errors.Is(err, ErrorLifecycleDuplicateRuleID))
+	err = client.SetLifecycleConfig("bucket", &LifecycleConfig{Rules: []LifecycleRule{rule("1", 0)}})
+	assert.True(t, errors.Is(err, ErrorLifecycleDaysNotPositive))
+	r := rule("2", -1)
+	assert.True(t, errors.Is(client.SetLifecycleRule("bucket", &r), ErrorLifecycleDaysNotPositive))
+	assert.Equal(t, 0, len(bodies))
+
+	assert.Nil(t, client.SetLifecycleConfig("bucket", &LifecycleConfig{Rules: []LifecycleRule{rule("1", 7), rule("", 3), rule("", 3)}}))
+	assert.Nil(t, client.DeleteLifecycleConfig("bucket"))
+	assert.Equal(t, 2, len(bodies))
+	assert.Contains(t, bodies[0], `"abortIncompleteMultipartUpload":{"days":1}`)
+	assert.Equal(t, `lifecycle= {"rules":[]}`, bodies[1])
+
+	bodies = nil
+	r = rule("3", 0)
+	r.Action[Expiration] = LifecycleBaseItem{Days: 7, Date: "2030-01-01"}
+	assert.True(t, errors.Is(client.SetLifecycleRule("bucket", &r), ErrorLifecycleDaysAndDate))
+	r.Action[Expiration] = LifecycleBaseItem{Date: "01/01/2030"}
+	assert.True(t, errors.Is(client.SetLifecycleRule("bucket", &r), ErrorLifecycleDateInvalid))
+	assert.Equal(t, 0, len(bodies))
+
+	r.Action[Expiration] = NewLifecycleDateItem(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, client.SetLifecycleConfig("bucket", &LifecycleConfig{Rules: []LifecycleRule{r}}))
+	assert.Contains(t, bodies[0], `"expiration":{"date":"2030-01-01"}`)
+
+	config, err := NewLifecycleConfigFromJSON([]byte(`{"rules":[{"id":"1","enabled":true,"actions":{"expiration":{"date":"2030-01-01"}}}]}`))
+	assert.Nil(t, err)
+	assert.Nil(t, config.Validate())
+	assert.Equal(t, "2030-01-01", config.Rules[0].Action[Expiration].Date)
+}
+
+func Test_BucketCORS(t *testing.T) {
+	var requests []string
+	var bodies []string
+	stored := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			stored = string(body)
+		case http.MethodDelete:
+			stored = ""
+		default:
+			if stored == "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(stored))
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(server)
+
+	invalids := []struct {
+		rule CORSRule
+		err  error
+	}{
+		{CORSRule{AllowedMethods: []string{"GET"}}, ErrorCORSOriginRequired},
+		{CORSRule{AllowedOrigins: []string{"*"}}, ErrorCORSMethodInvalid},
+		{CORSRule{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET", "PATCH"}}, ErrorCORSMethodInvalid},
+	}
+	for _, invalid := range invalids {
+		assert.True(t, errors.Is(invalid.rule.Validate(), invalid.err))
+		assert.True(t, errors.Is(client.AddBucketCORSRule("bucket", invalid.rule), invalid.err))
+		assert.True(t, errors.Is(client.PutBucketCORS("bucket", &CORSConfig{Rules: []CORSRule{invalid.rule}}), invalid.err))
+	}
+	assert.Empty(t, requests)
+
+	// no config yet, the rule is added to an empty one
+	first := CORSRule{AllowedOrigins: []string{"https://a.com"}, AllowedMethods: []string{"PUT", "POST"}, MaxAgeSeconds: 600}
+	assert.Nil(t, client.AddBucketCORSRule("bucket", first))
+	assert.Equal(t, []string{"GET /bucket?cors=", "PUT /bucket?cors="}, requests)
+	assert.JSONEq(t, `{"rules":[{"allowedOrigins":["https://a.com"],"allowedMethods":["PUT","POST"],"maxAgeSeconds":600}]}`, bodies[0])
+
+	second := CORSRule{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}, ExposedHeaders: []string{"ETag"}}
+	assert.Nil(t, client.AddBucketCORSRule("bucket", second))
+	config, err := client.GetBucketCORS("bucket")
+	assert.Nil(t, err)
+	assert.Equal(t, []CORSRule{first, second}, config.Rules)
+
+	requests = nil
+	assert.Nil(t, client.DeleteBucketCORS("bucket"))
+	assert.Equal(t, []string{"DELETE /bucket?cors="}, requests)
+	_, err = client.GetBucketCORS("bucket")
+	assert.True(t, IsNotFound(err))
+}
+
+type recordingLogger struct {
+	debugs []string
+}
+
+func (l *recordingLogger) Debug(args ...interface{}) {
+	l.debugs = append(l.debugs, fmt.Sprint(args...))
+}
+func (l *recordingLogger) Info(args ...interface{})  {}
+func (l *recordingLogger) Warn(args ...interface{})  {}
+func (l *recordingLogger) Error(args ...interface{}) {}
+
+func Test_ClientSetLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := newTestClient(server)
+	assert.Equal(t, nopLogger{}, client.logger)
+
+	logger := &recordingLogger{}
+	client.SetLogger(logger)
+	assert.Nil(t, client.DeleteObject("bucket", "object"))
+	assert.Contains(t, logger.debugs, " >>> HTTP URL: "+server.URL+"/bucket/object")
+
+	client.SetLogger(nil)
+	assert.Equal(t, nopLogger{}, client.logger)
+}
+
+func Test_Tags(t *testing.T) {
+	tags := Tags{}
+	tags.Set("team", "storage")
+	tags.Set("cost center", "a&b")
+	tags.Set("team", "fds")
+	assert.Equal(t, Tags{{"team", "fds"}, {"cost center", "a&b"}}, tags)
+	assert.Equal(t, "team=fds&cost+center=a%26b", tags.String())
+
+	value, ok := tags.Get("team")
+	assert.True(t, ok)
+	assert.Equal(t, "fds", value)
+	tags.Delete("team")
+	_, ok = tags.Get("team")
+	assert.False(t, ok)
+	assert.Nil(t, tags.Validate())
+
+	invalids := []struct {
+		tags Tags
+		err  error
+	}{
+		{Tags{{"", "v"}}, ErrorTagKeyInvalid},
+		{Tags{{strings.Repeat("k", MaxTagKeyLength+1), "v"}}, ErrorTagKeyInvalid},
+		{Tags{{"k", strings.Repeat("v", MaxTagValueLength+1)}}, ErrorTagValueTooLong},
+		{Tags{{"k", "1"}, {"k", "2"}}, ErrorTagKeyDuplicated},
+	}
+	for _, invalid := range invalids {
+		assert.True(t, errors.Is(invalid.tags.Validate(), invalid.err))
+	}
+
+	many := Tags{}
+	for i := 0; i <= MaxObjectTags; i++ {
+		many.Set(fmt.Sprintf("k%d", i), "v")
+	}
+	assert.True(t, errors.Is(many.Validate(), ErrorTagsTooMany))
+	assert.Nil(t, many.validate(MaxBucketTags))
+}
+
+func Test_Tagging(t *testing.T) {
+	var requests []string
+	var bodies []string
+	var tagging string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		tagging = r.Header.Get(HTTPHeaderTagging)
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("withTags") != "":
+			w.Write([]byte(`{"name":"bucket","truncated":true,"nextMarker":"a",` +
+				`"objects":[{"name":"a","tags":[{"key":"team","value":"fds"}]}]}`))
+		case r.Method == http.MethodGet:
+			w.Write([]byte(`{"tags":[{"key":"team","value":"fds"},{"key":"env","value":"test"}]}`))
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	tags, err := client.GetObjectTagging("bucket", "object")
+	assert.Nil(t, err)
+	assert.Equal(t, Tags{{"team", "fds"}, {"env", "test"}}, tags)
+	assert.Nil(t, client.PutObjectTagging("bucket", "object", tags))
+	assert.Nil(t, client.DeleteObjectTagging("bucket", "object"))
+	assert.Nil(t, client.PutBucketTagging("bucket", nil))
+	tags, err = client.GetBucketTagging("bucket")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tags))
+	assert.Nil(t, client.DeleteBucketTagging("bucket"))
+	assert.Equal(t, []string{
+		"GET /bucket/object?tagging=",
+		"PUT /bucket/object?tagging=",
+		"DELETE /bucket/object?tagging=",
+		"PUT /bucket?tagging=",
+		"GET /bucket?tagging=",
+		"DELETE /bucket?tagging=",
+	}, requests)
+	assert.Equal(t, `{"tags":[{"key":"team","value":"fds"},{"key":"env","value":"test"}]}`, bodies[1])
+	assert.Equal(t, `{"tags":[]}`, bodies[3])
+
+	many := Tags{}
+	for i := 0; i <= MaxObjectTags; i++ {
+		many.Set(fmt.Sprintf("k%d", i), "v")
+	}
+	requests = nil
+	assert.True(t, errors.Is(client.PutObjectTagging("bucket", "object", many), ErrorTagsTooMany))
+	_, err = client.PutObject(&PutObjectRequest{BucketName: "bucket", ObjectName: "object", Tags: many})
+	assert.True(t, errors.Is(err, ErrorTagsTooMany))
+	assert.Equal(t, 0, len(requests))
+	assert.Nil(t, client.PutBucketTagging("bucket", many))
+
+	_, err = client.PutObject(&PutObjectRequest{BucketName: "bucket", ObjectName: "object", Tags: Tags{{"team", "fds"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, "team=fds", tagging)
+	_, err = client.InitMultipartUpload(&InitMultipartUploadRequest{BucketName: "bucket", ObjectName: "object", Tags: Tags{{"env", "test"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, "env=test", tagging)
+
+	requests = nil
+	listing, err := client.ListObjects(&ListObjectsRequest{BucketName: "bucket", MaxKeys: 1, WithTags: true})
+	assert.Nil(t, err)
+	assert.Equal(t, Tags{{"team", "fds"}}, listing.ObjectSummaries[0].Tags)
+	_, err = client.ListObjectsNextBatch(listing)
+	assert.Nil(t, err)
+	for _, request := range requests {
+		assert.Contains(t, request, "withTags=true")
+	}
+}
+
+func Test_ObjectVersionID(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	body, err := client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "object", VersionID: "v1"})
+	assert.Nil(t, err)
+	body.Close()
+	_, err = client.GetObjectVersionMetadata("bucket", "object", "v1")
+	assert.Nil(t, err)
+	assert.Nil(t, client.DeleteObjectVersion("bucket", "object", "v1"))
+	_, err = client.GetObjectMetadata("bucket", "object")
+	assert.Nil(t, err)
+	assert.Nil(t, client.DeleteObject("bucket", "object"))
+	assert.Equal(t, []string{
+		"GET /bucket/object?versionId=v1",
+		"GET /bucket/object?metadata=&versionId=v1",
+		"DELETE /bucket/object?versionId=v1",
+		"GET /bucket/object?metadata=",
+		"DELETE /bucket/object",
+	}, requests)
+}
+
+func Test_MultipartListings(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		q := r.URL.Query()
+		switch {
+		case q.Get("uploadId") != "" && q.Get("partNumberMarker") == "":
+			w.Write([]byte(`{"maxParts":2,"truncated":true,"nextPartNumberMarker":2,"parts":[
+				{"partNumber":1,"etag":"e1","partSize":5,"lastModified":"2018-10-01T00:00:00Z"},
+				{"partNumber":2,"etag":"e2","partSize":5,"lastModified":"2018-10-01T00:00:00Z"}]}`))
+		case q.Get("uploadId") != "":
+			w.Write([]byte(`{"maxParts":2,"parts":[{"partNumber":3,"etag":"e3","partSize":1}]}`))
+		case q.Get("keyMarker") == "":
+			w.Write([]byte(`{"maxUploads":1,"truncated":true,"nextKeyMarker":"a","nextUploadIdMarker":"u1",
+				"uploads":[{"objectName":"a","uploadId":"u1","initiated":"2018-10-01T00:00:00Z","initiator":{"id":"alice"}}]}`))
+		default:
+			w.Write([]byte(`{"maxUploads":1,"uploads":[{"objectName":"b","uploadId":"u2"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	parts, err := client.ListParts("bucket", "object", "u1", 0, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "u1", parts.UploadID)
+	assert.True(t, parts.Truncated)
+	assert.Equal(t, PartSummary{
+		PartNumber:   2,
+		ETag:         "e2",
+		PartSize:     5,
+		LastModified: time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC),
+	}, parts.Parts[1])
+
+	parts, err = client.ListPartsNextBatch(parts)
+	assert.Nil(t, err)
+	assert.False(t, parts.Truncated)
+	assert.Equal(t, 3, parts.Parts[0].PartNumber)
+
+	uploads, err := client.ListMultipartUploads("bucket", "", "", "", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "bucket", uploads.BucketName)
+	assert.Equal(t, "alice", uploads.Uploads[0].Initiator.ID)
+	assert.True(t, time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC).Equal(uploads.Uploads[0].Initiated))
+
+	uploads, err = client.ListMultipartUploadsNextBatch(uploads)
+	assert.Nil(t, err)
+	assert.Equal(t, "u2", uploads.Uploads[0].UploadID)
+
+	upload := uploads.Uploads[0]
+	assert.Nil(t, client.AbortMultipartUpload(&InitMultipartUploadResponse{
+		BucketName: uploads.BucketName,
+		ObjectName: upload.ObjectName,
+		UploadID:   upload.UploadID,
+	}))
+
+	assert.Equal(t, []string{
+		"GET /bucket/object?maxParts=2&uploadId=u1",
+		"GET /bucket/object?maxParts=2&partNumberMarker=2&uploadId=u1",
+		"GET /bucket?maxUploads=1&prefix=&uploads=",
+		"GET /bucket?keyMarker=a&maxUploads=1&prefix=&uploadIdMarker=u1&uploads=",
+		"DELETE /bucket/b?uploadId=u2",
+	}, requests)
+}
+
+func Test_RestoreArchivedObject(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.RequestURI()+" "+string(body))
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errorCode":"ObjectArchived"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	assert.Equal(t, ErrorRestoreDaysNotPositive, client.RestoreArchivedObject("bucket", "object", 0))
+	assert.Nil(t, client.RestoreArchivedObject("bucket", "object", 3))
+	_, err := client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "object"})
+	assert.True(t, IsObjectArchived(err))
+	assert.True(t, IsAccessDenied(err))
+	assert.Equal(t, []string{
+		`PUT /bucket/object?restore= {"days":3}`,
+		`GET /bucket/object `,
+	}, requests)
+
+	assert.False(t, IsObjectArchived(&ServerError{StatusCode: http.StatusForbidden, ErrorCode: "AccessDenied"}))
+}
+
+func Test_GetRestoreStatus(t *testing.T) {
+	metadata := NewObjectMetadata()
+	_, err := metadata.GetRestoreStatus()
+	assert.True(t, errors.Is(err, ErrorMetadataNotFound))
+
+	metadata.Set(HTTPHeaderRestore, `ongoing-request="true"`)
+	status, err := metadata.GetRestoreStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, &RestoreStatus{Ongoing: true}, status)
+
+	metadata.Set(HTTPHeaderRestore, `ongoing-request="false", expiry-date="Fri, 23 Dec 2012 00:00:00 GMT"`)
+	status, err = metadata.GetRestoreStatus()
+	assert.Nil(t, err)
+	assert.False(t, status.Ongoing)
+	assert.Equal(t, time.Date(2012, 12, 23, 0, 0, 0, 0, time.UTC), status.Expiry)
+
+	metadata.Set(HTTPHeaderRestore, `ongoing-request="false", expiry-date="tomorrow"`)
+	_, err = metadata.GetRestoreStatus()
+	assert.True(t, errors.Is(err, ErrorMetadataInvalid))
+}
+
+func Test_GetObjectRange(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get(HTTPHeaderRange))
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	cases := []struct {
+		start, end int64
+		header     string
+		want       ContentRange
+	}{
+		{10, 19, "bytes=10-19", ContentRange{10, 19, 100}},
+		{90, -1, "bytes=90-", ContentRange{90, 99, 100}},
+		{-5, -1, "bytes=-5", ContentRange{95, 99, 100}},
+		{0, 0, "bytes=0-0", ContentRange{0, 0, 100}},
+	}
+	for _, c := range cases {
+		body, metadata, err := client.GetObjectRangeWithMetadata("bucket", "object", c.start, c.end)
+		assert.Nil(t, err)
+		data, _ := ioutil.ReadAll(body)
+		body.Close()
+		assert.Equal(t, content[c.want.Start:c.want.End+1], string(data))
+		assert.Equal(t, c.header, ranges[len(ranges)-1])
+
+		r, err := metadata.GetContentRange()
+		assert.Nil(t, err)
+		assert.Equal(t, &c.want, r)
+	}
+
+	_, err := client.GetObjectRange("bucket", "object", 20, 10)
+	assert.True(t, errors.Is(err, ErrorRangeInvalid))
+	_, err = client.GetObjectRange("bucket", "object", -5, 10)
+	assert.True(t, errors.Is(err, ErrorRangeInvalid))
+	assert.Equal(t, len(cases), len(ranges))
+
+	metadata := NewObjectMetadata()
+	_, err = metadata.GetContentRange()
+	assert.True(t, errors.Is(err, ErrorMetadataNotFound))
+	metadata.Set(HTTPHeaderContentRange, "bytes 0-9/*")
+	r, err := metadata.GetContentRange()
+	assert.Nil(t, err)
+	assert.Equal(t, &ContentRange{0, 9, -1}, r)
+	for _, v := range []string{"bytes 9-0/10", "bytes 0-9/9", "bytes */10", "0-9/10"} {
+		metadata.Set(HTTPHeaderContentRange, v)
+		_, err = metadata.GetContentRange()
+		assert.True(t, errors.Is(err, ErrorMetadataInvalid), v)
+	}
+}
+
+func Test_StorageClass(t *testing.T) {
+	var classes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		classes = append(classes, r.Header.Get(HTTPHeaderStorageClass))
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"objects":[{"name":"a","storageClass":"ARCHIVE"},{"name":"b"}]}`))
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	_, err := client.PutObject(&PutObjectRequest{BucketName: "bucket", ObjectName: "object", StorageClass: StorageClassArchive})
+	assert.Nil(t, err)
+	_, err = client.InitMultipartUpload(&InitMultipartUploadRequest{BucketName: "bucket", ObjectName: "object", StorageClass: StorageClassInfrequentAccess})
+	assert.Nil(t, err)
+	_, err = client.PutObject(&PutObjectRequest{BucketName: "bucket", ObjectName: "object"})
+	assert.Nil(t, err)
+	_, err = client.PutObject(&PutObjectRequest{BucketName: "bucket", ObjectName: "object", StorageClass: "standard"})
+	assert.True(t, errors.Is(err, ErrorStorageClassInvalid))
+	_, err = client.InitMultipartUpload(&InitMultipartUploadRequest{BucketName: "bucket", ObjectName: "object", StorageClass: "COLD"})
+	assert.True(t, errors.Is(err, ErrorStorageClassInvalid))
+	assert.Equal(t, []string{"ARCHIVE", "STANDARD_IA", ""}, classes)
+
+	listing, err := client.ListObjects(&ListObjectsRequest{BucketName: "bucket"})
+	assert.Nil(t, err)
+	assert.Equal(t, StorageClassArchive, listing.ObjectSummaries[0].StorageClass)
+	assert.Equal(t, StorageClass(""), listing.ObjectSummaries[1].StorageClass)
+
+	metadata := NewObjectMetadata()
+	assert.Equal(t, StorageClass(""), metadata.GetStorageClass())
+	metadata.Set(HTTPHeaderStorageClass, "ARCHIVE")
+	assert.Equal(t, StorageClassArchive, metadata.GetStorageClass())
+}
+
+func Test_GetObjectWithResult(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HTTPHeaderETag, "etag")
+		w.Header().Set(HTTPHeaderContentType, "text/plain")
+		w.Header().Set(XiaomiMetaPrefix+"Owner", "alice")
+		w.Header().Set(HTTPHeaderContentMetadataLength, "100")
+		http.ServeContent(w, r, "", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	result, err := client.GetObjectWithResult(&GetObjectRequest{BucketName: "bucket", ObjectName: "object"})
+	assert.Nil(t, err)
+	data, _ := ioutil.ReadAll(result.Body)
+	result.Body.Close()
+	assert.Equal(t, content, string(data))
+	assert.Equal(t, int64(100), result.ContentLength)
+	assert.Equal(t, "text/plain", result.ContentType)
+	assert.Equal(t, "etag", result.ETag)
+	assert.Equal(t, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), result.LastModified)
+	assert.Nil(t, result.ContentRange)
+	assert.Equal(t, map[string]string{"owner": "alice"}, result.UserMetadata)
+
+	request := &GetObjectRequest{BucketName: "bucket", ObjectName: "object"}
+	assert.Nil(t, request.SetRange(10, 19))
+	result, err = client.GetObjectWithResult(request)
+	assert.Nil(t, err)
+	result.Body.Close()
+	assert.Equal(t, int64(10), result.ContentLength)
+	assert.Equal(t, &ContentRange{10, 19, 100}, result.ContentRange)
+}
+
+func Test_GetObjectBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bucket/small":
+			w.Write([]byte("small"))
+		case "/bucket/chunked":
+			// without Content-Length the body is checked as it is read
+			w.Write([]byte("0123456789"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("0123456789"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+	assert.Equal(t, int64(DefaultMaxGetObjectBytes), client.Configuration.MaxGetObjectBytes)
+
+	data, err := client.GetObjectBytes("bucket", "small")
+	assert.Nil(t, err)
+	assert.Equal(t, "small", string(data))
+
+	client.Configuration.MaxGetObjectBytes = 5
+	data, err = client.GetObjectBytes("bucket", "small")
+	assert.Nil(t, err)
+	assert.Equal(t, "small", string(data))
+
+	client.Configuration.MaxGetObjectBytes = 4
+	_, err = client.GetObjectBytes("bucket", "small")
+	assert.True(t, errors.Is(err, ErrorObjectTooLarge), err)
+
+	client.Configuration.MaxGetObjectBytes = 15
+	_, err = client.GetObjectBytes("bucket", "chunked")
+	assert.True(t, errors.Is(err, ErrorObjectTooLarge), err)
+
+	client.Configuration.MaxGetObjectBytes = 0
+	data, err = client.GetObjectBytes("bucket", "chunked")
+	assert.Nil(t, err)
+	assert.Equal(t, 20, len(data))
+
+	_, err = client.GetObjectBytes("bucket", "missing")
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrorObjectTooLarge))
+}
+
+func Test_ConditionalGet(t *testing.T) {
+	lastModified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header)
+		w.Header().Set(HTTPHeaderETag, `"etag"`)
+		http.ServeContent(w, r, "", lastModified, strings.NewReader("content"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	_, err := client.GetObject(&GetObjectRequest{
+		BucketName: "bucket",
+		ObjectName: "object",
+		Conditions: Conditions{IfNoneMatch: `"etag"`},
+	})
+	assert.True(t, errors.Is(err, ErrorNotModified))
+	assert.True(t, IsNotModified(err))
+
+	_, err = client.GetObject(&GetObjectRequest{
+		BucketName: "bucket",
+		ObjectName: "object",
+		Conditions: Conditions{IfMatch: `"other"`},
+	})
+	assert.True(t, errors.Is(err, ErrorPreconditionFailed))
+	assert.True(t, IsPreconditionFailed(err))
+
+	_, err = client.GetObjectMetadataWithConditions("bucket", "object", Conditions{IfModifiedSince: lastModified})
+	assert.True(t, errors.Is(err, ErrorNotModified))
+
+	_, err = client.GetObjectMetadataWithConditions("bucket", "object", Conditions{IfUnmodifiedSince: lastModified.Add(-time.Hour)})
+	assert.True(t, errors.Is(err, ErrorPreconditionFailed))
+
+	body, err := client.GetObject(&GetObjectRequest{
+		BucketName: "bucket",
+		ObjectName: "object",
+		Conditions: Conditions{IfModifiedSince: lastModified.Add(-time.Hour)},
+	})
+	assert.Nil(t, err)
+	body.Close()
+
+	assert.Equal(t, `"etag"`, headers[0].Get("If-None-Match"))
+	assert.Equal(t, `"other"`, headers[1].Get("If-Match"))
+	assert.Equal(t, "Thu, 02 Jan 2020 03:04:05 GMT", headers[2].Get("If-Modified-Since"))
+	assert.Equal(t, "Thu, 02 Jan 2020 02:04:05 GMT", headers[3].Get("If-Unmodified-Since"))
+	assert.Empty(t, headers[4].Get("If-Match"))
+	assert.Empty(t, headers[4].Get("If-Unmodified-Since"))
+
+	assert.False(t, errors.Is(&ServerError{StatusCode: http.StatusNotFound}, ErrorNotModified))
+}
+
+// urlRecorder records the requests and answers them with an empty JSON
+type urlRecorder struct {
+	requests []*http.Request
+}
+
+func (recorder *urlRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder.requests = append(recorder.requests, req)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+func Test_AddressingStyle(t *testing.T) {
+	newClient := func(virtualHost bool) (*Client, *urlRecorder) {
+		conf := NewClientConfigurationWithRegion("gateway.internal:8080", "internal")
+		conf.EnableHTTPS = false
+		conf.VirtualHostStyle = virtualHost
+		client := New("ak", "sk", conf)
+		client.clock = &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		recorder := &urlRecorder{}
+		client.httpClient.Transport = recorder
+		return client, recorder
+	}
+
+	pathStyle, pathRecorder := newClient(false)
+	virtualHost, virtualRecorder := newClient(true)
+	assert.Equal(t, "internal", virtualHost.Configuration.RegionName())
+	assert.Equal(t, "cdn.internal"+URLCDNSuffix, virtualHost.Configuration.CDNEndpoint())
+
+	for _, c := range []*Client{pathStyle, virtualHost} {
+		body, err := c.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "dir/a b", Range: "bytes=0-9"})
+		assert.Nil(t, err)
+		body.Close()
+		_, err = c.ListObjects(&ListObjectsRequest{BucketName: "bucket", Prefix: "dir/"})
+		assert.Nil(t, err)
+		_, err = c.GetBucketACL("bucket")
+		assert.Nil(t, err)
+	}
+
+	var pathURLs, virtualURLs []string
+	for i := range pathRecorder.requests {
+		pathURLs = append(pathURLs, pathRecorder.requests[i].URL.String())
+		virtualURLs = append(virtualURLs, virtualRecorder.requests[i].URL.String())
+
+		// both styles sign the same canonical resource
+		assert.Equal(t, pathRecorder.requests[i].Header.Get(HTTPHeaderAuthorization),
+			virtualRecorder.requests[i].Header.Get(HTTPHeaderAuthorization))
+	}
+	assert.Equal(t, []string{
+		"http://gateway.internal:8080/bucket/dir/a%20b",
+		"http://gateway.internal:8080/bucket?delimiter=&maxKeys=0&prefix=dir%2F",
+		"http://gateway.internal:8080/bucket?acl=",
+	}, pathURLs)
+	assert.Equal(t, []string{
+		"http://bucket.gateway.internal:8080/dir/a%20b",
+		"http://bucket.gateway.internal:8080/?delimiter=&maxKeys=0&prefix=dir%2F",
+		"http://bucket.gateway.internal:8080/?acl=",
+	}, virtualURLs)
+
+	pathPresigned, err := pathStyle.GeneratePresignedURL(&GeneratePresignedURLRequest{
+		BucketName: "bucket", ObjectName: "object", Method: HTTPGet, Expiration: time.Unix(1600000000, 0),
+	})
+	assert.Nil(t, err)
+	virtualPresigned, err := virtualHost.GeneratePresignedURL(&GeneratePresignedURLRequest{
+		BucketName: "bucket", ObjectName: "object", Method: HTTPGet, Expiration: time.Unix(1600000000, 0),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "bucket.gateway.internal:8080", virtualPresigned.Host)
+	assert.Equal(t, "/object", virtualPresigned.Path)
+	assert.Equal(t, pathPresigned.RawQuery, virtualPresigned.RawQuery)
+}
+
+func Test_GetObjectURL(t *testing.T) {
+	conf, err := NewClientConfiguration("cnbj1.fds.api.xiaomi.com")
+	assert.Nil(t, err)
+	client := New("ak", "sk", conf)
+
+	names := []string{"object", "a/b c+d#e?.txt", "dir/", "目录/文件 1.jpg", "100%/x&y=z"}
+	for _, name := range names {
+		for _, opts := range []URLOptions{{}, {CDN: true}, {Internal: true}, {Scheme: "http"}} {
+			u, err := url.Parse(client.GetObjectURL("bucket", name, opts))
+			assert.Nil(t, err)
+			assert.Equal(t, "/bucket/"+name, u.Path, name)
+			assert.Empty(t, u.RawQuery)
+			assert.Empty(t, u.Fragment)
+		}
+	}
+
+	assert.Equal(t, "https://cnbj1.fds.api.xiaomi.com/bucket/a/b%20c%2Bd%23e%3F.txt",
+		client.GetObjectURL("bucket", "a/b c+d#e?.txt", URLOptions{}))
+	assert.Equal(t, "https://cdn.cnbj1.fds.api.mi-img.com/bucket/object",
+		client.GetObjectURL("bucket", "object", URLOptions{CDN: true}))
+	assert.Equal(t, "http://cnbj1-fds.api.xiaomi.net/bucket/object",
+		client.GetObjectURL("bucket", "object", URLOptions{Internal: true, Scheme: "http"}))
+
+	conf.VirtualHostStyle = true
+	assert.Equal(t, "https://bucket.cnbj1.fds.api.xiaomi.com/a/b%20c%2Bd%23e%3F.txt",
+		client.GetObjectURL("bucket", "a/b c+d#e?.txt", URLOptions{}))
+	assert.Equal(t, "https://cdn.cnbj1.fds.api.mi-img.com/bucket/object",
+		client.GetObjectURL("bucket", "object", URLOptions{CDN: true}))
+}
+
+func Test_GetObjectURLRoundTrip(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer server.Close()
+	client := newTestClient(server)
+
+	names := []string{"a/b c+d#e?.txt", "目录/文件 1.jpg", "100%/x&y=z"}
+	for _, name := range names {
+		resp, err := http.Get(client.GetObjectURL("bucket", name, URLOptions{}))
+		assert.Nil(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, []string{"/bucket/a/b c+d#e?.txt", "/bucket/目录/文件 1.jpg", "/bucket/100%/x&y=z"}, paths)
+}
+
+func Test_ObjectNameEncoding(t *testing.T) {
+	type received struct {
+		path, escapedPath string
+		signed            bool
+	}
+	var requests []received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server signs what it receives the same way
+		sig, err := signature(sha1.New, "sk", HTTPMethod(r.Method), "http://"+r.Host+r.RequestURI, r.Header)
+		assert.Nil(t, err)
+		requests = append(requests, received{
+			path:        r.URL.Path,
+			escapedPath: r.URL.EscapedPath(),
+			signed:      r.Header.Get(HTTPHeaderAuthorization) == "Galaxy-V2 ak:"+sig,
+		})
+		w.Header().Set(HTTPHeaderContentMetadataLength, "0")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+	client := newTestClient(server)
+
+	cases := []struct {
+		name    string
+		escaped string
+	}{
+		{"plain.txt", "plain.txt"},
+		{"a b", "a%20b"},
+		{"a+b", "a%2Bb"},
+		{"a#b", "a%23b"},
+		{"a?b=c&d", "a%3Fb%3Dc%26d"},
+		{"100%", "100%25"},
+		{"dir/sub dir/file", "dir/sub%20dir/file"},
+		{"semi;colon,comma", "semi%3Bcolon%2Ccomma"},
+		{"中文/文件.txt", "%E4%B8%AD%E6%96%87/%E6%96%87%E4%BB%B6.txt"},
+		{"~tilde_-.", "~tilde_-."},
+		{"a//b", "a//b"},
+	}
+	for _, c := range cases {
+		requests = nil
+		_, err := client.PutObject(&PutObjectRequest{BucketName: "bucket", ObjectName: c.name, Data: strings.NewReader("x")})
+		assert.Nil(t, err)
+		body, err := client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: c.name})
+		assert.Nil(t, err)
+		body.Close()
+		_, err = client.GetObjectMetadata("bucket", c.name)
+		assert.Nil(t, err)
+		assert.Nil(t, client.DeleteObject("bucket", c.name))
+
+		assert.Equal(t, 4, len(requests), c.name)
+		for _, r := range requests {
+			assert.Equal(t, "/bucket/"+c.name, r.path, c.name)
+			assert.Equal(t, "/bucket/"+c.escaped, r.escapedPath, c.name)
+			assert.True(t, r.signed, c.name)
+		}
+	}
+}
+
+func Test_HTTPClientConfiguration(t *testing.T) {
+	conf, err := NewClientConfiguration("cnbj1.fds.api.xiaomi.com")
+	assert.Nil(t, err)
+	transport := conf.newHTTPClient().Transport.(*http.Transport)
+	assert.Equal(t, 20, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 100, transport.MaxIdleConns)
+	assert.Equal(t, 60*time.Second, transport.ResponseHeaderTimeout)
+	assert.Equal(t, 10*time.Second, transport.TLSHandshakeTimeout)
+	assert.Equal(t, 50*time.Second, transport.IdleConnTimeout)
+
+	// the requests go through the proxy
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	conf.EnableHTTPS = false
+	conf.Proxy = http.ProxyURL(proxyURL)
+	_, err = New("ak", "sk", conf).GetObjectMetadata("bucket", "object")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"http://cnbj1.fds.api.xiaomi.com/bucket/object?metadata="}, proxied)
+
+	// a private endpoint with a custom CA
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	conf = NewClientConfigurationWithRegion(strings.TrimPrefix(server.URL, "https://"), "private")
+	conf.TLSConfig = &tls.Config{RootCAs: pool}
+	_, err = New("ak", "sk", conf).GetObjectMetadata("bucket", "object")
+	assert.Nil(t, err)
+
+	conf.TLSConfig = nil
+	_, err = New("ak", "sk", conf).GetObjectMetadata("bucket", "object")
+	assert.NotNil(t, err)
+
+	// the given client is used as-is
+	httpClient := &http.Client{}
+	conf.HTTPClient = httpClient
+	assert.True(t, New("ak", "sk", conf).httpClient == httpClient)
+}
+
+func Test_Interceptors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("X-Attempt", strconv.Itoa(attempts))
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+	client.Configuration.RetryPolicy = DefaultRetryPolicy()
+	client.clock = &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	var calls []string
+	client.AddRequestInterceptor(func(req *http.Request) error {
+		calls = append(calls, "request 1")
+		assert.NotEmpty(t, req.Header.Get(HTTPHeaderAuthorization))
+		req.Header.Set("X-Audit", "audit")
+		return nil
+	})
+	client.AddRequestInterceptor(func(req *http.Request) error {
+		calls = append(calls, "request 2 "+req.Header.Get("X-Audit"))
+		return nil
+	})
+	client.AddResponseInterceptor(func(resp *http.Response) error {
+		calls = append(calls, "response "+resp.Header.Get("X-Attempt"))
+		return nil
+	})
+
+	_, err := client.GetObjectMetadata("bucket", "object")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"request 1", "request 2 audit", "response 1",
+		"request 1", "request 2 audit", "response 2",
+	}, calls)
+
+	// an error stops the request and is not retried
+	denied := errors.New("denied")
+	calls = nil
+	client.AddRequestInterceptor(func(req *http.Request) error {
+		return denied
+	})
+	_, err = client.GetObjectMetadata("bucket", "object")
+	assert.True(t, errors.Is(err, denied))
+	assert.Equal(t, []string{"request 1", "request 2 audit"}, calls)
+	assert.Equal(t, 2, attempts)
+
+	client.requestInterceptors = nil
+	client.AddResponseInterceptor(func(resp *http.Response) error {
+		return denied
+	})
+	_, err = client.GetObjectMetadata("bucket", "object")
+	assert.True(t, errors.Is(err, denied))
+	assert.Equal(t, 3, attempts)
+}
+
+func Test_DebugTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HTTPHeaderRequestID, "request-1")
+		if r.Method == http.MethodPut {
+			w.Header().Set(HTTPHeaderContentType, "application/json")
+			w.Write([]byte(`{"bucketName":"bucket","objectName":"object"}`))
+			return
+		}
+		w.Header().Set(HTTPHeaderContentType, "application/octet-stream")
+		w.Write([]byte("binary"))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	conf, _ := NewClientConfiguration(u.Host)
+	conf.EnableHTTPS = false
+	conf.Debug = DebugBody
+	client := New("ak", "sk", conf)
+	logger := &recordingLogger{}
+	client.SetLogger(logger)
+
+	_, err := client.PutObject(&PutObjectRequest{
+		BucketName:  "bucket",
+		ObjectName:  "object",
+		ContentType: "text/plain",
+		Data:        strings.NewReader(strings.Repeat("a", MaxDebugBodySize+1)),
+	})
+	assert.Nil(t, err)
+	body, err := client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "object"})
+	assert.Nil(t, err)
+	ioutil.ReadAll(body)
+	body.Close()
+
+	logs := strings.Join(logger.debugs, "\n")
+	assert.Contains(t, logs, "--> PUT "+server.URL+"/bucket/object")
+	assert.Contains(t, logs, "Authorization: "+debugRedacted)
+	assert.NotContains(t, logs, "Galaxy-V2 ak:")
+	assert.Contains(t, logs, "<-- PUT "+server.URL+"/bucket/object 200 request-id=request-1")
+	assert.Contains(t, logs, "--> PUT "+server.URL+"/bucket/object body: "+strings.Repeat("a", MaxDebugBodySize)+"...(truncated)")
+	assert.Contains(t, logs, `<-- PUT `+server.URL+`/bucket/object body: {"bucketName":"bucket","objectName":"object"}`)
+	assert.Contains(t, logs, "<-- GET "+server.URL+"/bucket/object 200 request-id=request-1")
+	assert.NotContains(t, logs, "binary")
+
+	presigned := &url.URL{Scheme: "http", Host: "fds", Path: "/bucket/object", RawQuery: "GalaxyAccessKeyId=ak&Signature=secret"}
+	assert.Equal(t, "http://fds/bucket/object?GalaxyAccessKeyId=ak&Signature="+debugRedacted, redactURL(presigned))
+
+	os.Setenv(DebugEnvironment, "wire")
+	defer os.Unsetenv(DebugEnvironment)
+	assert.Equal(t, DebugWire, debugLevelOf(nil))
+	assert.Equal(t, DebugBody, debugLevelOf(conf))
+	os.Setenv(DebugEnvironment, "")
+	assert.Equal(t, DebugOff, debugLevelOf(nil))
+	_, ok := New("ak", "sk", nil).httpClient.Transport.(*debugTransport)
+	assert.False(t, ok)
+}
+
+func Test_ContextRequestHeaders(t *testing.T) {
+	var mu sync.Mutex
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		headers = append(headers, r.Header)
+		if len(headers)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+	client.Configuration.RetryPolicy = DefaultRetryPolicy()
+	client.Configuration.UserAgent = "billing/1.2"
+	client.clock = &fakeClock{}
+
+	ctx := WithRequestHeaders(context.Background(), http.Header{
+		"X-Custom-Trace-Id":       {"trace-1"},
+		"x-xiaomi-meta-service":   {"billing"},
+		HTTPHeaderAuthorization:   {"forged"},
+		HTTPHeaderContentType:     {"text/plain"},
+		"X-Custom-Overridden-Key": {"parent"},
+	})
+	ctx = WithRequestHeaders(ctx, http.Header{"X-Custom-Overridden-Key": {"child"}})
+
+	assert.Nil(t, client.DeleteObjectWithContext(ctx, "bucket", "object"))
+	_, err := client.PutObjectWithContext(ctx, &PutObjectRequest{
+		BucketName:  "bucket",
+		ObjectName:  "object",
+		ContentType: "application/json",
+		Data:        strings.NewReader("{}"),
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 4, len(headers))
+	for i, h := range headers {
+		assert.Equal(t, sdkUserAgent+" billing/1.2", h.Get(HTTPHeaderUserAgent), i)
+		assert.Regexp(t, `^go-fds/`+regexp.QuoteMeta(Version)+` \(go.*; .+/.+\)`, h.Get(HTTPHeaderUserAgent))
+		assert.Equal(t, "trace-1", h.Get("X-Custom-Trace-Id"), i)
+		assert.Equal(t, "billing", h.Get("X-Xiaomi-Meta-Service"), i)
+		assert.Equal(t, "child", h.Get("X-Custom-Overridden-Key"), i)
+		assert.True(t, strings.HasPrefix(h.Get(HTTPHeaderAuthorization), "Galaxy-V2 ak:"), i)
+	}
+	// the options of a request take precedence
+	assert.Equal(t, "application/json", headers[3].Get(HTTPHeaderContentType))
+
+	// the headers are signed as sent
+	sig, err := signature(sha1.New, "sk", HTTPDelete, server.URL+"/bucket/object", headers[1])
+	assert.Nil(t, err)
+	assert.Equal(t, "Galaxy-V2 ak:"+sig, headers[1].Get(HTTPHeaderAuthorization))
+}
+
+func Test_EndpointResolver(t *testing.T) {
+	assert.Equal(t, "cnbj1"+URLComSuffix, DefaultEndpointResolver.ResolveEndpoint(RegionCNBJ1, false, false))
+	assert.Equal(t, "cnbj1"+URLNetSuffix, DefaultEndpointResolver.ResolveEndpoint(RegionCNBJ1, true, false))
+	assert.Equal(t, "cdn.cnbj1"+URLCDNSuffix, DefaultEndpointResolver.ResolveEndpoint(RegionCNBJ1, true, true))
+
+	newClient := func(conf *ClientConfiguration) (*Client, *urlRecorder) {
+		client := New("ak", "sk", conf)
+		recorder := &urlRecorder{}
+		client.httpClient.Transport = recorder
+		return client, recorder
+	}
+	hosts := func(client *Client, recorder *urlRecorder) []string {
+		body, err := client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "object"})
+		assert.Nil(t, err)
+		body.Close()
+		_, err = client.GetObjectMetadata("bucket", "object")
+		assert.Nil(t, err)
+		_, err = client.ListObjects(&ListObjectsRequest{BucketName: "bucket"})
+		assert.Nil(t, err)
+		_, err = client.PutObject(&PutObjectRequest{BucketName: "bucket", ObjectName: "object", Data: strings.NewReader("data")})
+		assert.Nil(t, err)
+
+		var result []string
+		for _, req := range recorder.requests {
+			result = append(result, req.URL.Host)
+		}
+		recorder.requests = nil
+		return result
+	}
+
+	conf := NewRegionClientConfiguration(RegionCNBJ1)
+	assert.Equal(t, "cnbj1", conf.RegionName())
+	conf.EnableHTTPS = false
+	client, recorder := newClient(conf)
+	api, cdn := "cnbj1"+URLComSuffix, "cdn.cnbj1"+URLCDNSuffix
+	// only GetObject follows EnableCDNForDownload
+	assert.Equal(t, []string{cdn, api, api, api}, hosts(client, recorder))
+	conf.EnableCDNForDownload = false
+	assert.Equal(t, []string{api, api, api, api}, hosts(client, recorder))
+
+	conf.EnableInternalEndpoint = true
+	internal := "cnbj1" + URLNetSuffix
+	assert.Equal(t, []string{internal, internal, internal, internal}, hosts(client, recorder))
+	assert.Equal(t, "http://"+internal+"/bucket/object", client.GetObjectURL("bucket", "object", URLOptions{}))
+
+	// a private deployment overrides the API endpoints and keeps the CDN one of the configuration
+	conf = NewRegionClientConfiguration(RegionCNBJ1)
+	conf.EnableHTTPS = false
+	conf.EndpointResolver = EndpointResolverFunc(func(region Region, internal, cdn bool) string {
+		switch {
+		case cdn:
+			return ""
+		case internal:
+			return "fds." + string(region) + ".idc:8080"
+		}
+		return "fds." + string(region) + ".corp"
+	})
+	client, recorder = newClient(conf)
+	assert.Equal(t, []string{cdn, "fds.cnbj1.corp", "fds.cnbj1.corp", "fds.cnbj1.corp"}, hosts(client, recorder))
+	assert.Equal(t, "http://fds.cnbj1.corp/bucket/object", client.GetObjectURL("bucket", "object", URLOptions{}))
+	assert.Equal(t, "http://fds.cnbj1.idc:8080/bucket/object", client.GetObjectURL("bucket", "object", URLOptions{Internal: true}))
+	assert.Equal(t, "http://"+cdn+"/bucket/object", client.GetObjectURL("bucket", "object", URLOptions{CDN: true}))
+
+	u, err := client.GeneratePresignedURL(&GeneratePresignedURLRequest{
+		BucketName: "bucket",
+		ObjectName: "object",
+		Method:     HTTPGet,
+		Expiration: time.Now().Add(time.Hour),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "fds.cnbj1.corp", u.Host)
+
+	// virtual-host style signs the path-style resource of the resolved endpoint
+	conf.VirtualHostStyle = true
+	client, recorder = newClient(conf)
+	client.clock = &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	_, err = client.GetBucketACL("bucket")
+	assert.Nil(t, err)
+	req := recorder.requests[0]
+	assert.Equal(t, "bucket.fds.cnbj1.corp", req.URL.Host)
+	sig, err := signature(sha1.New, "sk", HTTPGet, "http://fds.cnbj1.corp/bucket?acl", req.Header)
+	assert.Nil(t, err)
+	assert.Equal(t, "Galaxy-V2 ak:"+sig, req.Header.Get(HTTPHeaderAuthorization))
+}
+
+func Test_NewClientForRegion(t *testing.T) {
+	provider := StaticCredentialsProvider{Credentials{AccessID: "ak", AccessSecret: "sk"}}
+	for _, region := range []Region{RegionCNBJ0, RegionCNBJ1, RegionCNBJ2, RegionAWSBJ0, RegionAWSUSOR0, RegionAWSSGP0, RegionAWSDE0} {
+		client, err := NewClientForRegion(region, provider)
+		assert.Nil(t, err, string(region))
+		assert.Equal(t, string(region), client.Configuration.RegionName())
+		assert.Equal(t, string(region)+URLComSuffix, client.Configuration.Endpoint)
+		assert.False(t, client.IsAnonymous())
+	}
+
+	client, err := NewClientForRegion(RegionCNBJ1, nil)
+	assert.Nil(t, err)
+	assert.True(t, client.IsAnonymous())
+
+	_, err = NewClientForRegion("cnbj9", provider)
+	assert.True(t, errors.Is(err, ErrorUnknownRegion))
+	_, err = NewClientForRegion("", provider)
+	assert.True(t, errors.Is(err, ErrorUnknownRegion))
+
+	// a custom region is resolved by the resolver, the known ones fall back to the default
+	resolver := EndpointResolverFunc(func(region Region, internal, cdn bool) string {
+		if region == "private0" && !cdn {
+			return "fds.private0.example.com"
+		}
+		return ""
+	})
+	_, err = NewClientForRegionWithResolver("private1", provider, resolver)
+	assert.True(t, errors.Is(err, ErrorUnknownRegion))
+
+	client, err = NewClientForRegionWithResolver("private0", provider, resolver)
+	assert.Nil(t, err)
+	client.Configuration.EnableHTTPS = false
+	recorder := &urlRecorder{}
+	client.httpClient.Transport = recorder
+	_, err = client.GetObjectMetadata("bucket", "object")
+	assert.Nil(t, err)
+	assert.Equal(t, "fds.private0.example.com", recorder.requests[0].URL.Host)
+
+	client, err = NewClientForRegionWithResolver(RegionCNBJ2, provider, resolver)
+	assert.Nil(t, err)
+	assert.Equal(t, "cnbj2"+URLComSuffix, client.Configuration.Endpoint)
+}
@@ -0,0 +1,94 @@
+package fds
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// PutObjectFromFile puts the file of filePath as objectName with metadata as the
+// headers, Content-MD5 is set if EnableMd5Calculate is set, the size of file is returned
+func (client *Client) PutObjectFromFile(bucketName, objectName, filePath string, metadata *ObjectMetadata) (int64, error) {
+	return client.PutObjectFromFileWithContext(context.Background(), bucketName, objectName, filePath, metadata)
+}
+
+// PutObjectFromFileWithContext puts the file of filePath as objectName with context controlling
+func (client *Client) PutObjectFromFileWithContext(ctx context.Context, bucketName, objectName, filePath string, metadata *ObjectMetadata) (int64, error) {
+	fd, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.Close()
+
+	info, err := fd.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	headers := http.Header{}
+	if metadata != nil {
+		for k, v := range metadata.h {
+			headers[k] = v
+		}
+	}
+	if client.Configuration.EnableMd5Calculate && headers.Get(HTTPHeaderContentMD5) == "" {
+		hash := md5.New()
+		if _, err := io.Copy(hash, fd); err != nil {
+			return 0, err
+		}
+		if _, err := fd.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		headers.Set(HTTPHeaderContentMD5, hex.EncodeToString(hash.Sum(nil)))
+	}
+
+	_, err = client.PutObjectWithContext(ctx, &PutObjectRequest{
+		BucketName: bucketName,
+		ObjectName: objectName,
+		Data:       fd,
+		Headers:    headers,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// GetObjectToFile gets the object into filePath, which is replaced atomically
+// after the whole object is written, the count of bytes written is returned
+func (client *Client) GetObjectToFile(request *GetObjectRequest, filePath string, perm os.FileMode) (int64, error) {
+	return client.GetObjectToFileWithContext(context.Background(), request, filePath, perm)
+}
+
+// GetObjectToFileWithContext gets the object into filePath with context controlling
+func (client *Client) GetObjectToFileWithContext(ctx context.Context, request *GetObjectRequest, filePath string, perm os.FileMode) (int64, error) {
+	body, err := client.GetObjectWithContext(ctx, request)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(filePath), filepath.Base(filePath)+".tmp-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, body)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return n, err
+	}
+
+	return n, os.Rename(tmp.Name(), filePath)
+}
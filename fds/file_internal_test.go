@@ -0,0 +1,78 @@
+package fds
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PutObjectFromFileAndGetObjectToFile(t *testing.T) {
+	var stored []byte
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			headers = r.Header
+			stored, _ = ioutil.ReadAll(r.Body)
+			w.Write([]byte("{}"))
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(string(stored)))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "fds-file-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	content := strings.Repeat("content", 100)
+	src := filepath.Join(dir, "src")
+	assert.Nil(t, ioutil.WriteFile(src, []byte(content), 0644))
+
+	client := newTestClient(server)
+	client.Configuration.EnableMd5Calculate = true
+
+	metadata := NewObjectMetadata()
+	metadata.Set(HTTPHeaderContentType, "text/plain")
+	metadata.Set(XiaomiMetaPrefix+"owner", "alice")
+	n, err := client.PutObjectFromFile("bucket", "object", src, metadata)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), n)
+	assert.Equal(t, content, string(stored))
+	assert.Equal(t, "700", headers.Get(HTTPHeaderContentLength))
+	assert.Equal(t, "text/plain", headers.Get(HTTPHeaderContentType))
+	assert.Equal(t, "alice", headers.Get(XiaomiMetaPrefix+"owner"))
+	sum := md5.Sum([]byte(content))
+	assert.Equal(t, []string{hex.EncodeToString(sum[:])}, headers["Content-Md5"])
+
+	_, err = client.PutObjectFromFile("bucket", "object", filepath.Join(dir, "missing"), nil)
+	assert.True(t, os.IsNotExist(err))
+
+	dst := filepath.Join(dir, "dst")
+	assert.Nil(t, ioutil.WriteFile(dst, []byte("old"), 0644))
+	n, err = client.GetObjectToFile(&GetObjectRequest{BucketName: "bucket", ObjectName: "object"}, dst, 0600)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), n)
+	data, err := ioutil.ReadFile(dst)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(data))
+	info, err := os.Stat(dst)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// a failed get leaves neither the temp file nor a change to dst
+	_, err = client.GetObjectToFile(&GetObjectRequest{BucketName: "bucket", ObjectName: "object", Range: "bytes=5000-"}, dst, 0600)
+	assert.NotNil(t, err)
+	data, _ = ioutil.ReadFile(dst)
+	assert.Equal(t, content, string(data))
+	entries, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 2, len(entries))
+}
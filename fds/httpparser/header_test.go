@@ -55,3 +55,18 @@ func TestHeader(t *testing.T) {
 	assert.Equal(t, headers.Get("OtherOption"), "helloworld")
 
 }
+
+func TestHeaderHTTPTime(t *testing.T) {
+	type testOptions struct {
+		IfModifiedSince time.Time `header:"If-Modified-Since,omitempty,http"`
+	}
+
+	headers, e := httpparser.Header(testOptions{})
+	assert.Nil(t, e)
+	assert.Empty(t, headers.Get("If-Modified-Since"))
+
+	loc := time.FixedZone("CST", 8*3600)
+	headers, e = httpparser.Header(testOptions{time.Date(2018, 1, 1, 9, 1, 1, 0, loc)})
+	assert.Nil(t, e)
+	assert.Equal(t, "Mon, 01 Jan 2018 01:01:01 GMT", headers.Get("If-Modified-Since"))
+}
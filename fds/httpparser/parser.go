@@ -2,6 +2,7 @@ package httpparser
 
 import (
 	"fmt"
+	"net/http"
 	"reflect"
 	"strings"
 	"time"
@@ -15,6 +16,7 @@ const (
 	omitemptyTag   = "omitempty"
 	headerTag      = "header"
 	querystringTag = "param"
+	httpTimeTag    = "http"
 )
 
 type tags []string
@@ -41,6 +43,9 @@ func toString(v reflect.Value, opts tags) string {
 
 	if v.Type() == timeType {
 		t := v.Interface().(time.Time)
+		if opts.Contains(httpTimeTag) {
+			return t.UTC().Format(http.TimeFormat)
+		}
 		return t.Format(time.RFC822)
 	}
 
@@ -0,0 +1,55 @@
+package fds
+
+import "net/http"
+
+// RequestInterceptor is called with every attempt of a request after it is signed,
+// an error stops the request from being sent. Changing the signed headers, which
+// are Content-MD5, Content-Type, Date and x-xiaomi-*, invalidates the signature.
+type RequestInterceptor func(req *http.Request) error
+
+// ResponseInterceptor is called with the response of every attempt of a request
+// before its status is checked, an error is returned in place of the response
+type ResponseInterceptor func(resp *http.Response) error
+
+// interceptorError is the error of an interceptor, the request is not retried
+type interceptorError struct {
+	err error
+}
+
+func (e *interceptorError) Error() string {
+	return e.err.Error()
+}
+
+func (e *interceptorError) Unwrap() error {
+	return e.err
+}
+
+// AddRequestInterceptor adds interceptor after the ones added before, the interceptors
+// have to be added before the client is used
+func (client *Client) AddRequestInterceptor(interceptor RequestInterceptor) {
+	client.requestInterceptors = append(client.requestInterceptors, interceptor)
+}
+
+// AddResponseInterceptor adds interceptor after the ones added before, the interceptors
+// have to be added before the client is used
+func (client *Client) AddResponseInterceptor(interceptor ResponseInterceptor) {
+	client.responseInterceptors = append(client.responseInterceptors, interceptor)
+}
+
+func (client *Client) interceptRequest(req *http.Request) error {
+	for _, interceptor := range client.requestInterceptors {
+		if err := interceptor(req); err != nil {
+			return &interceptorError{err}
+		}
+	}
+	return nil
+}
+
+func (client *Client) interceptResponse(resp *http.Response) error {
+	for _, interceptor := range client.responseInterceptors {
+		if err := interceptor(resp); err != nil {
+			return &interceptorError{err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package fds
+
+import (
+	"context"
+	"io"
+)
+
+// ObjectIterator iterates over the objects of ListObjects page by page
+type ObjectIterator struct {
+	client  *Client
+	ctx     context.Context
+	request *ListObjectsRequest
+
+	listing        *ObjectListing
+	summaries      []ObjectSummary
+	commonPrefixes []string
+	err            error
+}
+
+// ListObjectsIterator returns an iterator of objects with prefix and delimiter
+func (client *Client) ListObjectsIterator(bucketName, prefix, delimiter string) *ObjectIterator {
+	return client.ListObjectsIteratorWithContext(context.Background(), bucketName, prefix, delimiter, 0)
+}
+
+// ListObjectsIteratorWithContext returns an iterator of objects with context controlling,
+// pageSize is the maxKeys of each page, 0 means the default of the server
+func (client *Client) ListObjectsIteratorWithContext(ctx context.Context, bucketName, prefix, delimiter string, pageSize int) *ObjectIterator {
+	return &ObjectIterator{
+		client: client,
+		ctx:    ctx,
+		request: &ListObjectsRequest{
+			BucketName: bucketName,
+			Prefix:     prefix,
+			Delimiter:  delimiter,
+			MaxKeys:    pageSize,
+		},
+	}
+}
+
+// Next returns the next object, io.EOF is returned after the last one
+func (it *ObjectIterator) Next() (*ObjectSummary, error) {
+	for len(it.summaries) == 0 {
+		if it.err != nil {
+			return nil, it.err
+		}
+		it.err = it.fetch()
+	}
+
+	summary := it.summaries[0]
+	it.summaries = it.summaries[1:]
+	return &summary, nil
+}
+
+// CommonPrefixes returns the common prefixes of the pages fetched so far,
+// all of them are returned once Next returns io.EOF
+func (it *ObjectIterator) CommonPrefixes() []string {
+	return it.commonPrefixes
+}
+
+// fetch gets the next page, io.EOF is returned with the last page
+func (it *ObjectIterator) fetch() error {
+	var listing *ObjectListing
+	var err error
+	if it.listing == nil {
+		listing, err = it.client.ListObjectsWithContext(it.ctx, it.request)
+	} else {
+		listing, err = it.client.ListObjectsNextBatchWithContext(it.ctx, it.listing)
+	}
+	if err != nil {
+		return err
+	}
+
+	it.listing = listing
+	it.summaries = listing.ObjectSummaries
+	it.commonPrefixes = append(it.commonPrefixes, listing.CommonPrefixes...)
+
+	if !listing.Truncated || listing.NextMarker == "" {
+		return io.EOF
+	}
+	return nil
+}
+
+// ObjectVersionIterator iterates over the versions of ListObjectVersions page by page
+type ObjectVersionIterator struct {
+	client     *Client
+	ctx        context.Context
+	bucketName string
+	prefix     string
+	pageSize   int
+
+	listing  *VersionListing
+	versions []ObjectVersionSummary
+	err      error
+}
+
+// ListObjectVersionsIterator returns an iterator of versions and delete markers with prefix
+func (client *Client) ListObjectVersionsIterator(bucketName, prefix string) *ObjectVersionIterator {
+	return client.ListObjectVersionsIteratorWithContext(context.Background(), bucketName, prefix, 0)
+}
+
+// ListObjectVersionsIteratorWithContext returns an iterator of versions with context controlling,
+// pageSize is the maxKeys of each page, 0 means the default of the server
+func (client *Client) ListObjectVersionsIteratorWithContext(ctx context.Context, bucketName, prefix string, pageSize int) *ObjectVersionIterator {
+	return &ObjectVersionIterator{
+		client:     client,
+		ctx:        ctx,
+		bucketName: bucketName,
+		prefix:     prefix,
+		pageSize:   pageSize,
+	}
+}
+
+// Next returns the next version, io.EOF is returned after the last one
+func (it *ObjectVersionIterator) Next() (*ObjectVersionSummary, error) {
+	for len(it.versions) == 0 {
+		if it.err != nil {
+			return nil, it.err
+		}
+		it.err = it.fetch()
+	}
+
+	version := it.versions[0]
+	it.versions = it.versions[1:]
+	return &version, nil
+}
+
+// fetch gets the next page, io.EOF is returned with the last page
+func (it *ObjectVersionIterator) fetch() error {
+	var listing *VersionListing
+	var err error
+	if it.listing == nil {
+		listing, err = it.client.ListObjectVersionsWithContext(it.ctx, it.bucketName, it.prefix, "", "", it.pageSize)
+	} else {
+		listing, err = it.client.ListObjectVersionsNextBatchWithContext(it.ctx, it.listing)
+	}
+	if err != nil {
+		return err
+	}
+
+	it.listing = listing
+	it.versions = listing.Versions
+
+	if !listing.Truncated || listing.NextKeyMarker == "" {
+		return io.EOF
+	}
+	return nil
+}
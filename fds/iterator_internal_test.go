@@ -0,0 +1,133 @@
+package fds
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ListObjectsIterator(t *testing.T) {
+	pages := map[string]ObjectListing{
+		"": {
+			Truncated:       true,
+			NextMarker:      "a",
+			ObjectSummaries: []ObjectSummary{{ObjectName: "a"}},
+			CommonPrefixes:  []string{"dir1/"},
+		},
+		"a": {
+			Truncated:      true,
+			NextMarker:     "dir2/",
+			CommonPrefixes: []string{"dir2/"},
+		},
+		"dir2/": {
+			ObjectSummaries: []ObjectSummary{{ObjectName: "b"}, {ObjectName: "c"}},
+		},
+	}
+
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		page, ok := pages[r.URL.Query().Get("marker")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		page.BucketName = "bucket"
+		page.Prefix = r.URL.Query().Get("prefix")
+		page.Delimiter = r.URL.Query().Get("delimiter")
+		page.MaxKeys = 2
+		data, _ := json.Marshal(page)
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	it := client.ListObjectsIteratorWithContext(context.Background(), "bucket", "p", "/", 2)
+	var names []string
+	for {
+		summary, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		names = append(names, summary.ObjectName)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+	assert.Equal(t, []string{"dir1/", "dir2/"}, it.CommonPrefixes())
+
+	assert.Equal(t, 3, len(queries))
+	for _, q := range queries {
+		assert.Equal(t, "p", q.Get("prefix"))
+		assert.Equal(t, "/", q.Get("delimiter"))
+		assert.Equal(t, "2", q.Get("maxKeys"))
+	}
+
+	_, err := it.Next()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 3, len(queries))
+}
+
+func Test_ListObjectVersionsIterator(t *testing.T) {
+	pages := map[string]VersionListing{
+		"": {
+			Truncated:           true,
+			NextKeyMarker:       "a",
+			NextVersionIDMarker: "a1",
+			Versions: []ObjectVersionSummary{
+				{ObjectName: "a", VersionID: "a2", IsLatest: true},
+				{ObjectName: "a", VersionID: "a1"},
+			},
+		},
+		"a/a1": {
+			Versions: []ObjectVersionSummary{{ObjectName: "b", VersionID: "b1", IsDeleteMarker: true}},
+		},
+	}
+
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		queries = append(queries, q)
+		marker := q.Get("keyMarker")
+		if marker != "" {
+			marker += "/" + q.Get("versionIdMarker")
+		}
+		page, ok := pages[marker]
+		if _, versions := q["versions"]; !versions || !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		page.BucketName = "bucket"
+		page.Prefix = q.Get("prefix")
+		page.MaxKeys = 2
+		data, _ := json.Marshal(page)
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	it := client.ListObjectVersionsIteratorWithContext(context.Background(), "bucket", "p", 2)
+	var versions []string
+	for {
+		version, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		versions = append(versions, version.VersionID)
+	}
+	assert.Equal(t, []string{"a2", "a1", "b1"}, versions)
+	assert.Equal(t, 2, len(queries))
+	assert.Equal(t, "p", queries[1].Get("prefix"))
+	assert.Equal(t, "2", queries[1].Get("maxKeys"))
+
+	_, err := it.Next()
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,26 @@
+package fds
+
+// Logger is the logger of Client, *logrus.Logger satisfies it
+// so it can be passed to SetLogger as is
+type Logger interface {
+	Debug(args ...interface{})
+	Info(args ...interface{})
+	Warn(args ...interface{})
+	Error(args ...interface{})
+}
+
+// nopLogger is the default Logger, which discards everything
+type nopLogger struct{}
+
+func (nopLogger) Debug(args ...interface{}) {}
+func (nopLogger) Info(args ...interface{})  {}
+func (nopLogger) Warn(args ...interface{})  {}
+func (nopLogger) Error(args ...interface{}) {}
+
+// SetLogger sets logger of the client, nil discards the logs
+func (client *Client) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+	client.logger = logger
+}
@@ -0,0 +1,48 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/XiaoMi/go-fds/fds"
+)
+
+// AppendWriter is an io.Writer which appends every Write to an object
+type AppendWriter struct {
+	client     *fds.Client
+	ctx        context.Context
+	bucketName string
+	objectName string
+	position   int64
+}
+
+// NewAppendWriter new an AppendWriter which appends to objectName in bucketName from position,
+// which is the current length of the object, 0 for a new object
+func NewAppendWriter(ctx context.Context, client *fds.Client, bucketName, objectName string, position int64) *AppendWriter {
+	return &AppendWriter{
+		client:     client,
+		ctx:        ctx,
+		bucketName: bucketName,
+		objectName: objectName,
+		position:   position,
+	}
+}
+
+// Write appends p to the object, nothing is written on error
+func (w *AppendWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	next, err := w.client.AppendObjectWithContext(w.ctx, w.bucketName, w.objectName, w.position, bytes.NewReader(p))
+	if err != nil {
+		return 0, err
+	}
+	w.position = next
+	return len(p), nil
+}
+
+// Position returns the position of the next append
+func (w *AppendWriter) Position() int64 {
+	return w.position
+}
@@ -0,0 +1,35 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/XiaoMi/go-fds/fds"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendWriter(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	w := NewAppendWriter(context.Background(), server.client(), "bucket", "log", 0)
+	for i := 0; i < 3; i++ {
+		n, err := fmt.Fprintf(w, "line %d\n", i)
+		assert.Nil(t, err)
+		assert.Equal(t, 7, n)
+	}
+	assert.Equal(t, int64(21), w.Position())
+
+	content, _ := server.getObject("bucket", "log")
+	assert.Equal(t, "line 0\nline 1\nline 2\n", string(content))
+
+	stale := NewAppendWriter(context.Background(), server.client(), "bucket", "log", 7)
+	_, err := stale.Write([]byte("x"))
+	var positionErr *fds.AppendPositionError
+	assert.True(t, errors.As(err, &positionErr))
+	assert.Equal(t, int64(7), positionErr.Position)
+	assert.Equal(t, int64(21), positionErr.NextPosition)
+	assert.Equal(t, int64(7), stale.Position())
+}
@@ -0,0 +1,132 @@
+package manager
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/XiaoMi/go-fds/fds"
+)
+
+// UploadResult is the result of each file in UploadBatch
+type UploadResult struct {
+	Request  *UploadRequest
+	Response *fds.PutObjectResponse
+	Err      error
+}
+
+// UploadBatch uploads files through a pool of parallel workers
+func (uploader *Uploader) UploadBatch(requests []*UploadRequest, parallel int) ([]UploadResult, error) {
+	return uploader.UploadBatchWithContext(context.Background(), requests, parallel)
+}
+
+// UploadBatchWithContext uploads files through a pool of parallel workers with context controlling.
+// It does not fail fast, the result of each file is reported in the same order as requests.
+// Files which fit into a single part are uploaded by PutObject instead of multipart uploading.
+func (uploader *Uploader) UploadBatchWithContext(ctx context.Context, requests []*UploadRequest, parallel int) ([]UploadResult, error) {
+	if parallel < 1 {
+		return nil, ErrorConcurrencySmallerThanOne
+	}
+
+	results := make([]UploadResult, len(requests))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				request := requests[index]
+				response, err := uploader.uploadWithRetries(ctx, request)
+				results[index] = UploadResult{
+					Request:  request,
+					Response: response,
+					Err:      err,
+				}
+			}
+		}()
+	}
+
+	dispatched := 0
+dispatch:
+	for dispatched < len(requests) {
+		select {
+		case jobs <- dispatched:
+			dispatched++
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := dispatched; i < len(requests); i++ {
+		results[i] = UploadResult{
+			Request: requests[i],
+			Err:     ctx.Err(),
+		}
+	}
+
+	return results, ctx.Err()
+}
+
+func (uploader *Uploader) uploadWithRetries(ctx context.Context, request *UploadRequest) (*fds.PutObjectResponse, error) {
+	var response *fds.PutObjectResponse
+	var err error
+
+	for i := 0; i <= uploader.BatchRetries; i++ {
+		response, err = uploader.uploadSmallOrMultipart(ctx, request)
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		uploader.logger.Debug(err)
+	}
+
+	return response, err
+}
+
+func (uploader *Uploader) uploadSmallOrMultipart(ctx context.Context, request *UploadRequest) (*fds.PutObjectResponse, error) {
+	fileInfo, err := os.Stat(request.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := uploader.Plan(fileInfo.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	if plan.PartCount > 1 {
+		return uploader.UploadWithContext(ctx, request)
+	}
+
+	fd, err := os.Open(request.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	data, err := request.partReader(part{End: fileInfo.Size() - 1}, fd)
+	if err != nil {
+		return nil, err
+	}
+
+	putObjectRequest := &fds.PutObjectRequest{
+		BucketName:         request.BucketName,
+		ObjectName:         request.ObjectName,
+		Data:               data,
+		CacheControl:       request.CacheControl,
+		ContentDisposition: request.ContentDisposition,
+		ContentEncoding:    request.ContentEncoding,
+		ContentType:        request.ContentType,
+		Expect:             request.Expect,
+		Expires:            request.Expires,
+		Tags:               request.Tags,
+		StorageClass:       request.StorageClass,
+		UserMetadata:       request.initMultipartUploadRequest(0).UserMetadata,
+		Headers:            request.initMultipartUploadRequest(0).Headers,
+	}
+
+	return uploader.client.PutObjectWithContext(ctx, putObjectRequest)
+}
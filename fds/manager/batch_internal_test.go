@@ -0,0 +1,93 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/XiaoMi/go-fds/fds"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploader_UploadBatch(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	var failures int32
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		// the first put of object-1 fails
+		if r.URL.Path == "/bucket/object-1" && atomic.AddInt32(&failures, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return true
+		}
+		return false
+	}
+
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 2, false)
+	assert.Nil(t, err)
+	uploader.BatchRetries = 1
+
+	var requests []*UploadRequest
+	var contents [][]byte
+	for i, size := range []int{10, 20, 3 * fds.MinPartSize, 0} {
+		filePath, content := newTestUploadFile(t, size)
+		defer os.RemoveAll(filepath.Dir(filePath))
+
+		request := newTestUploadRequest(filePath)
+		request.ObjectName = fmt.Sprintf("object-%d", i)
+		requests = append(requests, request)
+		contents = append(contents, content)
+	}
+	requests = append(requests, newTestUploadRequest("/not/exist"))
+
+	results, err := uploader.UploadBatch(requests, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, len(requests), len(results))
+
+	for i := range contents {
+		assert.Nil(t, results[i].Err)
+		assert.Equal(t, requests[i], results[i].Request)
+
+		uploaded, ok := server.getObject("bucket", requests[i].ObjectName)
+		assert.True(t, ok)
+		assert.True(t, bytes.Equal(contents[i], uploaded))
+	}
+	assert.True(t, os.IsNotExist(results[4].Err))
+
+	// small files never start a multipart upload
+	for _, r := range server.requests {
+		if _, ok := r.URL.Query()["uploads"]; ok {
+			assert.Equal(t, "/bucket/object-2", r.URL.Path)
+		}
+	}
+}
+
+func TestUploader_UploadBatchUserMetadata(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 2, false)
+	assert.Nil(t, err)
+
+	filePath, _ := newTestUploadFile(t, 10)
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	request := newTestUploadRequest(filePath)
+	request.InitMultipartUploadRequest.UserMetadata = fds.UserMetadata{"iv": "ffff", "owner": "me"}
+	request.UserMetadata = map[string]string{"iv": "0102"}
+
+	results, err := uploader.UploadBatch([]*UploadRequest{request}, 1)
+	assert.Nil(t, err)
+	assert.Nil(t, results[0].Err)
+
+	// the small file is a single PUT carrying the user metadata
+	assert.Equal(t, 1, len(server.requests))
+	r := server.requests[0]
+	assert.Equal(t, http.MethodPut, r.Method)
+	assert.Equal(t, "0102", r.Header.Get(fds.XiaomiMetaPrefix+"iv"))
+	assert.Equal(t, "me", r.Header.Get(fds.XiaomiMetaPrefix+"owner"))
+}
@@ -0,0 +1,108 @@
+package manager
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/XiaoMi/go-fds/fds"
+)
+
+// breakpointSuffix is appended to FilePath for the breakpoint of a download
+const breakpointSuffix = ".download.bp"
+
+// breakpointInUseWindow is how long a breakpoint, or its temp file, is considered to
+// be in use by a running download after it is modified
+const breakpointInUseWindow = time.Minute
+
+// CleanupBreakpoints removes the breakpoints in dir which are corrupted or not modified
+// for olderThan, along with their temp files, and returns the paths removed. Breakpoints
+// modified in the last minute are skipped as a download may be writing them.
+func CleanupBreakpoints(dir string, olderThan time.Duration) ([]string, error) {
+	return cleanupBreakpoints(context.Background(), nil, dir, olderThan)
+}
+
+// CleanupBreakpoints works as the package level CleanupBreakpoints, and also removes the
+// breakpoints whose objects no longer exist
+func (downloader *Downloader) CleanupBreakpoints(ctx context.Context, dir string, olderThan time.Duration) ([]string, error) {
+	return cleanupBreakpoints(ctx, downloader, dir, olderThan)
+}
+
+func cleanupBreakpoints(ctx context.Context, downloader *Downloader, dir string, olderThan time.Duration) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	var firstErr error
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), breakpointSuffix) {
+			continue
+		}
+
+		path := filepath.Join(dir, info.Name())
+		tmpFilePath := strings.TrimSuffix(path, breakpointSuffix) + ".tmp"
+		modTime := info.ModTime()
+		if tmpInfo, err := os.Stat(tmpFilePath); err == nil && tmpInfo.ModTime().After(modTime) {
+			modTime = tmpInfo.ModTime()
+		}
+		age := time.Since(modTime)
+		if age < breakpointInUseWindow {
+			continue
+		}
+
+		remove := age >= olderThan
+		if !remove {
+			stale, err := staleBreakpoint(ctx, downloader, path)
+			if err != nil {
+				if ctx.Err() != nil {
+					return removed, ctx.Err()
+				}
+				continue
+			}
+			remove = stale
+		}
+		if !remove {
+			continue
+		}
+
+		for _, p := range []string{path, tmpFilePath} {
+			err := os.Remove(p)
+			if err == nil {
+				removed = append(removed, p)
+			} else if !os.IsNotExist(err) && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return removed, firstErr
+}
+
+// staleBreakpoint reports whether the breakpoint at path is corrupted, or the object of it
+// no longer exists when downloader is not nil
+func staleBreakpoint(ctx context.Context, downloader *Downloader, path string) (bool, error) {
+	bp := breakpointInfo{}
+	if err := bp.Load(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, err
+		}
+		return true, nil
+	}
+	if !bp.wellFormed() {
+		return true, nil
+	}
+	if downloader == nil {
+		return false, nil
+	}
+
+	_, err := downloader.client.GetObjectVersionMetadataWithContext(ctx, bp.BucketName, bp.ObjectName, bp.VersionID)
+	if fds.IsNotFound(err) {
+		return true, nil
+	}
+	return false, err
+}
@@ -0,0 +1,109 @@
+package manager
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/go-fds/fds"
+	"github.com/XiaoMi/go-fds/fds/httpparser"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestBreakpoint(t *testing.T, downloader *Downloader, filePath, objectName string) {
+	md, err := downloader.client.GetObjectMetadata("bucket", objectName)
+	assert.Nil(t, err)
+
+	bp := breakpointInfo{}
+	r := httpparser.HTTPRange{Start: 0, End: 99}
+	assert.Nil(t, bp.Initilize(downloader, "bucket", objectName, "", filePath+breakpointSuffix, r, md))
+	assert.Nil(t, bp.Dump())
+	assert.Nil(t, ioutil.WriteFile(filePath+".tmp", []byte("partial"), 0664))
+}
+
+func ageTestFiles(t *testing.T, age time.Duration, paths ...string) {
+	modTime := time.Now().Add(-age)
+	for _, p := range paths {
+		assert.Nil(t, os.Chtimes(p, modTime, modTime))
+	}
+}
+
+func TestCleanupBreakpoints(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+	server.putObject("bucket", "object", newTestContent(100))
+	server.putObject("bucket", "gone", newTestContent(100))
+
+	downloader, err := NewDownloader(server.client(), 10, 2, true)
+	assert.Nil(t, err)
+
+	dir, err := ioutil.TempDir("", "fds-cleanup-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	// a running download
+	writeTestBreakpoint(t, downloader, path("active"), "object")
+	// an interrupted download which could be resumed
+	writeTestBreakpoint(t, downloader, path("valid"), "object")
+	ageTestFiles(t, time.Hour, path("valid.download.bp"), path("valid.tmp"))
+	// a download interrupted long ago
+	writeTestBreakpoint(t, downloader, path("stale"), "object")
+	ageTestFiles(t, 48*time.Hour, path("stale.download.bp"), path("stale.tmp"))
+	// a download of an object which is deleted since
+	writeTestBreakpoint(t, downloader, path("gone"), "gone")
+	ageTestFiles(t, time.Hour, path("gone.download.bp"), path("gone.tmp"))
+	server.mu.Lock()
+	delete(server.objects, "bucket/gone")
+	server.mu.Unlock()
+
+	for name, content := range map[string]string{
+		"corrupt.download.bp":   "{not json",
+		"unchecked.download.bp": `{"BucketName":"bucket","ObjectName":"object"}`,
+		"writing.download.bp":   `{"BucketName":`,
+		"notes.bp":              "not a breakpoint",
+	} {
+		assert.Nil(t, ioutil.WriteFile(path(name), []byte(content), 0664))
+	}
+	ageTestFiles(t, time.Hour, path("corrupt.download.bp"), path("unchecked.download.bp"), path("notes.bp"))
+
+	removed, err := CleanupBreakpoints(dir, 24*time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		path("corrupt.download.bp"),
+		path("stale.download.bp"),
+		path("stale.tmp"),
+		path("unchecked.download.bp"),
+	}, removed)
+
+	removed, err = downloader.CleanupBreakpoints(context.Background(), dir, 24*time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{path("gone.download.bp"), path("gone.tmp")}, removed)
+
+	infos, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	var left []string
+	for _, info := range infos {
+		left = append(left, info.Name())
+	}
+	assert.Equal(t, []string{
+		"active.download.bp", "active.tmp",
+		"notes.bp",
+		"valid.download.bp", "valid.tmp",
+		"writing.download.bp",
+	}, left)
+
+	// the breakpoint which is kept still resumes
+	request := &DownloadRequest{
+		GetObjectRequest: fds.GetObjectRequest{BucketName: "bucket", ObjectName: "object"},
+		FilePath:         path("valid"),
+	}
+	assert.Nil(t, downloader.Download(request))
+	assertFileContent(t, path("valid"), newTestContent(100))
+
+	_, err = CleanupBreakpoints(path("missing"), time.Hour)
+	assert.True(t, os.IsNotExist(err))
+}
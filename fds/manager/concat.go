@@ -0,0 +1,111 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/XiaoMi/go-fds/fds"
+)
+
+// DownloadConcat downloads objects and writes them into dst one after another
+// in the given order, up to Concurrency objects are downloaded ahead of the
+// one being written
+func (downloader *Downloader) DownloadConcat(ctx context.Context, bucketName string, objectNames []string, dst string) error {
+	dir, err := ioutil.TempDir(filepath.Dir(dst), ".fds-concat-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// each object is downloaded without breakpoint into its own temp file
+	breakpoint := false
+
+	objectPath := func(i int) string {
+		return filepath.Join(dir, fmt.Sprintf("%d", i))
+	}
+
+	done := make([]chan error, len(objectNames))
+	for i := range done {
+		done[i] = make(chan error, 1)
+	}
+
+	window := make(chan struct{}, downloader.Concurrency)
+	go func() {
+		for i, objectName := range objectNames {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				done[i] <- ctx.Err()
+				continue
+			}
+
+			go func(i int, objectName string) {
+				done[i] <- downloader.DownloadWithContext(ctx, &DownloadRequest{
+					GetObjectRequest: fds.GetObjectRequest{
+						BucketName: bucketName,
+						ObjectName: objectName,
+					},
+					FilePath:   objectPath(i),
+					breakpoint: &breakpoint,
+				})
+			}(i, objectName)
+		}
+	}()
+
+	tmpFilePath := dst + ".tmp"
+	out, err := os.Create(tmpFilePath)
+	if err != nil {
+		cancel()
+		waitAll(done)
+		return err
+	}
+
+	for i := range objectNames {
+		err = <-done[i]
+		if err == nil {
+			err = appendFile(out, objectPath(i))
+		}
+		<-window
+
+		if err != nil {
+			cancel()
+			waitAll(done[i+1:])
+			out.Close()
+			os.Remove(tmpFilePath)
+			return err
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		os.Remove(tmpFilePath)
+		return err
+	}
+	return os.Rename(tmpFilePath, dst)
+}
+
+// waitAll waits until every download has reported its result
+func waitAll(done []chan error) {
+	for _, c := range done {
+		<-c
+	}
+}
+
+// appendFile copies the file to out and removes it to free the space
+func appendFile(out io.Writer, filePath string) error {
+	fd, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(filePath)
+	defer fd.Close()
+
+	_, err = io.Copy(out, fd)
+	return err
+}
@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloader_DownloadConcat(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	contents := [][]byte{
+		bytes.Repeat([]byte("a"), 700),
+		{},
+		bytes.Repeat([]byte("b"), 10),
+		bytes.Repeat([]byte("c"), 301),
+	}
+	objectNames := []string{"part-000", "part-001", "part-002", "part-003"}
+	for i, name := range objectNames {
+		server.putObject("bucket", name, contents[i])
+	}
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloader(server.client(), 300, 3, false)
+	assert.Nil(t, err)
+
+	assert.Nil(t, downloader.DownloadConcat(context.Background(), "bucket", objectNames, request.FilePath))
+	assertFileContent(t, request.FilePath, bytes.Join(contents, nil))
+	// the objects are counted in the stats of the Downloader
+	assert.Equal(t, int64(1011), downloader.Stats().Bytes)
+
+	entries, _ := filepath.Glob(filepath.Join(filepath.Dir(request.FilePath), "*"))
+	assert.Equal(t, []string{request.FilePath}, entries)
+}
+
+func TestDownloader_DownloadConcatFailed(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	server.putObject("bucket", "part-000", []byte("aaa"))
+	server.putObject("bucket", "part-002", []byte("ccc"))
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloader(server.client(), 300, 2, false)
+	assert.Nil(t, err)
+
+	err = downloader.DownloadConcat(context.Background(), "bucket", []string{"part-000", "part-001", "part-002"}, request.FilePath)
+	assert.NotNil(t, err)
+
+	entries, _ := filepath.Glob(filepath.Join(filepath.Dir(request.FilePath), "*"))
+	assert.Empty(t, entries)
+}
@@ -1,29 +1,102 @@
 package manager
 
 import (
+	"compress/gzip"
 	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/XiaoMi/go-fds/fds"
 	"github.com/XiaoMi/go-fds/fds/httpparser"
-	"github.com/sirupsen/logrus"
 )
 
-// Downloader is a FDS client for file concurrency download
+// Downloader is a FDS client for file concurrency download. It is safe for concurrent use
+// once configured, the state of a download is kept in the call and the counters of Stats
+// are atomic, but a DownloadRequest is of one download at a time.
 type Downloader struct {
-	logger *logrus.Logger
-	client *fds.Client
+	stats     downloaderStats
+	logger    Logger
+	client    *fds.Client
+	lifecycle *lifecycle
 
-	PartSize    int64
+	PartSize int64
+
+	// Concurrency is the count of parts downloaded at the same time, the idle
+	// connection pool of the client, MaxConnection of its configuration, should
+	// be no smaller so that the connections are reused across parts
 	Concurrency int
 	Breakpoint  bool
+
+	// Preallocate allocates the whole file before downloading, which reduces
+	// fragmentation and reports a full disk before any part is downloaded
+	Preallocate bool
+
+	// Retries is the count of retries of each part
+	Retries int
+
+	// PartTimeout bounds each attempt of a part, a part which times out is
+	// retried without failing the download, 0 means no timeout
+	PartTimeout time.Duration
+
+	// StallTimeout fails an attempt of a part once no data of it arrives for the
+	// duration, it overrides BodyIdleTimeout of the client configuration so that a
+	// stalled part is retried without bounding a slow one, 0 keeps BodyIdleTimeout
+	StallTimeout time.Duration
+
+	// VerifyParts checks each part against the Content-MD5 returned by the
+	// server, a mismatching part is retried
+	VerifyParts bool
+
+	// VerifyResumedParts re-hashes the parts which a breakpoint records as done
+	// against their checksums before resuming, the mismatching ones and the ones
+	// without a checksum are downloaded again
+	VerifyResumedParts bool
+
+	// OnPartStart and OnPartDone are called around every attempt of a part,
+	// they are called from the workers concurrently
+	OnPartStart func(p Part)
+	OnPartDone  func(p Part, d time.Duration, err error)
+
+	// Pool bounds the bytes of parts in flight across the Downloaders sharing it
+	Pool *DownloadPool
+
+	// AlignParts splits the download along the parts of a multipart upload, whose
+	// size is read from UploadPartSizeMetadata, so that each downloaded part is an
+	// uploaded one. PartSize is used if the object has no such metadata.
+	AlignParts bool
+
+	// Decompress decompresses objects with Content-Encoding gzip into FilePath.
+	// The parts are assembled in the temp file first and decompressed in a single
+	// stream after all of them are written, ranged downloads are written as-is.
+	Decompress bool
+
+	// MaxObjectSize refuses to download more bytes than it, which is the length of
+	// the range of ranged downloads, before any part is requested, 0 means no limit
+	MaxObjectSize int64
+
+	// openFile opens the temp file for a part, it is replaced in tests
+	openFile func(name string, flag int, perm os.FileMode) (partFile, error)
+}
+
+// partFile is the file which a part is written to
+type partFile interface {
+	io.Writer
+	io.Seeker
+	io.Closer
 }
 
 // NewDownloader new a downloader
@@ -43,19 +116,96 @@ func NewDownloader(client *fds.Client, partSize int64, concurrency int, breakpoi
 
 		client: client,
 	}
-	downloader.logger = logrus.New()
-	downloader.logger.SetLevel(logrus.WarnLevel)
+	downloader.logger = nopLogger{}
+	downloader.lifecycle = newLifecycle()
 
 	return downloader, nil
 }
 
+// OverwritePolicy decides what to do if FilePath exists
+type OverwritePolicy int
+
+const (
+	// OverwriteExisting replaces the existing file, it is the default
+	OverwriteExisting OverwritePolicy = iota
+
+	// FailIfExists returns ErrorFileExists, it is checked before downloading
+	// and again when the downloaded file is moved to FilePath
+	FailIfExists
+
+	// SkipIfExists skips the download if the existing file has the size of the
+	// content to download, a file of another size is overwritten
+	SkipIfExists
+)
+
 // DownloadRequest is the input of Download
 type DownloadRequest struct {
 	fds.GetObjectRequest
-	FilePath string
+	FilePath  string
+	Overwrite OverwritePolicy
+
+	// Metadata is the metadata of the object known already, which is used instead
+	// of the metadata request. Info is used the same way if Metadata is nil.
+	Metadata *fds.ObjectMetadata
+	Info     *ObjectInfo
 
 	// private
 	breakpointFilePath string
+	etag               string
+	onEvent            func(DownloadEvent)
+
+	// breakpoint overrides Breakpoint of the Downloader for the request if it is set,
+	// so that a download can force it without copying the Downloader
+	breakpoint *bool
+}
+
+// ObjectInfo is what a listing tells of an object, Decompress and the alignment of
+// the parts to the ones of a multipart upload need the Metadata instead
+type ObjectInfo struct {
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// ObjectInfoOf returns the ObjectInfo of an object listed
+func ObjectInfoOf(summary fds.ObjectSummary) *ObjectInfo {
+	return &ObjectInfo{Size: summary.Size, ETag: summary.ETag, LastModified: summary.LastModified}
+}
+
+// metadata makes the metadata of the headers of a metadata request from info
+func (info *ObjectInfo) metadata() *fds.ObjectMetadata {
+	metadata := fds.NewObjectMetadata()
+	metadata.Set(fds.HTTPHeaderContentMetadataLength, strconv.FormatInt(info.Size, 10))
+	if info.ETag != "" {
+		metadata.Set(fds.HTTPHeaderETag, info.ETag)
+	}
+	if !info.LastModified.IsZero() {
+		metadata.Set(fds.HTTPHeaderLastModified, info.LastModified.UTC().Format(http.TimeFormat))
+	}
+	return metadata
+}
+
+// objectMetadata returns the Metadata or the Info of request, or requests the metadata if both are nil
+func (request *DownloadRequest) objectMetadata(ctx context.Context, client *fds.Client) (*fds.ObjectMetadata, error) {
+	if request.Metadata != nil {
+		return request.Metadata, nil
+	}
+	if request.Info != nil {
+		return request.Info.metadata(), nil
+	}
+
+	metadata, err := client.GetObjectVersionMetadataWithContext(ctx, request.BucketName, request.ObjectName, request.VersionID)
+	if err != nil {
+		return nil, archivedError(err)
+	}
+	return metadata, nil
+}
+
+// emit reports e to the DownloadTask of the request if any, it is called from the workers concurrently
+func (request *DownloadRequest) emit(e DownloadEvent) {
+	if request.onEvent != nil {
+		request.onEvent(e)
+	}
 }
 
 // Download performs the downloading action
@@ -65,73 +215,139 @@ func (downloader *Downloader) Download(request *DownloadRequest) error {
 
 // DownloadWithContext performs the downloading action with context controlling
 func (downloader *Downloader) DownloadWithContext(ctx context.Context, request *DownloadRequest) error {
-	if downloader.Breakpoint && request.breakpointFilePath != "" {
-		request.breakpointFilePath = fmt.Sprintf("%s.download.bp", request.FilePath)
-	}
+	_, err := downloader.DownloadWithResult(ctx, request)
+	return err
+}
 
-	var parts []part
-	var err error
+// DownloadResult is the effective settings and the statistics of a download
+type DownloadResult struct {
+	PartSize int64
+	Workers  int
 
-	metadata, err := downloader.client.GetObjectMetadataWithContext(ctx, request.BucketName, request.ObjectName)
-	if err != nil {
+	// TotalParts includes the parts finished before a breakpoint resume,
+	// FetchedParts and Bytes only count the parts downloaded in this run
+	TotalParts   int
+	FetchedParts int
+	Bytes        int64
+
+	Elapsed time.Duration
+	Retries int
+
+	// Skipped is true if SkipIfExists found FilePath up to date
+	Skipped bool
+}
+
+// DownloadWithResult performs the downloading action and returns the effective
+// settings and statistics, which are filled as far as the download goes on error
+func (downloader *Downloader) DownloadWithResult(ctx context.Context, request *DownloadRequest) (*DownloadResult, error) {
+	ctx, span, end := startSpan(ctx, downloader.client, "fds.manager.Download", objectAttributes(request.BucketName, request.ObjectName)...)
+	result := &DownloadResult{PartSize: downloader.PartSize}
+	start := time.Now()
+	err := downloader.download(ctx, request, result)
+	result.Elapsed = time.Since(start)
+	span.SetAttributes(fds.Attribute{Key: fds.AttributeResponseBytes, Value: result.Bytes})
+	end(err)
+	reportTransfer(downloader.client, TransferDownload, result.Elapsed, result.Bytes, result.Retries, err)
+	return result, err
+}
+
+func (downloader *Downloader) download(ctx context.Context, request *DownloadRequest, result *DownloadResult) error {
+	if err := request.validate(); err != nil {
 		return err
 	}
+	if request.isStream() {
+		return downloader.downloadStream(ctx, request, result)
+	}
 
-	contentLength, err := strconv.ParseInt(metadata.Get(fds.HTTPHeaderContentMetadataLength), 10, 0)
+	ctx, release, err := downloader.lifecycle.begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer release()
 
-	ranges, err := httpparser.Range(request.Range)
+	// the path is not kept in request, which may be downloaded again to another FilePath
+	breakpoint := downloader.breakpoint(request)
+	breakpointFilePath := request.breakpointFilePath
+	if breakpoint && breakpointFilePath == "" {
+		breakpointFilePath = request.FilePath + breakpointSuffix
+	}
+
+	var parts []part
+
+	metadata, err := request.objectMetadata(ctx, downloader.client)
 	if err != nil {
 		return err
 	}
+	request.etag = metadata.GetETag()
 
-	if len(ranges) == 0 {
-		ranges = append(ranges, httpparser.HTTPRange{End: contentLength})
+	contentLength, err := objectSize(metadata)
+	if err != nil {
+		return err
 	}
 
-	if len(ranges) > 1 {
-		return ErrorRnageFormat
+	if contentLength == 0 {
+		if request.upToDate(0) {
+			result.Skipped = true
+			return nil
+		}
+		flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if request.Overwrite == FailIfExists {
+			flag |= os.O_EXCL
+		}
+		fd, err := os.OpenFile(request.FilePath, flag, os.FileMode(0664))
+		if os.IsExist(err) {
+			return fmt.Errorf("%w: %s", ErrorFileExists, request.FilePath)
+		}
+		if err != nil {
+			return err
+		}
+		return fd.Close()
 	}
 
-	start := ranges[0].Start
-	end := ranges[0].End + 1
-	if ranges[0].Start < 0 || ranges[0].Start >= contentLength || ranges[0].End > contentLength || ranges[0].Start > ranges[0].End {
-		start = 0
-		end = contentLength
+	r, err := downloadRange(request.Range, contentLength)
+	if err != nil {
+		return err
 	}
-	r := httpparser.HTTPRange{
-		Start: start,
-		End:   end,
+	if err := downloader.checkSize(r); err != nil {
+		return err
+	}
+	if request.upToDate(r.End - r.Start) {
+		result.Skipped = true
+		return nil
 	}
 
 	bp := breakpointInfo{
 		downloader: downloader,
 	}
-	if downloader.Breakpoint {
+	if breakpoint {
 		// load breakpoint info
-		err = bp.Load(request.breakpointFilePath)
+		err = bp.Load(breakpointFilePath)
 		if err != nil {
 			bp.Destroy()
 		}
 
 		// validate breakpoint info
-		err = bp.Validate(request.BucketName, request.ObjectName, r)
+		err = bp.Validate(request.BucketName, request.ObjectName, request.VersionID, r, metadata)
 		if err != nil {
 			downloader.logger.Debug(err)
 			downloader.logger.Debug("breakpoint info is invalid")
-			bp.Initilize(downloader, request.BucketName, request.ObjectName, request.breakpointFilePath, r, metadata)
+			bp.Initilize(downloader, request.BucketName, request.ObjectName, request.VersionID, breakpointFilePath, r, metadata)
 			bp.Destroy()
+		} else if downloader.VerifyResumedParts {
+			bp.verifyParts(request.FilePath + ".tmp")
 		}
 
 		// get parts from breakpoint info
 		parts = bp.UnfinishParts()
+		result.TotalParts = len(bp.Parts)
+		result.PartSize = partSizeOf(bp.Parts)
 	} else {
-		parts, err = downloader.splitDownloadParts(contentLength, r)
+		parts, err = downloader.splitDownloadParts(metadata, r)
 		if err != nil {
 			return err
 		}
+		result.TotalParts = len(parts)
+		result.PartSize = partSizeOf(parts)
 	}
 
 	jobs := make(chan part, len(parts))
@@ -140,86 +356,572 @@ func (downloader *Downloader) DownloadWithContext(ctx context.Context, request *
 	finished := make(chan bool)
 
 	tmpFilePath := request.FilePath + ".tmp"
-	for i := 1; i < downloader.Concurrency; i++ {
-		go downloader.downloaderTaskConsumer(ctx, i, request, tmpFilePath, jobs, results, failed, finished)
+	if downloader.Preallocate {
+		err = preallocateFile(tmpFilePath, r.End-r.Start)
+		if err != nil {
+			return downloader.cleanupFailed(err, tmpFilePath, breakpoint)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	workers := workerCount(downloader.logger, downloader.Concurrency, len(parts))
+	result.Workers = workers
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			downloader.downloaderTaskConsumer(ctx, id, request, tmpFilePath, jobs, results, failed, finished)
+		}(i)
 	}
 
-	go downloader.downloaderTaskProducer(jobs, parts)
+	go downloader.downloaderTaskProducer(jobs, parts, finished)
+
+	record := func(p part) {
+		result.FetchedParts++
+		result.Bytes += p.End - p.Start + 1
+		result.Retries += p.retries
+		request.emit(DownloadEvent{Type: DownloadPartCompleted, Part: p.view()})
+		if breakpoint {
+			bp.done(p)
+			bp.Dump()
+		}
+	}
 
 	completed := 0
 	for completed < len(parts) {
 		select {
 		case p := <-results:
 			completed++
-			if downloader.Breakpoint {
-				bp.PartStat[p.Index] = true
-				bp.Dump()
-			}
+			record(p)
 		case err := <-failed:
 			close(finished)
-			return err
+			cancel()
+			wg.Wait()
+
+			// keep the progress of the parts finished along with the failed one
+			for len(results) > 0 {
+				record(<-results)
+			}
+
+			// the downloaded parts belong to another version of the object
+			if errors.Is(err, ErrorObjectChanged) {
+				if breakpoint {
+					bp.Destroy()
+				}
+				os.Remove(tmpFilePath)
+				return err
+			}
+			return downloader.cleanupFailed(err, tmpFilePath, breakpoint)
 		}
 	}
+	wg.Wait()
+
+	if breakpoint {
+		os.Remove(breakpointFilePath)
+	}
+	if downloader.Decompress && request.Range == "" &&
+		strings.EqualFold(metadata.GetContentEncoding(), "gzip") {
+		return decompressFile(tmpFilePath, request)
+	}
 
-	if downloader.Breakpoint {
-		os.Remove(request.breakpointFilePath)
+	err = request.rename(tmpFilePath)
+	if errors.Is(err, ErrorFileExists) {
+		os.Remove(tmpFilePath)
 	}
-	return os.Rename(tmpFilePath, request.FilePath)
+	return err
 }
 
-func (downloader *Downloader) downloaderTaskConsumer(ctx context.Context, id int,
-	request *DownloadRequest, tmpFilePath string, jobs <-chan part, results chan<- part, failed chan<- error, finished <-chan bool) {
-	for p := range jobs {
-		req := &fds.GetObjectRequest{
-			BucketName: request.BucketName,
-			ObjectName: request.ObjectName,
-			Range:      fmt.Sprintf("bytes=%v-%v", p.Start, p.End),
+// objectSize is the size of the object described by metadata, which the parts, the range
+// and the breakpoints of a download are computed from. It is x-xiaomi-meta-content-length,
+// the size stored in FDS, as Content-Length is only the length of the body of a response,
+// such as the empty one of a metadata request or a part of the object.
+func objectSize(metadata *fds.ObjectMetadata) (int64, error) {
+	return metadata.GetContentLength()
+}
+
+// validateObject checks the object to download is specified
+func (request *DownloadRequest) validateObject() error {
+	if request.BucketName == "" {
+		return ErrorBucketNameEmpty
+	}
+	if request.ObjectName == "" {
+		return ErrorObjectNameEmpty
+	}
+	return nil
+}
+
+// validate checks the request before any request is sent, so that a bad
+// FilePath fails fast instead of after the metadata round trip
+func (request *DownloadRequest) validate() error {
+	if err := request.validateObject(); err != nil {
+		return err
+	}
+	if request.FilePath == "" {
+		return ErrorFilePathEmpty
+	}
+
+	if info, err := os.Stat(request.FilePath); err == nil && info.IsDir() {
+		return fmt.Errorf("%w: %s", ErrorFilePathIsDirectory, request.FilePath)
+	} else if err == nil && request.Overwrite == FailIfExists {
+		return fmt.Errorf("%w: %s", ErrorFileExists, request.FilePath)
+	} else if err == nil && !info.Mode().IsRegular() {
+		// a pipe or a device is written in place, nothing is created beside it
+		return nil
+	}
+
+	dir := filepath.Dir(request.FilePath)
+	probe, err := ioutil.TempFile(dir, ".fds-probe-")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrorDirectoryNotWritable, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// isStream returns true if FilePath is a named pipe, a device or another file
+// which can not be seeked, such as /dev/stdout
+func (request *DownloadRequest) isStream() bool {
+	info, err := os.Stat(request.FilePath)
+	return err == nil && !info.Mode().IsRegular()
+}
+
+// downloadStream downloads to the non-regular FilePath with DownloadSequential, so that
+// the parts are written in order. Opening a pipe blocks until it has a reader.
+func (downloader *Downloader) downloadStream(ctx context.Context, request *DownloadRequest, result *DownloadResult) error {
+	if downloader.breakpoint(request) || downloader.Preallocate || downloader.Decompress {
+		downloader.logger.Debug(fmt.Sprintf("%s is not a regular file, Breakpoint, Preallocate and Decompress are ignored", request.FilePath))
+	}
+
+	fd, err := os.OpenFile(request.FilePath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	err = downloader.downloadSequential(ctx, request, fd, result)
+	if e := fd.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// upToDate returns true if SkipIfExists is set and FilePath has size bytes
+func (request *DownloadRequest) upToDate(size int64) bool {
+	if request.Overwrite != SkipIfExists {
+		return false
+	}
+	info, err := os.Stat(request.FilePath)
+	return err == nil && info.Mode().IsRegular() && info.Size() == size
+}
+
+// rename moves the downloaded file to FilePath following the Overwrite policy
+func (request *DownloadRequest) rename(src string) error {
+	if request.Overwrite != FailIfExists {
+		return os.Rename(src, request.FilePath)
+	}
+
+	// a link fails on an existing FilePath, which a rename would replace
+	if err := os.Link(src, request.FilePath); err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%w: %s", ErrorFileExists, request.FilePath)
 		}
+		return err
+	}
+	return os.Remove(src)
+}
 
-		data, err := downloader.client.GetObjectWithContext(ctx, req)
-		if err != nil {
-			downloader.logger.Debug(err.Error())
-			failed <- err
-			break
+// downloadRange returns the range to download of an object, End is exclusive,
+// an invalid range falls back to the whole object
+func downloadRange(rangeHeader string, contentLength int64) (httpparser.HTTPRange, error) {
+	ranges, err := httpparser.Range(rangeHeader)
+	if err != nil {
+		return httpparser.HTTPRange{}, err
+	}
+
+	if len(ranges) == 0 {
+		ranges = append(ranges, httpparser.HTTPRange{End: contentLength - 1})
+	}
+
+	if len(ranges) > 1 {
+		return httpparser.HTTPRange{}, ErrorRnageFormat
+	}
+
+	start := ranges[0].Start
+	end := ranges[0].End + 1
+	if ranges[0].Start < 0 || ranges[0].Start >= contentLength || ranges[0].End >= contentLength || ranges[0].Start > ranges[0].End {
+		start = 0
+		end = contentLength
+	}
+	return httpparser.HTTPRange{
+		Start: start,
+		End:   end,
+	}, nil
+}
+
+// checkSize checks the length of r against MaxObjectSize
+func (downloader *Downloader) checkSize(r httpparser.HTTPRange) error {
+	if downloader.MaxObjectSize > 0 && r.End-r.Start > downloader.MaxObjectSize {
+		return fmt.Errorf("%w: %d bytes, at most %d", ErrorObjectTooLarge, r.End-r.Start, downloader.MaxObjectSize)
+	}
+	return nil
+}
+
+// decompressFile writes the gunzipped content of src to FilePath of request and removes src
+func decompressFile(src string, request *DownloadRequest) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	out, err := os.OpenFile(request.FilePath+".gunzip", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(0664))
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, zr); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err = out.Close(); err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+
+	if err = request.rename(out.Name()); err != nil {
+		os.Remove(out.Name())
+		if errors.Is(err, ErrorFileExists) {
+			os.Remove(src)
 		}
-		defer data.Close()
+		return err
+	}
+	return os.Remove(src)
+}
 
+func (downloader *Downloader) downloaderTaskConsumer(ctx context.Context, id int,
+	request *DownloadRequest, tmpFilePath string, jobs <-chan part, results chan<- part, failed chan<- error, finished <-chan bool) {
+	for p := range jobs {
 		select {
 		case <-finished:
 			return
 		default:
 		}
 
-		fd, err := os.OpenFile(tmpFilePath, os.O_WRONLY|os.O_CREATE, os.FileMode(0664))
+		size := p.End - p.Start + 1
+		err := downloader.Pool.acquire(ctx, size)
+		if err == nil {
+			p, err = downloader.downloadPartWithRetries(ctx, request, tmpFilePath, p)
+			downloader.Pool.release(size)
+		}
 		if err != nil {
-			failed <- err
-			break
+			select {
+			case failed <- err:
+			case <-finished:
+			}
+			return
 		}
 
-		_, err = fd.Seek(p.Start-p.Offset, io.SeekStart)
-		if err != nil {
-			fd.Close()
-			failed <- err
-			break
+		results <- p
+	}
+}
+
+// downloadPartWithRetries returns p with the count of retries and the checksum of the
+// downloaded data along with the error of the last attempt
+func (downloader *Downloader) downloadPartWithRetries(ctx context.Context, request *DownloadRequest, tmpFilePath string, p part) (part, error) {
+	var err error
+	attempts := 0
+	p.retries, err = downloader.retryPart(ctx, p, func(ctx context.Context) error {
+		if attempts > 0 {
+			request.emit(DownloadEvent{Type: DownloadPartRetried, Part: p.view(), Err: err})
 		}
+		attempts++
+		p.sum, err = downloader.downloadPart(ctx, request, tmpFilePath, p)
+		return err
+	})
+	return p, err
+}
 
-		_, err = io.Copy(fd, data)
-		if err != nil {
-			fd.Close()
-			failed <- err
+// retryPart calls attempt up to Retries+1 times along with the part hooks,
+// each attempt is given a context bounded by PartTimeout and the part is traced by a span
+func (downloader *Downloader) retryPart(ctx context.Context, p part, attempt func(ctx context.Context) error) (int, error) {
+	atomic.AddInt64(&downloader.stats.inFlight, 1)
+	defer atomic.AddInt64(&downloader.stats.inFlight, -1)
+
+	ctx, span, end := startSpan(ctx, downloader.client, "fds.manager.DownloadPart",
+		fds.Attribute{Key: AttributePart, Value: p.Index},
+		fds.Attribute{Key: fds.AttributeResponseBytes, Value: p.End - p.Start + 1})
+
+	var err error
+	i := 0
+	for ; i <= downloader.Retries; i++ {
+		err = downloader.attemptPartWithHooks(p, func() error {
+			return downloader.attemptWithTimeout(ctx, p, attempt)
+		})
+		if err == nil || ctx.Err() != nil || i == downloader.Retries || errors.Is(err, ErrorObjectChanged) || errors.Is(err, ErrorObjectArchived) {
 			break
 		}
+		downloader.logger.Debug(err.Error())
+		span.AddEvent(fds.EventRetry, fds.Attribute{Key: fds.AttributeAttempt, Value: i + 1},
+			fds.Attribute{Key: fds.AttributeError, Value: err.Error()})
+	}
+	end(err)
+
+	atomic.AddInt64(&downloader.stats.retries, int64(i))
+	switch {
+	case err == nil:
+		atomic.AddInt64(&downloader.stats.parts, 1)
+		atomic.AddInt64(&downloader.stats.bytes, p.End-p.Start+1)
+	case ctx.Err() == nil:
+		atomic.AddInt64(&downloader.stats.failedParts, 1)
+	}
+	return i, err
+}
 
-		fd.Close()
-		results <- p
+// attemptWithTimeout turns the deadline of PartTimeout into ErrorPartTimeout,
+// which is retried unlike the deadline of ctx, and bounds the stalls of the body by StallTimeout
+func (downloader *Downloader) attemptWithTimeout(ctx context.Context, p part, attempt func(ctx context.Context) error) error {
+	if downloader.StallTimeout > 0 {
+		ctx = fds.WithBodyIdleTimeout(ctx, downloader.StallTimeout)
+	}
+	if downloader.PartTimeout <= 0 {
+		return attempt(ctx)
+	}
+
+	partCtx, cancel := context.WithTimeout(ctx, downloader.PartTimeout)
+	defer cancel()
+	err := attempt(partCtx)
+	if err != nil && ctx.Err() == nil && partCtx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%w: part %d after %v", ErrorPartTimeout, p.Index, downloader.PartTimeout)
+	}
+	return err
+}
+
+func (downloader *Downloader) attemptPartWithHooks(p part, attempt func() error) error {
+	if downloader.OnPartStart == nil && downloader.OnPartDone == nil {
+		return attempt()
+	}
+
+	if downloader.OnPartStart != nil {
+		downloader.OnPartStart(p.view())
+	}
+	start := time.Now()
+	err := attempt()
+	if downloader.OnPartDone != nil {
+		downloader.OnPartDone(p.view(), time.Since(start), err)
 	}
+	return err
 }
 
-func (downloader *Downloader) downloaderTaskProducer(jobs chan part, parts []part) {
+// downloadPart writes part p into the temp file and returns the checksum of it
+func (downloader *Downloader) downloadPart(ctx context.Context, request *DownloadRequest, tmpFilePath string, p part) (string, error) {
+	data, metadata, err := downloader.getPart(ctx, request, p)
+	if err != nil {
+		return "", err
+	}
+	defer data.Close()
+
+	openFile := downloader.openFile
+	if openFile == nil {
+		openFile = openPartFile
+	}
+	fd, err := openFile(tmpFilePath, os.O_WRONLY|os.O_CREATE, os.FileMode(0664))
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	_, err = fd.Seek(p.Start-p.Offset, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+
+	h := md5.New()
+	if err := downloader.copyPart(p, io.MultiWriter(fd, h), data, metadata); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// getPart gets the range of part p, the range applies only to the ETag of the object
+// when the download started, ErrorObjectChanged is returned if the object is changed,
+// ErrorObjectArchived if the object is archived and not restored
+func (downloader *Downloader) getPart(ctx context.Context, request *DownloadRequest, p part) (io.ReadCloser, *fds.ObjectMetadata, error) {
+	req := &fds.GetObjectRequest{
+		BucketName: request.BucketName,
+		ObjectName: request.ObjectName,
+		IfRange:    request.etag,
+		VersionID:  request.VersionID,
+		Headers:    request.Headers,
+	}
+	if err := req.SetRange(p.Start, p.End); err != nil {
+		return nil, nil, err
+	}
+
+	data, metadata, err := downloader.client.GetObjectWithMetadataWithContext(ctx, req)
+	if fds.IsPreconditionFailed(err) {
+		return nil, nil, ErrorObjectChanged
+	}
+	if err != nil {
+		return nil, nil, archivedError(err)
+	}
+
+	if etag := metadata.GetETag(); request.etag != "" && etag != "" && etag != request.etag {
+		data.Close()
+		return nil, nil, ErrorObjectChanged
+	}
+	if err := checkPartRange(p, metadata); err != nil {
+		data.Close()
+		return nil, nil, err
+	}
+	return data, metadata, nil
+}
+
+// checkPartRange returns ErrorPartRangeNotMatching unless the Content-Range of the response
+// is the range of part p, a response without it is the whole object which is accepted only
+// if the object is exactly the part
+func checkPartRange(p part, metadata *fds.ObjectMetadata) error {
+	r, err := metadata.GetContentRange()
+	if err == nil {
+		if r.Start != p.Start || r.End != p.End {
+			return fmt.Errorf("%w: part %d got bytes %d-%d of %d-%d", ErrorPartRangeNotMatching,
+				p.Index, r.Start, r.End, p.Start, p.End)
+		}
+		return nil
+	}
+
+	if p.Start == 0 {
+		// the length of the object, or of the body if it is unknown, has to be the part's
+		length, e := metadata.GetContentLength()
+		if errors.Is(e, fds.ErrorMetadataNotFound) {
+			length, e = bodyLength(metadata)
+		}
+		if errors.Is(e, fds.ErrorMetadataNotFound) || (e == nil && length == p.End+1) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: part %d got no Content-Range: %v", ErrorPartRangeNotMatching, p.Index, err)
+}
+
+// bodyLength returns the Content-Length of the response whose metadata is metadata,
+// ErrorMetadataNotFound is returned if it is absent
+func bodyLength(metadata *fds.ObjectMetadata) (int64, error) {
+	v := metadata.Get(fds.HTTPHeaderContentLength)
+	if v == "" {
+		return 0, fds.ErrorMetadataNotFound
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// archivedError wraps the error of reading an archived object with ErrorObjectArchived
+func archivedError(err error) error {
+	if fds.IsObjectArchived(err) {
+		return fmt.Errorf("%w: %v", ErrorObjectArchived, err)
+	}
+	return err
+}
+
+// copyPart copies the data of a part to w, ErrorPartLengthNotMatching is returned if the length
+// of data is not the part's, the checksum is verified if VerifyParts is set
+func (downloader *Downloader) copyPart(p part, w io.Writer, data io.Reader, metadata *fds.ObjectMetadata) error {
+	if !downloader.VerifyParts {
+		return copyPartData(p, w, data)
+	}
+
+	h := md5.New()
+	if err := copyPartData(p, io.MultiWriter(w, h), data); err != nil {
+		return err
+	}
+
+	expected := metadata.GetContentMD5()
+	if expected == "" {
+		downloader.logger.Debug(fmt.Sprintf("part %d has no checksum to verify", p.Index))
+		return nil
+	}
+	if base64.StdEncoding.EncodeToString(h.Sum(nil)) != expected {
+		return ErrorPartChecksumNotMatching
+	}
+	return nil
+}
+
+// copyPartData copies exactly the length of part p from data to w, nothing beyond the part is written
+func copyPartData(p part, w io.Writer, data io.Reader) error {
+	expected := p.End - p.Start + 1
+	n, err := io.CopyN(w, data, expected)
+	if err == io.EOF {
+		return fmt.Errorf("%w: part %d got %d of %d bytes", ErrorPartLengthNotMatching, p.Index, n, expected)
+	}
+	if err != nil {
+		return err
+	}
+
+	if m, _ := data.Read(make([]byte, 1)); m > 0 {
+		return fmt.Errorf("%w: part %d got more than %d bytes", ErrorPartLengthNotMatching, p.Index, expected)
+	}
+	return nil
+}
+
+func openPartFile(name string, flag int, perm os.FileMode) (partFile, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+// breakpoint returns whether request is downloaded with breakpoint
+func (downloader *Downloader) breakpoint(request *DownloadRequest) bool {
+	if request.breakpoint != nil {
+		return *request.breakpoint
+	}
+	return downloader.Breakpoint
+}
+
+// cleanupFailed turns a full disk into ErrorDiskFull, the temp file is removed
+// to free the space unless it holds the progress of a breakpoint
+func (downloader *Downloader) cleanupFailed(err error, tmpFilePath string, breakpoint bool) error {
+	if !errors.Is(err, syscall.ENOSPC) {
+		return err
+	}
+
+	if !breakpoint {
+		os.Remove(tmpFilePath)
+	}
+	return fmt.Errorf("%w: %v", ErrorDiskFull, err)
+}
+
+// partSizeOf returns the size of the parts, which is the size of the first one
+// as the last one may be shorter
+func partSizeOf(parts []part) int64 {
+	if len(parts) == 0 {
+		return 0
+	}
+	return parts[0].End - parts[0].Start + 1
+}
+
+// workerCount caps the count of workers at the count of parts, so that no worker is idle
+func workerCount(logger Logger, concurrency int, parts int) int {
+	if concurrency > parts {
+		logger.Debug(fmt.Sprintf("concurrency %d is clamped to %d parts", concurrency, parts))
+		return parts
+	}
+	return concurrency
+}
+
+// downloaderTaskProducer sends parts to jobs until finished is closed, so that it
+// does not block on jobs which is no longer consumed after a part failed
+func (downloader *Downloader) downloaderTaskProducer(jobs chan<- part, parts []part, finished <-chan bool) {
+	defer close(jobs)
+
 	for _, p := range parts {
-		jobs <- p
+		select {
+		case jobs <- p:
+		case <-finished:
+			return
+		}
 	}
-	close(jobs)
 }
 
 type part struct {
@@ -227,26 +929,72 @@ type part struct {
 	Start  int64
 	End    int64
 	Offset int64
+
+	// retries is the count of retries of the last download of the part
+	retries int
+
+	// sum is the base64 MD5 of the downloaded part
+	sum string
 }
 
-func (downloader Downloader) splitDownloadParts(contentLength int64, r httpparser.HTTPRange) ([]part, error) {
+// Part is a read-only view of a part, Start and End are both inclusive
+type Part struct {
+	Index int
+	Start int64
+	End   int64
+}
+
+func (p part) view() Part {
+	return Part{
+		Index: p.Index,
+		Start: p.Start,
+		End:   p.End,
+	}
+}
+
+func (downloader *Downloader) splitDownloadParts(md *fds.ObjectMetadata, r httpparser.HTTPRange) ([]part, error) {
 	var parts []part
 
+	partSize := downloader.PartSize
+	offset := r.Start
+	if uploadPartSize, ok := downloader.uploadPartSize(md); ok {
+		// the first part ends at the boundary of the uploaded part r.Start is in
+		partSize = uploadPartSize
+		offset -= r.Start % partSize
+	}
+
 	i := 0
-	for offset := r.Start; offset < r.End; offset += downloader.PartSize {
+	for start := r.Start; start < r.End; offset += partSize {
 		p := part{
 			Index:  i,
-			Start:  offset,
-			End:    getEnd(offset, r.End, contentLength),
+			Start:  start,
+			End:    getEnd(offset, r.End, partSize),
 			Offset: r.Start,
 		}
 		i++
 		parts = append(parts, p)
+		start = p.End + 1
 	}
 
 	return parts, nil
 }
 
+// uploadPartSize returns the part size recorded by Uploader if AlignParts is set
+func (downloader *Downloader) uploadPartSize(md *fds.ObjectMetadata) (int64, bool) {
+	if !downloader.AlignParts || md == nil {
+		return 0, false
+	}
+	v := md.GetUserMetadata()[UploadPartSizeMetadata]
+	partSize, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || partSize < fds.MinPartSize || partSize > fds.MaxPartSize {
+		if v != "" {
+			downloader.logger.Debug(fmt.Sprintf("upload part size %q is invalid, PartSize is used", v))
+		}
+		return 0, false
+	}
+	return partSize, true
+}
+
 func getEnd(begin int64, total int64, per int64) int64 {
 	if begin+per > total {
 		return total - 1
@@ -254,83 +1002,162 @@ func getEnd(begin int64, total int64, per int64) int64 {
 	return begin + per - 1
 }
 
+// breakpointVersion is the layout of the breakpoints of downloads and uploads, the
+// ones without a version are written before it was added and have the same layout
+const breakpointVersion = 1
+
+// checkBreakpointVersion rejects the breakpoints written by a newer layout
+func checkBreakpointVersion(version int) error {
+	if version < 0 || version > breakpointVersion {
+		return fmt.Errorf("%w: %d", ErrorBreakpointVersion, version)
+	}
+	return nil
+}
+
 type breakpointInfo struct {
+	Version int `json:",omitempty"`
+
+	// FilePath is where the breakpoint was last written, it is informational only,
+	// so that a breakpoint can be moved along with the temp file to resume elsewhere
 	FilePath   string
 	BucketName string
 	ObjectName string
+
+	// VersionID is the version downloaded, empty for the latest one
+	VersionID string `json:",omitempty"`
+
 	ObjectStat objectStat
 	Parts      []part
 	PartStat   []bool
-	Start      int64
-	End        int64
-	MD5        string
+
+	// PartMD5 are the base64 MD5 of the done parts, it is absent in breakpoints
+	// written before it was added
+	PartMD5 []string `json:",omitempty"`
+
+	Start int64
+	End   int64
+	MD5   string
 
 	downloader *Downloader
+
+	// path is where the breakpoint is loaded from and dumped to
+	path string
 }
 
 type objectStat struct {
 	Size         int64  // Object size
 	LastModified string // Last modified time
+	ETag         string // Object ETag
+}
+
+// Matches reports whether the object described by metadata is still the same object.
+// ETag is the primary change detection, LastModified is used only when there is no ETag.
+func (stat objectStat) Matches(size int64, metadata *fds.ObjectMetadata) bool {
+	if stat.Size != size {
+		return false
+	}
+
+	etag := metadata.GetETag()
+	if stat.ETag != "" || etag != "" {
+		return stat.ETag == etag
+	}
+
+	lastModified, err := metadata.GetLastModified()
+	recorded, errRecorded := parseLastModified(stat.LastModified)
+	if err != nil || errRecorded != nil {
+		// unparsable values are compared verbatim
+		return stat.LastModified == metadata.Get(fds.HTTPHeaderLastModified)
+	}
+	// the dates are compared in second granularity, so that equivalent dates in
+	// different formats or time zones are the same
+	return recorded.Truncate(time.Second).Equal(lastModified.Truncate(time.Second))
+}
+
+// lastModifiedOf returns Last-Modified of metadata in RFC1123 with GMT, it is kept as-is if invalid
+func lastModifiedOf(metadata *fds.ObjectMetadata) string {
+	t, err := metadata.GetLastModified()
+	if err != nil {
+		return metadata.Get(fds.HTTPHeaderLastModified)
+	}
+	return t.UTC().Format(http.TimeFormat)
+}
+
+// parseLastModified parses a recorded Last-Modified header like GetLastModified
+func parseLastModified(v string) (time.Time, error) {
+	metadata := fds.NewObjectMetadata()
+	metadata.Set(fds.HTTPHeaderLastModified, v)
+	return metadata.GetLastModified()
 }
 
 func (bp *breakpointInfo) Load(path string) error {
+	bp.path = path
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(data, bp)
+	if err := json.Unmarshal(data, bp); err != nil {
+		return err
+	}
+	return checkBreakpointVersion(bp.Version)
 }
 
-func (bp *breakpointInfo) Dump() error {
+func (bp *breakpointInfo) checksum() (string, error) {
 	bpi := *bp
-
 	bpi.MD5 = ""
 	data, err := json.Marshal(bpi)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	sum := md5.Sum(data)
-	b64 := base64.StdEncoding.EncodeToString(sum[:])
-	bpi.MD5 = b64
+	return base64.StdEncoding.EncodeToString(sum[:]), nil
+}
 
-	data, err = json.Marshal(bpi)
+func (bp *breakpointInfo) Dump() error {
+	bp.FilePath = bp.path
+	bp.Version = breakpointVersion
+	sum, err := bp.checksum()
 	if err != nil {
 		return err
 	}
 
-	return ioutil.WriteFile(bpi.FilePath, data, os.FileMode(0664))
+	bpi := *bp
+	bpi.MD5 = sum
+	data, err := json.Marshal(bpi)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(bp.path, data, os.FileMode(0664))
 }
 
-func (bp *breakpointInfo) Validate(bucketName, objectName string, r httpparser.HTTPRange) error {
+// Validate checks bp against the object to download, metadata is the one the download
+// resolved, so that validating a breakpoint requests nothing more
+func (bp *breakpointInfo) Validate(bucketName, objectName, versionID string, r httpparser.HTTPRange, metadata *fds.ObjectMetadata) error {
+	if err := checkBreakpointVersion(bp.Version); err != nil {
+		return err
+	}
 	if bucketName != bp.BucketName || objectName != bp.ObjectName {
 		return ErrorBucketOrObjectNotMatching
 	}
+	if versionID != bp.VersionID {
+		return ErrorVersionNotMatching
+	}
 
-	bpi := *bp
-	bpi.MD5 = ""
-	data, err := json.Marshal(bpi)
+	sum, err := bp.checksum()
 	if err != nil {
 		return err
 	}
-	sum := md5.Sum(data)
-	b64 := base64.StdEncoding.EncodeToString(sum[:])
-	if b64 != bp.MD5 {
+	if sum != bp.MD5 {
 		return ErrorMD5NotMatching
 	}
 
-	c := bp.downloader.client
-	metadata, err := c.GetObjectMetadata(bucketName, objectName)
+	length, err := objectSize(metadata)
 	if err != nil {
 		return err
 	}
-
-	length, err := metadata.GetContentLength()
-	if err != nil {
-		return err
-	}
-	if bp.ObjectStat.Size != length || bp.ObjectStat.LastModified != metadata.Get(fds.HTTPHeaderLastModified) {
+	if !bp.ObjectStat.Matches(length, metadata) {
 		return ErrorObjectStateNotMatching
 	}
 
@@ -354,36 +1181,86 @@ func (bp *breakpointInfo) UnfinishParts() []part {
 }
 
 func (bp *breakpointInfo) Initilize(downloader *Downloader,
-	bucketName, objectName, filePath string, r httpparser.HTTPRange, md *fds.ObjectMetadata) error {
+	bucketName, objectName, versionID, filePath string, r httpparser.HTTPRange, md *fds.ObjectMetadata) error {
 	bp.MD5 = ""
 	bp.BucketName = bucketName
 	bp.ObjectName = objectName
+	bp.VersionID = versionID
 	bp.FilePath = filePath
+	bp.path = filePath
 	bp.Start = r.Start
 	bp.End = r.End
 	bp.downloader = downloader
 
-	contentLength, err := md.GetContentLength()
+	contentLength, err := objectSize(md)
 	if err != nil {
 		return err
 	}
 
-	parts, err := downloader.splitDownloadParts(contentLength, r)
+	parts, err := downloader.splitDownloadParts(md, r)
 	if err != nil {
 		return err
 	}
 	bp.Parts = parts
 
 	bp.PartStat = make([]bool, len(bp.Parts))
+	bp.PartMD5 = make([]string, len(bp.Parts))
 
 	bp.ObjectStat = objectStat{
 		Size:         contentLength,
-		LastModified: md.Get(fds.HTTPHeaderLastModified),
+		LastModified: lastModifiedOf(md),
+		ETag:         md.GetETag(),
 	}
 
 	return nil
 }
 
+// done records part p as done along with its checksum
+func (bp *breakpointInfo) done(p part) {
+	bp.PartStat[p.Index] = true
+	if len(bp.PartMD5) != len(bp.Parts) {
+		bp.PartMD5 = make([]string, len(bp.Parts))
+	}
+	bp.PartMD5[p.Index] = p.sum
+}
+
+// verifyParts marks the done parts as undone unless the data of them in tmpFilePath
+// matches their checksums
+func (bp *breakpointInfo) verifyParts(tmpFilePath string) {
+	fd, err := os.Open(tmpFilePath)
+	if err == nil {
+		defer fd.Close()
+	}
+
+	for i, p := range bp.Parts {
+		if !bp.PartStat[i] {
+			continue
+		}
+		if err != nil || i >= len(bp.PartMD5) || bp.PartMD5[i] == "" {
+			bp.PartStat[i] = false
+			continue
+		}
+
+		h := md5.New()
+		size := p.End - p.Start + 1
+		n, e := io.Copy(h, io.NewSectionReader(fd, p.Start-p.Offset, size))
+		if e != nil || n != size || base64.StdEncoding.EncodeToString(h.Sum(nil)) != bp.PartMD5[i] {
+			bp.downloader.logger.Debug(fmt.Sprintf("part %d of breakpoint is corrupted", p.Index))
+			bp.PartStat[i] = false
+		}
+	}
+}
+
 func (bp *breakpointInfo) Destroy() {
-	os.Remove(bp.FilePath)
+	os.Remove(bp.path)
+}
+
+// wellFormed reports whether the loaded breakpoint has the fields of a download and
+// matches its checksum
+func (bp *breakpointInfo) wellFormed() bool {
+	if bp.BucketName == "" || bp.ObjectName == "" || len(bp.Parts) != len(bp.PartStat) {
+		return false
+	}
+	sum, err := bp.checksum()
+	return err == nil && sum == bp.MD5
 }
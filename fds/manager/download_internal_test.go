@@ -1,7 +1,1699 @@
 package manager
 
-import "testing"
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/go-fds/fds"
+	"github.com/XiaoMi/go-fds/fds/httpparser"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
 
 func TestDownloader_splitDownloadParts(t *testing.T) {
+	downloader, err := NewDownloader(nil, 300, 1, false)
+	assert.Nil(t, err)
+
+	bounds := func(parts []part) [][2]int64 {
+		var result [][2]int64
+		for i, p := range parts {
+			assert.Equal(t, i, p.Index)
+			result = append(result, [2]int64{p.Start, p.End})
+		}
+		return result
+	}
+
+	md := fds.NewObjectMetadata()
+	md.Set(fds.XiaomiMetaPrefix+UploadPartSizeMetadata, strconv.Itoa(fds.MinPartSize))
+	full := httpparser.HTTPRange{Start: 0, End: 2*fds.MinPartSize + 10}
+	ranged := httpparser.HTTPRange{Start: 100, End: fds.MinPartSize + 200}
+
+	// PartSize is used unless AlignParts is set
+	parts, err := downloader.splitDownloadParts(md, ranged)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), parts[0].Start)
+	assert.Equal(t, int64(399), parts[0].End)
+	assert.Equal(t, int64(fds.MinPartSize+199), parts[len(parts)-1].End)
+
+	downloader.AlignParts = true
+	parts, err = downloader.splitDownloadParts(md, full)
+	assert.Nil(t, err)
+	assert.Equal(t, [][2]int64{
+		{0, fds.MinPartSize - 1},
+		{fds.MinPartSize, 2*fds.MinPartSize - 1},
+		{2 * fds.MinPartSize, 2*fds.MinPartSize + 9},
+	}, bounds(parts))
+
+	parts, err = downloader.splitDownloadParts(md, ranged)
+	assert.Nil(t, err)
+	assert.Equal(t, [][2]int64{
+		{100, fds.MinPartSize - 1},
+		{fds.MinPartSize, fds.MinPartSize + 199},
+	}, bounds(parts))
+
+	// PartSize is the fallback without a valid upload part size
+	for _, v := range []string{"", "abc", "10"} {
+		md.Set(fds.XiaomiMetaPrefix+UploadPartSizeMetadata, v)
+		parts, err = downloader.splitDownloadParts(md, ranged)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(399), parts[0].End, v)
+	}
+}
+
+func TestBreakpointInfo_ValidateETag(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+	server.putObject("bucket", "object", []byte("hello world"))
+
+	downloader, err := NewDownloader(server.client(), 4, 1, true)
+	assert.Nil(t, err)
+
+	md, err := downloader.client.GetObjectMetadata("bucket", "object")
+	assert.Nil(t, err)
+
+	r := httpparser.HTTPRange{Start: 0, End: 11}
+	bp := breakpointInfo{}
+	assert.Nil(t, bp.Initilize(downloader, "bucket", "object", "", "", r, md))
+	assert.NotEmpty(t, bp.ObjectStat.ETag)
+	bp.MD5, err = bp.checksum()
+	assert.Nil(t, err)
+	assert.Nil(t, bp.Validate("bucket", "object", "", r, md))
+
+	// same size, same last modified, but different content
+	server.putObject("bucket", "object", bytes.ToUpper([]byte("hello world")))
+	md, err = downloader.client.GetObjectMetadata("bucket", "object")
+	assert.Nil(t, err)
+	assert.Equal(t, ErrorObjectStateNotMatching, bp.Validate("bucket", "object", "", r, md))
+}
+
+func TestObjectStat_Matches(t *testing.T) {
+	md := fds.NewObjectMetadata()
+	md.Set(fds.HTTPHeaderLastModified, fakeLastModified)
+
+	// no ETag on both sides, falls back to last modified
+	stat := objectStat{Size: 10, LastModified: fakeLastModified}
+	assert.True(t, stat.Matches(10, md))
+	assert.False(t, stat.Matches(11, md))
+
+	md.Set(fds.HTTPHeaderETag, "etag")
+	assert.False(t, stat.Matches(10, md))
+
+	stat.ETag = "etag"
+	stat.LastModified = "Tue, 02 Oct 2018 00:00:00 GMT"
+	assert.True(t, stat.Matches(10, md))
+}
+
+func TestDownloader_DownloadWholeObject(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := make([]byte, 1000)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	server.putObject("bucket", "object", content)
+
+	dir, err := ioutil.TempDir("", "go-fds")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	downloader, err := NewDownloader(server.client(), 300, 3, false)
+	assert.Nil(t, err)
+
+	// no range, and a range ending at the object length, both download the
+	// whole object, split into parts of PartSize
+	for i, rangeHeader := range []string{"", "bytes=0-1000"} {
+		request := &DownloadRequest{
+			GetObjectRequest: fds.GetObjectRequest{
+				BucketName: "bucket",
+				ObjectName: "object",
+				Range:      rangeHeader,
+			},
+			FilePath: filepath.Join(dir, fmt.Sprintf("file-%d", i)),
+		}
+		assert.Nil(t, downloader.Download(request))
+
+		b, err := ioutil.ReadFile(request.FilePath)
+		assert.Nil(t, err)
+		assert.Equal(t, content, b)
+	}
+
+	parts, err := downloader.splitDownloadParts(nil, httpparser.HTTPRange{End: 1000})
+	assert.Nil(t, err)
+	assert.Len(t, parts, 4)
+	assert.Equal(t, int64(299), parts[0].End)
+	assert.Equal(t, int64(999), parts[3].End)
+}
+
+func TestObjectStat_MatchesLastModifiedFormats(t *testing.T) {
+	md := fds.NewObjectMetadata()
+	md.Set(fds.HTTPHeaderLastModified, "Monday, 01-Oct-18 00:00:00 GMT")
+
+	stat := objectStat{Size: 10, LastModified: lastModifiedOf(md)}
+	assert.Equal(t, fakeLastModified, stat.LastModified)
+	assert.True(t, stat.Matches(10, md))
+
+	md.Set(fds.HTTPHeaderLastModified, "Mon Oct  1 00:00:00 2018")
+	assert.True(t, stat.Matches(10, md))
+
+	md.Set(fds.HTTPHeaderLastModified, "Mon, 01 Oct 2018 08:00:00 +0800")
+	assert.True(t, stat.Matches(10, md))
+
+	md.Set(fds.HTTPHeaderLastModified, "Mon, 01 Oct 2018 00:00:01 GMT")
+	assert.False(t, stat.Matches(10, md))
+
+	// unparsable values are compared verbatim
+	stat.LastModified = "yesterday"
+	md.Set(fds.HTTPHeaderLastModified, "yesterday")
+	assert.True(t, stat.Matches(10, md))
+	assert.Equal(t, "yesterday", lastModifiedOf(md))
+}
+
+func newTestContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	return content
+}
+
+func newTestDownloadRequest(t *testing.T) *DownloadRequest {
+	dir, err := ioutil.TempDir("", "fds-download-test-")
+	assert.Nil(t, err)
+
+	return &DownloadRequest{
+		GetObjectRequest: fds.GetObjectRequest{
+			BucketName: "bucket",
+			ObjectName: "object",
+		},
+		FilePath: filepath.Join(dir, "object"),
+	}
+}
+
+func assertFileContent(t *testing.T, filePath string, content []byte) {
+	downloaded, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.True(t, bytes.Equal(content, downloaded))
+}
+
+func TestDownloader_DownloadPreallocate(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	release := make(chan bool)
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get(fds.HTTPHeaderRange) != "" {
+			<-release
+		}
+		return false
+	}
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloader(server.client(), 300, 3, false)
+	assert.Nil(t, err)
+	downloader.Preallocate = true
+
+	done := make(chan error)
+	go func() {
+		done <- downloader.Download(request)
+	}()
+
+	// parts are blocked, but the temp file has its final size already
+	var info os.FileInfo
+	for i := 0; i < 100; i++ {
+		if info, err = os.Stat(request.FilePath + ".tmp"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), info.Size())
+
+	close(release)
+	assert.Nil(t, <-done)
+	assertFileContent(t, request.FilePath, content)
+}
+
+func TestDownloader_DownloadRetries(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	var failures int32
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get(fds.HTTPHeaderRange) == "bytes=300-599" && atomic.AddInt32(&failures, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return true
+		}
+		return false
+	}
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithConcurrency(8), WithRetries(1))
+	assert.Nil(t, err)
+
+	result, err := downloader.DownloadWithResult(context.Background(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&failures))
+	assertFileContent(t, request.FilePath, content)
+
+	assert.Equal(t, int64(300), result.PartSize)
+	assert.Equal(t, 4, result.Workers)
+	assert.Equal(t, 4, result.TotalParts)
+	assert.Equal(t, 4, result.FetchedParts)
+	assert.Equal(t, int64(1000), result.Bytes)
+	assert.Equal(t, 1, result.Retries)
+	assert.True(t, result.Elapsed > 0)
+}
+
+func TestDownloader_DownloadPartTimeout(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	var stalls int32
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get(fds.HTTPHeaderRange) != "bytes=300-599" || atomic.AddInt32(&stalls, 1) != 1 {
+			return false
+		}
+		// the part stalls after the first bytes until the client gives up
+		w.Header().Set(fds.HTTPHeaderContentRange, "bytes 300-599/1000")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[300:310])
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		return true
+	}
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithConcurrency(2),
+		WithRetries(1), WithPartTimeout(100*time.Millisecond))
+	assert.Nil(t, err)
+
+	var timeouts int32
+	downloader.OnPartDone = func(p Part, d time.Duration, err error) {
+		if errors.Is(err, ErrorPartTimeout) {
+			atomic.AddInt32(&timeouts, 1)
+		}
+	}
+
+	result, err := downloader.DownloadWithResult(context.Background(), request)
+	assert.Nil(t, err)
+	assertFileContent(t, request.FilePath, content)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&timeouts))
+	assert.Equal(t, 1, result.Retries)
+
+	_, err = NewDownloaderWithOptions(server.client(), WithPartTimeout(-time.Second))
+	assert.Equal(t, ErrorPartTimeoutSmallerThanZero, err)
+}
+
+func TestDownloader_DownloadPartStall(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	var stalls int32
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get(fds.HTTPHeaderRange) != "bytes=300-599" || atomic.AddInt32(&stalls, 1) != 1 {
+			return false
+		}
+		w.Header().Set(fds.HTTPHeaderContentRange, "bytes 300-599/1000")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[300:310])
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		return true
+	}
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	// the stall is detected by the idle timeout of the body rather than a part timeout
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithConcurrency(2),
+		WithRetries(1), WithStallTimeout(100*time.Millisecond))
+	assert.Nil(t, err)
+
+	var idles int32
+	downloader.OnPartDone = func(p Part, d time.Duration, err error) {
+		if errors.Is(err, fds.ErrorBodyIdleTimeout) {
+			atomic.AddInt32(&idles, 1)
+		}
+	}
+
+	result, err := downloader.DownloadWithResult(context.Background(), request)
+	assert.Nil(t, err)
+	assertFileContent(t, request.FilePath, content)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&idles))
+	assert.Equal(t, 1, result.Retries)
+
+	_, err = NewDownloaderWithOptions(server.client(), WithStallTimeout(-time.Second))
+	assert.Equal(t, ErrorStallTimeoutSmallerThanZero, err)
+}
+
+func TestDownloader_Stats(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	var failures int32
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get(fds.HTTPHeaderRange) == "bytes=300-599" && atomic.AddInt32(&failures, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return true
+		}
+		return false
+	}
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithConcurrency(2), WithRetries(1))
+	assert.Nil(t, err)
+	var inFlight int64
+	downloader.OnPartStart = func(p Part) {
+		if n := downloader.Stats().InFlight; n > atomic.LoadInt64(&inFlight) {
+			atomic.StoreInt64(&inFlight, n)
+		}
+	}
+
+	assert.Nil(t, downloader.Download(request))
+	assert.Equal(t, DownloaderStats{Bytes: 1000, Parts: 4, Retries: 1}, downloader.Stats())
+	assert.True(t, atomic.LoadInt64(&inFlight) >= 1)
+
+	// the counters accumulate over downloads, a part failing after the retries is counted
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get(fds.HTTPHeaderRange) == "bytes=0-299" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return true
+		}
+		return false
+	}
+	downloader.Concurrency = 1
+	assert.NotNil(t, downloader.Download(request))
+	assert.Equal(t, DownloaderStats{Bytes: 1000, Parts: 4, Retries: 2, FailedParts: 1}, downloader.Stats())
+}
+
+// corruptPartOnce serves a corrupted body with the checksum of the real part
+// for the first request of rangeHeader
+func corruptPartOnce(content []byte, rangeHeader string, count *int32) func(http.ResponseWriter, *http.Request) bool {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get(fds.HTTPHeaderRange) != rangeHeader || atomic.AddInt32(count, 1) != 1 {
+			return false
+		}
+
+		var start, end int
+		fmt.Sscanf(rangeHeader, "bytes=%d-%d", &start, &end)
+		corrupted := append([]byte(nil), content[start:end+1]...)
+		corrupted[0] ^= 0xff
+
+		w.Header().Set(fds.HTTPHeaderContentMD5, contentMD5(content[start:end+1]))
+		w.Header().Set(fds.HTTPHeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(corrupted)
+		return true
+	}
+}
+
+func TestDownloader_DownloadVerifyParts(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	var count int32
+	server.hook = corruptPartOnce(content, "bytes=300-599", &count)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithRetries(1), WithVerifyParts(true))
+	assert.Nil(t, err)
+
+	assert.Nil(t, downloader.Download(request))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+	assertFileContent(t, request.FilePath, content)
+
+	count = 0
+	downloader.Retries = 0
+	assert.Equal(t, ErrorPartChecksumNotMatching, downloader.Download(request))
+}
+
+func TestCopyPartData(t *testing.T) {
+	p := part{Index: 1, Start: 100, End: 109}
+
+	var buf bytes.Buffer
+	assert.Nil(t, copyPartData(p, &buf, strings.NewReader("0123456789")))
+	assert.Equal(t, "0123456789", buf.String())
+
+	buf.Reset()
+	err := copyPartData(p, &buf, strings.NewReader("01234"))
+	assert.True(t, errors.Is(err, ErrorPartLengthNotMatching))
+
+	buf.Reset()
+	err = copyPartData(p, &buf, strings.NewReader("0123456789abc"))
+	assert.True(t, errors.Is(err, ErrorPartLengthNotMatching))
+	assert.Equal(t, "0123456789", buf.String())
+}
+
+func TestDownloader_TaskProducerFinished(t *testing.T) {
+	downloader, err := NewDownloader(fds.New("ak", "sk", nil), 100, 1, false)
+	assert.Nil(t, err)
+
+	parts, err := downloader.splitDownloadParts(nil, httpparser.HTTPRange{Start: 0, End: 1000})
+	assert.Nil(t, err)
+
+	// the only worker takes a part and fails, nobody consumes the bounded jobs any more
+	jobs := make(chan part, 1)
+	finished := make(chan bool)
+	returned := make(chan struct{})
+	go func() {
+		downloader.downloaderTaskProducer(jobs, parts, finished)
+		close(returned)
+	}()
+	<-jobs
+	close(finished)
+
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("producer is blocked after finished")
+	}
+
+	// jobs is closed, at most the part sent before finished is left
+	left := 0
+	for range jobs {
+		left++
+	}
+	assert.True(t, left <= 1)
+}
+
+func TestDownloader_DownloadTruncatedPart(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	var count int32
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get(fds.HTTPHeaderRange) != "bytes=300-599" || atomic.AddInt32(&count, 1) != 1 {
+			return false
+		}
+		// the connection is closed after the first half of the part
+		w.Header().Set(fds.HTTPHeaderContentRange, "bytes 300-599/1000")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[300:450])
+		return true
+	}
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithRetries(1))
+	assert.Nil(t, err)
+
+	assert.Nil(t, downloader.Download(request))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+	assertFileContent(t, request.FilePath, content)
+
+	count = 0
+	downloader.Retries = 0
+	err = downloader.Download(request)
+	assert.True(t, errors.Is(err, ErrorPartLengthNotMatching))
+
+	count = 0
+	sequential := &DownloadRequest{GetObjectRequest: request.GetObjectRequest}
+	err = downloader.DownloadSequential(sequential, &bytes.Buffer{})
+	assert.True(t, errors.Is(err, ErrorPartLengthNotMatching))
+}
+
+func TestCheckPartRange(t *testing.T) {
+	p := part{Index: 0, Start: 0, End: 299}
+	md := fds.NewObjectMetadata()
+	// neither length is known
+	assert.Nil(t, checkPartRange(p, md))
+
+	md.Set(fds.HTTPHeaderContentLength, "1000")
+	assert.True(t, errors.Is(checkPartRange(p, md), ErrorPartRangeNotMatching))
+	md.Set(fds.HTTPHeaderContentLength, "300")
+	assert.Nil(t, checkPartRange(p, md))
+
+	// the length of the object goes first
+	md.Set(fds.HTTPHeaderContentMetadataLength, "1000")
+	assert.True(t, errors.Is(checkPartRange(p, md), ErrorPartRangeNotMatching))
+	md.Set(fds.HTTPHeaderContentMetadataLength, "300")
+	assert.Nil(t, checkPartRange(p, md))
+
+	md.Set(fds.HTTPHeaderContentRange, "bytes 0-299/1000")
+	assert.Nil(t, checkPartRange(p, md))
+	assert.True(t, errors.Is(checkPartRange(part{Index: 1, Start: 300, End: 599}, md), ErrorPartRangeNotMatching))
+}
+
+func TestDownloader_DownloadRangeNotMatching(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	const (
+		ignored = iota
+		clamped
+	)
+	var mode int32
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		rangeHeader := r.Header.Get(fds.HTTPHeaderRange)
+		switch atomic.LoadInt32(&mode) {
+		case ignored:
+			// the range is ignored, the whole object is returned
+			if r.Method != http.MethodGet || rangeHeader == "" {
+				return false
+			}
+			w.Write(content)
+		case clamped:
+			if rangeHeader != "bytes=300-599" {
+				return false
+			}
+			w.Header().Set(fds.HTTPHeaderContentRange, "bytes 300-499/1000")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[300:500])
+		}
+		return true
+	}
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithRetries(0))
+	assert.Nil(t, err)
+
+	err = downloader.Download(request)
+	assert.True(t, errors.Is(err, ErrorPartRangeNotMatching))
+	_, err = os.Stat(request.FilePath)
+	assert.True(t, os.IsNotExist(err))
+
+	atomic.StoreInt32(&mode, clamped)
+	err = downloader.Download(request)
+	assert.True(t, errors.Is(err, ErrorPartRangeNotMatching))
+
+	// the whole object is accepted when it is the only part
+	atomic.StoreInt32(&mode, ignored)
+	downloader.PartSize = 1000
+	assert.Nil(t, downloader.Download(request))
+	assertFileContent(t, request.FilePath, content)
+}
+
+func TestDownloader_DownloadPartHooks(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	var count int32
+	server.hook = corruptPartOnce(content, "bytes=300-599", &count)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	var mu sync.Mutex
+	var started []Part
+	failures := map[int]int{}
+	onStart := func(p Part) {
+		mu.Lock()
+		defer mu.Unlock()
+		started = append(started, p)
+	}
+	onDone := func(p Part, d time.Duration, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failures[p.Index]++
+		}
+	}
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithRetries(1),
+		WithVerifyParts(true), WithPartHooks(onStart, onDone))
+	assert.Nil(t, err)
+
+	assert.Nil(t, downloader.Download(request))
+	assert.Equal(t, 5, len(started))
+	assert.Contains(t, started, Part{Index: 3, Start: 900, End: 999})
+	assert.Equal(t, map[int]int{1: 1}, failures)
+}
+
+// fullDiskFile fails with ENOSPC when a part is written at offset
+type fullDiskFile struct {
+	fd     *os.File
+	offset int64
+	pos    int64
+}
+
+func (f *fullDiskFile) Seek(offset int64, whence int) (int64, error) {
+	f.pos = offset
+	return f.fd.Seek(offset, whence)
+}
+
+func (f *fullDiskFile) Write(b []byte) (int, error) {
+	if f.pos == f.offset {
+		return 0, &os.PathError{Op: "write", Path: f.fd.Name(), Err: syscall.ENOSPC}
+	}
+	return f.fd.Write(b)
+}
+
+func (f *fullDiskFile) Close() error {
+	return f.fd.Close()
+}
+
+func fullDiskAt(offset int64) func(string, int, os.FileMode) (partFile, error) {
+	return func(name string, flag int, perm os.FileMode) (partFile, error) {
+		fd, err := os.OpenFile(name, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		return &fullDiskFile{fd: fd, offset: offset}, nil
+	}
+}
+
+func TestDownloader_DownloadDiskFull(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloader(server.client(), 300, 1, false)
+	assert.Nil(t, err)
+	downloader.openFile = fullDiskAt(300)
+
+	err = downloader.Download(request)
+	assert.True(t, errors.Is(err, ErrorDiskFull))
+	_, err = os.Stat(request.FilePath + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+
+	// the progress of a breakpoint is kept
+	downloader.Breakpoint = true
+	err = downloader.Download(request)
+	assert.True(t, errors.Is(err, ErrorDiskFull))
+	_, err = os.Stat(request.FilePath + ".tmp")
+	assert.Nil(t, err)
+
+	bp := breakpointInfo{}
+	assert.Nil(t, bp.Load(request.FilePath+".download.bp"))
+	assert.Equal(t, []bool{true, false, false, false}, bp.PartStat)
+
+	// the resumed download keeps the part size of the breakpoint
+	downloader.openFile = nil
+	downloader.PartSize = 500
+	result, err := downloader.DownloadWithResult(context.Background(), request)
+	assert.Nil(t, err)
+	assertFileContent(t, request.FilePath, content)
+	assert.Equal(t, int64(300), result.PartSize)
+	assert.Equal(t, 4, result.TotalParts)
+	assert.Equal(t, 3, result.FetchedParts)
+	assert.Equal(t, int64(700), result.Bytes)
+	_, err = os.Stat(request.FilePath + ".download.bp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloader_DownloadVersion(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object?versionId=v1", content)
+	server.putObject("bucket", "object", newTestContent(900))
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+	request.VersionID = "v1"
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithConcurrency(1), WithBreakpoint(true))
+	assert.Nil(t, err)
+	downloader.openFile = fullDiskAt(300)
+	assert.True(t, errors.Is(downloader.Download(request), ErrorDiskFull))
+
+	bp := breakpointInfo{}
+	assert.Nil(t, bp.Load(request.FilePath+breakpointSuffix))
+	assert.Equal(t, "v1", bp.VersionID)
+
+	// the resumed download gets the same version though a newer one is written
+	server.putObject("bucket", "object", newTestContent(800))
+	downloader.openFile = nil
+	result, err := downloader.DownloadWithResult(context.Background(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.FetchedParts)
+	assertFileContent(t, request.FilePath, content)
+
+	server.mu.Lock()
+	for _, r := range server.requests {
+		assert.Equal(t, "v1", r.URL.Query().Get("versionId"), r.URL.String())
+	}
+	server.mu.Unlock()
+
+	// the breakpoint of another version is not resumed
+	assert.Nil(t, os.Remove(request.FilePath))
+	downloader.openFile = fullDiskAt(300)
+	assert.True(t, errors.Is(downloader.Download(request), ErrorDiskFull))
+	downloader.openFile = nil
+	latest := &DownloadRequest{GetObjectRequest: request.GetObjectRequest, FilePath: request.FilePath}
+	latest.VersionID = ""
+	result, err = downloader.DownloadWithResult(context.Background(), latest)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.FetchedParts)
+	assert.Equal(t, 3, result.TotalParts)
+	assertFileContent(t, request.FilePath, newTestContent(800))
+}
+
+func TestDownloader_DownloadBreakpointVersion(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+	bpPath := request.FilePath + breakpointSuffix
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithConcurrency(1), WithBreakpoint(true))
+	assert.Nil(t, err)
+	downloader.openFile = fullDiskAt(300)
+	assert.True(t, errors.Is(downloader.Download(request), ErrorDiskFull))
+
+	bp := breakpointInfo{}
+	assert.Nil(t, bp.Load(bpPath))
+	assert.Equal(t, breakpointVersion, bp.Version)
+	r := httpparser.HTTPRange{Start: 0, End: 1000}
+
+	// the breakpoints written before the version was added are resumed
+	legacy := bp
+	legacy.Version = 0
+	legacy.MD5, err = legacy.checksum()
+	assert.Nil(t, err)
+	data, err := json.Marshal(legacy)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "Version")
+	assert.Nil(t, ioutil.WriteFile(bpPath, data, 0664))
+	loaded := breakpointInfo{downloader: downloader}
+	assert.Nil(t, loaded.Load(bpPath))
+	md, err := downloader.client.GetObjectMetadata("bucket", "object")
+	assert.Nil(t, err)
+	assert.Nil(t, loaded.Validate("bucket", "object", "", r, md))
+
+	// a newer layout is rejected and downloaded again, though its parts look done
+	bp.Version = breakpointVersion + 1
+	bp.PartStat = []bool{true, true, true, true}
+	bp.MD5, err = bp.checksum()
+	assert.Nil(t, err)
+	data, err = json.Marshal(bp)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(bpPath, data, 0664))
+	assert.True(t, errors.Is(bp.Load(bpPath), ErrorBreakpointVersion))
+	assert.True(t, errors.Is(bp.Validate("bucket", "object", "", r, md), ErrorBreakpointVersion))
+
+	downloader.openFile = nil
+	result, err := downloader.DownloadWithResult(context.Background(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, result.FetchedParts)
+	assertFileContent(t, request.FilePath, content)
+}
+
+func TestDownloader_DownloadObjectSize(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	// the metadata response has a body, whose Content-Length is not the size of the object
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if _, ok := r.URL.Query()["metadata"]; !ok {
+			return false
+		}
+		body := []byte(`{"size":"see x-xiaomi-meta-content-length"}`)
+		w.Header().Set(fds.HTTPHeaderContentMetadataLength, "1000")
+		w.Header().Set(fds.HTTPHeaderContentLength, strconv.Itoa(len(body)))
+		w.Header().Set(fds.HTTPHeaderLastModified, fakeLastModified)
+		w.Header().Set(fds.HTTPHeaderETag, fmt.Sprintf("%x", md5.Sum(content)))
+		w.Write(body)
+		return true
+	}
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithConcurrency(1), WithBreakpoint(true))
+	assert.Nil(t, err)
+	downloader.openFile = fullDiskAt(300)
+	assert.True(t, errors.Is(downloader.Download(request), ErrorDiskFull))
+
+	bp := breakpointInfo{}
+	assert.Nil(t, bp.Load(request.FilePath+breakpointSuffix))
+	assert.Equal(t, int64(1000), bp.ObjectStat.Size)
+	assert.Equal(t, int64(1000), bp.End)
+
+	// the breakpoint validates against the same size and is resumed
+	downloader.openFile = nil
+	result, err := downloader.DownloadWithResult(context.Background(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, result.TotalParts)
+	assert.Equal(t, 3, result.FetchedParts)
+	assertFileContent(t, request.FilePath, content)
+
+	var buf bytes.Buffer
+	assert.Nil(t, downloader.DownloadSequential(&DownloadRequest{GetObjectRequest: request.GetObjectRequest}, &buf))
+	assert.Equal(t, content, buf.Bytes())
+}
+
+func TestDownloader_DownloadMaxObjectSize(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithMaxObjectSize(999))
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(downloader.Download(request), ErrorObjectTooLarge))
+	assert.True(t, errors.Is(downloader.DownloadSequential(request, ioutil.Discard), ErrorObjectTooLarge))
+	_, err = os.Stat(request.FilePath + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+
+	// only the metadata is requested
+	server.mu.Lock()
+	assert.Equal(t, 2, len(server.requests))
+	for _, r := range server.requests {
+		_, ok := r.URL.Query()["metadata"]
+		assert.True(t, ok, r.URL.String())
+	}
+	server.requests = nil
+	server.mu.Unlock()
+
+	// the limit applies to the length of a range
+	request.Range = "bytes=100-599"
+	downloader.MaxObjectSize = 500
+	assert.Nil(t, downloader.Download(request))
+	assertFileContent(t, request.FilePath, content[100:600])
+
+	request.Range = "bytes=100-600"
+	assert.True(t, errors.Is(downloader.Download(request), ErrorObjectTooLarge))
+}
+
+func TestDownloader_DownloadRelocatedBreakpoint(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloader(server.client(), 300, 1, true)
+	assert.Nil(t, err)
+	downloader.openFile = fullDiskAt(300)
+	err = downloader.Download(request)
+	assert.True(t, errors.Is(err, ErrorDiskFull))
+
+	// the breakpoint and the temp file are moved to another directory
+	moved := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(moved.FilePath))
+	assert.Nil(t, os.Rename(request.FilePath+".tmp", moved.FilePath+".tmp"))
+	assert.Nil(t, os.Rename(request.FilePath+".download.bp", moved.FilePath+".download.bp"))
+
+	downloader.openFile = nil
+	result, err := downloader.DownloadWithResult(context.Background(), moved)
+	assert.Nil(t, err)
+	assertFileContent(t, moved.FilePath, content)
+	assert.Equal(t, 3, result.FetchedParts)
+	assert.Equal(t, int64(700), result.Bytes)
+
+	// nothing is written to where the breakpoint was
+	for _, name := range []string{".download.bp", ".tmp", ""} {
+		_, err = os.Stat(request.FilePath + name)
+		assert.True(t, os.IsNotExist(err), name)
+	}
+	_, err = os.Stat(moved.FilePath + ".download.bp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloader_DownloadVerifyResumedParts(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithConcurrency(1),
+		WithBreakpoint(true), WithVerifyResumedParts(true))
+	assert.Nil(t, err)
+	downloader.openFile = fullDiskAt(600)
+	err = downloader.Download(request)
+	assert.True(t, errors.Is(err, ErrorDiskFull))
+
+	bp := breakpointInfo{}
+	assert.Nil(t, bp.Load(request.FilePath+".download.bp"))
+	assert.Equal(t, []bool{true, true, false, false}, bp.PartStat)
+	assert.Equal(t, contentMD5(content[300:600]), bp.PartMD5[1])
+
+	// the second part is corrupted in the temp file
+	fd, err := os.OpenFile(request.FilePath+".tmp", os.O_WRONLY, 0)
+	assert.Nil(t, err)
+	_, err = fd.WriteAt([]byte("corrupted"), 400)
+	assert.Nil(t, err)
+	fd.Close()
+
+	downloader.openFile = nil
+	result, err := downloader.DownloadWithResult(context.Background(), request)
+	assert.Nil(t, err)
+	assertFileContent(t, request.FilePath, content)
+	assert.Equal(t, 3, result.FetchedParts)
+	assert.Equal(t, int64(700), result.Bytes)
+}
+
+func TestDownloader_DownloadDiskFullConcurrent(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloader(server.client(), 300, 4, true)
+	assert.Nil(t, err)
+	downloader.openFile = fullDiskAt(300)
+
+	// part 1 fails after the others are downloaded, which are reported only after the failure
+	var downloaded sync.WaitGroup
+	downloaded.Add(3)
+	failed := make(chan struct{})
+	downloader.OnPartStart = func(p Part) {
+		if p.Index == 1 {
+			downloaded.Wait()
+		}
+	}
+	downloader.OnPartDone = func(p Part, d time.Duration, err error) {
+		if p.Index == 1 {
+			close(failed)
+			return
+		}
+		downloaded.Done()
+		<-failed
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	result, err := downloader.DownloadWithResult(context.Background(), request)
+	assert.True(t, errors.Is(err, ErrorDiskFull))
+	assert.Equal(t, 3, result.FetchedParts)
+
+	bp := breakpointInfo{}
+	assert.Nil(t, bp.Load(request.FilePath+".download.bp"))
+	assert.Equal(t, []bool{true, false, true, true}, bp.PartStat)
+}
+
+func TestDownloader_DownloadHeaders(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+	request.Headers = http.Header{"X-Trace-Id": {"trace-1"}}
+
+	downloader, err := NewDownloader(server.client(), 300, 2, false)
+	assert.Nil(t, err)
+	assert.Nil(t, downloader.Download(request))
+
+	ranged := 0
+	for _, r := range server.requests {
+		if r.Header.Get(fds.HTTPHeaderRange) != "" {
+			ranged++
+			assert.Equal(t, "trace-1", r.Header.Get("X-Trace-Id"))
+		}
+	}
+	assert.Equal(t, 4, ranged)
+}
+
+func TestDownloader_DownloadUserAgent(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	client := server.client()
+	client.Configuration.UserAgent = "my-app/1.2"
+	downloader, err := NewDownloader(client, 300, 2, false)
+	assert.Nil(t, err)
+	assert.Nil(t, downloader.Download(request))
+
+	ua := regexp.MustCompile(`^go-fds/` + regexp.QuoteMeta(fds.Version) + ` \(go[^;]*; \w+/\w+\) my-app/1\.2$`)
+	ranged := 0
+	for _, r := range server.requests {
+		assert.Regexp(t, ua, r.Header.Get(fds.HTTPHeaderUserAgent))
+		if r.Header.Get(fds.HTTPHeaderRange) != "" {
+			ranged++
+		}
+	}
+	assert.Equal(t, 4, ranged)
+}
+
+func TestDownloader_DownloadDecompress(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(5000)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(content)
+	zw.Close()
+	server.putObject("bucket", "object", compressed.Bytes())
+	server.putObject("bucket", "plain", content)
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/bucket/object" {
+			w.Header().Set(fds.HTTPHeaderContentEncoding, "gzip")
+		}
+		return false
+	}
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithDecompress(true))
+	assert.Nil(t, err)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+	assert.Nil(t, downloader.Download(request))
+	assertFileContent(t, request.FilePath, content)
+	_, err = os.Stat(request.FilePath + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+
+	plain := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(plain.FilePath))
+	plain.ObjectName = "plain"
+	assert.Nil(t, downloader.Download(plain))
+	assertFileContent(t, plain.FilePath, content)
+}
+
+func TestDownloader_DownloadPartSizeLargerThanObject(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	logger, hook := logrustest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(4096), WithConcurrency(8), WithLogger(logger))
+	assert.Nil(t, err)
+
+	assert.Nil(t, downloader.Download(request))
+	assertFileContent(t, request.FilePath, content)
+
+	var ranges []string
+	for _, r := range server.requests {
+		if v := r.Header.Get(fds.HTTPHeaderRange); v != "" {
+			ranges = append(ranges, v)
+		}
+	}
+	assert.Equal(t, []string{"bytes=0-999"}, ranges)
+
+	var clamped bool
+	for _, entry := range hook.AllEntries() {
+		clamped = clamped || entry.Message == "concurrency 8 is clamped to 1 parts"
+	}
+	assert.True(t, clamped)
+}
+
+func TestDownloader_DownloadConcurrencyOne(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloader(server.client(), 300, 1, false)
+	assert.Nil(t, err)
+
+	assert.Nil(t, downloader.Download(request))
+	assertFileContent(t, request.FilePath, content)
+}
+
+func TestDownloader_DownloadAnonymous(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	client := server.client()
+	anonymous := fds.NewAnonymousClient(client.Configuration)
+	downloader, err := NewDownloader(anonymous, 300, 2, false)
+	assert.Nil(t, err)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	assert.Nil(t, downloader.Download(request))
+	assertFileContent(t, request.FilePath, content)
+	for _, r := range server.requests {
+		assert.Empty(t, r.Header.Get(fds.HTTPHeaderAuthorization))
+	}
+}
+
+func TestDownloader_DownloadValidateRequest(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+	server.putObject("bucket", "object", newTestContent(10))
+
+	dir, err := ioutil.TempDir("", "fds-download-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "file")
+	assert.Nil(t, ioutil.WriteFile(file, nil, 0644))
+
+	var requests int32
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		atomic.AddInt32(&requests, 1)
+		return false
+	}
+
+	downloader, err := NewDownloader(server.client(), 300, 1, false)
+	assert.Nil(t, err)
+
+	invalids := []struct {
+		name   string
+		bucket string
+		object string
+		path   string
+		err    error
+	}{
+		{"empty bucket", "", "object", filepath.Join(dir, "object"), ErrorBucketNameEmpty},
+		{"empty object", "bucket", "", filepath.Join(dir, "object"), ErrorObjectNameEmpty},
+		{"empty file path", "bucket", "object", "", ErrorFilePathEmpty},
+		{"directory", "bucket", "object", dir, ErrorFilePathIsDirectory},
+		{"missing directory", "bucket", "object", filepath.Join(dir, "missing", "object"), ErrorDirectoryNotWritable},
+		{"file as directory", "bucket", "object", filepath.Join(file, "object"), ErrorDirectoryNotWritable},
+	}
+	for _, invalid := range invalids {
+		request := &DownloadRequest{
+			GetObjectRequest: fds.GetObjectRequest{BucketName: invalid.bucket, ObjectName: invalid.object},
+			FilePath:         invalid.path,
+		}
+		err = downloader.Download(request)
+		assert.True(t, errors.Is(err, invalid.err), invalid.name)
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+
+	entries, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+}
+
+func TestDownloader_DownloadOverwritePolicy(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	var parts int32
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get(fds.HTTPHeaderRange) != "" {
+			atomic.AddInt32(&parts, 1)
+		}
+		return false
+	}
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloader(server.client(), 300, 2, false)
+	assert.Nil(t, err)
+
+	existing := []byte("old")
+	reset := func(data []byte) {
+		assert.Nil(t, ioutil.WriteFile(request.FilePath, data, 0644))
+		atomic.StoreInt32(&parts, 0)
+	}
+
+	// the file is overwritten by default
+	reset(existing)
+	assert.Nil(t, downloader.Download(request))
+	assertFileContent(t, request.FilePath, content)
+
+	// FailIfExists fails before any part is downloaded
+	reset(existing)
+	request.Overwrite = FailIfExists
+	err = downloader.Download(request)
+	assert.True(t, errors.Is(err, ErrorFileExists))
+	assertFileContent(t, request.FilePath, existing)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&parts))
+
+	// and when the file appears during the download
+	os.Remove(request.FilePath)
+	downloader.OnPartStart = func(p Part) {
+		if p.Index == 0 {
+			ioutil.WriteFile(request.FilePath, existing, 0644)
+		}
+	}
+	err = downloader.Download(request)
+	downloader.OnPartStart = nil
+	assert.True(t, errors.Is(err, ErrorFileExists))
+	assertFileContent(t, request.FilePath, existing)
+	_, err = os.Stat(request.FilePath + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+
+	// SkipIfExists skips a file of the same size and overwrites another one
+	request.Overwrite = SkipIfExists
+	reset(content[:999])
+	result, err := downloader.DownloadWithResult(context.Background(), request)
+	assert.Nil(t, err)
+	assert.False(t, result.Skipped)
+	assertFileContent(t, request.FilePath, content)
+
+	atomic.StoreInt32(&parts, 0)
+	result, err = downloader.DownloadWithResult(context.Background(), request)
+	assert.Nil(t, err)
+	assert.True(t, result.Skipped)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&parts))
+}
+
+func TestDownloader_DownloadObjectChanged(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	for _, breakpoint := range []bool{false, true} {
+		server.putObject("bucket", "object", content)
+		downloader, err := NewDownloader(server.client(), 300, 1, breakpoint)
+		assert.Nil(t, err)
+		downloader.Retries = 2
+
+		// the object is replaced after the first part
+		var parts int32
+		downloader.OnPartDone = func(p Part, d time.Duration, err error) {
+			atomic.AddInt32(&parts, 1)
+			if p.Index == 0 {
+				server.putObject("bucket", "object", newTestContent(1000)[500:])
+			}
+		}
+
+		err = downloader.Download(request)
+		assert.True(t, errors.Is(err, ErrorObjectChanged))
+		assert.Equal(t, int32(2), atomic.LoadInt32(&parts))
+		for _, suffix := range []string{"", ".tmp", ".download.bp"} {
+			_, err = os.Stat(request.FilePath + suffix)
+			assert.True(t, os.IsNotExist(err), suffix)
+		}
+	}
+
+	// a server rejecting the If-Range fails the download without retries
+	server.putObject("bucket", "object", content)
+	var attempts int32
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get(fds.HTTPHeaderIfRange) == "" {
+			return false
+		}
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return true
+	}
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithConcurrency(1), WithRetries(2))
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(downloader.Download(request), ErrorObjectChanged))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestDownloader_DownloadObjectArchived(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+	server.putObject("bucket", "object", newTestContent(1000))
+
+	var attempts int32
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodGet || r.URL.Query().Get("metadata") != "" {
+			return false
+		}
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errorCode":"ObjectArchived"}`))
+		return true
+	}
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithConcurrency(1), WithRetries(2))
+	assert.Nil(t, err)
+	err = downloader.Download(request)
+	assert.True(t, errors.Is(err, ErrorObjectArchived))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestDownloader_Shutdown(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+	server.putObject("bucket", "object", newTestContent(1000))
+
+	// part requests are held until the client gives up
+	started := make(chan struct{}, 10)
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get(fds.HTTPHeaderRange) == "" {
+			return false
+		}
+		started <- struct{}{}
+		<-r.Context().Done()
+		return true
+	}
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloader(server.client(), 100, 3, false)
+	assert.Nil(t, err)
+
+	transport := http.DefaultTransport.(*http.Transport)
+	transport.CloseIdleConnections()
+	baseline := runtime.NumGoroutine()
+
+	done := make(chan error)
+	go func() {
+		done <- downloader.Download(request)
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, downloader.Shutdown(ctx))
+	assert.True(t, errors.Is(<-done, context.Canceled))
+	assert.Equal(t, ErrorDownloaderClosed, downloader.Download(request))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		transport.CloseIdleConnections()
+		// the idle connection of the metadata request is not of the default transport
+		server.CloseClientConnections()
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, runtime.NumGoroutine() <= baseline, "%v goroutines, %v at baseline", runtime.NumGoroutine(), baseline)
+
+	// a shutdown of an idle downloader returns at once
+	assert.Nil(t, downloader.Shutdown(ctx))
+}
+
+func TestDownloader_DownloadAlignParts(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	// the fake keeps no metadata, so the part size recorded at init is served back
+	key := fds.XiaomiMetaPrefix + UploadPartSizeMetadata
+	var uploadPartSize atomic.Value
+	uploadPartSize.Store("")
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		q := r.URL.Query()
+		if _, ok := q["uploads"]; ok {
+			uploadPartSize.Store(r.Header.Get(key))
+		}
+		if _, ok := q["metadata"]; ok {
+			w.Header().Set(key, uploadPartSize.Load().(string))
+		}
+		return false
+	}
+
+	filePath, content := newTestUploadFile(t, 2*fds.MinPartSize+10)
+	defer os.RemoveAll(filepath.Dir(filePath))
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 2, false)
+	assert.Nil(t, err)
+	_, err = uploader.Upload(newTestUploadRequest(filePath))
+	assert.Nil(t, err)
+	assert.Equal(t, strconv.Itoa(fds.MinPartSize), uploadPartSize.Load())
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	for _, align := range []bool{false, true} {
+		var mu sync.Mutex
+		var sizes []int64
+		downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(1000), WithConcurrency(2), WithAlignParts(align),
+			WithPartHooks(func(p Part) {
+				mu.Lock()
+				sizes = append(sizes, p.End-p.Start+1)
+				mu.Unlock()
+			}, nil))
+		assert.Nil(t, err)
+
+		result, err := downloader.DownloadWithResult(context.Background(), request)
+		assert.Nil(t, err)
+		assertFileContent(t, request.FilePath, content)
+		if align {
+			assert.Equal(t, int64(fds.MinPartSize), result.PartSize)
+			assert.Equal(t, 3, len(sizes))
+		} else {
+			assert.Equal(t, int64(1000), result.PartSize)
+			assert.Equal(t, (len(content)+999)/1000, len(sizes))
+		}
+	}
+}
+
+func TestDownloader_DownloadPool(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+	server.putObject("bucket", "a", newTestContent(1000))
+	server.putObject("bucket", "b", newTestContent(1500))
+
+	_, err := NewDownloadPool(0)
+	assert.Equal(t, ErrorPoolSizeSmallerThanOne, err)
+	pool, err := NewDownloadPool(300)
+	assert.Nil(t, err)
+
+	// the parts in flight of both downloads never exceed the pool
+	var mu sync.Mutex
+	var inFlight, peak int64
+	hooks := WithPartHooks(func(p Part) {
+		mu.Lock()
+		defer mu.Unlock()
+		inFlight += p.End - p.Start + 1
+		if inFlight > peak {
+			peak = inFlight
+		}
+		assert.True(t, pool.InFlight() <= 300)
+	}, func(p Part, d time.Duration, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		inFlight -= p.End - p.Start + 1
+	})
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b"} {
+		downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(100), WithConcurrency(4), WithDownloadPool(pool), hooks)
+		assert.Nil(t, err)
+
+		request := newTestDownloadRequest(t)
+		request.ObjectName = name
+		defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, downloader.Download(request))
+		}()
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			sequential := &DownloadRequest{GetObjectRequest: request.GetObjectRequest}
+			assert.Nil(t, downloader.DownloadSequential(sequential, &buf))
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, peak > 0 && peak <= 300, "peak %d", peak)
+	assert.Equal(t, int64(0), pool.InFlight())
+}
+
+func TestDownloader_DownloadWithInfo(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+	metadata, err := server.client().GetObjectMetadata("bucket", "object")
+	assert.Nil(t, err)
+	listing, err := server.client().ListObjects(&fds.ListObjectsRequest{BucketName: "bucket"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(listing.ObjectSummaries))
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithConcurrency(2))
+	assert.Nil(t, err)
+
+	metadataRequests := func() int {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		n := 0
+		for _, r := range server.requests {
+			if _, ok := r.URL.Query()["metadata"]; ok {
+				n++
+			}
+		}
+		return n
+	}
+	before := metadataRequests()
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+	request.Info = ObjectInfoOf(listing.ObjectSummaries[0])
+	assert.Nil(t, downloader.Download(request))
+	assertFileContent(t, request.FilePath, content)
+
+	request.Info = nil
+	request.Metadata = metadata
+	var buf bytes.Buffer
+	assert.Nil(t, downloader.DownloadSequential(request, &buf))
+	assert.Equal(t, content, buf.Bytes())
+	assert.Equal(t, before, metadataRequests())
+
+	// a breakpoint is resumed with the Info, which is not requested again
+	downloader, err = NewDownloaderWithOptions(server.client(), WithPartSize(300), WithConcurrency(1), WithBreakpoint(true))
+	assert.Nil(t, err)
+	request.Metadata = nil
+	request.Info = ObjectInfoOf(listing.ObjectSummaries[0])
+	downloader.openFile = fullDiskAt(300)
+	assert.True(t, errors.Is(downloader.Download(request), ErrorDiskFull))
+	downloader.openFile = nil
+	result, err := downloader.DownloadWithResult(context.Background(), request)
+	assert.Nil(t, err)
+	assertFileContent(t, request.FilePath, content)
+	assert.Equal(t, 3, result.FetchedParts)
+	assert.Equal(t, before, metadataRequests())
+
+	// without them the metadata is requested once by each download, also when resumed
+	request.Info = nil
+	downloader.openFile = fullDiskAt(300)
+	assert.True(t, errors.Is(downloader.Download(request), ErrorDiskFull))
+	assert.Equal(t, before+1, metadataRequests())
+	downloader.openFile = nil
+	assert.Nil(t, downloader.Download(request))
+	assertFileContent(t, request.FilePath, content)
+	assert.Equal(t, before+2, metadataRequests())
+}
+
+func TestDownloader_DownloadConcurrently(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	const downloads = 16
+	contents := make([][]byte, downloads)
+	for i := range contents {
+		contents[i] = newTestContent(1000 + i*100)
+		server.putObject("bucket", fmt.Sprintf("object-%d", i), contents[i])
+	}
+
+	dir, err := ioutil.TempDir("", "fds-download-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	pool, err := NewDownloadPool(1200)
+	assert.Nil(t, err)
+	var parts int64
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithConcurrency(3),
+		WithBreakpoint(true), WithVerifyParts(true), WithRetries(1), WithDownloadPool(pool),
+		WithPartHooks(nil, func(p Part, d time.Duration, err error) { atomic.AddInt64(&parts, 1) }))
+	assert.Nil(t, err)
+
+	// one Downloader serves all the downloads at the same time, half of them sequentially
+	var wg sync.WaitGroup
+	errs := make([]error, downloads)
+	buffers := make([]bytes.Buffer, downloads)
+	for i := 0; i < downloads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			request := &DownloadRequest{
+				GetObjectRequest: fds.GetObjectRequest{BucketName: "bucket", ObjectName: fmt.Sprintf("object-%d", i)},
+				FilePath:         filepath.Join(dir, fmt.Sprintf("object-%d", i)),
+			}
+			if i%2 == 0 {
+				errs[i] = downloader.Download(request)
+			} else {
+				errs[i] = downloader.DownloadSequential(request, &buffers[i])
+			}
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		downloader.Stats()
+	}
+	wg.Wait()
 
+	for i := 0; i < downloads; i++ {
+		assert.Nil(t, errs[i], "download %d", i)
+		if i%2 == 0 {
+			assertFileContent(t, filepath.Join(dir, fmt.Sprintf("object-%d", i)), contents[i])
+		} else {
+			assert.Equal(t, contents[i], buffers[i].Bytes(), "download %d", i)
+		}
+	}
+	assert.Equal(t, downloader.Stats().Parts, atomic.LoadInt64(&parts))
 }
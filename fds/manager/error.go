@@ -4,13 +4,44 @@ import "errors"
 
 // Errors
 var (
-	ErrorPartSizeSmallerThanOne    = errors.New("PartSize can not be smaller than 1")
-	ErrorConcurrencySmallerThanOne = errors.New("Concurrency can not be smaller than 1")
-	ErrorRnageFormat               = errors.New("Does not support (bytes=i-j,m-n) format, only support (bytes=i-j)")
-	ErrorBucketOrObjectNotMatching = errors.New("BucketName or ObjectName is not matching")
-	ErrorMD5NotMatching            = errors.New("MD5 is not matching")
-	ErrorObjectStateNotMatching    = errors.New("Object state is not matching")
-	ErrorRangeNotMatching          = errors.New("Range is not matching")
-	ErrorFileNotFound              = errors.New("File is not found")
-	ErrorTooManyUploadParts        = errors.New("Too many upload parts, increase PartSize please")
+	ErrorPartSizeSmallerThanOne      = errors.New("PartSize can not be smaller than 1")
+	ErrorPartSizeTooSmall            = errors.New("PartSize can not be smaller than fds.MinPartSize")
+	ErrorPartSizeTooLarge            = errors.New("PartSize can not be larger than fds.MaxPartSize")
+	ErrorConcurrencySmallerThanOne   = errors.New("Concurrency can not be smaller than 1")
+	ErrorRetriesSmallerThanZero      = errors.New("Retries can not be smaller than 0")
+	ErrorPartTimeoutSmallerThanZero  = errors.New("PartTimeout can not be smaller than 0")
+	ErrorStallTimeoutSmallerThanZero = errors.New("StallTimeout can not be smaller than 0")
+	ErrorNilLogger                   = errors.New("Logger can not be nil")
+	ErrorRnageFormat                 = errors.New("Does not support (bytes=i-j,m-n) format, only support (bytes=i-j)")
+	ErrorBucketOrObjectNotMatching   = errors.New("BucketName or ObjectName is not matching")
+	ErrorMD5NotMatching              = errors.New("MD5 is not matching")
+	ErrorBreakpointVersion           = errors.New("Breakpoint version is not supported")
+	ErrorObjectStateNotMatching      = errors.New("Object state is not matching")
+	ErrorFileStateNotMatching        = errors.New("File state is not matching")
+	ErrorVersionNotMatching          = errors.New("Version is not matching")
+	ErrorRangeNotMatching            = errors.New("Range is not matching")
+	ErrorPartChecksumNotMatching     = errors.New("Part checksum is not matching")
+	ErrorPartLengthNotMatching       = errors.New("Part length is not matching")
+	ErrorPartTimeout                 = errors.New("Part is timed out")
+	ErrorPartRangeNotMatching        = errors.New("Part range is not matching")
+	ErrorFileNotFound                = errors.New("File is not found")
+	ErrorDiskFull                    = errors.New("No space left on device")
+	ErrorTooManyUploadParts          = errors.New("Too many upload parts, increase PartSize please")
+	ErrorTransformChangedLength      = errors.New("TransformReader can not change the length of part")
+	ErrorTransformSeek               = errors.New("TransformReader part can only be rewound to its start")
+	ErrorTaskNotRunning              = errors.New("Task is not running")
+	ErrorTaskNotPaused               = errors.New("Task is not paused")
+	ErrorTaskDone                    = errors.New("Task is done")
+	ErrorTaskCancelled               = errors.New("Task is cancelled")
+	ErrorBucketNameEmpty             = errors.New("BucketName can not be empty")
+	ErrorObjectNameEmpty             = errors.New("ObjectName can not be empty")
+	ErrorFilePathEmpty               = errors.New("FilePath can not be empty")
+	ErrorFilePathIsDirectory         = errors.New("FilePath can not be a directory")
+	ErrorDirectoryNotWritable        = errors.New("Directory of FilePath is not writable")
+	ErrorFileExists                  = errors.New("FilePath exists")
+	ErrorObjectChanged               = errors.New("Object is changed during downloading")
+	ErrorObjectTooLarge              = errors.New("Object is larger than MaxObjectSize")
+	ErrorObjectArchived              = errors.New("Object is archived, restore it before downloading")
+	ErrorDownloaderClosed            = errors.New("Downloader is shut down")
+	ErrorPoolSizeSmallerThanOne      = errors.New("DownloadPool size can not be smaller than 1")
 )
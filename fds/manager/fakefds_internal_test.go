@@ -0,0 +1,313 @@
+package manager
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/go-fds/fds"
+)
+
+const fakeLastModified = "Mon, 01 Oct 2018 00:00:00 GMT"
+
+// fakeFDS is an in-memory FDS server which speaks just enough of the REST
+// protocol for the manager tests
+type fakeFDS struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	objects  map[string][]byte
+	modTimes map[string]time.Time
+	uploads  map[string]map[int][]byte
+	aborted  []string
+	requests []*http.Request
+	nextID   int
+
+	// hook is called before the default handling, returns true if the request is handled
+	hook func(w http.ResponseWriter, r *http.Request) bool
+}
+
+func newFakeFDS() *fakeFDS {
+	s := &fakeFDS{
+		objects:  map[string][]byte{},
+		modTimes: map[string]time.Time{},
+		uploads:  map[string]map[int][]byte{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *fakeFDS) client() *fds.Client {
+	u, _ := url.Parse(s.URL)
+	conf, _ := fds.NewClientConfiguration(u.Host)
+	conf.EnableHTTPS = false
+	return fds.New("ak", "sk", conf)
+}
+
+func (s *fakeFDS) putObject(bucketName, objectName string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setObject(bucketName+"/"+objectName, content)
+}
+
+// setObject stores an object, it must be called with mu held
+func (s *fakeFDS) setObject(key string, content []byte) {
+	s.objects[key] = content
+	s.modTimes[key] = time.Now()
+}
+
+func (s *fakeFDS) getObject(bucketName, objectName string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, ok := s.objects[bucketName+"/"+objectName]
+	return content, ok
+}
+
+func (s *fakeFDS) abortedUploads() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.aborted...)
+}
+
+func (s *fakeFDS) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	hook := s.hook
+	s.mu.Unlock()
+
+	if hook != nil && hook(w, r) {
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	q := r.URL.Query()
+	_, hasUploads := q["uploads"]
+	_, hasMetadata := q["metadata"]
+	uploadID := q.Get("uploadId")
+
+	bucketName, objectName := splitKey(key)
+	_, hasDeleteObjects := q["deleteObjects"]
+	_, hasAppend := q["append"]
+
+	// the versions of an object are kept as objects named with the version
+	if versionID := q.Get("versionId"); versionID != "" {
+		key += "?versionId=" + versionID
+	}
+
+	switch {
+	case r.Method == http.MethodGet && objectName == "":
+		s.listObjects(w, bucketName, q)
+	case r.Method == http.MethodPut && objectName == "" && hasDeleteObjects:
+		var names []string
+		json.NewDecoder(r.Body).Decode(&names)
+		s.mu.Lock()
+		for _, name := range names {
+			delete(s.objects, bucketName+"/"+name)
+		}
+		s.mu.Unlock()
+	case r.Method == http.MethodGet && hasMetadata, r.Method == http.MethodHead:
+		content, ok := s.getObjectByKey(key)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set(fds.HTTPHeaderContentMetadataLength, strconv.Itoa(len(content)))
+		w.Header().Set(fds.HTTPHeaderLastModified, fakeLastModified)
+		w.Header().Set(fds.HTTPHeaderETag, fmt.Sprintf("%x", md5.Sum(content)))
+	case r.Method == http.MethodGet:
+		content, ok := s.getObjectByKey(key)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.serveContent(w, r, content)
+	case r.Method == http.MethodPut && hasUploads:
+		s.mu.Lock()
+		s.nextID++
+		id := fmt.Sprintf("upload-%d", s.nextID)
+		s.uploads[id] = map[int][]byte{}
+		s.mu.Unlock()
+		writeJSON(w, fds.InitMultipartUploadResponse{BucketName: bucketName, ObjectName: objectName, UploadID: id})
+	case r.Method == http.MethodPut && uploadID != "" && q.Get("partNumber") != "":
+		partNumber, _ := strconv.Atoi(q.Get("partNumber"))
+		data, _ := ioutil.ReadAll(r.Body)
+		etag := fmt.Sprintf("%x", md5.Sum(data))
+		if sums := r.Header["Content-Md5"]; len(sums) > 1 || len(sums) == 1 && sums[0] != "" && sums[0] != etag {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		parts, ok := s.uploads[uploadID]
+		if ok {
+			parts[partNumber] = data
+		}
+		s.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, fds.UploadPartResponse{PartNumber: partNumber, ETag: etag, PartSize: int64(len(data))})
+	case r.Method == http.MethodPut && uploadID != "":
+		list := fds.UploadPartList{}
+		json.NewDecoder(r.Body).Decode(&list)
+		s.mu.Lock()
+		parts, ok := s.uploads[uploadID]
+		if ok {
+			var numbers []int
+			for _, p := range list.UploadPartResultList {
+				numbers = append(numbers, p.PartNumber)
+			}
+			sort.Ints(numbers)
+			var content []byte
+			for _, n := range numbers {
+				content = append(content, parts[n]...)
+			}
+			s.setObject(key, content)
+			delete(s.uploads, uploadID)
+		}
+		s.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, fds.PutObjectResponse{BucketName: bucketName, ObjectName: objectName})
+	case r.Method == http.MethodDelete && uploadID != "":
+		s.mu.Lock()
+		delete(s.uploads, uploadID)
+		s.aborted = append(s.aborted, uploadID)
+		s.mu.Unlock()
+	case r.Method == http.MethodPut && hasAppend:
+		data, _ := ioutil.ReadAll(r.Body)
+		s.mu.Lock()
+		content := s.objects[key]
+		matched := q.Get("position") == strconv.Itoa(len(content))
+		if matched {
+			content = append(append([]byte(nil), content...), data...)
+			s.setObject(key, content)
+		}
+		s.mu.Unlock()
+		w.Header().Set(fds.HTTPHeaderNextAppendPosition, strconv.Itoa(len(content)))
+		if !matched {
+			w.WriteHeader(http.StatusConflict)
+		}
+	case r.Method == http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		s.mu.Lock()
+		s.setObject(key, data)
+		s.mu.Unlock()
+		writeJSON(w, fds.PutObjectResponse{BucketName: bucketName, ObjectName: objectName})
+	case r.Method == http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, key)
+		s.mu.Unlock()
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeFDS) listObjects(w http.ResponseWriter, bucketName string, q url.Values) {
+	maxKeys, _ := strconv.Atoi(q.Get("maxKeys"))
+	if maxKeys <= 0 {
+		maxKeys = fds.DefaultListObjectsMaxKeys
+	}
+
+	s.mu.Lock()
+	var names []string
+	for key := range s.objects {
+		b, name := splitKey(key)
+		if b == bucketName && strings.HasPrefix(name, q.Get("prefix")) && name > q.Get("marker") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	listing := fds.ObjectListing{
+		BucketName: bucketName,
+		Prefix:     q.Get("prefix"),
+		MaxKeys:    maxKeys,
+		Marker:     q.Get("marker"),
+	}
+	if len(names) > maxKeys {
+		names = names[:maxKeys]
+		listing.Truncated = true
+		listing.NextMarker = names[len(names)-1]
+	}
+	for _, name := range names {
+		content := s.objects[bucketName+"/"+name]
+		listing.ObjectSummaries = append(listing.ObjectSummaries, fds.ObjectSummary{
+			ObjectName:   name,
+			Size:         int64(len(content)),
+			ETag:         fmt.Sprintf("%x", md5.Sum(content)),
+			LastModified: s.modTimes[bucketName+"/"+name],
+		})
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, listing)
+}
+
+func (s *fakeFDS) getObjectByKey(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, ok := s.objects[key]
+	return content, ok
+}
+
+func (s *fakeFDS) serveContent(w http.ResponseWriter, r *http.Request, content []byte) {
+	etag := fmt.Sprintf("%x", md5.Sum(content))
+	w.Header().Set(fds.HTTPHeaderETag, etag)
+	w.Header().Set(fds.HTTPHeaderContentMetadataLength, strconv.Itoa(len(content)))
+
+	rangeHeader := r.Header.Get(fds.HTTPHeaderRange)
+	if ifRange := r.Header.Get(fds.HTTPHeaderIfRange); ifRange != "" && ifRange != etag {
+		rangeHeader = ""
+	}
+	if rangeHeader == "" {
+		w.Header().Set(fds.HTTPHeaderContentMD5, contentMD5(content))
+		w.Write(content)
+		return
+	}
+
+	var start, end int
+	fmt.Sscanf(rangeHeader, "bytes=%d-%d", &start, &end)
+	if end >= len(content) {
+		end = len(content) - 1
+	}
+	if start > end {
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+	w.Header().Set(fds.HTTPHeaderContentMD5, contentMD5(content[start:end+1]))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(content[start : end+1])
+}
+
+func contentMD5(content []byte) string {
+	sum := md5.Sum(content)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func splitKey(key string) (string, string) {
+	i := strings.Index(key, "/")
+	if i == -1 {
+		return key, ""
+	}
+	return key[:i], key[i+1:]
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, _ := json.Marshal(v)
+	w.Write(data)
+}
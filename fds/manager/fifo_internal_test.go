@@ -0,0 +1,53 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package manager
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloader_DownloadToPipe(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+	assert.Nil(t, syscall.Mkfifo(request.FilePath, 0600))
+
+	received := make(chan []byte)
+	go func() {
+		fd, err := os.Open(request.FilePath)
+		assert.Nil(t, err)
+		defer fd.Close()
+		data, err := ioutil.ReadAll(fd)
+		assert.Nil(t, err)
+		received <- data
+	}()
+
+	downloader, err := NewDownloader(server.client(), 300, 3, true)
+	assert.Nil(t, err)
+	result, err := downloader.DownloadWithResult(context.Background(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, content, <-received)
+	assert.Equal(t, 4, result.TotalParts)
+	assert.Equal(t, int64(1000), result.Bytes)
+
+	// the pipe is written in place, neither a temporary file nor a breakpoint is left
+	info, err := os.Stat(request.FilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.ModeNamedPipe, info.Mode()&os.ModeNamedPipe)
+	entries, err := ioutil.ReadDir(filepath.Dir(request.FilePath))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+}
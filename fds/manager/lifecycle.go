@@ -0,0 +1,77 @@
+package manager
+
+import (
+	"context"
+	"sync"
+)
+
+// lifecycle tracks the running downloads of a Downloader so that Shutdown can
+// cancel and wait for them
+type lifecycle struct {
+	mu      sync.Mutex
+	closed  bool
+	done    chan struct{}
+	running sync.WaitGroup
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{done: make(chan struct{})}
+}
+
+// begin registers a download, the returned context is cancelled on shutdown
+// and release has to be called when the download returns
+func (l *lifecycle) begin(ctx context.Context) (context.Context, func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, nil, ErrorDownloaderClosed
+	}
+	l.running.Add(1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-l.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	release := func() {
+		cancel()
+		<-stopped
+		l.running.Done()
+	}
+	return ctx, release, nil
+}
+
+// shutdown rejects new downloads, cancels the running ones and waits for them
+func (l *lifecycle) shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.done)
+	}
+	l.mu.Unlock()
+
+	idle := make(chan struct{})
+	go func() {
+		l.running.Wait()
+		close(idle)
+	}()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown cancels the running downloads of downloader and waits for them to
+// return until ctx is done, downloads started after it fail with ErrorDownloaderClosed
+func (downloader *Downloader) Shutdown(ctx context.Context) error {
+	return downloader.lifecycle.shutdown(ctx)
+}
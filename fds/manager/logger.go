@@ -0,0 +1,14 @@
+package manager
+
+import "github.com/XiaoMi/go-fds/fds"
+
+// Logger is the logger of Downloader and Uploader, the same as the one of fds.Client
+type Logger = fds.Logger
+
+// nopLogger is the default Logger, which discards everything
+type nopLogger struct{}
+
+func (nopLogger) Debug(args ...interface{}) {}
+func (nopLogger) Info(args ...interface{})  {}
+func (nopLogger) Warn(args ...interface{})  {}
+func (nopLogger) Error(args ...interface{}) {}
@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/XiaoMi/go-fds/fds"
+)
+
+// Metrics of the manager, reported to the MetricsCollector of the client
+const (
+	// MetricTransfers counts the downloads and uploads by type and result, which is success or failure
+	MetricTransfers = "fds_manager_transfers_total"
+	// MetricTransferDuration observes the seconds of the transfers by type
+	MetricTransferDuration = "fds_manager_transfer_duration_seconds"
+	// MetricTransferBytes counts the bytes of the parts transferred by type
+	MetricTransferBytes = "fds_manager_transfer_bytes_total"
+	// MetricPartRetries counts the retries of the parts by type
+	MetricPartRetries = "fds_manager_part_retries_total"
+)
+
+// Labels of the metrics
+const (
+	LabelType   = "type"
+	LabelResult = "result"
+)
+
+// Types of the transfers
+const (
+	TransferDownload = "download"
+	TransferUpload   = "upload"
+)
+
+func metricsCollector(client *fds.Client) fds.MetricsCollector {
+	if client == nil || client.Configuration == nil {
+		return nil
+	}
+	return client.Configuration.MetricsCollector
+}
+
+// reportTransfer reports a transfer of kind to the MetricsCollector of client, bytes
+// and retries are of its parts
+func reportTransfer(client *fds.Client, kind string, elapsed time.Duration, bytes int64, retries int, err error) {
+	collector := metricsCollector(client)
+	if collector == nil {
+		return
+	}
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	labels := map[string]string{LabelType: kind}
+	collector.AddCounter(MetricTransfers, map[string]string{LabelType: kind, LabelResult: result}, 1)
+	collector.ObserveHistogram(MetricTransferDuration, labels, elapsed.Seconds())
+	if bytes > 0 {
+		collector.AddCounter(MetricTransferBytes, labels, float64(bytes))
+	}
+	if retries > 0 {
+		collector.AddCounter(MetricPartRetries, labels, float64(retries))
+	}
+}
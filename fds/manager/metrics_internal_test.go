@@ -0,0 +1,83 @@
+package manager
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/XiaoMi/go-fds/fds"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloader_DownloadMetrics(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+	var count int32
+	server.hook = corruptPartOnce(content, "bytes=300-599", &count)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	metrics := fds.NewMemoryMetrics()
+	client := server.client()
+	client.Configuration.MetricsCollector = metrics
+	downloader, err := NewDownloaderWithOptions(client, WithPartSize(300), WithConcurrency(2),
+		WithRetries(1), WithVerifyParts(true))
+	assert.Nil(t, err)
+	assert.Nil(t, downloader.Download(request))
+
+	missing := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(missing.FilePath))
+	missing.ObjectName = "missing"
+	assert.NotNil(t, downloader.Download(missing))
+
+	snapshot := metrics.Snapshot()
+	assert.Equal(t, float64(1), snapshot.Counters[`fds_manager_transfers_total{result="success",type="download"}`])
+	assert.Equal(t, float64(1), snapshot.Counters[`fds_manager_transfers_total{result="failure",type="download"}`])
+	assert.Equal(t, float64(1000), snapshot.Counters[`fds_manager_transfer_bytes_total{type="download"}`])
+	assert.Equal(t, float64(1), snapshot.Counters[`fds_manager_part_retries_total{type="download"}`])
+	assert.Equal(t, uint64(2), snapshot.Histograms[`fds_manager_transfer_duration_seconds{type="download"}`].Count)
+	// the requests of the client are reported too
+	assert.Equal(t, float64(1), snapshot.Counters[`fds_requests_total{operation="GET object?metadata",status_class="4xx"}`])
+}
+
+func TestUploader_UploadMetrics(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	filePath, _ := newTestUploadFile(t, 3*fds.MinPartSize)
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	// the second part is reported as received with other content once
+	var corrupted int32
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Query().Get("partNumber") != "2" || atomic.AddInt32(&corrupted, 1) != 1 {
+			return false
+		}
+		ioutil.ReadAll(r.Body)
+		writeJSON(w, fds.UploadPartResponse{PartNumber: 2, ETag: "0123456789abcdef0123456789abcdef"})
+		return true
+	}
+
+	metrics := fds.NewMemoryMetrics()
+	client := server.client()
+	client.Configuration.MetricsCollector = metrics
+	uploader, err := NewUploader(client, fds.MinPartSize, 2, false)
+	assert.Nil(t, err)
+	uploader.VerifyParts = true
+	_, err = uploader.Upload(newTestUploadRequest(filePath))
+	assert.Nil(t, err)
+
+	snapshot := metrics.Snapshot()
+	assert.Equal(t, float64(1), snapshot.Counters[`fds_manager_transfers_total{result="success",type="upload"}`])
+	assert.Equal(t, float64(3*fds.MinPartSize), snapshot.Counters[`fds_manager_transfer_bytes_total{type="upload"}`])
+	assert.Equal(t, float64(1), snapshot.Counters[`fds_manager_part_retries_total{type="upload"}`])
+	assert.Equal(t, uint64(1), snapshot.Histograms[`fds_manager_transfer_duration_seconds{type="upload"}`].Count)
+	assert.Equal(t, float64(4), snapshot.Counters[`fds_requests_total{operation="PUT object?partNumber",status_class="2xx"}`])
+}
@@ -0,0 +1,165 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/XiaoMi/go-fds/fds"
+)
+
+// DefaultDownloadConcurrency is the default Concurrency of NewDownloaderWithOptions
+const DefaultDownloadConcurrency = 5
+
+// DownloaderOption configures the Downloader created by NewDownloaderWithOptions
+type DownloaderOption func(*Downloader)
+
+// WithPartSize sets PartSize of Downloader
+func WithPartSize(partSize int64) DownloaderOption {
+	return func(downloader *Downloader) {
+		downloader.PartSize = partSize
+	}
+}
+
+// WithConcurrency sets Concurrency of Downloader
+func WithConcurrency(concurrency int) DownloaderOption {
+	return func(downloader *Downloader) {
+		downloader.Concurrency = concurrency
+	}
+}
+
+// WithBreakpoint sets Breakpoint of Downloader
+func WithBreakpoint(breakpoint bool) DownloaderOption {
+	return func(downloader *Downloader) {
+		downloader.Breakpoint = breakpoint
+	}
+}
+
+// WithPreallocate sets Preallocate of Downloader
+func WithPreallocate(preallocate bool) DownloaderOption {
+	return func(downloader *Downloader) {
+		downloader.Preallocate = preallocate
+	}
+}
+
+// WithRetries sets Retries of Downloader
+func WithRetries(retries int) DownloaderOption {
+	return func(downloader *Downloader) {
+		downloader.Retries = retries
+	}
+}
+
+// WithPartTimeout sets PartTimeout of Downloader
+func WithPartTimeout(timeout time.Duration) DownloaderOption {
+	return func(downloader *Downloader) {
+		downloader.PartTimeout = timeout
+	}
+}
+
+// WithStallTimeout sets StallTimeout of Downloader
+func WithStallTimeout(timeout time.Duration) DownloaderOption {
+	return func(downloader *Downloader) {
+		downloader.StallTimeout = timeout
+	}
+}
+
+// WithVerifyParts sets VerifyParts of Downloader
+func WithVerifyParts(verify bool) DownloaderOption {
+	return func(downloader *Downloader) {
+		downloader.VerifyParts = verify
+	}
+}
+
+// WithVerifyResumedParts sets VerifyResumedParts of Downloader
+func WithVerifyResumedParts(verify bool) DownloaderOption {
+	return func(downloader *Downloader) {
+		downloader.VerifyResumedParts = verify
+	}
+}
+
+// WithDecompress sets Decompress of Downloader
+func WithDecompress(decompress bool) DownloaderOption {
+	return func(downloader *Downloader) {
+		downloader.Decompress = decompress
+	}
+}
+
+// WithDownloadPool sets Pool of Downloader
+func WithDownloadPool(pool *DownloadPool) DownloaderOption {
+	return func(downloader *Downloader) {
+		downloader.Pool = pool
+	}
+}
+
+// WithAlignParts sets AlignParts of Downloader
+func WithAlignParts(align bool) DownloaderOption {
+	return func(downloader *Downloader) {
+		downloader.AlignParts = align
+	}
+}
+
+// WithMaxObjectSize sets MaxObjectSize of Downloader
+func WithMaxObjectSize(size int64) DownloaderOption {
+	return func(downloader *Downloader) {
+		downloader.MaxObjectSize = size
+	}
+}
+
+// WithPartHooks sets OnPartStart and OnPartDone of Downloader
+func WithPartHooks(onStart func(p Part), onDone func(p Part, d time.Duration, err error)) DownloaderOption {
+	return func(downloader *Downloader) {
+		downloader.OnPartStart = onStart
+		downloader.OnPartDone = onDone
+	}
+}
+
+// WithLogger sets logger of Downloader
+func WithLogger(logger Logger) DownloaderOption {
+	return func(downloader *Downloader) {
+		downloader.logger = logger
+	}
+}
+
+// NewDownloaderWithOptions new a downloader with options, PartSize defaults to
+// PartSize of client configuration, Concurrency defaults to DefaultDownloadConcurrency
+func NewDownloaderWithOptions(client *fds.Client, opts ...DownloaderOption) (*Downloader, error) {
+	downloader := &Downloader{
+		PartSize:    fds.MinPartSize,
+		Concurrency: DefaultDownloadConcurrency,
+
+		client: client,
+	}
+	if client.Configuration != nil && client.Configuration.PartSize > 0 {
+		downloader.PartSize = int64(client.Configuration.PartSize)
+	}
+	downloader.logger = nopLogger{}
+	downloader.lifecycle = newLifecycle()
+
+	for _, opt := range opts {
+		opt(downloader)
+	}
+
+	if downloader.PartSize < 1 {
+		return nil, ErrorPartSizeSmallerThanOne
+	}
+
+	if downloader.Concurrency < 1 {
+		return nil, ErrorConcurrencySmallerThanOne
+	}
+
+	if downloader.Retries < 0 {
+		return nil, ErrorRetriesSmallerThanZero
+	}
+
+	if downloader.PartTimeout < 0 {
+		return nil, ErrorPartTimeoutSmallerThanZero
+	}
+
+	if downloader.StallTimeout < 0 {
+		return nil, ErrorStallTimeoutSmallerThanZero
+	}
+
+	if downloader.logger == nil {
+		return nil, ErrorNilLogger
+	}
+
+	return downloader, nil
+}
@@ -0,0 +1,107 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/XiaoMi/go-fds/fds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDownloaderWithOptions(t *testing.T) {
+	conf, _ := fds.NewClientConfiguration("cnbj0.fds.api.xiaomi.com")
+	client := fds.New("ak", "sk", conf)
+
+	downloader, err := NewDownloaderWithOptions(client)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(conf.PartSize), downloader.PartSize)
+	assert.Equal(t, DefaultDownloadConcurrency, downloader.Concurrency)
+	assert.False(t, downloader.Breakpoint)
+
+	logger := logrus.New()
+	downloader, err = NewDownloaderWithOptions(client,
+		WithPartSize(1024),
+		WithConcurrency(3),
+		WithBreakpoint(true),
+		WithPreallocate(true),
+		WithRetries(2),
+		WithLogger(logger))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1024), downloader.PartSize)
+	assert.Equal(t, 3, downloader.Concurrency)
+	assert.True(t, downloader.Breakpoint)
+	assert.True(t, downloader.Preallocate)
+	assert.Equal(t, 2, downloader.Retries)
+	assert.Equal(t, logger, downloader.logger)
+
+	invalids := []struct {
+		opt DownloaderOption
+		err error
+	}{
+		{WithPartSize(0), ErrorPartSizeSmallerThanOne},
+		{WithConcurrency(0), ErrorConcurrencySmallerThanOne},
+		{WithRetries(-1), ErrorRetriesSmallerThanZero},
+		{WithLogger(nil), ErrorNilLogger},
+	}
+	for _, invalid := range invalids {
+		_, err = NewDownloaderWithOptions(client, invalid.opt)
+		assert.Equal(t, invalid.err, err)
+	}
+}
+
+type capturingLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *capturingLogger) log(level string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, level+": "+fmt.Sprint(args...))
+}
+
+func (l *capturingLogger) Debug(args ...interface{}) { l.log("debug", args...) }
+func (l *capturingLogger) Info(args ...interface{})  { l.log("info", args...) }
+func (l *capturingLogger) Warn(args ...interface{})  { l.log("warn", args...) }
+func (l *capturingLogger) Error(args ...interface{}) { l.log("error", args...) }
+
+func TestDownloaderLogger(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloaderWithOptions(server.client())
+	assert.Nil(t, err)
+	assert.Equal(t, nopLogger{}, downloader.logger)
+
+	logger := &capturingLogger{}
+	downloader, err = NewDownloaderWithOptions(server.client(), WithPartSize(4096), WithConcurrency(2), WithLogger(logger))
+	assert.Nil(t, err)
+	assert.Nil(t, downloader.Download(request))
+	assertFileContent(t, request.FilePath, content)
+	assert.Equal(t, []string{"debug: concurrency 2 is clamped to 1 parts"}, logger.entries)
+}
+
+func TestUploaderLogger(t *testing.T) {
+	uploader, err := NewUploader(&fds.Client{}, fds.MinPartSize, 1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, nopLogger{}, uploader.logger)
+
+	logger := &capturingLogger{}
+	uploader.SetLogger(logger)
+	_, err = uploader.splitUploadParts(2 * fds.MinPartSize)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{fmt.Sprintf("debug: upload plan: part size %d, part count 2", fds.MinPartSize)}, logger.entries)
+
+	uploader.SetLogger(nil)
+	assert.Equal(t, nopLogger{}, uploader.logger)
+}
@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"context"
+	"sync"
+)
+
+// DownloadPool bounds the bytes of the parts in flight across all of the
+// Downloaders sharing it, a part is in flight from its first attempt until it
+// is written
+type DownloadPool struct {
+	mu      sync.Mutex
+	max     int64
+	used    int64
+	changed chan struct{}
+}
+
+// NewDownloadPool new a pool of maxInFlightBytes, a part larger than it is
+// downloaded alone
+func NewDownloadPool(maxInFlightBytes int64) (*DownloadPool, error) {
+	if maxInFlightBytes < 1 {
+		return nil, ErrorPoolSizeSmallerThanOne
+	}
+
+	return &DownloadPool{
+		max:     maxInFlightBytes,
+		changed: make(chan struct{}),
+	}, nil
+}
+
+// InFlight returns the bytes of the parts in flight
+func (pool *DownloadPool) InFlight() int64 {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.used
+}
+
+// acquire waits until n bytes fit in the pool, a nil pool is unlimited
+func (pool *DownloadPool) acquire(ctx context.Context, n int64) error {
+	if pool == nil {
+		return nil
+	}
+
+	for {
+		pool.mu.Lock()
+		if pool.used == 0 || pool.used+n <= pool.max {
+			pool.used += n
+			pool.mu.Unlock()
+			return nil
+		}
+		changed := pool.changed
+		pool.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release returns n bytes to the pool and wakes up the waiters
+func (pool *DownloadPool) release(n int64) {
+	if pool == nil {
+		return
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.used -= n
+	close(pool.changed)
+	pool.changed = make(chan struct{})
+}
@@ -0,0 +1,19 @@
+package manager
+
+import "os"
+
+// preallocateFile creates the file at path and allocates size bytes of it
+func preallocateFile(path string, size int64) error {
+	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, os.FileMode(0664))
+	if err != nil {
+		return err
+	}
+
+	err = preallocate(fd, size)
+	if err != nil {
+		fd.Close()
+		return err
+	}
+
+	return fd.Close()
+}
@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package manager
+
+import (
+	"os"
+	"syscall"
+)
+
+func preallocate(fd *os.File, size int64) error {
+	if size > 0 {
+		err := syscall.Fallocate(int(fd.Fd()), 0, 0, size)
+		if err != nil && err != syscall.EOPNOTSUPP && err != syscall.ENOSYS {
+			return err
+		}
+	}
+
+	// fallocate never shrinks a file, truncate takes care of a larger stale file
+	return fd.Truncate(size)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package manager
+
+import "os"
+
+func preallocate(fd *os.File, size int64) error {
+	return fd.Truncate(size)
+}
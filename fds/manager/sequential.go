@@ -0,0 +1,146 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// DownloadSequential downloads the object of request and writes it to w in order
+func (downloader *Downloader) DownloadSequential(request *DownloadRequest, w io.Writer) error {
+	return downloader.DownloadSequentialWithContext(context.Background(), request, w)
+}
+
+// DownloadSequentialWithContext downloads the object of request and writes it to w in order
+// with context controlling, so that w could be a pipe or stdout. Up to Concurrency parts are
+// fetched ahead into memory while the current one is written. FilePath is not used and
+// Breakpoint, Preallocate and Decompress are unavailable in this mode, as they rely on a
+// seekable file.
+func (downloader *Downloader) DownloadSequentialWithContext(ctx context.Context, request *DownloadRequest, w io.Writer) error {
+	ctx, _, end := startSpan(ctx, downloader.client, "fds.manager.DownloadSequential", objectAttributes(request.BucketName, request.ObjectName)...)
+	err := downloader.downloadSequential(ctx, request, w, &DownloadResult{PartSize: downloader.PartSize})
+	end(err)
+	return err
+}
+
+// downloadSequential writes the object of request to w and fills the statistics of result
+func (downloader *Downloader) downloadSequential(ctx context.Context, request *DownloadRequest, w io.Writer, result *DownloadResult) error {
+	if err := request.validateObject(); err != nil {
+		return err
+	}
+
+	ctx, release, err := downloader.lifecycle.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	metadata, err := request.objectMetadata(ctx, downloader.client)
+	if err != nil {
+		return err
+	}
+	request.etag = metadata.GetETag()
+
+	contentLength, err := objectSize(metadata)
+	if err != nil {
+		return err
+	}
+	if contentLength == 0 {
+		return nil
+	}
+
+	r, err := downloadRange(request.Range, contentLength)
+	if err != nil {
+		return err
+	}
+	if err := downloader.checkSize(r); err != nil {
+		return err
+	}
+	parts, err := downloader.splitDownloadParts(metadata, r)
+	if err != nil {
+		return err
+	}
+	result.TotalParts = len(parts)
+	result.PartSize = partSizeOf(parts)
+	result.Workers = workerCount(downloader.logger, downloader.Concurrency, len(parts))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type fetched struct {
+		data     []byte
+		err      error
+		acquired bool
+		retries  int
+	}
+	done := make([]chan fetched, len(parts))
+	for i := range done {
+		done[i] = make(chan fetched, 1)
+	}
+
+	window := make(chan struct{}, result.Workers)
+	go func() {
+		for i, p := range parts {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				done[i] <- fetched{err: ctx.Err()}
+				continue
+			}
+			if err := downloader.Pool.acquire(ctx, p.End-p.Start+1); err != nil {
+				<-window
+				done[i] <- fetched{err: err}
+				continue
+			}
+
+			go func(i int, p part) {
+				var buf bytes.Buffer
+				retries, err := downloader.retryPart(ctx, p, func(ctx context.Context) error {
+					buf.Reset()
+					return downloader.fetchPart(ctx, request, p, &buf)
+				})
+				done[i] <- fetched{data: buf.Bytes(), err: err, acquired: true, retries: retries}
+			}(i, p)
+		}
+	}()
+
+	for i := range parts {
+		f := <-done[i]
+		err = f.err
+		if err == nil {
+			_, err = w.Write(f.data)
+		}
+		if err == nil {
+			result.FetchedParts++
+			result.Bytes += int64(len(f.data))
+			result.Retries += f.retries
+		}
+		if f.acquired {
+			downloader.Pool.release(parts[i].End - parts[i].Start + 1)
+		}
+		<-window
+
+		if err != nil {
+			cancel()
+			for j, c := range done[i+1:] {
+				if f := <-c; f.acquired {
+					p := parts[i+1+j]
+					downloader.Pool.release(p.End - p.Start + 1)
+				}
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (downloader *Downloader) fetchPart(ctx context.Context, request *DownloadRequest, p part, w io.Writer) error {
+	data, metadata, err := downloader.getPart(ctx, request, p)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	return downloader.copyPart(p, w, data, metadata)
+}
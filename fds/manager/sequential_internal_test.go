@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/go-fds/fds"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloader_DownloadSequential(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	// the first part is the slowest, so the later ones are fetched ahead
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get(fds.HTTPHeaderRange) == "bytes=0-299" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return false
+	}
+
+	downloader, err := NewDownloader(server.client(), 300, 3, false)
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	request := &DownloadRequest{GetObjectRequest: fds.GetObjectRequest{BucketName: "bucket", ObjectName: "object"}}
+	assert.Nil(t, downloader.DownloadSequential(request, &buf))
+	assert.Equal(t, content, buf.Bytes())
+
+	buf.Reset()
+	request.Range = "bytes=100-699"
+	assert.Nil(t, downloader.DownloadSequential(request, &buf))
+	assert.Equal(t, content[100:700], buf.Bytes())
+}
+
+func TestDownloader_DownloadSequentialFailed(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	server.putObject("bucket", "object", newTestContent(1000))
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get(fds.HTTPHeaderRange) == "bytes=300-599" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return true
+		}
+		return false
+	}
+
+	downloader, err := NewDownloader(server.client(), 300, 2, false)
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	request := &DownloadRequest{GetObjectRequest: fds.GetObjectRequest{BucketName: "bucket", ObjectName: "object"}}
+	err = downloader.DownloadSequentialWithContext(context.Background(), request, &buf)
+	assert.Equal(t, http.StatusInternalServerError, err.(*fds.ServerError).StatusCode)
+	assert.Equal(t, 300, buf.Len())
+}
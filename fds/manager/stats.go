@@ -0,0 +1,127 @@
+package manager
+
+import "sync/atomic"
+
+// TransferStats is a snapshot of the progress of a transfer
+type TransferStats struct {
+	TotalParts     int
+	CompletedParts int
+	TotalBytes     int64
+	CompletedBytes int64
+
+	// Retries, FailedParts and InFlight are counted like the ones of DownloaderStats,
+	// they accumulate over the resumed rounds of a transfer
+	Retries     int64
+	FailedParts int64
+	InFlight    int64
+}
+
+// transferStats is updated atomically by the transfer workers
+type transferStats struct {
+	totalParts     int64
+	completedParts int64
+	totalBytes     int64
+	completedBytes int64
+	retries        int64
+	failedParts    int64
+	inFlight       int64
+}
+
+func (stats *transferStats) reset(parts []part, partStat []bool) {
+	var totalBytes, completedParts, completedBytes int64
+	for i, p := range parts {
+		size := p.End - p.Start + 1
+		totalBytes += size
+		if partStat[i] {
+			completedParts++
+			completedBytes += size
+		}
+	}
+
+	atomic.StoreInt64(&stats.totalParts, int64(len(parts)))
+	atomic.StoreInt64(&stats.totalBytes, totalBytes)
+	atomic.StoreInt64(&stats.completedParts, completedParts)
+	atomic.StoreInt64(&stats.completedBytes, completedBytes)
+}
+
+func (stats *transferStats) complete(p part) {
+	atomic.AddInt64(&stats.completedParts, 1)
+	atomic.AddInt64(&stats.completedBytes, p.End-p.Start+1)
+}
+
+// begin counts a part in flight, stats may be nil as the methods of it below
+func (stats *transferStats) begin() {
+	if stats != nil {
+		atomic.AddInt64(&stats.inFlight, 1)
+	}
+}
+
+// end counts a part no longer in flight, failed counts it as a failed part
+func (stats *transferStats) end(failed bool) {
+	if stats == nil {
+		return
+	}
+	atomic.AddInt64(&stats.inFlight, -1)
+	if failed {
+		atomic.AddInt64(&stats.failedParts, 1)
+	}
+}
+
+func (stats *transferStats) retry() {
+	if stats != nil {
+		atomic.AddInt64(&stats.retries, 1)
+	}
+}
+
+func (stats *transferStats) snapshot() TransferStats {
+	return TransferStats{
+		TotalParts:     int(atomic.LoadInt64(&stats.totalParts)),
+		CompletedParts: int(atomic.LoadInt64(&stats.completedParts)),
+		TotalBytes:     atomic.LoadInt64(&stats.totalBytes),
+		CompletedBytes: atomic.LoadInt64(&stats.completedBytes),
+		Retries:        atomic.LoadInt64(&stats.retries),
+		FailedParts:    atomic.LoadInt64(&stats.failedParts),
+		InFlight:       atomic.LoadInt64(&stats.inFlight),
+	}
+}
+
+// DownloaderStats is a snapshot of the counters of a Downloader,
+// which accumulate over all the downloads of it
+type DownloaderStats struct {
+	// Bytes and Parts count the parts downloaded successfully
+	Bytes int64
+	Parts int64
+
+	// Retries counts the retried attempts of all parts, FailedParts counts the
+	// parts which still failed after the retries, cancelled parts are not counted
+	Retries     int64
+	FailedParts int64
+
+	// InFlight is the count of parts being downloaded at the moment
+	InFlight int64
+}
+
+// downloaderStats holds the counters updated atomically by the workers,
+// it is the first field of Downloader to keep the 64-bit alignment
+type downloaderStats struct {
+	bytes       int64
+	parts       int64
+	retries     int64
+	failedParts int64
+	inFlight    int64
+}
+
+func (stats *downloaderStats) snapshot() DownloaderStats {
+	return DownloaderStats{
+		Bytes:       atomic.LoadInt64(&stats.bytes),
+		Parts:       atomic.LoadInt64(&stats.parts),
+		Retries:     atomic.LoadInt64(&stats.retries),
+		FailedParts: atomic.LoadInt64(&stats.failedParts),
+		InFlight:    atomic.LoadInt64(&stats.inFlight),
+	}
+}
+
+// Stats returns a snapshot of the counters, it is safe to call while downloading
+func (downloader *Downloader) Stats() DownloaderStats {
+	return downloader.stats.snapshot()
+}
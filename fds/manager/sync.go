@@ -0,0 +1,449 @@
+package manager
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/go-fds/fds"
+)
+
+// SyncCompare is the way Syncer decides whether a file differs from an object
+type SyncCompare int
+
+const (
+	// SyncCompareModTime compares size and modification time
+	SyncCompareModTime SyncCompare = iota
+	// SyncCompareMD5 compares size and the MD5 of the content against the ETag
+	SyncCompareMD5
+)
+
+// SyncActionType is the kind of a SyncAction
+type SyncActionType string
+
+// Sync action types
+const (
+	SyncActionUpload       SyncActionType = "upload"
+	SyncActionDownload     SyncActionType = "download"
+	SyncActionDeleteRemote SyncActionType = "delete-remote"
+	SyncActionDeleteLocal  SyncActionType = "delete-local"
+)
+
+// SyncAction is a single planned operation of a sync
+type SyncAction struct {
+	Type SyncActionType
+
+	// Path is relative to both the directory and the prefix, slash separated
+	Path       string
+	FilePath   string
+	ObjectName string
+	Size       int64
+
+	// info of a small object is known from the listing
+	info *ObjectInfo
+}
+
+// Syncer synchronizes a local directory with a bucket prefix
+type Syncer struct {
+	uploader   *Uploader
+	downloader *Downloader
+	client     *fds.Client
+
+	Compare SyncCompare
+
+	// Delete removes files on the destination which do not exist on the source
+	Delete bool
+
+	// Include and Exclude are glob patterns matched against the relative path
+	// and the base name, a file is synced if it matches any Include pattern
+	// (or Include is empty) and no Exclude pattern
+	Include []string
+	Exclude []string
+
+	// DryRun returns the planned actions without executing them
+	DryRun bool
+
+	// Parallel is the count of actions executed at the same time
+	Parallel int
+
+	// PageSize is the maxKeys of each listing request, 0 means the default
+	PageSize int
+}
+
+// NewSyncer new a syncer which transfers with uploader and downloader
+func NewSyncer(uploader *Uploader, downloader *Downloader, parallel int) (*Syncer, error) {
+	if parallel < 1 {
+		return nil, ErrorConcurrencySmallerThanOne
+	}
+
+	return &Syncer{
+		uploader:   uploader,
+		downloader: downloader,
+		client:     uploader.client,
+		Parallel:   parallel,
+	}, nil
+}
+
+type syncEntry struct {
+	path         string
+	size         int64
+	modTime      time.Time
+	etag         string
+	storageClass fds.StorageClass
+}
+
+// SyncUp uploads the differences from localDir to prefix in bucket
+func (syncer *Syncer) SyncUp(ctx context.Context, localDir, bucketName, prefix string) ([]SyncAction, error) {
+	prefix = syncPrefix(prefix)
+
+	locals, err := syncer.listLocal(localDir)
+	if err != nil {
+		return nil, err
+	}
+	remotes, err := syncer.listRemote(ctx, bucketName, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []SyncAction
+	for _, l := range sortedEntries(locals) {
+		r, ok := remotes[l.path]
+		if ok {
+			same, err := syncer.same(localPath(localDir, l.path), l, r, l.modTime.After(r.modTime))
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				continue
+			}
+		}
+		actions = append(actions, SyncAction{
+			Type:       SyncActionUpload,
+			Path:       l.path,
+			FilePath:   localPath(localDir, l.path),
+			ObjectName: prefix + l.path,
+			Size:       l.size,
+		})
+	}
+
+	if syncer.Delete {
+		for _, r := range sortedEntries(remotes) {
+			if _, ok := locals[r.path]; !ok {
+				actions = append(actions, SyncAction{
+					Type:       SyncActionDeleteRemote,
+					Path:       r.path,
+					ObjectName: prefix + r.path,
+					Size:       r.size,
+				})
+			}
+		}
+	}
+
+	if syncer.DryRun {
+		return actions, nil
+	}
+	return actions, syncer.execute(ctx, bucketName, actions)
+}
+
+// SyncDown downloads the differences from prefix in bucket to localDir
+func (syncer *Syncer) SyncDown(ctx context.Context, bucketName, prefix, localDir string) ([]SyncAction, error) {
+	prefix = syncPrefix(prefix)
+
+	remotes, err := syncer.listRemote(ctx, bucketName, prefix)
+	if err != nil {
+		return nil, err
+	}
+	locals, err := syncer.listLocal(localDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []SyncAction
+	for _, r := range sortedEntries(remotes) {
+		l, ok := locals[r.path]
+		if ok {
+			same, err := syncer.same(localPath(localDir, r.path), l, r, r.modTime.After(l.modTime))
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				continue
+			}
+		}
+		actions = append(actions, SyncAction{
+			Type:       SyncActionDownload,
+			Path:       r.path,
+			FilePath:   localPath(localDir, r.path),
+			ObjectName: prefix + r.path,
+			Size:       r.size,
+			info:       syncer.listedInfo(r),
+		})
+	}
+
+	if syncer.Delete {
+		for _, l := range sortedEntries(locals) {
+			if _, ok := remotes[l.path]; !ok {
+				actions = append(actions, SyncAction{
+					Type:     SyncActionDeleteLocal,
+					Path:     l.path,
+					FilePath: localPath(localDir, l.path),
+					Size:     l.size,
+				})
+			}
+		}
+	}
+
+	if syncer.DryRun {
+		return actions, nil
+	}
+	return actions, syncer.execute(ctx, bucketName, actions)
+}
+
+// same reports whether the local file and the object hold the same content,
+// newer tells whether the source is newer than the destination
+func (syncer *Syncer) same(filePath string, local, remote *syncEntry, newer bool) (bool, error) {
+	if local.size != remote.size {
+		return false, nil
+	}
+
+	if syncer.Compare == SyncCompareMD5 {
+		sum, err := fileMD5(filePath)
+		if err != nil {
+			return false, err
+		}
+		return sum == strings.Trim(remote.etag, "\""), nil
+	}
+
+	return !newer, nil
+}
+
+// listedInfo is the info of an object downloaded in a single part from its listing, so
+// that it is downloaded without a metadata request. It is nil for the objects which need
+// the metadata, the ones of multiple parts, the archived ones and the ones to decompress.
+func (syncer *Syncer) listedInfo(remote *syncEntry) *ObjectInfo {
+	downloader := syncer.downloader
+	if remote.size > downloader.PartSize || remote.storageClass == fds.StorageClassArchive || downloader.Decompress {
+		return nil
+	}
+	return &ObjectInfo{Size: remote.size, ETag: remote.etag, LastModified: remote.modTime}
+}
+
+func (syncer *Syncer) match(relPath string) bool {
+	base := path.Base(relPath)
+	matchAny := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, relPath); ok {
+				return true
+			}
+			if ok, _ := path.Match(pattern, base); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(syncer.Include) > 0 && !matchAny(syncer.Include) {
+		return false
+	}
+	return !matchAny(syncer.Exclude)
+}
+
+func (syncer *Syncer) listLocal(localDir string) (map[string]*syncEntry, error) {
+	entries := map[string]*syncEntry{}
+
+	err := filepath.Walk(localDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && filePath == localDir {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() || isTransferFile(filePath) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(localDir, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !syncer.match(rel) {
+			return nil
+		}
+
+		entries[rel] = &syncEntry{path: rel, size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+
+	return entries, err
+}
+
+func (syncer *Syncer) listRemote(ctx context.Context, bucketName, prefix string) (map[string]*syncEntry, error) {
+	entries := map[string]*syncEntry{}
+
+	it := syncer.client.ListObjectsIteratorWithContext(ctx, bucketName, prefix, "", syncer.PageSize)
+	for {
+		summary, err := it.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rel := strings.TrimPrefix(summary.ObjectName, prefix)
+		if rel == "" || strings.HasSuffix(rel, "/") || !syncer.match(rel) {
+			continue
+		}
+		entries[rel] = &syncEntry{
+			path:         rel,
+			size:         summary.Size,
+			modTime:      summary.LastModified,
+			etag:         summary.ETag,
+			storageClass: summary.StorageClass,
+		}
+	}
+}
+
+func (syncer *Syncer) execute(ctx context.Context, bucketName string, actions []SyncAction) error {
+	var deletes []string
+	var transfers []SyncAction
+	for _, action := range actions {
+		if action.Type == SyncActionDeleteRemote {
+			deletes = append(deletes, action.ObjectName)
+		} else {
+			transfers = append(transfers, action)
+		}
+	}
+
+	jobs := make(chan SyncAction)
+	errs := make(chan error, len(transfers))
+	var wg sync.WaitGroup
+	for i := 0; i < workerCount(syncer.uploader.logger, syncer.Parallel, len(transfers)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for action := range jobs {
+				if err := syncer.executeAction(ctx, bucketName, action); err != nil {
+					errs <- fmt.Errorf("%s %s: %v", action.Type, action.Path, err)
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, action := range transfers {
+		select {
+		case jobs <- action:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := <-errs; err != nil {
+		return err
+	}
+
+	if len(deletes) == 0 {
+		return nil
+	}
+
+	result, err := syncer.client.BatchDeleteObjectsWithContext(ctx, &fds.DeleteObjectsRequest{
+		BucketName:  bucketName,
+		ObjectNames: deletes,
+	})
+	if err != nil {
+		return err
+	}
+	if len(result.Failed) > 0 {
+		f := result.Failed[0]
+		return fmt.Errorf("%s %s: %s", SyncActionDeleteRemote, f.ObjectName, f.Message)
+	}
+
+	return nil
+}
+
+func (syncer *Syncer) executeAction(ctx context.Context, bucketName string, action SyncAction) error {
+	switch action.Type {
+	case SyncActionUpload:
+		_, err := syncer.uploader.uploadWithRetries(ctx, &UploadRequest{
+			InitMultipartUploadRequest: fds.InitMultipartUploadRequest{
+				BucketName: bucketName,
+				ObjectName: action.ObjectName,
+			},
+			FilePath: action.FilePath,
+		})
+		return err
+	case SyncActionDownload:
+		if err := os.MkdirAll(filepath.Dir(action.FilePath), 0755); err != nil {
+			return err
+		}
+		return syncer.downloader.DownloadWithContext(ctx, &DownloadRequest{
+			GetObjectRequest: fds.GetObjectRequest{
+				BucketName: bucketName,
+				ObjectName: action.ObjectName,
+			},
+			FilePath: action.FilePath,
+			Info:     action.info,
+		})
+	case SyncActionDeleteLocal:
+		return os.Remove(action.FilePath)
+	}
+	return nil
+}
+
+// syncPrefix makes a non-empty prefix behave like a directory
+func syncPrefix(prefix string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		return prefix + "/"
+	}
+	return prefix
+}
+
+func localPath(localDir, relPath string) string {
+	return filepath.Join(localDir, filepath.FromSlash(relPath))
+}
+
+// isTransferFile reports whether the file is a temporary or breakpoint file of a transfer
+func isTransferFile(filePath string) bool {
+	return strings.HasSuffix(filePath, ".tmp") ||
+		strings.HasSuffix(filePath, ".download.bp") ||
+		strings.HasSuffix(filePath, ".upload.bp")
+}
+
+func sortedEntries(entries map[string]*syncEntry) []*syncEntry {
+	sorted := make([]*syncEntry, 0, len(entries))
+	for _, entry := range entries {
+		sorted = append(sorted, entry)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].path < sorted[j].path })
+	return sorted
+}
+
+func fileMD5(filePath string) (string, error) {
+	fd, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
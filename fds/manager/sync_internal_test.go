@@ -0,0 +1,196 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/go-fds/fds"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSyncer(t *testing.T, server *fakeFDS) *Syncer {
+	client := server.client()
+
+	uploader, err := NewUploader(client, fds.MinPartSize, 2, false)
+	assert.Nil(t, err)
+	downloader, err := NewDownloader(client, fds.MinPartSize, 2, false)
+	assert.Nil(t, err)
+
+	syncer, err := NewSyncer(uploader, downloader, 2)
+	assert.Nil(t, err)
+	syncer.PageSize = 2
+	return syncer
+}
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+		assert.Nil(t, ioutil.WriteFile(filePath, []byte(content), 0664))
+	}
+}
+
+func TestSyncer_SyncUp(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "fds-sync-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTestFiles(t, dir, map[string]string{
+		"a.txt":     "same",
+		"b/c.txt":   "new",
+		"d.txt":     "changed",
+		"debug.log": "excluded",
+	})
+	server.putObject("bucket", "p/a.txt", []byte("same"))
+	server.putObject("bucket", "p/d.txt", []byte("chang3d"))
+	server.putObject("bucket", "p/old.txt", []byte("old"))
+	server.putObject("bucket", "other/e.txt", []byte("other"))
+
+	syncer := newTestSyncer(t, server)
+	syncer.Compare = SyncCompareMD5
+	syncer.Delete = true
+	syncer.Exclude = []string{"*.log"}
+	syncer.DryRun = true
+
+	expected := []SyncAction{
+		{Type: SyncActionUpload, Path: "b/c.txt", FilePath: filepath.Join(dir, "b", "c.txt"), ObjectName: "p/b/c.txt", Size: 3},
+		{Type: SyncActionUpload, Path: "d.txt", FilePath: filepath.Join(dir, "d.txt"), ObjectName: "p/d.txt", Size: 7},
+		{Type: SyncActionDeleteRemote, Path: "old.txt", ObjectName: "p/old.txt", Size: 3},
+	}
+
+	actions, err := syncer.SyncUp(context.Background(), dir, "bucket", "p")
+	assert.Nil(t, err)
+	assert.Equal(t, expected, actions)
+	_, ok := server.getObject("bucket", "p/old.txt")
+	assert.True(t, ok)
+
+	syncer.DryRun = false
+	actions, err = syncer.SyncUp(context.Background(), dir, "bucket", "p")
+	assert.Nil(t, err)
+	assert.Equal(t, expected, actions)
+
+	content, _ := server.getObject("bucket", "p/b/c.txt")
+	assert.Equal(t, "new", string(content))
+	content, _ = server.getObject("bucket", "p/d.txt")
+	assert.Equal(t, "changed", string(content))
+	_, ok = server.getObject("bucket", "p/old.txt")
+	assert.False(t, ok)
+	_, ok = server.getObject("bucket", "p/debug.log")
+	assert.False(t, ok)
+	_, ok = server.getObject("bucket", "other/e.txt")
+	assert.True(t, ok)
+
+	actions, err = syncer.SyncUp(context.Background(), dir, "bucket", "p")
+	assert.Nil(t, err)
+	assert.Empty(t, actions)
+}
+
+func TestSyncer_SyncDown(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "fds-sync-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTestFiles(t, dir, map[string]string{
+		"stale.txt": "stale",
+		"keep.bin":  "not included",
+	})
+	server.putObject("bucket", "p/a.txt", []byte("aaa"))
+	server.putObject("bucket", "p/b/c.txt", []byte("ccc"))
+	server.putObject("bucket", "p/empty.txt", []byte{})
+	server.putObject("bucket", "p/skip.bin", []byte("bin"))
+
+	syncer := newTestSyncer(t, server)
+	syncer.Delete = true
+	syncer.Include = []string{"*.txt"}
+
+	actions, err := syncer.SyncDown(context.Background(), "bucket", "p/", dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(actions))
+	assert.Equal(t, SyncActionDeleteLocal, actions[3].Type)
+	assert.Equal(t, "stale.txt", actions[3].Path)
+
+	assertFileContent(t, filepath.Join(dir, "a.txt"), []byte("aaa"))
+	assertFileContent(t, filepath.Join(dir, "b", "c.txt"), []byte("ccc"))
+	assertFileContent(t, filepath.Join(dir, "empty.txt"), []byte{})
+	assertFileContent(t, filepath.Join(dir, "keep.bin"), []byte("not included"))
+	_, err = os.Stat(filepath.Join(dir, "stale.txt"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "skip.bin"))
+	assert.True(t, os.IsNotExist(err))
+
+	actions, err = syncer.SyncDown(context.Background(), "bucket", "p/", dir)
+	assert.Nil(t, err)
+	assert.Empty(t, actions)
+}
+
+func TestSyncer_SyncDownSmallObjects(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "fds-sync-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	large := newTestContent(fds.MinPartSize + 1)
+	server.putObject("bucket", "p/small.txt", []byte("small"))
+	server.putObject("bucket", "p/large.bin", large)
+
+	syncer := newTestSyncer(t, server)
+	_, err = syncer.SyncDown(context.Background(), "bucket", "p/", dir)
+	assert.Nil(t, err)
+	assertFileContent(t, filepath.Join(dir, "small.txt"), []byte("small"))
+	assertFileContent(t, filepath.Join(dir, "large.bin"), large)
+
+	// only the object of multiple parts is downloaded after its metadata
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	var metadataRequests []string
+	for _, r := range server.requests {
+		if _, ok := r.URL.Query()["metadata"]; ok {
+			metadataRequests = append(metadataRequests, r.URL.Path)
+		}
+	}
+	assert.Equal(t, []string{"/bucket/p/large.bin"}, metadataRequests)
+}
+
+func BenchmarkSyncer_SyncDownSmallObjects(b *testing.B) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	// every request takes a round trip of a remote server
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		time.Sleep(time.Millisecond)
+		return false
+	}
+	for i := 0; i < 200; i++ {
+		server.putObject("bucket", fmt.Sprintf("p/%03d.txt", i), newTestContent(1024))
+	}
+
+	client := server.client()
+	uploader, _ := NewUploader(client, fds.MinPartSize, 1, false)
+	downloader, _ := NewDownloader(client, fds.MinPartSize, 1, false)
+	syncer, _ := NewSyncer(uploader, downloader, 16)
+
+	for i := 0; i < b.N; i++ {
+		dir, err := ioutil.TempDir("", "fds-sync-bench-")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := syncer.SyncDown(context.Background(), "bucket", "p/", dir); err != nil {
+			b.Fatal(err)
+		}
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,400 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/XiaoMi/go-fds/fds"
+)
+
+type taskState int
+
+const (
+	taskRunning taskState = iota
+	taskPaused
+	taskDone
+)
+
+// UploadTask is an asynchronous upload started by Uploader.UploadAsync
+type UploadTask struct {
+	// stats is the first field to keep the 64-bit alignment of its counters,
+	// which are updated atomically also on 32-bit platforms
+	stats transferStats
+
+	uploader *Uploader
+	request  *UploadRequest
+
+	mu       sync.Mutex
+	state    taskState
+	cancel   context.CancelFunc
+	stopped  chan struct{}
+	done     chan struct{}
+	response *fds.PutObjectResponse
+	err      error
+}
+
+// UploadAsync starts uploading in background and returns the task controlling it.
+// The task always uses breakpoint, so that it could be paused and resumed.
+func (uploader *Uploader) UploadAsync(request *UploadRequest) *UploadTask {
+	u := *uploader
+	u.Breakpoint = true
+
+	if request.breakpointFilePath == "" {
+		request.breakpointFilePath = fmt.Sprintf("%s.upload.bp", request.FilePath)
+	}
+
+	task := &UploadTask{
+		uploader: &u,
+		request:  request,
+		done:     make(chan struct{}),
+	}
+
+	task.mu.Lock()
+	task.run()
+	task.mu.Unlock()
+
+	return task
+}
+
+// run starts a round of uploading, it must be called with mu held
+func (task *UploadTask) run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+
+	task.state = taskRunning
+	task.cancel = cancel
+	task.stopped = stopped
+
+	go func() {
+		defer close(stopped)
+		defer cancel()
+
+		response, err := task.uploader.upload(ctx, task.request, &task.stats)
+
+		task.mu.Lock()
+		defer task.mu.Unlock()
+		if task.state == taskRunning || err == nil {
+			task.finish(response, err)
+		}
+	}()
+}
+
+// finish marks the task as done, it must be called with mu held
+func (task *UploadTask) finish(response *fds.PutObjectResponse, err error) {
+	task.state = taskDone
+	task.response = response
+	task.err = err
+	close(task.done)
+}
+
+// stop cancels the running round and waits for it, it must be called with mu held
+// and returns with mu held
+func (task *UploadTask) stop() {
+	task.cancel()
+	stopped := task.stopped
+	task.mu.Unlock()
+	<-stopped
+	task.mu.Lock()
+}
+
+// Pause stops dispatching parts, waits for the in-flight parts and persists the breakpoint
+func (task *UploadTask) Pause() error {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	if task.state != taskRunning {
+		return ErrorTaskNotRunning
+	}
+
+	task.state = taskPaused
+	task.stop()
+
+	if task.state == taskDone {
+		return ErrorTaskDone
+	}
+	return nil
+}
+
+// Resume continues uploading the unfinished parts of a paused task
+func (task *UploadTask) Resume() error {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	if task.state != taskPaused {
+		return ErrorTaskNotPaused
+	}
+
+	task.run()
+	return nil
+}
+
+// Cancel stops the task, aborts the multipart upload and removes the breakpoint
+func (task *UploadTask) Cancel() error {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	if task.state == taskRunning {
+		// finish the round as cancelled rather than as failed
+		task.state = taskPaused
+		task.stop()
+	}
+
+	if task.state == taskDone {
+		return ErrorTaskDone
+	}
+
+	bp := uploadBreakpointInfo{}
+	if err := bp.Load(task.request.breakpointFilePath); err == nil && bp.UploadID != "" {
+		abortRequest := &fds.InitMultipartUploadResponse{
+			BucketName: task.request.BucketName,
+			ObjectName: task.request.ObjectName,
+			UploadID:   bp.UploadID,
+		}
+		if err := task.uploader.client.AbortMultipartUpload(abortRequest); err != nil {
+			task.uploader.logger.Debug(err)
+		}
+	}
+	bp.FilePath = task.request.breakpointFilePath
+	bp.Destroy()
+
+	task.finish(nil, ErrorTaskCancelled)
+	return nil
+}
+
+// Done is closed when the task completes, fails or is cancelled
+func (task *UploadTask) Done() <-chan struct{} {
+	return task.done
+}
+
+// Result returns the response and the error of a done task
+func (task *UploadTask) Result() (*fds.PutObjectResponse, error) {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	return task.response, task.err
+}
+
+// Stats returns the progress of the task
+func (task *UploadTask) Stats() TransferStats {
+	return task.stats.snapshot()
+}
+
+// DownloadEventType is the kind of a DownloadEvent
+type DownloadEventType int
+
+// Download events
+const (
+	DownloadStarted DownloadEventType = iota
+	DownloadPartCompleted
+	DownloadPartRetried
+	DownloadPaused
+	DownloadResumed
+	DownloadFailed
+	DownloadCompleted
+)
+
+// DownloadEvent is an event of a DownloadTask, Part is set for the part events and
+// Err is the error of a retried part or a failed download
+type DownloadEvent struct {
+	Type DownloadEventType
+	Part Part
+	Err  error
+}
+
+// downloadEventBuffer is the count of events kept for a slow consumer, the ones
+// beyond it are dropped
+const downloadEventBuffer = 64
+
+// DownloadTask is an asynchronous download started by Downloader.DownloadAsync
+type DownloadTask struct {
+	downloader *Downloader
+	request    *DownloadRequest
+
+	mu      sync.Mutex
+	state   taskState
+	cancel  context.CancelFunc
+	stopped chan struct{}
+	done    chan struct{}
+	result  *DownloadResult
+	err     error
+
+	eventsMu     sync.Mutex
+	events       chan DownloadEvent
+	eventsClosed bool
+}
+
+// DownloadAsync starts downloading in background and returns the task controlling it.
+// The task always uses breakpoint, so that it could be paused and resumed.
+func (downloader *Downloader) DownloadAsync(request *DownloadRequest) *DownloadTask {
+	breakpoint := true
+	request.breakpoint = &breakpoint
+	if request.breakpointFilePath == "" {
+		request.breakpointFilePath = request.FilePath + breakpointSuffix
+	}
+
+	task := &DownloadTask{
+		downloader: downloader,
+		request:    request,
+		done:       make(chan struct{}),
+		events:     make(chan DownloadEvent, downloadEventBuffer),
+	}
+	request.onEvent = task.emit
+
+	task.mu.Lock()
+	task.emit(DownloadEvent{Type: DownloadStarted})
+	task.run()
+	task.mu.Unlock()
+
+	return task
+}
+
+// run starts a round of downloading, it must be called with mu held
+func (task *DownloadTask) run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+
+	task.state = taskRunning
+	task.cancel = cancel
+	task.stopped = stopped
+
+	go func() {
+		defer close(stopped)
+		defer cancel()
+
+		result, err := task.downloader.DownloadWithResult(ctx, task.request)
+
+		task.mu.Lock()
+		defer task.mu.Unlock()
+		if task.state == taskRunning || err == nil {
+			task.finish(result, err)
+		}
+	}()
+}
+
+// finish marks the task as done, it must be called with mu held
+func (task *DownloadTask) finish(result *DownloadResult, err error) {
+	task.state = taskDone
+	task.result = result
+	task.err = err
+	task.request.onEvent = nil
+	close(task.done)
+
+	if err != nil {
+		task.emit(DownloadEvent{Type: DownloadFailed, Err: err})
+	} else {
+		task.emit(DownloadEvent{Type: DownloadCompleted})
+	}
+	task.eventsMu.Lock()
+	task.eventsClosed = true
+	close(task.events)
+	task.eventsMu.Unlock()
+}
+
+// emit sends e without blocking, the events beyond the buffer are dropped except for
+// the last ones of a task, which replace the oldest events kept
+func (task *DownloadTask) emit(e DownloadEvent) {
+	task.eventsMu.Lock()
+	defer task.eventsMu.Unlock()
+	if task.eventsClosed {
+		return
+	}
+
+	select {
+	case task.events <- e:
+		return
+	default:
+	}
+	if e.Type != DownloadFailed && e.Type != DownloadCompleted {
+		return
+	}
+	select {
+	case <-task.events:
+	default:
+	}
+	task.events <- e
+}
+
+// stop cancels the running round and waits for it, it must be called with mu held
+// and returns with mu held
+func (task *DownloadTask) stop() {
+	task.cancel()
+	stopped := task.stopped
+	task.mu.Unlock()
+	<-stopped
+	task.mu.Lock()
+}
+
+// Pause stops dispatching parts, waits for the in-flight parts and persists the breakpoint
+func (task *DownloadTask) Pause() error {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	if task.state != taskRunning {
+		return ErrorTaskNotRunning
+	}
+
+	task.state = taskPaused
+	task.stop()
+
+	if task.state == taskDone {
+		return ErrorTaskDone
+	}
+	task.emit(DownloadEvent{Type: DownloadPaused})
+	return nil
+}
+
+// Resume continues downloading the unfinished parts of a paused task
+func (task *DownloadTask) Resume() error {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	if task.state != taskPaused {
+		return ErrorTaskNotPaused
+	}
+
+	task.emit(DownloadEvent{Type: DownloadResumed})
+	task.run()
+	return nil
+}
+
+// Cancel stops the task and removes the breakpoint along with the temp file
+func (task *DownloadTask) Cancel() error {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	if task.state == taskRunning {
+		// finish the round as cancelled rather than as failed
+		task.state = taskPaused
+		task.stop()
+	}
+
+	if task.state == taskDone {
+		return ErrorTaskDone
+	}
+
+	os.Remove(task.request.breakpointFilePath)
+	os.Remove(task.request.FilePath + ".tmp")
+
+	task.finish(nil, ErrorTaskCancelled)
+	return nil
+}
+
+// Events returns the events of the task as they happen, it is closed after the
+// DownloadCompleted or DownloadFailed event. Events are dropped rather than stalling
+// the download if the consumer falls behind.
+func (task *DownloadTask) Events() <-chan DownloadEvent {
+	return task.events
+}
+
+// Done is closed when the task completes, fails or is cancelled
+func (task *DownloadTask) Done() <-chan struct{} {
+	return task.done
+}
+
+// Result returns the result of the last round and the error of a done task
+func (task *DownloadTask) Result() (*DownloadResult, error) {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	return task.result, task.err
+}
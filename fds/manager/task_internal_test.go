@@ -0,0 +1,308 @@
+package manager
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/XiaoMi/go-fds/fds"
+	"github.com/stretchr/testify/assert"
+)
+
+// holdPartOnce holds the first request of partNumber until the client gives up
+func holdPartOnce(partNumber string, reached chan<- bool) func(http.ResponseWriter, *http.Request) bool {
+	var held int32
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Query().Get("partNumber") != partNumber || !atomic.CompareAndSwapInt32(&held, 0, 1) {
+			return false
+		}
+		ioutil.ReadAll(r.Body)
+		reached <- true
+		<-r.Context().Done()
+		return true
+	}
+}
+
+func TestUploadTask_PauseResume(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	filePath, content := newTestUploadFile(t, 5*fds.MinPartSize)
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	reached := make(chan bool, 1)
+	server.hook = holdPartOnce("3", reached)
+
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 1, false)
+	assert.Nil(t, err)
+
+	task := uploader.UploadAsync(newTestUploadRequest(filePath))
+	<-reached
+	assert.Nil(t, task.Pause())
+	assert.Equal(t, ErrorTaskNotRunning, task.Pause())
+
+	stats := task.Stats()
+	assert.Equal(t, 5, stats.TotalParts)
+	assert.Equal(t, 2, stats.CompletedParts)
+	assert.Equal(t, int64(2*fds.MinPartSize), stats.CompletedBytes)
+	// the part cancelled by the pause is not counted as failed
+	assert.Equal(t, int64(0), stats.FailedParts)
+	assert.Equal(t, int64(0), stats.InFlight)
+	_, err = os.Stat(filePath + ".upload.bp")
+	assert.Nil(t, err)
+
+	assert.Nil(t, task.Resume())
+	assert.Equal(t, ErrorTaskNotPaused, task.Resume())
+	<-task.Done()
+
+	response, err := task.Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "object", response.ObjectName)
+	assert.Equal(t, 5, task.Stats().CompletedParts)
+	assert.Empty(t, server.abortedUploads())
+
+	uploaded, _ := server.getObject("bucket", "object")
+	assert.True(t, bytes.Equal(content, uploaded))
+}
+
+func TestUploadTask_Stats(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	filePath, _ := newTestUploadFile(t, 4*fds.MinPartSize)
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	var corrupted int32
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		switch r.URL.Query().Get("partNumber") {
+		case "2":
+			// the ETag of the first attempt does not match
+			if atomic.AddInt32(&corrupted, 1) == 1 {
+				ioutil.ReadAll(r.Body)
+				writeJSON(w, fds.UploadPartResponse{PartNumber: 2, ETag: "0123456789abcdef0123456789abcdef"})
+				return true
+			}
+		case "4":
+			ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusForbidden)
+			return true
+		}
+		return false
+	}
+
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 1, false)
+	assert.Nil(t, err)
+	uploader.VerifyParts = true
+
+	task := uploader.UploadAsync(newTestUploadRequest(filePath))
+	<-task.Done()
+	_, err = task.Result()
+	assert.NotNil(t, err)
+
+	stats := task.Stats()
+	assert.Equal(t, 3, stats.CompletedParts)
+	assert.Equal(t, int64(1), stats.Retries)
+	assert.Equal(t, int64(1), stats.FailedParts)
+	assert.Equal(t, int64(0), stats.InFlight)
+}
+
+func TestUploadTask_Cancel(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	filePath, _ := newTestUploadFile(t, 5*fds.MinPartSize)
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	reached := make(chan bool, 1)
+	server.hook = holdPartOnce("2", reached)
+
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 1, false)
+	assert.Nil(t, err)
+
+	task := uploader.UploadAsync(newTestUploadRequest(filePath))
+	<-reached
+	assert.Nil(t, task.Cancel())
+	<-task.Done()
+
+	_, err = task.Result()
+	assert.Equal(t, ErrorTaskCancelled, err)
+	assert.Equal(t, ErrorTaskDone, task.Cancel())
+	assert.Equal(t, []string{"upload-1"}, server.abortedUploads())
+
+	_, err = os.Stat(filePath + ".upload.bp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadTask_Events(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	var failures, holds int32
+	reached := make(chan bool, 1)
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		switch r.Header.Get(fds.HTTPHeaderRange) {
+		case "bytes=200-299":
+			if atomic.AddInt32(&failures, 1) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return true
+			}
+		case "bytes=500-599":
+			if atomic.AddInt32(&holds, 1) == 1 {
+				reached <- true
+				<-r.Context().Done()
+				return true
+			}
+		}
+		return false
+	}
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(100), WithConcurrency(1), WithRetries(1))
+	assert.Nil(t, err)
+
+	task := downloader.DownloadAsync(request)
+	<-reached
+	assert.Nil(t, task.Pause())
+	assert.Nil(t, task.Resume())
+
+	var events []DownloadEvent
+	for e := range task.Events() {
+		events = append(events, e)
+	}
+	<-task.Done()
+	_, err = task.Result()
+	assert.Nil(t, err)
+	assertFileContent(t, request.FilePath, content)
+
+	completed := func(index int) DownloadEvent {
+		return DownloadEvent{Type: DownloadPartCompleted, Part: Part{Index: index, Start: int64(index) * 100, End: int64(index)*100 + 99}}
+	}
+	var types []DownloadEventType
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []DownloadEventType{
+		DownloadStarted,
+		DownloadPartCompleted, DownloadPartCompleted,
+		DownloadPartRetried,
+		DownloadPartCompleted, DownloadPartCompleted, DownloadPartCompleted,
+		DownloadPaused, DownloadResumed,
+		DownloadPartCompleted, DownloadPartCompleted, DownloadPartCompleted, DownloadPartCompleted, DownloadPartCompleted,
+		DownloadCompleted,
+	}, types)
+	assert.Equal(t, completed(0), events[1])
+	assert.Equal(t, 2, events[3].Part.Index)
+	assert.NotNil(t, events[3].Err)
+	assert.Equal(t, completed(4), events[6])
+	assert.Equal(t, completed(5), events[9])
+}
+
+func TestDownloadTask_Stats(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(100), WithConcurrency(2))
+	assert.Nil(t, err)
+
+	// a download runs on the same Downloader while the task does
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+	done := make(chan error, 1)
+	go func() {
+		done <- downloader.Download(request)
+	}()
+
+	asyncRequest := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(asyncRequest.FilePath))
+	task := downloader.DownloadAsync(asyncRequest)
+	<-task.Done()
+	_, err = task.Result()
+	assert.Nil(t, err)
+	assert.Nil(t, <-done)
+	assertFileContent(t, asyncRequest.FilePath, content)
+
+	// the task forces breakpoint only for itself and counts in the stats of the Downloader
+	assert.False(t, downloader.Breakpoint)
+	assert.Equal(t, int64(2000), downloader.Stats().Bytes)
+	assert.Equal(t, int64(20), downloader.Stats().Parts)
+}
+
+func TestDownloadTask_SlowConsumer(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(5), WithConcurrency(4))
+	assert.Nil(t, err)
+
+	// nobody reads the events until the download is done
+	task := downloader.DownloadAsync(request)
+	<-task.Done()
+	assertFileContent(t, request.FilePath, content)
+
+	count := 0
+	var last DownloadEvent
+	for e := range task.Events() {
+		count++
+		last = e
+	}
+	assert.Equal(t, downloadEventBuffer, count)
+	assert.Equal(t, DownloadCompleted, last.Type)
+
+	assert.Equal(t, ErrorTaskDone, task.Cancel())
+}
+
+func TestDownloadTask_Cancel(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+	server.putObject("bucket", "object", newTestContent(1000))
+
+	reached := make(chan bool, 1)
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get(fds.HTTPHeaderRange) != "bytes=300-599" {
+			return false
+		}
+		reached <- true
+		<-r.Context().Done()
+		return true
+	}
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	downloader, err := NewDownloaderWithOptions(server.client(), WithPartSize(300), WithConcurrency(1))
+	assert.Nil(t, err)
+
+	task := downloader.DownloadAsync(request)
+	<-reached
+	assert.Nil(t, task.Cancel())
+	_, err = task.Result()
+	assert.Equal(t, ErrorTaskCancelled, err)
+
+	var last DownloadEvent
+	for e := range task.Events() {
+		last = e
+	}
+	assert.Equal(t, DownloadEvent{Type: DownloadFailed, Err: ErrorTaskCancelled}, last)
+	for _, suffix := range []string{"", ".tmp", breakpointSuffix} {
+		_, err = os.Stat(request.FilePath + suffix)
+		assert.True(t, os.IsNotExist(err), suffix)
+	}
+}
@@ -0,0 +1,26 @@
+package manager
+
+import (
+	"context"
+
+	"github.com/XiaoMi/go-fds/fds"
+)
+
+// AttributePart is the index of the part of a span, which starts from 0
+const AttributePart = "fds.part"
+
+// startSpan starts a span of the TraceProvider of client, see fds.StartSpan
+func startSpan(ctx context.Context, client *fds.Client, name string, attributes ...fds.Attribute) (context.Context, fds.Span, func(err error)) {
+	var provider fds.TraceProvider
+	if client != nil && client.Configuration != nil {
+		provider = client.Configuration.TraceProvider
+	}
+	return fds.StartSpan(ctx, provider, name, attributes...)
+}
+
+func objectAttributes(bucketName, objectName string) []fds.Attribute {
+	return []fds.Attribute{
+		{Key: fds.AttributeBucket, Value: bucketName},
+		{Key: fds.AttributeObject, Value: objectName},
+	}
+}
@@ -0,0 +1,158 @@
+package manager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/XiaoMi/go-fds/fds"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedSpan struct {
+	mu         *sync.Mutex
+	name       string
+	parent     *recordedSpan
+	attributes map[string]interface{}
+	events     []string
+	err        error
+}
+
+func (span *recordedSpan) SetAttributes(attributes ...fds.Attribute) {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	for _, a := range attributes {
+		span.attributes[a.Key] = a.Value
+	}
+}
+
+func (span *recordedSpan) AddEvent(name string, attributes ...fds.Attribute) {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	span.events = append(span.events, name)
+}
+
+type recordedSpanKey struct{}
+
+// recordingTracer keeps the spans started, whose parents are the spans of the contexts
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (tracer *recordingTracer) StartSpan(ctx context.Context, name string, attributes ...fds.Attribute) (context.Context, fds.Span) {
+	span := &recordedSpan{mu: &tracer.mu, name: name, attributes: map[string]interface{}{}}
+	span.parent, _ = ctx.Value(recordedSpanKey{}).(*recordedSpan)
+	span.SetAttributes(attributes...)
+
+	tracer.mu.Lock()
+	tracer.spans = append(tracer.spans, span)
+	tracer.mu.Unlock()
+	return context.WithValue(ctx, recordedSpanKey{}, span), span
+}
+
+func (tracer *recordingTracer) EndSpan(span fds.Span, err error) {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	span.(*recordedSpan).err = err
+}
+
+// named returns the spans of name
+func (tracer *recordingTracer) named(name string) []*recordedSpan {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	var spans []*recordedSpan
+	for _, span := range tracer.spans {
+		if span.name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func TestDownloader_DownloadTrace(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	content := newTestContent(1000)
+	server.putObject("bucket", "object", content)
+	var count int32
+	server.hook = corruptPartOnce(content, "bytes=300-599", &count)
+
+	request := newTestDownloadRequest(t)
+	defer os.RemoveAll(filepath.Dir(request.FilePath))
+
+	tracer := &recordingTracer{}
+	client := server.client()
+	client.Configuration.TraceProvider = tracer
+	downloader, err := NewDownloaderWithOptions(client, WithPartSize(300), WithConcurrency(2),
+		WithRetries(1), WithVerifyParts(true))
+	assert.Nil(t, err)
+	assert.Nil(t, downloader.Download(request))
+	assertFileContent(t, request.FilePath, content)
+
+	downloads := tracer.named("fds.manager.Download")
+	assert.Equal(t, 1, len(downloads))
+	assert.Equal(t, "bucket", downloads[0].attributes[fds.AttributeBucket])
+	assert.Equal(t, int64(1000), downloads[0].attributes[fds.AttributeResponseBytes])
+	assert.Nil(t, downloads[0].err)
+
+	parts := tracer.named("fds.manager.DownloadPart")
+	assert.Equal(t, 4, len(parts))
+	retried := 0
+	for _, span := range parts {
+		assert.Equal(t, downloads[0], span.parent)
+		assert.Nil(t, span.err)
+		if len(span.events) > 0 {
+			retried++
+			assert.Equal(t, 1, span.attributes[AttributePart])
+			assert.Equal(t, []string{fds.EventRetry}, span.events)
+		}
+	}
+	assert.Equal(t, 1, retried)
+
+	// the requests of the parts are their children, the metadata is of the download
+	for _, span := range tracer.named("fds.GET") {
+		if span.parent != downloads[0] {
+			assert.Equal(t, "fds.manager.DownloadPart", span.parent.name)
+		}
+	}
+	assert.Equal(t, 6, len(tracer.named("fds.GET")))
+}
+
+func TestUploader_UploadTrace(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	filePath, _ := newTestUploadFile(t, 3*fds.MinPartSize)
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	tracer := &recordingTracer{}
+	client := server.client()
+	client.Configuration.TraceProvider = tracer
+	uploader, err := NewUploader(client, fds.MinPartSize, 2, false)
+	assert.Nil(t, err)
+	_, err = uploader.Upload(newTestUploadRequest(filePath))
+	assert.Nil(t, err)
+
+	uploads := tracer.named("fds.manager.Upload")
+	assert.Equal(t, 1, len(uploads))
+	parts := tracer.named("fds.manager.UploadPart")
+	assert.Equal(t, 3, len(parts))
+	var bytes int64
+	for _, span := range parts {
+		assert.Equal(t, uploads[0], span.parent)
+		bytes += span.attributes[fds.AttributeRequestBytes].(int64)
+	}
+	assert.Equal(t, int64(3*fds.MinPartSize), bytes)
+
+	partRequests := 0
+	for _, span := range tracer.named("fds.PUT") {
+		if span.parent.name == "fds.manager.UploadPart" {
+			partRequests++
+		}
+	}
+	assert.Equal(t, 3, partRequests)
+}
@@ -0,0 +1,701 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/go-fds/fds"
+)
+
+// UploadPartSizeMetadata is the user metadata which Uploader records the part size of
+// multipart uploads in, Downloader with AlignParts splits the download along it
+const UploadPartSizeMetadata = "upload-part-size"
+
+// Uploader is a FDS client for file concurrency upload
+type Uploader struct {
+	logger Logger
+	client *fds.Client
+
+	// PartSize is the size of each part, 0 means choosing it automatically
+	// from DefaultPartSize according to the file size
+	PartSize        int64
+	DefaultPartSize int64
+
+	// Concurrency is the count of parts uploaded at the same time, MaxConnection
+	// of the client configuration should be no smaller to reuse the connections
+	Concurrency int
+	Breakpoint  bool
+
+	// BatchRetries is the count of retries of each file in UploadBatch
+	BatchRetries int
+
+	// VerifyParts sends the MD5 of each part for the server to verify and checks
+	// the ETag returned against it, a mismatching part is uploaded again. A part of
+	// TransformReader is transformed once into memory, so that the bytes hashed are
+	// the ones sent, and its retries send the same bytes.
+	VerifyParts bool
+}
+
+// verifyPartAttempts is the count of times a part is uploaded with VerifyParts
+// before ErrorPartChecksumNotMatching is returned
+const verifyPartAttempts = 3
+
+// NewUploader new a uploader, partSize could be 0 to let the uploader choose it
+func NewUploader(client *fds.Client, partSize int64, concurrency int, breakpoint bool) (*Uploader, error) {
+	if err := validateUploadPartSize(partSize); err != nil {
+		return nil, err
+	}
+
+	if concurrency < 1 {
+		return nil, ErrorConcurrencySmallerThanOne
+	}
+
+	uploader := &Uploader{
+		PartSize:        partSize,
+		DefaultPartSize: fds.MinPartSize,
+		Concurrency:     concurrency,
+		Breakpoint:      breakpoint,
+
+		client: client,
+	}
+	if client.Configuration != nil && client.Configuration.PartSize > 0 {
+		uploader.DefaultPartSize = int64(client.Configuration.PartSize)
+	}
+	uploader.logger = nopLogger{}
+
+	return uploader, nil
+}
+
+// SetLogger sets logger of Uploader, nil discards the logs
+func (uploader *Uploader) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+	uploader.logger = logger
+}
+
+// TransformReader wraps the reader of a part before it is sent, e.g. for encryption.
+// The wrapped reader must produce exactly as many bytes as the part, a retried part is
+// transformed again.
+type TransformReader func(p Part, r io.Reader) (io.Reader, error)
+
+// UploadRequest is the input of Upload
+type UploadRequest struct {
+	fds.InitMultipartUploadRequest
+	FilePath string
+
+	// UserMetadata is set as x-xiaomi-meta-* headers of the object along with the
+	// UserMetadata of InitMultipartUploadRequest, the entries of it win over the ones
+	// of the same keys there
+	UserMetadata    map[string]string
+	TransformReader TransformReader
+
+	// private
+	breakpointFilePath string
+}
+
+// initMultipartUploadRequest returns the request with UserMetadata, partSize is
+// recorded as UploadPartSizeMetadata if it is positive
+func (request *UploadRequest) initMultipartUploadRequest(partSize int64) *fds.InitMultipartUploadRequest {
+	r := request.InitMultipartUploadRequest
+	if len(request.UserMetadata) > 0 || partSize > 0 {
+		r.UserMetadata = fds.UserMetadata{}
+		for k, v := range request.InitMultipartUploadRequest.UserMetadata {
+			r.UserMetadata[k] = v
+		}
+		for k, v := range request.UserMetadata {
+			r.UserMetadata[k] = v
+		}
+		if partSize > 0 {
+			r.UserMetadata[UploadPartSizeMetadata] = strconv.FormatInt(partSize, 10)
+		}
+	}
+	return &r
+}
+
+// partReader returns the reader of part p of fd, transformed if TransformReader is set
+func (request *UploadRequest) partReader(p part, fd *os.File) (io.Reader, error) {
+	size := p.End - p.Start + 1
+	r := io.NewSectionReader(fd, p.Start, size)
+	if request.TransformReader == nil {
+		return r, nil
+	}
+
+	transformed := &transformedPart{request: request, p: p, fd: fd}
+	if _, err := transformed.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return transformed, nil
+}
+
+// transformedPart is the transformed reader of a part, which is transformed again from
+// the start of the part when it is rewound so that the part can be retried
+type transformedPart struct {
+	lengthCheckReader
+	request *UploadRequest
+	p       part
+	fd      *os.File
+}
+
+// Seek only reports the bytes read and rewinds to the start of the part
+func (r *transformedPart) Seek(offset int64, whence int) (int64, error) {
+	size := r.p.End - r.p.Start + 1
+	read := size - r.remaining
+	if r.r != nil && (whence == io.SeekCurrent && offset == 0 || whence == io.SeekStart && offset == read) {
+		return read, nil
+	}
+	if whence != io.SeekStart || offset != 0 {
+		return read, ErrorTransformSeek
+	}
+
+	transformed, err := r.request.TransformReader(r.p.view(), io.NewSectionReader(r.fd, r.p.Start, size))
+	if err != nil {
+		return read, err
+	}
+	r.lengthCheckReader = lengthCheckReader{r: transformed, remaining: size}
+	return 0, nil
+}
+
+// lengthCheckReader fails if r does not produce exactly remaining bytes
+type lengthCheckReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (r *lengthCheckReader) Read(b []byte) (int, error) {
+	if r.remaining <= 0 {
+		var extra [1]byte
+		n, err := r.r.Read(extra[:])
+		if n > 0 {
+			return 0, ErrorTransformChangedLength
+		}
+		return 0, err
+	}
+
+	if int64(len(b)) > r.remaining {
+		b = b[:r.remaining]
+	}
+	n, err := r.r.Read(b)
+	r.remaining -= int64(n)
+	if err == io.EOF && r.remaining > 0 {
+		return n, ErrorTransformChangedLength
+	}
+	return n, err
+}
+
+// Len is the count of bytes left, which is used as Content-Length
+func (r *lengthCheckReader) Len() int {
+	return int(r.remaining)
+}
+
+// Upload performs the uploading action
+func (uploader *Uploader) Upload(request *UploadRequest) (*fds.PutObjectResponse, error) {
+	return uploader.UploadWithContext(context.Background(), request)
+}
+
+// UploadWithContext performs the uploading action with context controlling.
+// When ctx is cancelled, no more parts are dispatched and the in-flight parts
+// are waited for. Then the breakpoint is persisted if enabled, otherwise the
+// multipart upload is aborted.
+func (uploader *Uploader) UploadWithContext(ctx context.Context, request *UploadRequest) (*fds.PutObjectResponse, error) {
+	return uploader.upload(ctx, request, nil)
+}
+
+func (uploader *Uploader) upload(ctx context.Context, request *UploadRequest, stats *transferStats) (*fds.PutObjectResponse, error) {
+	ctx, _, end := startSpan(ctx, uploader.client, "fds.manager.Upload", objectAttributes(request.BucketName, request.ObjectName)...)
+	start := time.Now()
+	if stats == nil {
+		stats = &transferStats{}
+	}
+	// the stats of a task accumulate over its rounds, only the retries of this one are reported
+	retries := stats.snapshot().Retries
+	var bytes int64
+	response, err := uploader.uploadParts(ctx, request, stats, &bytes)
+	end(err)
+	reportTransfer(uploader.client, TransferUpload, time.Since(start), bytes, int(stats.snapshot().Retries-retries), err)
+	return response, err
+}
+
+// uploadParts uploads the parts of request and adds the bytes of the uploaded ones to bytes
+func (uploader *Uploader) uploadParts(ctx context.Context, request *UploadRequest, stats *transferStats, bytes *int64) (*fds.PutObjectResponse, error) {
+	if uploader.Breakpoint && request.breakpointFilePath == "" {
+		request.breakpointFilePath = fmt.Sprintf("%s.upload.bp", request.FilePath)
+	}
+
+	fd, err := os.Open(request.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	fileInfo, err := fd.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	bp := uploadBreakpointInfo{}
+	var parts []part
+	if uploader.Breakpoint {
+		// load breakpoint info
+		err = bp.Load(request.breakpointFilePath)
+		if err == nil {
+			// validate breakpoint info
+			err = bp.Validate(request.BucketName, request.ObjectName, fileInfo)
+		}
+
+		if err != nil {
+			uploader.logger.Debug(err)
+			uploader.logger.Debug("breakpoint info is invalid")
+			err = uploader.initBreakpoint(ctx, &bp, request, fileInfo)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// get parts from breakpoint info
+		parts = bp.UnfinishParts()
+	} else {
+		parts, err = uploader.splitUploadParts(fileInfo.Size())
+		if err != nil {
+			return nil, err
+		}
+
+		initResponse, err := uploader.client.InitMultipartUploadWithContext(ctx, request.initMultipartUploadRequest(partSizeOf(parts)))
+		if err != nil {
+			return nil, err
+		}
+
+		bp.UploadID = initResponse.UploadID
+		bp.Parts = parts
+		bp.PartStat = make([]bool, len(parts))
+		bp.PartResults = make([]fds.UploadPartResponse, len(parts))
+	}
+
+	initResponse := &fds.InitMultipartUploadResponse{
+		BucketName: request.BucketName,
+		ObjectName: request.ObjectName,
+		UploadID:   bp.UploadID,
+	}
+
+	if stats != nil {
+		stats.reset(bp.Parts, bp.PartStat)
+	}
+
+	jobs := make(chan part, len(parts))
+	results := make(chan uploadPartResult, len(parts))
+	workers := workerCount(uploader.logger, uploader.Concurrency, len(parts))
+	failed := make(chan error, workers)
+	finished := make(chan bool)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go uploader.uploaderTaskConsumer(ctx, i, &wg, request, initResponse, fd, jobs, results, failed, finished, stats)
+	}
+
+	go uploader.uploaderTaskProducer(jobs, parts, finished)
+
+	// abort leaves no parts on the server unless a breakpoint resumes them,
+	// ctx may be cancelled already, so it aborts with a fresh one
+	abort := func() {
+		if uploader.Breakpoint {
+			return
+		}
+		if e := uploader.client.AbortMultipartUploadWithContext(context.Background(), initResponse); e != nil {
+			uploader.logger.Debug(e)
+		}
+	}
+
+	record := func(r uploadPartResult) {
+		bp.PartStat[r.Index] = true
+		bp.PartResults[r.Index] = r.Response
+		*bytes += r.End - r.Start + 1
+		if stats != nil {
+			stats.complete(r.part)
+		}
+		if uploader.Breakpoint {
+			bp.Dump()
+		}
+	}
+
+	completed := 0
+	for completed < len(parts) && err == nil {
+		select {
+		case r := <-results:
+			completed++
+			record(r)
+		case err = <-failed:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	// stop dispatching and wait for the in-flight parts
+	close(finished)
+	wg.Wait()
+
+	if err != nil {
+		for len(results) > 0 {
+			record(<-results)
+		}
+
+		abort()
+		return nil, err
+	}
+
+	list := &fds.UploadPartList{
+		UploadPartResultList: bp.PartResults,
+	}
+	sort.Slice(list.UploadPartResultList, func(i, j int) bool {
+		return list.UploadPartResultList[i].PartNumber < list.UploadPartResultList[j].PartNumber
+	})
+
+	response, err := uploader.client.CompleteMultipartUploadWithContext(ctx, initResponse, list)
+	if err != nil {
+		abort()
+		return nil, err
+	}
+
+	if uploader.Breakpoint {
+		bp.Destroy()
+	}
+	return response, nil
+}
+
+func (uploader *Uploader) initBreakpoint(ctx context.Context, bp *uploadBreakpointInfo, request *UploadRequest, fileInfo os.FileInfo) error {
+	parts, err := uploader.splitUploadParts(fileInfo.Size())
+	if err != nil {
+		return err
+	}
+
+	initResponse, err := uploader.client.InitMultipartUploadWithContext(ctx, request.initMultipartUploadRequest(partSizeOf(parts)))
+	if err != nil {
+		return err
+	}
+
+	bp.Initilize(request.BucketName, request.ObjectName, request.breakpointFilePath, initResponse.UploadID, fileInfo, parts)
+	return bp.Dump()
+}
+
+type uploadPartResult struct {
+	part
+	Response fds.UploadPartResponse
+}
+
+func (uploader *Uploader) uploaderTaskConsumer(ctx context.Context, id int, wg *sync.WaitGroup, request *UploadRequest,
+	upload *fds.InitMultipartUploadResponse, fd *os.File, jobs <-chan part, results chan<- uploadPartResult, failed chan<- error, finished <-chan bool,
+	stats *transferStats) {
+	defer wg.Done()
+
+	for p := range jobs {
+		select {
+		case <-finished:
+			return
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		data, err := request.partReader(p, fd)
+		if err != nil {
+			failed <- err
+			return
+		}
+
+		req := &fds.UploadPartRequest{
+			BucketName: upload.BucketName,
+			ObjectName: upload.ObjectName,
+			UploadID:   upload.UploadID,
+			PartNumber: p.Index + 1,
+			Data:       data,
+		}
+
+		partCtx, _, end := startSpan(ctx, uploader.client, "fds.manager.UploadPart",
+			fds.Attribute{Key: AttributePart, Value: p.Index},
+			fds.Attribute{Key: fds.AttributeRequestBytes, Value: p.End - p.Start + 1})
+		stats.begin()
+		resp, err := uploader.uploadPart(partCtx, req, p, stats)
+		stats.end(err != nil && ctx.Err() == nil)
+		end(err)
+		if err != nil {
+			uploader.logger.Debug(err.Error())
+			failed <- err
+			return
+		}
+
+		results <- uploadPartResult{p, *resp}
+	}
+}
+
+// uploadPart uploads req of part p, with VerifyParts its MD5 is sent along and the part
+// is uploaded again from its start while the ETag returned does not match it, which is
+// counted as a retry in stats
+func (uploader *Uploader) uploadPart(ctx context.Context, req *fds.UploadPartRequest, p part, stats *transferStats) (*fds.UploadPartResponse, error) {
+	if !uploader.VerifyParts {
+		return uploader.client.UploadPartWithContext(ctx, req)
+	}
+
+	if transformed, ok := req.Data.(*transformedPart); ok {
+		// rewinding transforms the part again, which may not give the same bytes
+		buf, err := ioutil.ReadAll(transformed)
+		if err != nil {
+			return nil, err
+		}
+		req.Data = bytes.NewReader(buf)
+	}
+	data, ok := req.Data.(io.ReadSeeker)
+	if !ok {
+		return nil, fmt.Errorf("part %d can not be read again to verify it", p.Index)
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, data); err != nil {
+		return nil, err
+	}
+	req.ContentMD5 = hex.EncodeToString(h.Sum(nil))
+
+	for attempt := 1; ; attempt++ {
+		if _, err := data.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		resp, err := uploader.client.UploadPartWithContext(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		etag := strings.Trim(resp.ETag, `"`)
+		if strings.EqualFold(etag, req.ContentMD5) {
+			return resp, nil
+		}
+		err = fmt.Errorf("%w: part %d has ETag %s, expected %s", ErrorPartChecksumNotMatching, p.Index, etag, req.ContentMD5)
+		if attempt == verifyPartAttempts {
+			return nil, err
+		}
+		uploader.logger.Debug(err.Error())
+		stats.retry()
+	}
+}
+
+func (uploader *Uploader) uploaderTaskProducer(jobs chan<- part, parts []part, finished <-chan bool) {
+	defer close(jobs)
+
+	for _, p := range parts {
+		select {
+		case jobs <- p:
+		case <-finished:
+			return
+		}
+	}
+}
+
+func validateUploadPartSize(partSize int64) error {
+	if partSize < 0 {
+		return ErrorPartSizeSmallerThanOne
+	}
+
+	if partSize > 0 && partSize < fds.MinPartSize {
+		return ErrorPartSizeTooSmall
+	}
+
+	if partSize > fds.MaxPartSize {
+		return ErrorPartSizeTooLarge
+	}
+
+	return nil
+}
+
+// UploadPlan describes how a file is split into parts
+type UploadPlan struct {
+	PartSize  int64
+	PartCount int
+}
+
+// Plan computes the part size and the part count of uploading a file of fileSize.
+// If PartSize is 0, the part size starts from DefaultPartSize and doubles until
+// the part count fits into fds.MaxUploadParts.
+func (uploader *Uploader) Plan(fileSize int64) (*UploadPlan, error) {
+	if err := validateUploadPartSize(uploader.PartSize); err != nil {
+		return nil, err
+	}
+
+	partSize := uploader.PartSize
+	if partSize == 0 {
+		partSize = uploader.DefaultPartSize
+		if partSize < fds.MinPartSize {
+			partSize = fds.MinPartSize
+		}
+
+		for partCount(fileSize, partSize) > fds.MaxUploadParts && partSize < fds.MaxPartSize {
+			partSize *= 2
+		}
+		if partSize > fds.MaxPartSize {
+			partSize = fds.MaxPartSize
+		}
+	}
+
+	count := partCount(fileSize, partSize)
+	if count > fds.MaxUploadParts {
+		return nil, ErrorTooManyUploadParts
+	}
+
+	return &UploadPlan{
+		PartSize:  partSize,
+		PartCount: count,
+	}, nil
+}
+
+func partCount(fileSize, partSize int64) int {
+	return int((fileSize + partSize - 1) / partSize)
+}
+
+func (uploader *Uploader) splitUploadParts(fileSize int64) ([]part, error) {
+	plan, err := uploader.Plan(fileSize)
+	if err != nil {
+		return nil, err
+	}
+	uploader.logger.Debug(fmt.Sprintf("upload plan: part size %d, part count %d", plan.PartSize, plan.PartCount))
+
+	var parts []part
+
+	i := 0
+	for offset := int64(0); offset < fileSize; offset += plan.PartSize {
+		end := offset + plan.PartSize
+		if end > fileSize {
+			end = fileSize
+		}
+
+		p := part{
+			Index: i,
+			Start: offset,
+			End:   end - 1,
+		}
+		i++
+		parts = append(parts, p)
+	}
+
+	return parts, nil
+}
+
+type uploadBreakpointInfo struct {
+	Version     int `json:",omitempty"`
+	FilePath    string
+	BucketName  string
+	ObjectName  string
+	UploadID    string
+	FileStat    fileStat
+	Parts       []part
+	PartStat    []bool
+	PartResults []fds.UploadPartResponse
+	MD5         string
+}
+
+type fileStat struct {
+	Size         int64     // File size
+	LastModified time.Time // Last modified time
+}
+
+func (bp *uploadBreakpointInfo) Load(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, bp); err != nil {
+		return err
+	}
+	return checkBreakpointVersion(bp.Version)
+}
+
+func (bp *uploadBreakpointInfo) checksum() (string, error) {
+	bpi := *bp
+	bpi.MD5 = ""
+	data, err := json.Marshal(bpi)
+	if err != nil {
+		return "", err
+	}
+
+	sum := md5.Sum(data)
+	return base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+func (bp *uploadBreakpointInfo) Dump() error {
+	bp.Version = breakpointVersion
+	sum, err := bp.checksum()
+	if err != nil {
+		return err
+	}
+
+	bpi := *bp
+	bpi.MD5 = sum
+	data, err := json.Marshal(bpi)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(bpi.FilePath, data, os.FileMode(0664))
+}
+
+func (bp *uploadBreakpointInfo) Validate(bucketName, objectName string, fileInfo os.FileInfo) error {
+	if err := checkBreakpointVersion(bp.Version); err != nil {
+		return err
+	}
+	if bucketName != bp.BucketName || objectName != bp.ObjectName {
+		return ErrorBucketOrObjectNotMatching
+	}
+
+	sum, err := bp.checksum()
+	if err != nil {
+		return err
+	}
+	if sum != bp.MD5 {
+		return ErrorMD5NotMatching
+	}
+
+	if bp.FileStat.Size != fileInfo.Size() || !bp.FileStat.LastModified.Equal(fileInfo.ModTime()) {
+		return ErrorFileStateNotMatching
+	}
+
+	return nil
+}
+
+func (bp *uploadBreakpointInfo) UnfinishParts() []part {
+	var result []part
+
+	for i, s := range bp.PartStat {
+		if !s {
+			result = append(result, bp.Parts[i])
+		}
+	}
+
+	return result
+}
+
+func (bp *uploadBreakpointInfo) Initilize(bucketName, objectName, filePath, uploadID string, fileInfo os.FileInfo, parts []part) {
+	bp.MD5 = ""
+	bp.BucketName = bucketName
+	bp.ObjectName = objectName
+	bp.FilePath = filePath
+	bp.UploadID = uploadID
+	bp.Parts = parts
+	bp.PartStat = make([]bool, len(parts))
+	bp.PartResults = make([]fds.UploadPartResponse, len(parts))
+	bp.FileStat = fileStat{
+		Size:         fileInfo.Size(),
+		LastModified: fileInfo.ModTime(),
+	}
+}
+
+func (bp *uploadBreakpointInfo) Destroy() {
+	os.Remove(bp.FilePath)
+}
@@ -0,0 +1,506 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/XiaoMi/go-fds/fds"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestUploadFile(t *testing.T, size int) (string, []byte) {
+	dir, err := ioutil.TempDir("", "fds-upload-test-")
+	assert.Nil(t, err)
+
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	filePath := filepath.Join(dir, "file")
+	assert.Nil(t, ioutil.WriteFile(filePath, content, 0664))
+	return filePath, content
+}
+
+func newTestUploadRequest(filePath string) *UploadRequest {
+	return &UploadRequest{
+		InitMultipartUploadRequest: fds.InitMultipartUploadRequest{
+			BucketName: "bucket",
+			ObjectName: "object",
+		},
+		FilePath: filePath,
+	}
+}
+
+func TestUploader_Upload(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	filePath, content := newTestUploadFile(t, 10*fds.MinPartSize)
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 3, false)
+	assert.Nil(t, err)
+
+	resp, err := uploader.Upload(newTestUploadRequest(filePath))
+	assert.Nil(t, err)
+	assert.Equal(t, "object", resp.ObjectName)
+
+	uploaded, ok := server.getObject("bucket", "object")
+	assert.True(t, ok)
+	assert.True(t, bytes.Equal(content, uploaded))
+}
+
+// cancelOnPart cancels the upload when partNumber arrives and holds the
+// request until the client gives up
+func cancelOnPart(partNumber string, cancel context.CancelFunc) func(http.ResponseWriter, *http.Request) bool {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Query().Get("partNumber") != partNumber {
+			return false
+		}
+		ioutil.ReadAll(r.Body)
+		cancel()
+		<-r.Context().Done()
+		return true
+	}
+}
+
+func TestUploader_UploadWithContextAbort(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	filePath, _ := newTestUploadFile(t, 10*fds.MinPartSize)
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	server.hook = cancelOnPart("3", cancel)
+
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 1, false)
+	assert.Nil(t, err)
+
+	_, err = uploader.UploadWithContext(ctx, newTestUploadRequest(filePath))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, []string{"upload-1"}, server.abortedUploads())
+
+	_, ok := server.getObject("bucket", "object")
+	assert.False(t, ok)
+}
+
+func TestUploader_UploadCompleteFailed(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	filePath, _ := newTestUploadFile(t, 2*fds.MinPartSize)
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		q := r.URL.Query()
+		if r.Method != http.MethodPut || q.Get("uploadId") == "" || q.Get("partNumber") != "" {
+			return false
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return true
+	}
+
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 2, false)
+	assert.Nil(t, err)
+
+	_, err = uploader.Upload(newTestUploadRequest(filePath))
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"upload-1"}, server.abortedUploads())
+}
+
+func TestUploader_UploadWithContextBreakpoint(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	filePath, content := newTestUploadFile(t, 10*fds.MinPartSize)
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	server.hook = cancelOnPart("3", cancel)
+
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 1, true)
+	assert.Nil(t, err)
+
+	_, err = uploader.UploadWithContext(ctx, newTestUploadRequest(filePath))
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, server.abortedUploads())
+
+	bp := uploadBreakpointInfo{}
+	assert.Nil(t, bp.Load(filePath+".upload.bp"))
+	assert.Equal(t, "upload-1", bp.UploadID)
+	assert.Equal(t, 8, len(bp.UnfinishParts()))
+
+	server.hook = nil
+	_, err = uploader.Upload(newTestUploadRequest(filePath))
+	assert.Nil(t, err)
+
+	uploaded, ok := server.getObject("bucket", "object")
+	assert.True(t, ok)
+	assert.True(t, bytes.Equal(content, uploaded))
+
+	_, err = os.Stat(filePath + ".upload.bp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUploader_UploadBreakpointVersion(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	filePath, content := newTestUploadFile(t, 2*fds.MinPartSize)
+	defer os.RemoveAll(filepath.Dir(filePath))
+	info, err := os.Stat(filePath)
+	assert.Nil(t, err)
+
+	// a breakpoint of a newer layout, whose parts of an unknown upload look done
+	bp := uploadBreakpointInfo{}
+	parts := []part{{Start: 0, End: fds.MinPartSize - 1}, {Start: fds.MinPartSize, End: 2*fds.MinPartSize - 1}}
+	bp.Initilize("bucket", "object", filePath+".upload.bp", "unknown", info, parts)
+	bp.PartStat = []bool{true, true}
+	bp.Version = breakpointVersion + 1
+	bp.MD5, err = bp.checksum()
+	assert.Nil(t, err)
+	data, err := json.Marshal(bp)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(bp.FilePath, data, 0664))
+
+	loaded := uploadBreakpointInfo{}
+	assert.True(t, errors.Is(loaded.Load(bp.FilePath), ErrorBreakpointVersion))
+
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 1, true)
+	assert.Nil(t, err)
+	_, err = uploader.Upload(newTestUploadRequest(filePath))
+	assert.Nil(t, err)
+
+	uploaded, ok := server.getObject("bucket", "object")
+	assert.True(t, ok)
+	assert.True(t, bytes.Equal(content, uploaded))
+}
+
+func TestUploader_splitUploadParts(t *testing.T) {
+	uploader, err := NewUploader(&fds.Client{}, fds.MinPartSize, 1, false)
+	assert.Nil(t, err)
+
+	parts, err := uploader.splitUploadParts(fds.MinPartSize * 5 / 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []part{
+		{Index: 0, Start: 0, End: fds.MinPartSize - 1},
+		{Index: 1, Start: fds.MinPartSize, End: 2*fds.MinPartSize - 1},
+		{Index: 2, Start: 2 * fds.MinPartSize, End: fds.MinPartSize*5/2 - 1},
+	}, parts)
+
+	_, err = uploader.splitUploadParts(fds.MinPartSize * (fds.MaxUploadParts + 1))
+	assert.Equal(t, ErrorTooManyUploadParts, err)
+}
+
+func TestUploader_Plan(t *testing.T) {
+	_, err := NewUploader(&fds.Client{}, fds.MinPartSize-1, 1, false)
+	assert.Equal(t, ErrorPartSizeTooSmall, err)
+
+	_, err = NewUploader(&fds.Client{}, -1, 1, false)
+	assert.Equal(t, ErrorPartSizeSmallerThanOne, err)
+
+	uploader, err := NewUploader(&fds.Client{}, 0, 1, false)
+	assert.Nil(t, err)
+	uploader.DefaultPartSize = 1024 * 1024
+
+	plan, err := uploader.Plan(10 * 1024 * 1024)
+	assert.Nil(t, err)
+	assert.Equal(t, &UploadPlan{PartSize: 1024 * 1024, PartCount: 10}, plan)
+
+	plan, err = uploader.Plan(3 * 1024 * 1024 * fds.MaxUploadParts)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4*1024*1024), plan.PartSize)
+	assert.True(t, plan.PartCount <= fds.MaxUploadParts)
+
+	_, err = uploader.Plan(fds.MaxPartSize*fds.MaxUploadParts + 1)
+	assert.Equal(t, ErrorTooManyUploadParts, err)
+
+	uploader.PartSize = 1
+	_, err = uploader.Plan(100)
+	assert.Equal(t, ErrorPartSizeTooSmall, err)
+}
+
+func xorTransform(p Part, r io.Reader) (io.Reader, error) {
+	return &xorReader{r}, nil
+}
+
+type xorReader struct {
+	r io.Reader
+}
+
+func (x *xorReader) Read(b []byte) (int, error) {
+	n, err := x.r.Read(b)
+	for i := 0; i < n; i++ {
+		b[i] ^= 0xff
+	}
+	return n, err
+}
+
+func TestUploader_UploadTransformReader(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	filePath, content := newTestUploadFile(t, 3*fds.MinPartSize)
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 2, false)
+	assert.Nil(t, err)
+
+	var mu sync.Mutex
+	var seen []Part
+	request := newTestUploadRequest(filePath)
+	request.UserMetadata = map[string]string{"iv": "0102"}
+	request.TransformReader = func(p Part, r io.Reader) (io.Reader, error) {
+		mu.Lock()
+		seen = append(seen, p)
+		mu.Unlock()
+		return xorTransform(p, r)
+	}
+
+	_, err = uploader.Upload(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(seen))
+
+	uploaded, _ := server.getObject("bucket", "object")
+	assert.Equal(t, len(content), len(uploaded))
+	for i := range content {
+		if content[i]^0xff != uploaded[i] {
+			t.Fatalf("byte %d is not transformed", i)
+		}
+	}
+
+	for _, r := range server.requests {
+		if _, ok := r.URL.Query()["uploads"]; ok {
+			assert.Equal(t, "0102", r.Header.Get(fds.XiaomiMetaPrefix+"iv"))
+		}
+	}
+}
+
+func TestUploader_UploadTransformReaderRetried(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	var failed int32
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Query().Get("partNumber") == "2" && atomic.AddInt32(&failed, 1) == 1 {
+			ioutil.ReadAll(r.Body)
+			w.Header().Set(fds.HTTPHeaderRetryAfter, "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return true
+		}
+		return false
+	}
+
+	filePath, content := newTestUploadFile(t, 3*fds.MinPartSize)
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	client := server.client()
+	client.Configuration.RetryPolicy = fds.DefaultRetryPolicy()
+	uploader, err := NewUploader(client, fds.MinPartSize, 2, false)
+	assert.Nil(t, err)
+
+	var transforms int32
+	request := newTestUploadRequest(filePath)
+	request.TransformReader = func(p Part, r io.Reader) (io.Reader, error) {
+		atomic.AddInt32(&transforms, 1)
+		return xorTransform(p, r)
+	}
+
+	_, err = uploader.Upload(request)
+	assert.Nil(t, err)
+	// the failed part is transformed again from its start
+	assert.Equal(t, int32(4), atomic.LoadInt32(&transforms))
+
+	uploaded, _ := server.getObject("bucket", "object")
+	assert.Equal(t, len(content), len(uploaded))
+	for i := range content {
+		if content[i]^0xff != uploaded[i] {
+			t.Fatalf("byte %d is not transformed", i)
+		}
+	}
+}
+
+func TestUploader_UploadVerifyParts(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	var sums []string
+	var mu sync.Mutex
+	var corrupted int32
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		partNumber := r.URL.Query().Get("partNumber")
+		if partNumber == "" {
+			return false
+		}
+		mu.Lock()
+		assert.Len(t, r.Header["Content-Md5"], 1)
+		sums = append(sums, r.Header.Get(fds.HTTPHeaderContentMD5))
+		mu.Unlock()
+		if partNumber != "2" || atomic.AddInt32(&corrupted, 1) != 1 {
+			return false
+		}
+		// the part is reported as received with other content
+		ioutil.ReadAll(r.Body)
+		writeJSON(w, fds.UploadPartResponse{PartNumber: 2, ETag: "0123456789abcdef0123456789abcdef"})
+		return true
+	}
+
+	filePath, content := newTestUploadFile(t, 3*fds.MinPartSize)
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 2, false)
+	assert.Nil(t, err)
+	uploader.VerifyParts = true
+
+	_, err = uploader.Upload(newTestUploadRequest(filePath))
+	assert.Nil(t, err)
+	// the mismatching part is uploaded again
+	assert.Equal(t, int32(2), atomic.LoadInt32(&corrupted))
+	assert.Equal(t, 4, len(sums))
+	for _, sum := range sums {
+		assert.Equal(t, 32, len(sum))
+	}
+
+	uploaded, _ := server.getObject("bucket", "object")
+	assert.True(t, bytes.Equal(content, uploaded))
+
+	// a part which keeps mismatching fails the upload
+	atomic.StoreInt32(&corrupted, 0)
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Query().Get("partNumber") != "2" {
+			return false
+		}
+		atomic.AddInt32(&corrupted, 1)
+		ioutil.ReadAll(r.Body)
+		writeJSON(w, fds.UploadPartResponse{PartNumber: 2, ETag: "0123456789abcdef0123456789abcdef"})
+		return true
+	}
+	_, err = uploader.Upload(newTestUploadRequest(filePath))
+	assert.True(t, errors.Is(err, ErrorPartChecksumNotMatching), err)
+	assert.Equal(t, int32(verifyPartAttempts), atomic.LoadInt32(&corrupted))
+}
+
+func TestUploader_UploadVerifyPartsTransformReader(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	filePath, content := newTestUploadFile(t, 3*fds.MinPartSize)
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 2, false)
+	assert.Nil(t, err)
+	uploader.VerifyParts = true
+
+	// every transform of a part uses another key, like a random IV does
+	var transforms int32
+	request := newTestUploadRequest(filePath)
+	request.TransformReader = func(p Part, r io.Reader) (io.Reader, error) {
+		key := byte(atomic.AddInt32(&transforms, 1))
+		return &keyedXorReader{r, key}, nil
+	}
+
+	_, err = uploader.Upload(request)
+	assert.Nil(t, err)
+	// each part is transformed once and the MD5 of the bytes sent matches
+	assert.Equal(t, int32(3), atomic.LoadInt32(&transforms))
+
+	uploaded, _ := server.getObject("bucket", "object")
+	assert.Equal(t, len(content), len(uploaded))
+	assert.False(t, bytes.Equal(content, uploaded))
+}
+
+type keyedXorReader struct {
+	r   io.Reader
+	key byte
+}
+
+func (x *keyedXorReader) Read(b []byte) (int, error) {
+	n, err := x.r.Read(b)
+	for i := 0; i < n; i++ {
+		b[i] ^= x.key
+	}
+	return n, err
+}
+
+func TestUploader_UploadTransformReaderChangedLength(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	filePath, _ := newTestUploadFile(t, 2*fds.MinPartSize)
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 1, false)
+	assert.Nil(t, err)
+
+	request := newTestUploadRequest(filePath)
+	request.TransformReader = func(p Part, r io.Reader) (io.Reader, error) {
+		return io.MultiReader(r, strings.NewReader("padding")), nil
+	}
+
+	_, err = uploader.Upload(request)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), ErrorTransformChangedLength.Error())
+	assert.Equal(t, []string{"upload-1"}, server.abortedUploads())
+}
+
+func TestUploader_UploadStorageClass(t *testing.T) {
+	server := newFakeFDS()
+	defer server.Close()
+
+	var mu sync.Mutex
+	classes := map[string]string{}
+	server.hook = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodGet {
+			mu.Lock()
+			classes[r.Method+" "+r.URL.Path+" "+r.URL.Query().Encode()] = r.Header.Get(fds.HTTPHeaderStorageClass)
+			mu.Unlock()
+		}
+		return false
+	}
+
+	uploader, err := NewUploader(server.client(), fds.MinPartSize, 1, false)
+	assert.Nil(t, err)
+
+	filePath, _ := newTestUploadFile(t, fds.MinPartSize+1)
+	defer os.RemoveAll(filepath.Dir(filePath))
+	request := newTestUploadRequest(filePath)
+	request.StorageClass = fds.StorageClassArchive
+
+	_, err = uploader.Upload(request)
+	assert.Nil(t, err)
+	var initClass string
+	for k, v := range classes {
+		if strings.HasSuffix(k, " uploads=") {
+			initClass = v
+		}
+	}
+	assert.Equal(t, "ARCHIVE", initClass)
+
+	// small files of a batch are put in a single request
+	small, _ := newTestUploadFile(t, 10)
+	defer os.RemoveAll(filepath.Dir(small))
+	request = newTestUploadRequest(small)
+	request.ObjectName = "small"
+	request.StorageClass = fds.StorageClassInfrequentAccess
+	results, err := uploader.UploadBatch([]*UploadRequest{request}, 1)
+	assert.Nil(t, err)
+	assert.Nil(t, results[0].Err)
+	assert.Equal(t, "STANDARD_IA", classes["PUT /bucket/small "])
+
+	request.StorageClass = "COLD"
+	_, err = uploader.Upload(request)
+	assert.True(t, errors.Is(err, fds.ErrorStorageClassInvalid))
+}
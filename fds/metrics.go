@@ -0,0 +1,231 @@
+package fds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics of the Client, the ones of the manager are in its package
+const (
+	// MetricRequests counts the requests by operation and status_class, which
+	// is 2xx to 5xx or "error" if there is no response
+	MetricRequests = "fds_requests_total"
+	// MetricRequestDuration observes the seconds of the requests by operation across their retries
+	MetricRequestDuration = "fds_request_duration_seconds"
+	// MetricRetries counts the retries of the requests by operation
+	MetricRetries = "fds_request_retries_total"
+	// MetricUploadedBytes and MetricDownloadedBytes count the bytes of the request and response bodies
+	MetricUploadedBytes   = "fds_uploaded_bytes_total"
+	MetricDownloadedBytes = "fds_downloaded_bytes_total"
+)
+
+// Labels of the metrics
+const (
+	LabelOperation   = "operation"
+	LabelStatusClass = "status_class"
+)
+
+// MetricsCollector collects the counters and histograms of the Client and the manager, the
+// names and labels follow the conventions of Prometheus. It is called concurrently.
+type MetricsCollector interface {
+	AddCounter(name string, labels map[string]string, delta float64)
+	ObserveHistogram(name string, labels map[string]string, value float64)
+}
+
+type operationKey struct{}
+
+// operationName is the method, the resource and the sub resource of a request, such as "PUT object?partNumber"
+func operationName(method HTTPMethod, bucketName, objectName string, query url.Values) string {
+	name := string(method) + " service"
+	switch {
+	case objectName != "":
+		name = string(method) + " object"
+	case bucketName != "":
+		name = string(method) + " bucket"
+	}
+
+	var subResources []string
+	for k := range query {
+		if _, ok := subResourceMap[k]; ok {
+			subResources = append(subResources, k)
+		}
+	}
+	if len(subResources) > 0 {
+		sort.Strings(subResources)
+		name += "?" + subResources[0]
+	}
+	return name
+}
+
+func (client *Client) metricsCollector() MetricsCollector {
+	if client.Configuration == nil {
+		return nil
+	}
+	return client.Configuration.MetricsCollector
+}
+
+// countRetry counts a retry of the request of ctx
+func (client *Client) countRetry(ctx context.Context) {
+	if collector := client.metricsCollector(); collector != nil {
+		operation, _ := ctx.Value(operationKey{}).(string)
+		collector.AddCounter(MetricRetries, map[string]string{LabelOperation: operation}, 1)
+	}
+}
+
+func statusClass(statusCode int) string {
+	if statusCode < 100 || statusCode > 599 {
+		return "error"
+	}
+	return fmt.Sprintf("%dxx", statusCode/100)
+}
+
+// countingBody counts the bytes read from a response body
+type countingBody struct {
+	io.ReadCloser
+	add func(n int)
+}
+
+func (body *countingBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	if n > 0 {
+		body.add(n)
+	}
+	return n, err
+}
+
+// MemoryMetrics is a MetricsCollector which keeps the metrics in memory, for tests and simple exporters
+type MemoryMetrics struct {
+	mu         sync.Mutex
+	counters   map[string]*float64
+	histograms map[string]*HistogramSnapshot
+}
+
+// HistogramSnapshot is the count and the sum of the values observed by a histogram
+type HistogramSnapshot struct {
+	Count uint64
+	Sum   float64
+}
+
+// MetricsSnapshot are the metrics of MemoryMetrics keyed by name{label="value",...},
+// whose labels are sorted
+type MetricsSnapshot struct {
+	Counters   map[string]float64
+	Histograms map[string]HistogramSnapshot
+}
+
+// NewMemoryMetrics new an empty MemoryMetrics
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{
+		counters:   map[string]*float64{},
+		histograms: map[string]*HistogramSnapshot{},
+	}
+}
+
+// AddCounter adds delta to the counter of name and labels
+func (metrics *MemoryMetrics) AddCounter(name string, labels map[string]string, delta float64) {
+	key := metricKey(name, labels)
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	counter, ok := metrics.counters[key]
+	if !ok {
+		counter = new(float64)
+		metrics.counters[key] = counter
+	}
+	*counter += delta
+}
+
+// ObserveHistogram observes value by the histogram of name and labels
+func (metrics *MemoryMetrics) ObserveHistogram(name string, labels map[string]string, value float64) {
+	key := metricKey(name, labels)
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	histogram, ok := metrics.histograms[key]
+	if !ok {
+		histogram = &HistogramSnapshot{}
+		metrics.histograms[key] = histogram
+	}
+	histogram.Count++
+	histogram.Sum += value
+}
+
+// Snapshot returns a copy of the metrics
+func (metrics *MemoryMetrics) Snapshot() MetricsSnapshot {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	snapshot := MetricsSnapshot{
+		Counters:   make(map[string]float64, len(metrics.counters)),
+		Histograms: make(map[string]HistogramSnapshot, len(metrics.histograms)),
+	}
+	for k, v := range metrics.counters {
+		snapshot.Counters[k] = *v
+	}
+	for k, v := range metrics.histograms {
+		snapshot.Histograms[k] = *v
+	}
+	return snapshot
+}
+
+func metricKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", k, labels[k])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// observeRequest reports a request of operation which is sent since start, until the
+// headers of its response arrive for the streamed ones
+func (client *Client) observeRequest(operation string, start time.Time, response *http.Response) {
+	collector := client.metricsCollector()
+	if collector == nil {
+		return
+	}
+
+	class := "error"
+	if response != nil {
+		class = statusClass(response.StatusCode)
+	}
+	collector.AddCounter(MetricRequests, map[string]string{LabelOperation: operation, LabelStatusClass: class}, 1)
+	collector.ObserveHistogram(MetricRequestDuration, map[string]string{LabelOperation: operation}, time.Since(start).Seconds())
+}
+
+// countBytes counts the bytes of the request and the response of an attempt of ctx, the
+// response body is counted as it is read
+func (client *Client) countBytes(ctx context.Context, req *http.Request, response *http.Response) {
+	collector := client.metricsCollector()
+	if collector == nil {
+		return
+	}
+
+	operation, _ := ctx.Value(operationKey{}).(string)
+	labels := map[string]string{LabelOperation: operation}
+	if req.ContentLength > 0 {
+		collector.AddCounter(MetricUploadedBytes, labels, float64(req.ContentLength))
+	}
+	response.Body = &countingBody{response.Body, func(n int) {
+		collector.AddCounter(MetricDownloadedBytes, labels, float64(n))
+	}}
+}
@@ -0,0 +1,92 @@
+package fds
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OperationName(t *testing.T) {
+	assert.Equal(t, "GET service", operationName(HTTPGet, "", "", nil))
+	assert.Equal(t, "GET bucket", operationName(HTTPGet, "bucket", "", url.Values{"prefix": {"p"}}))
+	assert.Equal(t, "PUT bucket?acl", operationName(HTTPPut, "bucket", "", url.Values{"acl": {""}}))
+	assert.Equal(t, "PUT object?partNumber", operationName(HTTPPut, "bucket", "object",
+		url.Values{"uploadId": {"id"}, "partNumber": {"1"}}))
+}
+
+func Test_MemoryMetrics(t *testing.T) {
+	metrics := NewMemoryMetrics()
+	metrics.AddCounter("c", map[string]string{"b": "2", "a": "1"}, 1)
+	metrics.AddCounter("c", map[string]string{"a": "1", "b": "2"}, 2)
+	metrics.AddCounter("c", nil, 1)
+	metrics.ObserveHistogram("h", map[string]string{"a": `"`}, 0.5)
+	metrics.ObserveHistogram("h", map[string]string{"a": `"`}, 1.5)
+
+	snapshot := metrics.Snapshot()
+	assert.Equal(t, map[string]float64{`c{a="1",b="2"}`: 3, "c": 1}, snapshot.Counters)
+	assert.Equal(t, map[string]HistogramSnapshot{`h{a="\""}`: {Count: 2, Sum: 2}}, snapshot.Histograms)
+
+	// the snapshot is a copy
+	metrics.AddCounter("c", nil, 1)
+	assert.Equal(t, float64(1), snapshot.Counters["c"])
+}
+
+func Test_MetricsCollector(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			w.Write([]byte("{}"))
+		case http.MethodGet:
+			if r.URL.Path == "/bucket/missing" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte("content"))
+		}
+	}))
+	defer server.Close()
+
+	metrics := NewMemoryMetrics()
+	client := newTestClient(server)
+	client.Configuration.MetricsCollector = metrics
+	client.Configuration.RetryPolicy = &RetryPolicy{
+		MaxAttempts:          2,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	}
+	client.clock = &fakeClock{now: time.Now()}
+
+	_, err := client.PutObject(&PutObjectRequest{BucketName: "bucket", ObjectName: "object", Data: strings.NewReader("data")})
+	assert.Nil(t, err)
+	body, err := client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "object"})
+	assert.Nil(t, err)
+	ioutil.ReadAll(body)
+	body.Close()
+	_, err = client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "missing"})
+	assert.NotNil(t, err)
+
+	snapshot := metrics.Snapshot()
+	assert.Equal(t, map[string]float64{
+		`fds_requests_total{operation="PUT object",status_class="2xx"}`: 1,
+		`fds_requests_total{operation="GET object",status_class="2xx"}`: 1,
+		`fds_requests_total{operation="GET object",status_class="4xx"}`: 1,
+		`fds_request_retries_total{operation="PUT object"}`:             1,
+		// both attempts sent the body
+		`fds_uploaded_bytes_total{operation="PUT object"}`:   8,
+		`fds_downloaded_bytes_total{operation="PUT object"}`: 2,
+		`fds_downloaded_bytes_total{operation="GET object"}`: 7,
+	}, snapshot.Counters)
+	assert.Equal(t, uint64(1), snapshot.Histograms[`fds_request_duration_seconds{operation="PUT object"}`].Count)
+	assert.Equal(t, uint64(2), snapshot.Histograms[`fds_request_duration_seconds{operation="GET object"}`].Count)
+}
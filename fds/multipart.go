@@ -0,0 +1,155 @@
+package fds
+
+import (
+	"context"
+	"time"
+)
+
+// PartSummary is an uploaded part of a multipart upload
+type PartSummary struct {
+	PartNumber   int       `json:"partNumber"`
+	ETag         string    `json:"etag"`
+	PartSize     int64     `json:"partSize"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// PartListing is a page of ListParts
+type PartListing struct {
+	BucketName           string        `json:"bucketName"`
+	ObjectName           string        `json:"objectName"`
+	UploadID             string        `json:"uploadId"`
+	PartNumberMarker     int           `json:"partNumberMarker"`
+	MaxParts             int           `json:"maxParts"`
+	Truncated            bool          `json:"truncated"`
+	NextPartNumberMarker int           `json:"nextPartNumberMarker"`
+	Parts                []PartSummary `json:"parts"`
+}
+
+type listPartsOption struct {
+	UploadID         string `param:"uploadId" header:"-"`
+	PartNumberMarker int    `param:"partNumberMarker,omitempty" header:"-"`
+	MaxParts         int    `param:"maxParts,omitempty" header:"-"`
+}
+
+// ListParts lists the uploaded parts of uploadID after the part number marker,
+// maxParts 0 means the default of the server
+func (client *Client) ListParts(bucketName, objectName, uploadID string, marker, maxParts int) (*PartListing, error) {
+	return client.ListPartsWithContext(context.Background(), bucketName, objectName, uploadID, marker, maxParts)
+}
+
+// ListPartsWithContext lists the uploaded parts of uploadID with context controlling
+func (client *Client) ListPartsWithContext(ctx context.Context, bucketName, objectName, uploadID string, marker, maxParts int) (*PartListing, error) {
+	result := &PartListing{}
+	req := &clientRequest{
+		BucketName: bucketName,
+		ObjectName: objectName,
+		Method:     HTTPGet,
+		QueryHeaderOptions: listPartsOption{
+			UploadID:         uploadID,
+			PartNumberMarker: marker,
+			MaxParts:         maxParts,
+		},
+		Result: result,
+	}
+
+	resp, err := client.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if result.BucketName == "" {
+		result.BucketName = bucketName
+	}
+	if result.ObjectName == "" {
+		result.ObjectName = objectName
+	}
+	if result.UploadID == "" {
+		result.UploadID = uploadID
+	}
+	return result, err
+}
+
+// ListPartsNextBatch lists next batch of ListParts
+func (client *Client) ListPartsNextBatch(previous *PartListing) (*PartListing, error) {
+	return client.ListPartsNextBatchWithContext(context.Background(), previous)
+}
+
+// ListPartsNextBatchWithContext lists next batch of ListParts with context controlling
+func (client *Client) ListPartsNextBatchWithContext(ctx context.Context, previous *PartListing) (*PartListing, error) {
+	return client.ListPartsWithContext(ctx, previous.BucketName, previous.ObjectName, previous.UploadID,
+		previous.NextPartNumberMarker, previous.MaxParts)
+}
+
+// MultipartUploadSummary is a multipart upload which is neither completed nor aborted
+type MultipartUploadSummary struct {
+	ObjectName string    `json:"objectName"`
+	UploadID   string    `json:"uploadId"`
+	Initiated  time.Time `json:"initiated"`
+	Initiator  Owner     `json:"initiator"`
+}
+
+// MultipartUploadListing is a page of ListMultipartUploads
+type MultipartUploadListing struct {
+	BucketName         string                   `json:"bucketName"`
+	Prefix             string                   `json:"prefix"`
+	MaxUploads         int                      `json:"maxUploads"`
+	KeyMarker          string                   `json:"keyMarker"`
+	UploadIDMarker     string                   `json:"uploadIdMarker"`
+	Truncated          bool                     `json:"truncated"`
+	NextKeyMarker      string                   `json:"nextKeyMarker"`
+	NextUploadIDMarker string                   `json:"nextUploadIdMarker"`
+	Uploads            []MultipartUploadSummary `json:"uploads"`
+}
+
+type listMultipartUploadsOption struct {
+	Uploads        string `param:"uploads" header:"-"`
+	Prefix         string `param:"prefix" header:"-"`
+	KeyMarker      string `param:"keyMarker,omitempty" header:"-"`
+	UploadIDMarker string `param:"uploadIdMarker,omitempty" header:"-"`
+	MaxUploads     int    `param:"maxUploads,omitempty" header:"-"`
+}
+
+// ListMultipartUploads lists the ongoing multipart uploads of objects with prefix, starting after
+// keyMarker and uploadIDMarker which could be empty, maxUploads 0 means the default of the server
+func (client *Client) ListMultipartUploads(bucketName, prefix, keyMarker, uploadIDMarker string, maxUploads int) (*MultipartUploadListing, error) {
+	return client.ListMultipartUploadsWithContext(context.Background(), bucketName, prefix, keyMarker, uploadIDMarker, maxUploads)
+}
+
+// ListMultipartUploadsWithContext lists the ongoing multipart uploads with context controlling
+func (client *Client) ListMultipartUploadsWithContext(ctx context.Context, bucketName, prefix, keyMarker, uploadIDMarker string, maxUploads int) (*MultipartUploadListing, error) {
+	result := &MultipartUploadListing{}
+	req := &clientRequest{
+		BucketName: bucketName,
+		Method:     HTTPGet,
+		QueryHeaderOptions: listMultipartUploadsOption{
+			Prefix:         prefix,
+			KeyMarker:      keyMarker,
+			UploadIDMarker: uploadIDMarker,
+			MaxUploads:     maxUploads,
+		},
+		Result: result,
+	}
+
+	resp, err := client.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if result.BucketName == "" {
+		result.BucketName = bucketName
+	}
+	return result, err
+}
+
+// ListMultipartUploadsNextBatch lists next batch of ListMultipartUploads
+func (client *Client) ListMultipartUploadsNextBatch(previous *MultipartUploadListing) (*MultipartUploadListing, error) {
+	return client.ListMultipartUploadsNextBatchWithContext(context.Background(), previous)
+}
+
+// ListMultipartUploadsNextBatchWithContext lists next batch of ListMultipartUploads with context controlling
+func (client *Client) ListMultipartUploadsNextBatchWithContext(ctx context.Context, previous *MultipartUploadListing) (*MultipartUploadListing, error) {
+	return client.ListMultipartUploadsWithContext(ctx, previous.BucketName, previous.Prefix,
+		previous.NextKeyMarker, previous.NextUploadIDMarker, previous.MaxUploads)
+}
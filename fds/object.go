@@ -7,9 +7,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,6 +21,27 @@ type GetObjectRequest struct {
 	BucketName string `param:"-" header:"-"`
 	ObjectName string `param:"-" header:"-"`
 	Range      string `param:"-" header:"Range,omitempty"`
+
+	// IfRange is the ETag which Range applies to, the whole object is returned if it is changed
+	IfRange string `param:"-" header:"If-Range,omitempty"`
+
+	// VersionID gets the version of object, empty means the latest one
+	VersionID string `param:"versionId,omitempty" header:"-"`
+
+	Conditions
+
+	// Headers are extra headers of the request, x-xiaomi-* ones are signed
+	Headers http.Header `header:",omitempty" param:"-"`
+}
+
+// Conditions are the conditional headers of GetObject and GetObjectMetadata, a
+// ServerError wrapping ErrorNotModified or ErrorPreconditionFailed is returned
+// if they are not met
+type Conditions struct {
+	IfMatch           string    `param:"-" header:"If-Match,omitempty"`
+	IfNoneMatch       string    `param:"-" header:"If-None-Match,omitempty"`
+	IfModifiedSince   time.Time `param:"-" header:"If-Modified-Since,omitempty,http"`
+	IfUnmodifiedSince time.Time `param:"-" header:"If-Unmodified-Since,omitempty,http"`
 }
 
 // GetObject will get full content of object
@@ -27,19 +51,168 @@ func (client *Client) GetObject(request *GetObjectRequest) (io.ReadCloser, error
 
 // GetObjectWithContext will get full content of object with context controlling
 func (client *Client) GetObjectWithContext(ctx context.Context, request *GetObjectRequest) (io.ReadCloser, error) {
+	body, _, err := client.GetObjectWithMetadataWithContext(ctx, request)
+	return body, err
+}
+
+// GetObjectWithMetadata will get content of object with the metadata in response headers
+func (client *Client) GetObjectWithMetadata(request *GetObjectRequest) (io.ReadCloser, *ObjectMetadata, error) {
+	return client.GetObjectWithMetadataWithContext(context.Background(), request)
+}
+
+// GetObjectWithMetadataWithContext will get content of object with the metadata in response headers with context controlling
+func (client *Client) GetObjectWithMetadataWithContext(ctx context.Context, request *GetObjectRequest) (io.ReadCloser, *ObjectMetadata, error) {
 	req := &clientRequest{
 		BucketName:         request.BucketName,
 		ObjectName:         request.ObjectName,
 		QueryHeaderOptions: request,
 		Method:             HTTPGet,
+		CDN:                client.Configuration.EnableCDNForDownload,
 	}
 
 	resp, err := client.do(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp.Body, &ObjectMetadata{resp.Header}, nil
+}
+
+// GetObjectResult is the content of object with the parsed response headers
+type GetObjectResult struct {
+	Body io.ReadCloser
+
+	// ContentLength is the length of Body, -1 if unknown
+	ContentLength int64
+	ContentType   string
+	ETag          string
+
+	// LastModified is zero if absent
+	LastModified time.Time
+
+	// ContentRange is nil unless a part of object is returned
+	ContentRange *ContentRange
+
+	// UserMetadata are x-xiaomi-meta-* headers without the prefix
+	UserMetadata map[string]string
+
+	// Metadata are all of the response headers
+	Metadata *ObjectMetadata
+}
+
+// GetObjectWithResult will get content of object with the parsed response headers
+func (client *Client) GetObjectWithResult(request *GetObjectRequest) (*GetObjectResult, error) {
+	return client.GetObjectWithResultWithContext(context.Background(), request)
+}
+
+// GetObjectWithResultWithContext will get content of object with the parsed response headers with context controlling
+func (client *Client) GetObjectWithResultWithContext(ctx context.Context, request *GetObjectRequest) (*GetObjectResult, error) {
+	body, metadata, err := client.GetObjectWithMetadataWithContext(ctx, request)
 	if err != nil {
 		return nil, err
 	}
 
-	return resp.Body, nil
+	result := &GetObjectResult{
+		Body:          body,
+		ContentLength: -1,
+		ContentType:   metadata.GetContentType(),
+		ETag:          metadata.GetETag(),
+		UserMetadata:  metadata.GetUserMetadata(),
+		Metadata:      metadata,
+	}
+	if v := metadata.Get(HTTPHeaderContentLength); v != "" {
+		if length, err := strconv.ParseInt(v, 10, 64); err == nil && length >= 0 {
+			result.ContentLength = length
+		}
+	}
+	if t, err := metadata.GetLastModified(); err == nil {
+		result.LastModified = t
+	}
+	if r, err := metadata.GetContentRange(); err == nil {
+		result.ContentRange = r
+	}
+	return result, nil
+}
+
+// SetRange sets Range of the request from start to end inclusively, end < 0 means
+// to the end of object, and start < 0 means the last -start bytes with end < 0
+func (request *GetObjectRequest) SetRange(start, end int64) error {
+	switch {
+	case start < 0 && end < 0:
+		request.Range = fmt.Sprintf("bytes=%v", start)
+	case start >= 0 && end < 0:
+		request.Range = fmt.Sprintf("bytes=%v-", start)
+	case start >= 0 && start <= end:
+		request.Range = fmt.Sprintf("bytes=%v-%v", start, end)
+	default:
+		return fmt.Errorf("%w: %v-%v", ErrorRangeInvalid, start, end)
+	}
+	return nil
+}
+
+// GetObjectRange gets content of object from start to end, see SetRange for the range
+func (client *Client) GetObjectRange(bucketName, objectName string, start, end int64) (io.ReadCloser, error) {
+	return client.GetObjectRangeWithContext(context.Background(), bucketName, objectName, start, end)
+}
+
+// GetObjectRangeWithContext gets content of object from start to end with context controlling
+func (client *Client) GetObjectRangeWithContext(ctx context.Context, bucketName, objectName string, start, end int64) (io.ReadCloser, error) {
+	body, _, err := client.GetObjectRangeWithMetadataWithContext(ctx, bucketName, objectName, start, end)
+	return body, err
+}
+
+// GetObjectRangeWithMetadata gets content of object from start to end with the metadata,
+// which has the returned range in Content-Range
+func (client *Client) GetObjectRangeWithMetadata(bucketName, objectName string, start, end int64) (io.ReadCloser, *ObjectMetadata, error) {
+	return client.GetObjectRangeWithMetadataWithContext(context.Background(), bucketName, objectName, start, end)
+}
+
+// GetObjectRangeWithMetadataWithContext gets content of object from start to end with the metadata with context controlling
+func (client *Client) GetObjectRangeWithMetadataWithContext(ctx context.Context, bucketName, objectName string, start, end int64) (io.ReadCloser, *ObjectMetadata, error) {
+	request := &GetObjectRequest{
+		BucketName: bucketName,
+		ObjectName: objectName,
+	}
+	if err := request.SetRange(start, end); err != nil {
+		return nil, nil, err
+	}
+	return client.GetObjectWithMetadataWithContext(ctx, request)
+}
+
+// GetObjectBytes gets full content of a small object in memory, at most MaxGetObjectBytes
+func (client *Client) GetObjectBytes(bucketName, objectName string) ([]byte, error) {
+	return client.GetObjectBytesWithContext(context.Background(), bucketName, objectName)
+}
+
+// GetObjectBytesWithContext gets full content of a small object in memory with context controlling,
+// ErrorObjectTooLarge is returned if it is larger than MaxGetObjectBytes
+func (client *Client) GetObjectBytesWithContext(ctx context.Context, bucketName, objectName string) ([]byte, error) {
+	limit := client.Configuration.MaxGetObjectBytes
+	body, metadata, err := client.GetObjectWithMetadataWithContext(ctx, &GetObjectRequest{
+		BucketName: bucketName,
+		ObjectName: objectName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	if limit <= 0 {
+		return ioutil.ReadAll(body)
+	}
+	tooLarge := fmt.Errorf("%w: at most %d bytes", ErrorObjectTooLarge, limit)
+	if length, err := strconv.ParseInt(metadata.Get(HTTPHeaderContentLength), 10, 64); err == nil && length > limit {
+		return nil, tooLarge
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, tooLarge
+	}
+	return data, nil
 }
 
 // PutObjectRequest is the input of PutObject method
@@ -55,6 +228,18 @@ type PutObjectRequest struct {
 	ContentLength      int    `header:"Content-Length,omitempty" param:"-"`
 	Expect             string `header:"Expect,omitempty" param:"-"`
 	Expires            string `header:"Expires,omitempty" param:"-"`
+
+	// Tags are set on the object when it is created
+	Tags Tags `header:"x-xiaomi-tagging,omitempty" param:"-"`
+
+	// StorageClass of the object, the default of bucket if empty
+	StorageClass StorageClass `header:"x-xiaomi-storage-class,omitempty" param:"-"`
+
+	// UserMetadata is set as x-xiaomi-meta-* headers of the object
+	UserMetadata UserMetadata `header:"-" param:"-"`
+
+	// Headers are extra headers of the request such as x-xiaomi-meta-*, x-xiaomi-* ones are signed
+	Headers http.Header `header:",omitempty" param:"-"`
 }
 
 // PutObjectResponse is the result of PutObject method
@@ -75,6 +260,21 @@ func (client *Client) PutObject(request *PutObjectRequest) (*PutObjectResponse,
 
 // PutObjectWithContext will create object with context controlling
 func (client *Client) PutObjectWithContext(ctx context.Context, request *PutObjectRequest) (*PutObjectResponse, error) {
+	if err := request.Tags.Validate(); err != nil {
+		return nil, err
+	}
+	if err := request.StorageClass.Validate(); err != nil {
+		return nil, err
+	}
+	if err := request.UserMetadata.Validate(); err != nil {
+		return nil, err
+	}
+	if len(request.UserMetadata) > 0 {
+		r := *request
+		r.Headers = request.UserMetadata.header(request.Headers)
+		request = &r
+	}
+
 	result := &PutObjectResponse{}
 	req := &clientRequest{
 		BucketName:         request.BucketName,
@@ -83,6 +283,7 @@ func (client *Client) PutObjectWithContext(ctx context.Context, request *PutObje
 		QueryHeaderOptions: request,
 		Method:             HTTPPut,
 		Result:             result,
+		CDN:                client.Configuration.EnableCDNForUpload,
 	}
 
 	resp, err := client.do(ctx, req)
@@ -94,7 +295,49 @@ func (client *Client) PutObjectWithContext(ctx context.Context, request *PutObje
 	return result, nil
 }
 
-// DoesObjectExist judge wether object exists
+type appendObjectOption struct {
+	Append   string `param:"append" header:"-"`
+	Position int64  `param:"position" header:"-"`
+}
+
+// AppendObject appends data to objectName in bucketName at position and returns
+// the position of the next append, an AppendPositionError is returned if position
+// is not the current length of the object
+func (client *Client) AppendObject(bucketName, objectName string, position int64, data io.Reader) (int64, error) {
+	return client.AppendObjectWithContext(context.Background(), bucketName, objectName, position, data)
+}
+
+// AppendObjectWithContext appends data to objectName in bucketName at position with context controlling
+func (client *Client) AppendObjectWithContext(ctx context.Context, bucketName, objectName string, position int64, data io.Reader) (int64, error) {
+	req := &clientRequest{
+		BucketName:         bucketName,
+		ObjectName:         objectName,
+		Data:               data,
+		QueryHeaderOptions: appendObjectOption{Position: position},
+		Method:             HTTPPut,
+
+		// a retry of an append which is applied already fails with a position mismatch
+		NoRetry: true,
+	}
+
+	resp, err := client.do(ctx, req)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusConflict {
+			return 0, newAppendPositionError(position, resp, err)
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	next, err := strconv.ParseInt(resp.Header.Get(HTTPHeaderNextAppendPosition), 10, 64)
+	if err != nil {
+		return 0, newMetadataError(HTTPHeaderNextAppendPosition, resp.Header.Get(HTTPHeaderNextAppendPosition), ErrorMetadataInvalid)
+	}
+	return next, nil
+}
+
+// DoesObjectExist judge wether object exists, false is returned on 404 and
+// other failures such as 403 are returned as error
 func (client *Client) DoesObjectExist(bucketName, objectName string) (bool, error) {
 	return client.DoesObjectExistWithContext(context.Background(), bucketName, objectName)
 }
@@ -111,6 +354,7 @@ func (client *Client) DoesObjectExistWithContext(ctx context.Context, bucketName
 	if err != nil {
 		return false, err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusOK {
 		return true, nil
@@ -119,6 +363,33 @@ func (client *Client) DoesObjectExistWithContext(ctx context.Context, bucketName
 	return false, nil
 }
 
+// ObjectExists judge whether object exists, the metadata is returned if it exists
+// and an error is returned only if the existence is unknown
+func (client *Client) ObjectExists(bucketName, objectName string) (bool, *ObjectMetadata, error) {
+	return client.ObjectExistsWithContext(context.Background(), bucketName, objectName)
+}
+
+// ObjectExistsWithContext judge whether object exists with context controlling
+func (client *Client) ObjectExistsWithContext(ctx context.Context, bucketName, objectName string) (bool, *ObjectMetadata, error) {
+	req := &clientRequest{
+		BucketName: bucketName,
+		ObjectName: objectName,
+		Method:     HTTPHead,
+	}
+
+	resp, err := client.do(ctx, req)
+	if err != nil {
+		return false, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil, nil
+	}
+
+	return true, &ObjectMetadata{resp.Header}, nil
+}
+
 type copyObjectOption struct {
 	Copy string `param:"cp" header:"-"`
 }
@@ -130,6 +401,9 @@ type CopyObjectRequest struct {
 	SourceObjectName string `param:"-" header:"-"`
 	TargetBucketName string `param:"-" header:"-"`
 	TargetObjectName string `param:"-" header:"-"`
+
+	// CopySourceIfMatch asks the service to copy only if the ETag of the source matches
+	CopySourceIfMatch string `param:"-" header:"x-xiaomi-copy-source-if-match,omitempty"`
 }
 
 // CopyObject copy object from a bucket to other bucket
@@ -193,6 +467,125 @@ func (client *Client) RenameObjectWithContext(ctx context.Context, bucketName, s
 	return nil
 }
 
+// CopyOptions are the options of CopyObjectWithOptions
+type CopyOptions struct {
+	// ReplaceMetadata replaces the metadata copied from the source with Metadata
+	ReplaceMetadata bool
+	Metadata        *ObjectMetadata
+
+	// ContentType is the new Content-Type of the target, empty keeps the one of the source
+	ContentType string
+
+	// UserMetadata replaces the user metadata of the target if it is not nil
+	UserMetadata UserMetadata
+
+	// IfMatch copies only if the ETag of the source matches, ErrorCopyPreconditionFailed
+	// is returned otherwise. It is sent along with the copy request and also checked
+	// against the metadata read before the copy, the check is best effort on services
+	// which ignore the header, as the source may change in between.
+	IfMatch string
+}
+
+// CopyObjectWithOptions copies srcObject in srcBucket to dstObject in dstBucket
+func (client *Client) CopyObjectWithOptions(srcBucket, srcObject, dstBucket, dstObject string, opts *CopyOptions) error {
+	return client.CopyObjectWithOptionsWithContext(context.Background(), srcBucket, srcObject, dstBucket, dstObject, opts)
+}
+
+// CopyObjectWithOptionsWithContext copies srcObject in srcBucket to dstObject in dstBucket with context controlling.
+// A new metadata is set right after the copy, the target is deleted if setting it fails,
+// so that no target with the metadata of the source is left behind.
+func (client *Client) CopyObjectWithOptionsWithContext(ctx context.Context, srcBucket, srcObject, dstBucket, dstObject string, opts *CopyOptions) error {
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
+	if err := opts.UserMetadata.Validate(); err != nil {
+		return err
+	}
+
+	var source *ObjectMetadata
+	if opts.IfMatch != "" || (!opts.ReplaceMetadata && (opts.ContentType != "" || opts.UserMetadata != nil)) {
+		var err error
+		source, err = client.GetObjectMetadataWithContext(ctx, srcBucket, srcObject)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.IfMatch != "" && strings.Trim(source.GetETag(), "\"") != strings.Trim(opts.IfMatch, "\"") {
+		return ErrorCopyPreconditionFailed
+	}
+
+	// the metadata of the target is prepared before the copy, so that nothing can fail in between
+	var metadata *ObjectMetadata
+	if opts.ReplaceMetadata {
+		metadata = NewObjectMetadata()
+		if opts.Metadata != nil {
+			for k := range opts.Metadata.h {
+				metadata.Set(k, opts.Metadata.Get(k))
+			}
+		}
+	} else if opts.ContentType != "" || opts.UserMetadata != nil {
+		metadata = source.settable()
+	}
+	if metadata != nil && opts.ContentType != "" {
+		metadata.Set(HTTPHeaderContentType, opts.ContentType)
+	}
+	if metadata != nil && opts.UserMetadata != nil {
+		metadata.SetUserMetadata(opts.UserMetadata)
+	}
+	if metadata != nil {
+		if err := metadata.validateSettable(); err != nil {
+			return err
+		}
+	}
+
+	err := client.CopyObjectWithContext(ctx, &CopyObjectRequest{
+		SourceBucketName:  srcBucket,
+		SourceObjectName:  srcObject,
+		TargetBucketName:  dstBucket,
+		TargetObjectName:  dstObject,
+		CopySourceIfMatch: opts.IfMatch,
+	})
+	if statusCodeOf(err) == http.StatusPreconditionFailed {
+		return ErrorCopyPreconditionFailed
+	}
+	if err != nil || metadata == nil {
+		return err
+	}
+
+	err = client.SetObjectMetadataWithContext(ctx, &SetObjectMetadataRequest{
+		BucketName: dstBucket,
+		ObjectName: dstObject,
+		Metadata:   metadata,
+	})
+	if err != nil {
+		if e := client.DeleteObjectWithContext(ctx, dstBucket, dstObject); e != nil {
+			return fmt.Errorf("%w, and the copy is left behind: %v", err, e)
+		}
+		return err
+	}
+	return nil
+}
+
+// MoveObject moves srcObject in srcBucket to dstObject in dstBucket
+func (client *Client) MoveObject(srcBucket, srcObject, dstBucket, dstObject string, opts *CopyOptions) error {
+	return client.MoveObjectWithContext(context.Background(), srcBucket, srcObject, dstBucket, dstObject, opts)
+}
+
+// MoveObjectWithContext moves srcObject in srcBucket to dstObject in dstBucket with context controlling.
+// Inside a bucket without opts it is an atomic RenameObject, otherwise it is a copy followed
+// by a delete of the source, which is not atomic: the target may exist along with the source
+// if the delete fails, and the source is not deleted if the copy fails.
+func (client *Client) MoveObjectWithContext(ctx context.Context, srcBucket, srcObject, dstBucket, dstObject string, opts *CopyOptions) error {
+	if srcBucket == dstBucket && opts == nil {
+		return client.RenameObjectWithContext(ctx, srcBucket, srcObject, dstObject)
+	}
+
+	if err := client.CopyObjectWithOptionsWithContext(ctx, srcBucket, srcObject, dstBucket, dstObject, opts); err != nil {
+		return err
+	}
+	return client.DeleteObjectWithContext(ctx, srcBucket, srcObject)
+}
+
 // DeleteObject deletes objectName in bucketName
 func (client *Client) DeleteObject(bucketName, objectName string) error {
 	return client.DeleteObjectWithContext(context.Background(), bucketName, objectName)
@@ -200,10 +593,26 @@ func (client *Client) DeleteObject(bucketName, objectName string) error {
 
 // DeleteObjectWithContext deletes object in bucket with context controlling
 func (client *Client) DeleteObjectWithContext(ctx context.Context, bucketName, objectName string) error {
+	return client.DeleteObjectVersionWithContext(ctx, bucketName, objectName, "")
+}
+
+type versionIDOption struct {
+	VersionID string `param:"versionId,omitempty" header:"-"`
+}
+
+// DeleteObjectVersion deletes the version versionID of objectName in bucketName
+func (client *Client) DeleteObjectVersion(bucketName, objectName, versionID string) error {
+	return client.DeleteObjectVersionWithContext(context.Background(), bucketName, objectName, versionID)
+}
+
+// DeleteObjectVersionWithContext deletes the version of object with context controlling,
+// empty versionID deletes the latest one
+func (client *Client) DeleteObjectVersionWithContext(ctx context.Context, bucketName, objectName, versionID string) error {
 	req := &clientRequest{
-		BucketName: bucketName,
-		ObjectName: objectName,
-		Method:     HTTPDelete,
+		BucketName:         bucketName,
+		ObjectName:         objectName,
+		Method:             HTTPDelete,
+		QueryHeaderOptions: versionIDOption{VersionID: versionID},
 	}
 
 	resp, err := client.do(ctx, req)
@@ -220,75 +629,224 @@ type deleteObjectsOption struct {
 	DeleteObjects string `param:"deleteObjects" header:"-"`
 }
 
-// DeleteObjects will delete all objects in objectNames
+// DeleteObjects will delete all objects in objectNames, use BatchDeleteObjects
+// to know which objects are failed to delete
 func (client *Client) DeleteObjects(bucketName string, objectNames []string, put2trash bool) error {
 	return client.DeleteObjectsWithContext(context.Background(), bucketName, objectNames, put2trash)
 }
 
 // DeleteObjectsWithContext will delete all objects in bucket with context controlling
 func (client *Client) DeleteObjectsWithContext(ctx context.Context, bucketName string, objectNames []string, put2trash bool) error {
+	_, err := client.BatchDeleteObjectsWithContext(ctx, &DeleteObjectsRequest{
+		BucketName:  bucketName,
+		ObjectNames: objectNames,
+		Put2Trash:   put2trash,
+	})
+	return err
+}
+
+// DeleteObjectsWithPrefix will delete all objects with prefix of prefix
+func (client *Client) DeleteObjectsWithPrefix(bucketName, prefix string, put2stash bool) error {
+	return client.DeleteObjectsWithPrefixWithContext(context.Background(), bucketName, prefix, put2stash)
+}
+
+// DeleteObjectsWithPrefixWithContext will delete all objects with prefix of prefix with context controlling
+func (client *Client) DeleteObjectsWithPrefixWithContext(ctx context.Context, bucketName, prefix string, put2stash bool) error {
+	_, err := client.BatchDeleteObjectsWithPrefixWithContext(ctx, bucketName, prefix, put2stash, 1)
+	return err
+}
+
+// DeleteObjectsRequest is input of BatchDeleteObjects
+type DeleteObjectsRequest struct {
+	BucketName  string
+	ObjectNames []string
+	Put2Trash   bool
+}
+
+// DeleteObjectError is an object which is failed to delete
+type DeleteObjectError struct {
+	ObjectName string `json:"name"`
+	Message    string `json:"result"`
+}
+
+// DeleteObjectsResult is result of BatchDeleteObjects
+type DeleteObjectsResult struct {
+	Deleted []string
+	Failed  []DeleteObjectError
+}
+
+func (result *DeleteObjectsResult) merge(other *DeleteObjectsResult) {
+	result.Deleted = append(result.Deleted, other.Deleted...)
+	result.Failed = append(result.Failed, other.Failed...)
+}
+
+// BatchDeleteObjects deletes objects in batches of BatchDeleteSize and reports each object
+func (client *Client) BatchDeleteObjects(request *DeleteObjectsRequest) (*DeleteObjectsResult, error) {
+	return client.BatchDeleteObjectsWithContext(context.Background(), request)
+}
+
+// BatchDeleteObjectsWithContext deletes objects in batches with context controlling
+func (client *Client) BatchDeleteObjectsWithContext(ctx context.Context, request *DeleteObjectsRequest) (*DeleteObjectsResult, error) {
+	batchSize := int(client.Configuration.BatchDeleteSize)
+	if batchSize < 1 {
+		batchSize = len(request.ObjectNames)
+	}
+
+	result := &DeleteObjectsResult{}
+	for start := 0; start < len(request.ObjectNames); start += batchSize {
+		end := start + batchSize
+		if end > len(request.ObjectNames) {
+			end = len(request.ObjectNames)
+		}
+
+		batch, err := client.deleteObjectsBatch(ctx, request.BucketName, request.ObjectNames[start:end], request.Put2Trash)
+		if err != nil {
+			return result, err
+		}
+		result.merge(batch)
+	}
+
+	return result, nil
+}
+
+// deleteObjectsBatch sends a single batch, the server responses the objects failed to delete
+func (client *Client) deleteObjectsBatch(ctx context.Context, bucketName string, objectNames []string, put2trash bool) (*DeleteObjectsResult, error) {
 	data, err := json.Marshal(objectNames)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	var body bytes.Buffer
 	req := &clientRequest{
 		BucketName:         bucketName,
 		Method:             HTTPPut,
 		QueryHeaderOptions: deleteObjectsOption{EnableTrash: put2trash},
 		Data:               bytes.NewReader(data),
+		Result:             &body,
 	}
 
 	resp, err := client.do(ctx, req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	return nil
+	result := &DeleteObjectsResult{}
+	if len(bytes.TrimSpace(body.Bytes())) > 0 {
+		if err := json.Unmarshal(body.Bytes(), &result.Failed); err != nil {
+			return nil, err
+		}
+	}
+
+	failed := make(map[string]bool, len(result.Failed))
+	for _, f := range result.Failed {
+		failed[f.ObjectName] = true
+	}
+	for _, name := range objectNames {
+		if !failed[name] {
+			result.Deleted = append(result.Deleted, name)
+		}
+	}
+
+	return result, nil
 }
 
-// DeleteObjectsWithPrefix will delete all objects with prefix of prefix
-func (client *Client) DeleteObjectsWithPrefix(bucketName, prefix string, put2stash bool) error {
-	return client.DeleteObjectsWithPrefixWithContext(context.Background(), bucketName, prefix, put2stash)
+// BatchDeleteObjectsWithPrefix lists objects with prefix and deletes them page by page,
+// up to parallel pages are deleted at the same time
+func (client *Client) BatchDeleteObjectsWithPrefix(bucketName, prefix string, put2trash bool, parallel int) (*DeleteObjectsResult, error) {
+	return client.BatchDeleteObjectsWithPrefixWithContext(context.Background(), bucketName, prefix, put2trash, parallel)
 }
 
-// DeleteObjectsWithPrefixWithContext will delete all objects with prefix of prefix with context controlling
-func (client *Client) DeleteObjectsWithPrefixWithContext(ctx context.Context, bucketName, prefix string, put2stash bool) error {
-	listObjectsRequest := &ListObjectsRequest{
-		BucketName: bucketName,
-		Prefix:     prefix,
-		Delimiter:  "",
-		MaxKeys:    DefaultListObjectsMaxKeys,
+// BatchDeleteObjectsWithPrefixWithContext lists objects with prefix and deletes them page by page
+// with context controlling
+func (client *Client) BatchDeleteObjectsWithPrefixWithContext(ctx context.Context, bucketName, prefix string, put2trash bool, parallel int) (*DeleteObjectsResult, error) {
+	if parallel < 1 {
+		parallel = 1
 	}
 
-	objectListing, err := client.ListObjectsWithContext(ctx, listObjectsRequest)
-	if err != nil {
-		return err
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan []string)
+	results := make(chan *DeleteObjectsResult)
+	errs := make(chan error, parallel)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for names := range batches {
+				r, err := client.BatchDeleteObjectsWithContext(ctx, &DeleteObjectsRequest{
+					BucketName:  bucketName,
+					ObjectNames: names,
+					Put2Trash:   put2trash,
+				})
+				results <- r
+				if err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
 	}
 
-	for {
-		names := make([]string, 0)
-		for _, o := range objectListing.ObjectSummaries {
-			names = append(names, o.ObjectName)
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	listErr := make(chan error, 1)
+	go func() {
+		defer close(batches)
+		listErr <- client.listObjectNames(ctx, bucketName, prefix, batches)
+	}()
+
+	result := &DeleteObjectsResult{}
+	for r := range results {
+		if r != nil {
+			result.merge(r)
 		}
+	}
 
-		err = client.DeleteObjectsWithContext(ctx, bucketName, names, put2stash)
-		if err != nil {
+	select {
+	case err := <-errs:
+		return result, err
+	default:
+	}
+	return result, <-listErr
+}
+
+// listObjectNames sends the object names of every listing page to batches
+func (client *Client) listObjectNames(ctx context.Context, bucketName, prefix string, batches chan<- []string) error {
+	pageSize := int(client.Configuration.BatchDeleteSize)
+	if pageSize < 1 || pageSize > DefaultListObjectsMaxKeys {
+		pageSize = DefaultListObjectsMaxKeys
+	}
+
+	it := client.ListObjectsIteratorWithContext(ctx, bucketName, prefix, "", pageSize)
+	var names []string
+	for {
+		summary, err := it.Next()
+		if err != nil && err != io.EOF {
 			return err
 		}
-
-		if !objectListing.Truncated {
-			break
+		if err == nil {
+			names = append(names, summary.ObjectName)
 		}
 
-		objectListing, err = client.ListObjectsNextBatchWithContext(ctx, objectListing)
-		if err != nil {
-			return err
+		if len(names) == pageSize || (err == io.EOF && len(names) > 0) {
+			select {
+			case batches <- names:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			names = nil
+		}
+		if err == io.EOF {
+			return nil
 		}
 	}
-
-	return nil
 }
 
 // ObjectMetadata is metadata of object
@@ -311,9 +869,126 @@ func (metadata *ObjectMetadata) Set(k, v string) {
 	metadata.h.Set(k, v)
 }
 
-// GetContentLength gets ContentLength of object metadata
-func (metadata *ObjectMetadata) GetContentLength() (int64, error) {
-	return strconv.ParseInt(metadata.Get(HTTPHeaderContentMetadataLength), 10, 64)
+// GetContentLength gets ContentLength of object metadata
+func (metadata *ObjectMetadata) GetContentLength() (int64, error) {
+	v := metadata.Get(HTTPHeaderContentMetadataLength)
+	if v == "" {
+		return 0, newMetadataError(HTTPHeaderContentMetadataLength, v, ErrorMetadataNotFound)
+	}
+
+	length, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || length < 0 {
+		return 0, newMetadataError(HTTPHeaderContentMetadataLength, v, ErrorMetadataInvalid)
+	}
+	return length, nil
+}
+
+// GetETag gets ETag of object metadata, empty if absent
+func (metadata *ObjectMetadata) GetETag() string {
+	return metadata.Get(HTTPHeaderETag)
+}
+
+// GetContentType gets Content-Type of object metadata, empty if absent
+func (metadata *ObjectMetadata) GetContentType() string {
+	return metadata.Get(HTTPHeaderContentType)
+}
+
+// GetContentMD5 gets Content-MD5 of object metadata, empty if absent
+func (metadata *ObjectMetadata) GetContentMD5() string {
+	return metadata.Get(HTTPHeaderContentMD5)
+}
+
+// GetContentEncoding gets Content-Encoding of object metadata, empty if absent
+func (metadata *ObjectMetadata) GetContentEncoding() string {
+	return metadata.Get(HTTPHeaderContentEncoding)
+}
+
+// GetCacheControl gets Cache-Control of object metadata, empty if absent
+func (metadata *ObjectMetadata) GetCacheControl() string {
+	return metadata.Get(HTTPHeaderCacheControl)
+}
+
+// GetLastModified gets Last-Modified of object metadata, which is in one of the
+// HTTP date formats or RFC1123 with a numeric time zone
+func (metadata *ObjectMetadata) GetLastModified() (time.Time, error) {
+	v := metadata.Get(HTTPHeaderLastModified)
+	if v == "" {
+		return time.Time{}, newMetadataError(HTTPHeaderLastModified, v, ErrorMetadataNotFound)
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		t, err = time.Parse(time.RFC1123Z, v)
+	}
+	if err != nil {
+		return time.Time{}, newMetadataError(HTTPHeaderLastModified, v, ErrorMetadataInvalid)
+	}
+	return t, nil
+}
+
+// ContentRange is the range of content returned by a ranged GetObject, End is inclusive
+type ContentRange struct {
+	Start int64
+	End   int64
+
+	// Total is the length of object, -1 if unknown
+	Total int64
+}
+
+// GetContentRange gets Content-Range of object metadata, which is absent unless
+// the response is a part of object
+func (metadata *ObjectMetadata) GetContentRange() (*ContentRange, error) {
+	v := metadata.Get(HTTPHeaderContentRange)
+	if v == "" {
+		return nil, newMetadataError(HTTPHeaderContentRange, v, ErrorMetadataNotFound)
+	}
+
+	var r ContentRange
+	var total string
+	_, err := fmt.Sscanf(v, "bytes %d-%d/%s", &r.Start, &r.End, &total)
+	if err != nil || r.Start < 0 || r.Start > r.End {
+		return nil, newMetadataError(HTTPHeaderContentRange, v, ErrorMetadataInvalid)
+	}
+
+	r.Total = -1
+	if total != "*" {
+		r.Total, err = strconv.ParseInt(total, 10, 64)
+		if err != nil || r.Total <= r.End {
+			return nil, newMetadataError(HTTPHeaderContentRange, v, ErrorMetadataInvalid)
+		}
+	}
+	return &r, nil
+}
+
+// isUserMetadata reports whether header k is a x-xiaomi-meta-* header set by user
+func isUserMetadata(k string) bool {
+	key := strings.ToLower(k)
+	return strings.HasPrefix(key, XiaomiMetaPrefix) && key != strings.ToLower(HTTPHeaderContentMetadataLength)
+}
+
+// GetUserMetadata gets x-xiaomi-meta-* headers of object metadata with the prefix
+// trimmed, the keys lowercased and the RFC 2047 encoded values decoded
+func (metadata *ObjectMetadata) GetUserMetadata() map[string]string {
+	result := make(map[string]string)
+	for k := range metadata.h {
+		if isUserMetadata(k) {
+			result[strings.TrimPrefix(strings.ToLower(k), XiaomiMetaPrefix)] = decodeUserMetadataValue(metadata.Get(k))
+		}
+	}
+	return result
+}
+
+// SetUserMetadata replaces x-xiaomi-meta-* headers of object metadata with userMetadata,
+// whose keys are without the prefix and values are encoded as UserMetadata
+func (metadata *ObjectMetadata) SetUserMetadata(userMetadata map[string]string) {
+	for k := range metadata.h {
+		if isUserMetadata(k) {
+			delete(metadata.h, k)
+		}
+	}
+	for k, v := range userMetadata {
+		metadata.Set(XiaomiMetaPrefix+k, encodeUserMetadataValue(v))
+	}
 }
 
 // SetContentLength sets ContentLength of object metadata
@@ -321,6 +996,21 @@ func (metadata *ObjectMetadata) SetContentLength(length int64) {
 	metadata.Set(HTTPHeaderContentMetadataLength, strconv.FormatInt(length, 10))
 }
 
+// settable returns the metadata which can be set with SetObjectMetadata
+func (metadata *ObjectMetadata) settable() *ObjectMetadata {
+	result := NewObjectMetadata()
+	for k := range metadata.h {
+		switch key := strings.ToLower(k); {
+		case isUserMetadata(k),
+			key == strings.ToLower(HTTPHeaderContentType),
+			key == strings.ToLower(HTTPHeaderContentEncoding),
+			key == strings.ToLower(HTTPHeaderCacheControl):
+			result.Set(k, metadata.Get(k))
+		}
+	}
+	return result
+}
+
 func (metadata *ObjectMetadata) serialize() ([]byte, error) {
 	x := make(map[string]string)
 	for k := range metadata.h {
@@ -338,7 +1028,9 @@ func (metadata *ObjectMetadata) serialize() ([]byte, error) {
 }
 
 type getObjectMetadataOption struct {
-	Metadata string `param:"metadata" header:"-"`
+	Metadata  string `param:"metadata" header:"-"`
+	VersionID string `param:"versionId,omitempty" header:"-"`
+	Conditions
 }
 
 // GetObjectMetadata gets metadata of objectName in bucketName
@@ -348,12 +1040,38 @@ func (client *Client) GetObjectMetadata(bucketName, objectName string) (*ObjectM
 
 // GetObjectMetadataWithContext gets metadata of objectName in bucketName with context controlling
 func (client *Client) GetObjectMetadataWithContext(ctx context.Context, bucketName, objectName string) (*ObjectMetadata, error) {
+	return client.GetObjectVersionMetadataWithContext(ctx, bucketName, objectName, "")
+}
+
+// GetObjectVersionMetadata gets metadata of the version versionID of objectName in bucketName
+func (client *Client) GetObjectVersionMetadata(bucketName, objectName, versionID string) (*ObjectMetadata, error) {
+	return client.GetObjectVersionMetadataWithContext(context.Background(), bucketName, objectName, versionID)
+}
+
+// GetObjectVersionMetadataWithContext gets metadata of the version of object with context controlling,
+// empty versionID gets the latest one
+func (client *Client) GetObjectVersionMetadataWithContext(ctx context.Context, bucketName, objectName, versionID string) (*ObjectMetadata, error) {
+	return client.getObjectMetadata(ctx, bucketName, objectName, getObjectMetadataOption{VersionID: versionID})
+}
+
+// GetObjectMetadataWithConditions gets metadata of objectName in bucketName if conditions are met
+func (client *Client) GetObjectMetadataWithConditions(bucketName, objectName string, conditions Conditions) (*ObjectMetadata, error) {
+	return client.GetObjectMetadataWithConditionsWithContext(context.Background(), bucketName, objectName, conditions)
+}
+
+// GetObjectMetadataWithConditionsWithContext gets metadata of objectName in bucketName if conditions
+// are met with context controlling
+func (client *Client) GetObjectMetadataWithConditionsWithContext(ctx context.Context, bucketName, objectName string, conditions Conditions) (*ObjectMetadata, error) {
+	return client.getObjectMetadata(ctx, bucketName, objectName, getObjectMetadataOption{Conditions: conditions})
+}
+
+func (client *Client) getObjectMetadata(ctx context.Context, bucketName, objectName string, option getObjectMetadataOption) (*ObjectMetadata, error) {
 	result := &ObjectMetadata{}
 	req := &clientRequest{
 		BucketName:         bucketName,
 		ObjectName:         objectName,
 		Method:             HTTPGet,
-		QueryHeaderOptions: getObjectMetadataOption{},
+		QueryHeaderOptions: option,
 	}
 
 	resp, err := client.do(ctx, req)
@@ -376,6 +1094,44 @@ type SetObjectMetadataRequest struct {
 	BucketName string          `param:"-" header:"-"`
 	ObjectName string          `param:"-" header:"-"`
 	Metadata   *ObjectMetadata `param:"-" header:"-"`
+
+	// Merge keeps the current metadata which are not in Metadata,
+	// otherwise Metadata replaces the whole metadata of the object
+	Merge bool `param:"-" header:"-"`
+}
+
+// immutableMetadata are decided by the content of object and can not be set
+var immutableMetadata = []string{
+	HTTPHeaderContentLength,
+	HTTPHeaderContentMetadataLength,
+	HTTPHeaderContentMD5,
+	HTTPHeaderETag,
+	HTTPHeaderLastModified,
+	HTTPHeaderUploadTime,
+}
+
+// validateSettable returns ErrorMetadataImmutable if metadata changes an immutable header
+func (metadata *ObjectMetadata) validateSettable() error {
+	for _, k := range immutableMetadata {
+		if _, ok := metadata.h[http.CanonicalHeaderKey(k)]; ok {
+			return fmt.Errorf("%w: %s", ErrorMetadataImmutable, k)
+		}
+	}
+	return nil
+}
+
+// merge returns current overridden by metadata and whether anything changed
+func (metadata *ObjectMetadata) merge(current *ObjectMetadata) (*ObjectMetadata, bool) {
+	merged := current.settable()
+	changed := false
+	for k := range metadata.h {
+		v := metadata.Get(k)
+		if _, ok := merged.h[http.CanonicalHeaderKey(k)]; !ok || merged.Get(k) != v {
+			changed = true
+		}
+		merged.Set(k, v)
+	}
+	return merged, changed
 }
 
 // SetObjectMetadata sets metadata of object
@@ -385,7 +1141,23 @@ func (client *Client) SetObjectMetadata(request *SetObjectMetadataRequest) error
 
 // SetObjectMetadataWithContext sets metadata of object with context controlling
 func (client *Client) SetObjectMetadataWithContext(ctx context.Context, request *SetObjectMetadataRequest) error {
-	data, e := request.Metadata.serialize()
+	metadata := request.Metadata
+	if metadata == nil {
+		metadata = NewObjectMetadata()
+	}
+	if err := metadata.validateSettable(); err != nil {
+		return err
+	}
+
+	if request.Merge {
+		current, err := client.GetObjectMetadataWithContext(ctx, request.BucketName, request.ObjectName)
+		if err != nil {
+			return err
+		}
+		metadata, _ = metadata.merge(current)
+	}
+
+	data, e := metadata.serialize()
 	if e != nil {
 		return e
 	}
@@ -407,6 +1179,40 @@ func (client *Client) SetObjectMetadataWithContext(ctx context.Context, request
 	return err
 }
 
+// UpdateObjectMetadata replaces the metadata of objectName in bucketName without re-uploading it
+func (client *Client) UpdateObjectMetadata(bucketName, objectName string, metadata *ObjectMetadata) error {
+	return client.UpdateObjectMetadataWithContext(context.Background(), bucketName, objectName, metadata)
+}
+
+// UpdateObjectMetadataWithContext replaces the metadata of objectName in bucketName with context controlling.
+// Fields of metadata override the current ones, the others are kept. The object has to exist
+// and at least one field has to change, ErrorMetadataUnchanged is returned otherwise.
+func (client *Client) UpdateObjectMetadataWithContext(ctx context.Context, bucketName, objectName string, metadata *ObjectMetadata) error {
+	if metadata == nil || len(metadata.h) == 0 {
+		return ErrorMetadataUnchanged
+	}
+
+	if err := metadata.validateSettable(); err != nil {
+		return err
+	}
+
+	current, err := client.GetObjectMetadataWithContext(ctx, bucketName, objectName)
+	if err != nil {
+		return err
+	}
+
+	updated, changed := metadata.merge(current)
+	if !changed {
+		return ErrorMetadataUnchanged
+	}
+
+	return client.SetObjectMetadataWithContext(ctx, &SetObjectMetadataRequest{
+		BucketName: bucketName,
+		ObjectName: objectName,
+		Metadata:   updated,
+	})
+}
+
 // ObjectSummary beans
 type ObjectSummary struct {
 	ETag         string    `json:"etag"`
@@ -415,6 +1221,11 @@ type ObjectSummary struct {
 	Size         int64     `json:"size"`
 	LastModified time.Time `json:"lastModified"`
 	UploadTime   int64     `json:"uploadTime"`
+
+	// Tags are returned only if WithTags is set in ListObjectsRequest
+	Tags Tags `json:"tags,omitempty"`
+
+	StorageClass StorageClass `json:"storageClass,omitempty"`
 }
 
 // ListObjectsRequest is input of ListObjectsRequest
@@ -423,6 +1234,30 @@ type ListObjectsRequest struct {
 	Prefix     string `param:"prefix" header:"-"`
 	Delimiter  string `param:"delimiter" header:"-"`
 	MaxKeys    int    `param:"maxKeys" header:"-"`
+
+	// WithTags asks for the tags of each object where the service supports it
+	WithTags bool `param:"-" header:"-"`
+}
+
+type withTagsOption struct {
+	WithTags string `param:"withTags,omitempty" header:"-"`
+}
+
+func newWithTagsOption(withTags bool) withTagsOption {
+	if withTags {
+		return withTagsOption{WithTags: "true"}
+	}
+	return withTagsOption{}
+}
+
+type listObjectsOption struct {
+	ListObjectsRequest
+	withTagsOption
+}
+
+type listObjectsNextBatchOption struct {
+	ObjectListing
+	withTagsOption
 }
 
 // ObjectListing bean
@@ -436,6 +1271,9 @@ type ObjectListing struct {
 	Delimiter       string          `json:"delimiter" param:"delimiter" header:"-"`
 	ObjectSummaries []ObjectSummary `json:"objects" param:"-" header:"-"`
 	CommonPrefixes  []string        `json:"commonPrefixes" param:"-" header:"-"`
+
+	// WithTags is kept from ListObjectsRequest for the next batches
+	WithTags bool `json:"-" param:"-" header:"-"`
 }
 
 // ListObjects list all objects with Prefix and Delimiter
@@ -449,7 +1287,7 @@ func (client *Client) ListObjectsWithContext(ctx context.Context, request *ListO
 	req := &clientRequest{
 		BucketName:         request.BucketName,
 		Method:             HTTPGet,
-		QueryHeaderOptions: request,
+		QueryHeaderOptions: listObjectsOption{*request, newWithTagsOption(request.WithTags)},
 		Result:             result,
 	}
 
@@ -459,6 +1297,7 @@ func (client *Client) ListObjectsWithContext(ctx context.Context, request *ListO
 	}
 	defer resp.Body.Close()
 
+	result.WithTags = request.WithTags
 	return result, err
 }
 
@@ -473,7 +1312,7 @@ func (client *Client) ListObjectsNextBatchWithContext(ctx context.Context, previ
 	req := &clientRequest{
 		BucketName:         previous.BucketName,
 		Method:             HTTPGet,
-		QueryHeaderOptions: previous,
+		QueryHeaderOptions: listObjectsNextBatchOption{*previous, newWithTagsOption(previous.WithTags)},
 		Result:             result,
 	}
 
@@ -483,9 +1322,87 @@ func (client *Client) ListObjectsNextBatchWithContext(ctx context.Context, previ
 	}
 	defer resp.Body.Close()
 
+	result.WithTags = previous.WithTags
+	return result, err
+}
+
+// ObjectVersionSummary is a version or a delete marker of object
+type ObjectVersionSummary struct {
+	ObjectName     string    `json:"name"`
+	VersionID      string    `json:"versionId"`
+	ETag           string    `json:"etag"`
+	Owner          Owner     `json:"owner"`
+	Size           int64     `json:"size"`
+	LastModified   time.Time `json:"lastModified"`
+	IsLatest       bool      `json:"isLatest"`
+	IsDeleteMarker bool      `json:"isDeleteMarker"`
+}
+
+// VersionListing is a page of ListObjectVersions
+type VersionListing struct {
+	BucketName          string                 `json:"name"`
+	Prefix              string                 `json:"prefix"`
+	MaxKeys             int                    `json:"maxKeys"`
+	KeyMarker           string                 `json:"keyMarker"`
+	VersionIDMarker     string                 `json:"versionIdMarker"`
+	Truncated           bool                   `json:"truncated"`
+	NextKeyMarker       string                 `json:"nextKeyMarker"`
+	NextVersionIDMarker string                 `json:"nextVersionIdMarker"`
+	Versions            []ObjectVersionSummary `json:"versions"`
+}
+
+type listObjectVersionsOption struct {
+	Versions        string `param:"versions" header:"-"`
+	Prefix          string `param:"prefix" header:"-"`
+	KeyMarker       string `param:"keyMarker,omitempty" header:"-"`
+	VersionIDMarker string `param:"versionIdMarker,omitempty" header:"-"`
+	MaxKeys         int    `param:"maxKeys,omitempty" header:"-"`
+}
+
+// ListObjectVersions lists versions and delete markers of objects with prefix, starting after
+// keyMarker and versionMarker which could be empty, maxKeys 0 means the default of the server
+func (client *Client) ListObjectVersions(bucketName, prefix, keyMarker, versionMarker string, maxKeys int) (*VersionListing, error) {
+	return client.ListObjectVersionsWithContext(context.Background(), bucketName, prefix, keyMarker, versionMarker, maxKeys)
+}
+
+// ListObjectVersionsWithContext lists versions and delete markers of objects with context controlling
+func (client *Client) ListObjectVersionsWithContext(ctx context.Context, bucketName, prefix, keyMarker, versionMarker string, maxKeys int) (*VersionListing, error) {
+	result := &VersionListing{}
+	req := &clientRequest{
+		BucketName: bucketName,
+		Method:     HTTPGet,
+		QueryHeaderOptions: listObjectVersionsOption{
+			Prefix:          prefix,
+			KeyMarker:       keyMarker,
+			VersionIDMarker: versionMarker,
+			MaxKeys:         maxKeys,
+		},
+		Result: result,
+	}
+
+	resp, err := client.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if result.BucketName == "" {
+		result.BucketName = bucketName
+	}
 	return result, err
 }
 
+// ListObjectVersionsNextBatch lists next batch of ListObjectVersions
+func (client *Client) ListObjectVersionsNextBatch(previous *VersionListing) (*VersionListing, error) {
+	return client.ListObjectVersionsNextBatchWithContext(context.Background(), previous)
+}
+
+// ListObjectVersionsNextBatchWithContext lists next batch of ListObjectVersions with context controlling
+func (client *Client) ListObjectVersionsNextBatchWithContext(ctx context.Context, previous *VersionListing) (*VersionListing, error) {
+	return client.ListObjectVersionsWithContext(ctx, previous.BucketName, previous.Prefix,
+		previous.NextKeyMarker, previous.NextVersionIDMarker, previous.MaxKeys)
+}
+
 type initMultipartUploadOption struct {
 	Uploads string `param:"uploads" header:"-"`
 }
@@ -503,6 +1420,18 @@ type InitMultipartUploadRequest struct {
 	ContentLength      int    `header:"Content-Length,omitempty" param:"-"`
 	Expect             string `header:"Expect,omitempty" param:"-"`
 	Expires            string `header:"Expires,omitempty" param:"-"`
+
+	// Tags are set on the object when it is created
+	Tags Tags `header:"x-xiaomi-tagging,omitempty" param:"-"`
+
+	// StorageClass of the object, the default of bucket if empty
+	StorageClass StorageClass `header:"x-xiaomi-storage-class,omitempty" param:"-"`
+
+	// UserMetadata is set as x-xiaomi-meta-* headers of the object
+	UserMetadata UserMetadata `header:"-" param:"-"`
+
+	// Headers are extra headers of the request such as x-xiaomi-meta-*, x-xiaomi-* ones are signed
+	Headers http.Header `header:",omitempty" param:"-"`
 }
 
 // InitMultipartUploadResponse is result of InitMultipartUpload
@@ -519,6 +1448,21 @@ func (client *Client) InitMultipartUpload(request *InitMultipartUploadRequest) (
 
 // InitMultipartUploadWithContext starts a progress of multipart uploading with context controlling
 func (client *Client) InitMultipartUploadWithContext(ctx context.Context, request *InitMultipartUploadRequest) (*InitMultipartUploadResponse, error) {
+	if err := request.Tags.Validate(); err != nil {
+		return nil, err
+	}
+	if err := request.StorageClass.Validate(); err != nil {
+		return nil, err
+	}
+	if err := request.UserMetadata.Validate(); err != nil {
+		return nil, err
+	}
+	if len(request.UserMetadata) > 0 {
+		r := *request
+		r.Headers = request.UserMetadata.header(request.Headers)
+		request = &r
+	}
+
 	result := &InitMultipartUploadResponse{}
 	req := &clientRequest{
 		BucketName:         request.BucketName,
@@ -544,6 +1488,10 @@ type UploadPartRequest struct {
 	UploadID   string    `param:"uploadId" header:"-"`
 	PartNumber int       `param:"partNumber" header:"-"`
 	Data       io.Reader `param:"-" header:"-"`
+
+	// ContentMD5 is the hex MD5 of Data which the server verifies the part against,
+	// the ETag returned is the MD5 of the part received
+	ContentMD5 string `param:"-" header:"Content-MD5,omitempty"`
 }
 
 // UploadPartResponse is result of UploadPart
@@ -568,6 +1516,7 @@ func (client *Client) UploadPartWithContext(ctx context.Context, request *Upload
 		Data:               request.Data,
 		QueryHeaderOptions: request,
 		Result:             result,
+		CDN:                client.Configuration.EnableCDNForUpload,
 	}
 
 	resp, err := client.do(ctx, req)
@@ -670,6 +1619,35 @@ func (client *Client) GenerateAbsoluteObjectURL(bucketName, objectName string) *
 	return client.buildRequestURL(bucketName, objectName, "", false)
 }
 
+// URLOptions are the options of GetObjectURL
+type URLOptions struct {
+	// CDN uses the CDN endpoint for downloading instead of the API endpoint
+	CDN bool
+
+	// Internal uses the internal API endpoint of the region, it is ignored with CDN
+	Internal bool
+
+	// Scheme overrides the scheme of the client, http or https
+	Scheme string
+}
+
+// GetObjectURL returns the unsigned url of objectName in bucketName, which is accessible
+// only if the object is public, the slashes of objectName are kept as path separators
+func (client *Client) GetObjectURL(bucketName, objectName string, opts URLOptions) string {
+	conf := client.Configuration
+	host := conf.endpoint(opts.Internal || conf.EnableInternalEndpoint, opts.CDN)
+
+	scheme := opts.Scheme
+	if scheme == "" {
+		scheme = client.httpSchema()
+	}
+
+	if client.virtualHost(opts.CDN) {
+		return scheme + "://" + bucketName + "." + host + "/" + escapeObjectName(objectName)
+	}
+	return scheme + "://" + host + "/" + bucketName + "/" + escapeObjectName(objectName)
+}
+
 // GeneratePresignedURLRequest is input of GeneratePresignedURL
 type GeneratePresignedURLRequest struct {
 	CDN        bool
@@ -678,27 +1656,102 @@ type GeneratePresignedURLRequest struct {
 	Method     HTTPMethod
 	Expiration time.Time
 	Metadata   *ObjectMetadata
+
+	// Scheme overrides the scheme of the client, http or https
+	Scheme string
+
+	// Params are extra query parameters such as image processing ones,
+	// they are not part of the canonical resource so the signature is kept
+	Params url.Values
 }
 
 // GeneratePresignedURL generates presigned url
 func (client *Client) GeneratePresignedURL(request *GeneratePresignedURLRequest) (*url.URL, error) {
+	if client.anonymous {
+		return nil, ErrorCredentialsRequired
+	}
+
+	switch request.Method {
+	case HTTPGet, HTTPPut, HTTPHead, HTTPDelete:
+	default:
+		return nil, ErrorPresignedURLMethod
+	}
+
 	baseURL := client.buildRequestURL(request.BucketName, request.ObjectName, "", request.CDN)
+	switch request.Scheme {
+	case "":
+	case "http", "https":
+		baseURL.Scheme = request.Scheme
+	default:
+		return nil, ErrorPresignedURLScheme
+	}
 
 	params := url.Values{}
+	for k, v := range request.Params {
+		if _, ok := subResourceMap[k]; ok {
+			return nil, ErrorPresignedURLParam
+		}
+		params[k] = v
+	}
 	if request.Method == HTTPHead {
 		params.Add("metadata", "")
 	}
 
-	params.Add(HTTPHeaderGalaxyAccessKeyID, client.AccessID)
-	params.Add(HTTPHeaderExpires, fmt.Sprintf("%d", request.Expiration.UnixNano()/int64(time.Millisecond)))
+	creds, err := client.credentials()
+	if err != nil {
+		return nil, err
+	}
+	if creds.SecurityToken != "" {
+		params.Set(HTTPHeaderSecurityToken, creds.SecurityToken)
+	}
+
 	baseURL.RawQuery = params.Encode()
 
-	sig, e := signature(client.AccessSecret, request.Method, baseURL.String(), request.Metadata.h)
-	if e != nil {
+	header := http.Header{}
+	if request.Metadata != nil {
+		header = request.Metadata.h
+	}
+	signing := client.signingURL(baseURL)
+	if e := client.getSigner().Presign(request.Method, signing, header, request.Expiration, creds.AccessID, creds.AccessSecret); e != nil {
 		return nil, e
 	}
+	baseURL.RawQuery = signing.RawQuery
+
+	return baseURL, nil
+}
+
+// GeneratePresignedCDNURL generates a presigned GET url on the CDN endpoint
+func (client *Client) GeneratePresignedCDNURL(bucketName, objectName string, expires time.Time, params url.Values) (*url.URL, error) {
+	return client.GeneratePresignedURL(&GeneratePresignedURLRequest{
+		CDN:        true,
+		BucketName: bucketName,
+		ObjectName: objectName,
+		Method:     HTTPGet,
+		Expiration: expires,
+		Params:     params,
+	})
+}
+
+// PresignURL generates a presigned url for method, headers such as Content-Type
+// and x-xiaomi-meta-* are signed and must be sent along with the url
+func (client *Client) PresignURL(method HTTPMethod, bucketName, objectName string, expires time.Time, headers map[string]string) (string, error) {
+	metadata := NewObjectMetadata()
+	for k, v := range headers {
+		metadata.Set(k, v)
+	}
+
+	u, err := client.GeneratePresignedURL(&GeneratePresignedURLRequest{
+		BucketName: bucketName,
+		ObjectName: objectName,
+		Method:     method,
+		Expiration: expires,
+		Metadata:   metadata,
+	})
+	if err != nil {
+		return "", err
+	}
 
-	return url.Parse(baseURL.String() + "&" + HTTPHeaderSignature + "=" + sig)
+	return u.String(), nil
 }
 
 // GetObjectACLRequest is input of GetObjectACL
@@ -779,16 +1832,8 @@ func (client *Client) SetObjectPublic(bucketName, objectName string) error {
 
 // SetObjectPublicWithContext is a shortcut of setting object public with context controlling
 func (client *Client) SetObjectPublicWithContext(ctx context.Context, bucketName, objectName string) error {
-	grant := Grant{
-		Grantee: GrantKey{
-			ID: "ALL_USERS",
-		},
-		Permission: GrantPermissionRead,
-		Type:       GrantTypeGroup,
-	}
-
 	controlList := &AccessControlList{}
-	controlList.AddGrant(grant)
+	controlList.AddGrant(NewPublicReadGrant())
 
 	aclRequest := &SetObjectACLRequest{
 		BucketName: bucketName,
@@ -798,3 +1843,174 @@ func (client *Client) SetObjectPublicWithContext(ctx context.Context, bucketName
 
 	return client.SetObjectACLWithContext(ctx, aclRequest)
 }
+
+// SetObjectPrivate is a shortcut of removing the grants to all users from object
+func (client *Client) SetObjectPrivate(bucketName, objectName string) error {
+	return client.SetObjectPrivateWithContext(context.Background(), bucketName, objectName)
+}
+
+// SetObjectPrivateWithContext is a shortcut of removing the grants to all users from object
+// with context controlling
+func (client *Client) SetObjectPrivateWithContext(ctx context.Context, bucketName, objectName string) error {
+	acl, err := client.GetObjectACLWithContext(ctx, &GetObjectACLRequest{BucketName: bucketName, ObjectName: objectName})
+	if err != nil {
+		return err
+	}
+
+	var public []Grant
+	for _, grant := range acl.Grants {
+		if grant.Type == GrantTypeGroup && grant.Grantee.ID == GranteeAllUsers {
+			public = append(public, grant)
+		}
+	}
+
+	return client.removeObjectGrants(ctx, bucketName, objectName, acl, public)
+}
+
+// RemoveObjectGrant removes grants from the ACL of object, the other grants are kept
+func (client *Client) RemoveObjectGrant(bucketName, objectName string, grants ...Grant) error {
+	return client.RemoveObjectGrantWithContext(context.Background(), bucketName, objectName, grants...)
+}
+
+// RemoveObjectGrantWithContext removes grants from the ACL of object with context controlling,
+// SetObjectACL only adds grants so the removed ones are sent with the delete action
+func (client *Client) RemoveObjectGrantWithContext(ctx context.Context, bucketName, objectName string, grants ...Grant) error {
+	acl, err := client.GetObjectACLWithContext(ctx, &GetObjectACLRequest{BucketName: bucketName, ObjectName: objectName})
+	if err != nil {
+		return err
+	}
+
+	return client.removeObjectGrants(ctx, bucketName, objectName, acl, grants)
+}
+
+func (client *Client) removeObjectGrants(ctx context.Context, bucketName, objectName string, acl *AccessControlList, grants []Grant) error {
+	removed := &AccessControlList{Owner: acl.Owner}
+	for _, grant := range grants {
+		if acl.HasGrant(grant) {
+			removed.AddGrant(grant)
+		}
+	}
+	if len(removed.Grants) == 0 {
+		return nil
+	}
+
+	aclBytes, e := json.Marshal(removed)
+	if e != nil {
+		return errors.New("fds client: can't marshal acl")
+	}
+
+	req := &clientRequest{
+		BucketName:         bucketName,
+		ObjectName:         objectName,
+		Method:             HTTPPut,
+		QueryHeaderOptions: deleteACLOption{Action: "delete"},
+		Data:               bytes.NewReader(aclBytes),
+	}
+
+	resp, err := client.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return err
+}
+
+// GetObjectTagging returns the tags of object
+func (client *Client) GetObjectTagging(bucketName, objectName string) (Tags, error) {
+	return client.GetObjectTaggingWithContext(context.Background(), bucketName, objectName)
+}
+
+// GetObjectTaggingWithContext returns the tags of object with context controlling
+func (client *Client) GetObjectTaggingWithContext(ctx context.Context, bucketName, objectName string) (Tags, error) {
+	return client.getTagging(ctx, bucketName, objectName)
+}
+
+// PutObjectTagging replaces the tags of object with tags
+func (client *Client) PutObjectTagging(bucketName, objectName string, tags Tags) error {
+	return client.PutObjectTaggingWithContext(context.Background(), bucketName, objectName, tags)
+}
+
+// PutObjectTaggingWithContext replaces the tags of object with tags with context controlling
+func (client *Client) PutObjectTaggingWithContext(ctx context.Context, bucketName, objectName string, tags Tags) error {
+	if err := tags.Validate(); err != nil {
+		return err
+	}
+
+	return client.putTagging(ctx, bucketName, objectName, tags)
+}
+
+// DeleteObjectTagging removes all tags of object
+func (client *Client) DeleteObjectTagging(bucketName, objectName string) error {
+	return client.DeleteObjectTaggingWithContext(context.Background(), bucketName, objectName)
+}
+
+// DeleteObjectTaggingWithContext removes all tags of object with context controlling
+func (client *Client) DeleteObjectTaggingWithContext(ctx context.Context, bucketName, objectName string) error {
+	return client.deleteTagging(ctx, bucketName, objectName)
+}
+
+// getTagging gets tags of object, or of bucket if objectName is empty
+func (client *Client) getTagging(ctx context.Context, bucketName, objectName string) (Tags, error) {
+	result := &tagging{}
+	req := &clientRequest{
+		BucketName:         bucketName,
+		ObjectName:         objectName,
+		Method:             HTTPGet,
+		QueryHeaderOptions: taggingOption{},
+		Result:             result,
+	}
+
+	resp, err := client.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return result.Tags, nil
+}
+
+// putTagging puts tags of object, or of bucket if objectName is empty
+func (client *Client) putTagging(ctx context.Context, bucketName, objectName string, tags Tags) error {
+	if tags == nil {
+		tags = Tags{}
+	}
+	data, err := json.Marshal(tagging{Tags: tags})
+	if err != nil {
+		return err
+	}
+
+	req := &clientRequest{
+		BucketName:         bucketName,
+		ObjectName:         objectName,
+		Method:             HTTPPut,
+		QueryHeaderOptions: taggingOption{},
+		Data:               bytes.NewReader(data),
+	}
+
+	resp, err := client.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return err
+}
+
+// deleteTagging deletes tags of object, or of bucket if objectName is empty
+func (client *Client) deleteTagging(ctx context.Context, bucketName, objectName string) error {
+	req := &clientRequest{
+		BucketName:         bucketName,
+		ObjectName:         objectName,
+		Method:             HTTPDelete,
+		QueryHeaderOptions: taggingOption{},
+	}
+
+	resp, err := client.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return err
+}
@@ -0,0 +1,20 @@
+module github.com/XiaoMi/go-fds/fds/otelfds
+
+go 1.20
+
+require (
+	github.com/XiaoMi/go-fds v0.0.0
+	go.opentelemetry.io/otel v1.21.0
+	go.opentelemetry.io/otel/sdk v1.21.0
+	go.opentelemetry.io/otel/trace v1.21.0
+)
+
+require (
+	github.com/go-logr/logr v1.3.0 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/otel/metric v1.21.0 // indirect
+	golang.org/x/sys v0.14.0 // indirect
+	golang.org/x/time v0.3.0 // indirect
+)
+
+replace github.com/XiaoMi/go-fds => ../..
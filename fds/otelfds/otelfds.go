@@ -0,0 +1,82 @@
+// Package otelfds traces the operations of fds.Client and the manager with OpenTelemetry,
+// set the TraceProvider of the configuration to enable it:
+//
+//	conf.TraceProvider = otelfds.New(nil)
+package otelfds
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/XiaoMi/go-fds/fds"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the tracer
+const InstrumentationName = "github.com/XiaoMi/go-fds/fds/otelfds"
+
+// TraceProvider is a fds.TraceProvider which starts the spans with an OpenTelemetry tracer
+type TraceProvider struct {
+	tracer trace.Tracer
+}
+
+// New returns a TraceProvider of provider, the global one is used if provider is nil
+func New(provider trace.TracerProvider) *TraceProvider {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &TraceProvider{tracer: provider.Tracer(InstrumentationName)}
+}
+
+// StartSpan starts a client span which is a child of the span of ctx
+func (p *TraceProvider) StartSpan(ctx context.Context, name string, attributes ...fds.Attribute) (context.Context, fds.Span) {
+	ctx, s := p.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(keyValues(attributes)...))
+	return ctx, span{s}
+}
+
+// EndSpan records err as the status of span and ends it
+func (p *TraceProvider) EndSpan(s fds.Span, err error) {
+	otelSpan := s.(span).span
+	if err != nil {
+		otelSpan.RecordError(err)
+		otelSpan.SetStatus(codes.Error, err.Error())
+	}
+	otelSpan.End()
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s span) SetAttributes(attributes ...fds.Attribute) {
+	s.span.SetAttributes(keyValues(attributes)...)
+}
+
+func (s span) AddEvent(name string, attributes ...fds.Attribute) {
+	s.span.AddEvent(name, trace.WithAttributes(keyValues(attributes)...))
+}
+
+func keyValues(attributes []fds.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attributes))
+	for _, a := range attributes {
+		key := attribute.Key(a.Key)
+		switch v := a.Value.(type) {
+		case string:
+			kvs = append(kvs, key.String(v))
+		case bool:
+			kvs = append(kvs, key.Bool(v))
+		case int:
+			kvs = append(kvs, key.Int(v))
+		case int64:
+			kvs = append(kvs, key.Int64(v))
+		default:
+			kvs = append(kvs, key.String(fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}
@@ -0,0 +1,70 @@
+package otelfds
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/XiaoMi/go-fds/fds"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(fds.HTTPHeaderRequestID, "request-id")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	u, _ := url.Parse(server.URL)
+	conf, _ := fds.NewClientConfiguration(u.Host)
+	conf.EnableHTTPS = false
+	conf.TraceProvider = New(provider)
+	client := fds.New("ak", "sk", conf)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	_, err := client.GetObjectMetadataWithContext(ctx, "bucket", "object")
+	parent.End()
+	if err == nil {
+		t.Fatal("expect an error of 404")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expect 2 spans, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "fds.GET" {
+		t.Errorf("unexpected name %s", span.Name())
+	}
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("the span is not a child of the span of the context")
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("unexpected status %v", span.Status())
+	}
+
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attributes[kv.Key] = kv.Value
+	}
+	expected := map[attribute.Key]attribute.Value{
+		fds.AttributeBucket:     attribute.StringValue("bucket"),
+		fds.AttributeObject:     attribute.StringValue("object"),
+		fds.AttributeStatusCode: attribute.IntValue(http.StatusNotFound),
+		fds.AttributeRequestID:  attribute.StringValue("request-id"),
+	}
+	for k, v := range expected {
+		if attributes[k] != v {
+			t.Errorf("attribute %s is %v, expect %v", k, attributes[k].Emit(), v.Emit())
+		}
+	}
+}
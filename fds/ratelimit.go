@@ -0,0 +1,34 @@
+package fds
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimiter returns the limiter of the requests of method, nil if they are not limited
+func (client *Client) rateLimiter(method HTTPMethod) *rate.Limiter {
+	if client.Configuration == nil {
+		return nil
+	}
+	if method == HTTPGet || method == HTTPHead {
+		return client.Configuration.ReadRateLimiter
+	}
+	return client.Configuration.WriteRateLimiter
+}
+
+// waitRateLimit blocks until an attempt of method is allowed or ctx is done
+func (client *Client) waitRateLimit(ctx context.Context, method HTTPMethod) error {
+	limiter := client.rateLimiter(method)
+	if limiter == nil {
+		return nil
+	}
+	if err := limiter.Wait(ctx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("wait for the rate limiter: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package fds
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func Test_RateLimiter(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	read := rate.NewLimiter(rate.Every(time.Hour), 3)
+	write := rate.NewLimiter(rate.Every(time.Hour), 1)
+	newClient := func() *Client {
+		client := newTestClient(server)
+		client.Configuration.ReadRateLimiter = read
+		client.Configuration.WriteRateLimiter = write
+		client.Configuration.RetryPolicy = &RetryPolicy{
+			MaxAttempts:          2,
+			RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+		}
+		client.clock = &fakeClock{now: time.Now()}
+		return client
+	}
+	client, other := newClient(), newClient()
+
+	// both attempts of the retried request take a token
+	_, err := client.GetObjectMetadata("bucket", "object")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	assert.InDelta(t, 1, read.Tokens(), 0.01)
+	assert.InDelta(t, 1, write.Tokens(), 0.01)
+
+	// the limiter is shared by the clients
+	_, err = other.GetObjectMetadata("bucket", "object")
+	assert.Nil(t, err)
+	assert.InDelta(t, 0, read.Tokens(), 0.01)
+
+	assert.Nil(t, client.DeleteObject("bucket", "object"))
+
+	// the waits of the exhausted limiters respect the context
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err = other.GetObjectMetadataWithContext(ctx, "bucket", "object")
+	assert.Equal(t, context.Canceled, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err = client.DeleteObjectWithContext(ctx, "bucket", "object")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "rate limiter")
+	assert.Equal(t, int32(4), atomic.LoadInt32(&requests))
+}
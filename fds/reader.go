@@ -0,0 +1,198 @@
+package fds
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// Defaults of ObjectReader
+const (
+	DefaultObjectReaderBlockSize = 1024 * 1024
+	DefaultObjectReaderMaxBlocks = 8
+)
+
+// ObjectReader reads an object randomly with ranged GetObject, the blocks read
+// are cached so that small sequential reads don't send a request each
+type ObjectReader struct {
+	client     *Client
+	ctx        context.Context
+	bucketName string
+	objectName string
+	size       int64
+	etag       string
+	offset     int64
+
+	// BlockSize is the size of each ranged GetObject, it can't be changed after the first read
+	BlockSize int64
+
+	// MaxBlocks is the count of blocks cached, the least recently used one is evicted
+	MaxBlocks int
+
+	mu     sync.Mutex
+	blocks map[int64][]byte
+	order  []int64
+}
+
+// NewObjectReader opens object for reading, its size and ETag are captured so
+// that ErrorObjectChanged is returned if it is replaced
+func NewObjectReader(client *Client, bucketName, objectName string) (*ObjectReader, error) {
+	return NewObjectReaderWithContext(context.Background(), client, bucketName, objectName)
+}
+
+// NewObjectReaderWithContext opens object for reading, ctx controls all of the reads
+func NewObjectReaderWithContext(ctx context.Context, client *Client, bucketName, objectName string) (*ObjectReader, error) {
+	metadata, err := client.GetObjectMetadataWithContext(ctx, bucketName, objectName)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := metadata.GetContentLength()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectReader{
+		client:     client,
+		ctx:        ctx,
+		bucketName: bucketName,
+		objectName: objectName,
+		size:       size,
+		etag:       metadata.GetETag(),
+		BlockSize:  DefaultObjectReaderBlockSize,
+		MaxBlocks:  DefaultObjectReaderMaxBlocks,
+		blocks:     make(map[int64][]byte),
+	}, nil
+}
+
+// Size returns the size of object when it is opened
+func (r *ObjectReader) Size() int64 {
+	return r.size
+}
+
+// ETag returns the ETag of object when it is opened
+func (r *ObjectReader) ETag() string {
+	return r.etag
+}
+
+// Read implements io.Reader
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return r.offset, ErrorSeekOffsetInvalid
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// ReadAt implements io.ReaderAt, it is safe for concurrent use
+func (r *ObjectReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrorSeekOffsetInvalid
+	}
+
+	n := 0
+	for n < len(p) && off < r.size {
+		blockSize := r.blockSize()
+		data, err := r.block(off / blockSize)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], data[off%blockSize:])
+		n += copied
+		off += int64(copied)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *ObjectReader) blockSize() int64 {
+	if r.BlockSize < 1 {
+		return DefaultObjectReaderBlockSize
+	}
+	return r.BlockSize
+}
+
+// block returns the block of index i from cache or the server
+func (r *ObjectReader) block(i int64) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, j := range r.order {
+		if j == i {
+			r.order = append(append(r.order[:k:k], r.order[k+1:]...), i)
+			return r.blocks[i], nil
+		}
+	}
+
+	data, err := r.fetch(i)
+	if err != nil {
+		return nil, err
+	}
+
+	r.blocks[i] = data
+	r.order = append(r.order, i)
+	for len(r.order) > r.MaxBlocks && len(r.order) > 1 {
+		delete(r.blocks, r.order[0])
+		r.order = r.order[1:]
+	}
+	return data, nil
+}
+
+func (r *ObjectReader) fetch(i int64) ([]byte, error) {
+	start := i * r.blockSize()
+	end := start + r.blockSize()
+	if end > r.size {
+		end = r.size
+	}
+
+	request := &GetObjectRequest{
+		BucketName: r.bucketName,
+		ObjectName: r.objectName,
+		IfRange:    r.etag,
+	}
+	if err := request.SetRange(start, end-1); err != nil {
+		return nil, err
+	}
+
+	body, metadata, err := r.client.GetObjectWithMetadataWithContext(r.ctx, request)
+	if IsPreconditionFailed(err) {
+		return nil, ErrorObjectChanged
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	if etag := metadata.GetETag(); r.etag != "" && etag != "" && etag != r.etag {
+		return nil, ErrorObjectChanged
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, end-start+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != end-start {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
@@ -0,0 +1,122 @@
+package fds
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newReaderTestServer serves content as an object and counts the ranged gets
+func newReaderTestServer(content *[]byte) (*httptest.Server, *int) {
+	var mu sync.Mutex
+	gets := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		data := *content
+		if _, ok := r.URL.Query()["metadata"]; !ok {
+			gets++
+		}
+		mu.Unlock()
+
+		w.Header().Set(HTTPHeaderETag, fmt.Sprintf("\"%x\"", md5.Sum(data)))
+		w.Header().Set(HTTPHeaderContentMetadataLength, strconv.Itoa(len(data)))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	return server, &gets
+}
+
+func Test_ObjectReader(t *testing.T) {
+	content := make([]byte, 1000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	server, gets := newReaderTestServer(&content)
+	defer server.Close()
+
+	r, err := NewObjectReader(newTestClient(server), "bucket", "object")
+	assert.Nil(t, err)
+	r.BlockSize = 100
+	r.MaxBlocks = 2
+	assert.Equal(t, int64(1000), r.Size())
+
+	// small sequential reads share a block
+	buf := make([]byte, 10)
+	for i := 0; i < 10; i++ {
+		n, err := r.Read(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, content[i*10:i*10+n], buf[:n])
+	}
+	assert.Equal(t, 1, *gets)
+
+	// a read across blocks
+	buf = make([]byte, 150)
+	n, err := r.ReadAt(buf, 50)
+	assert.Nil(t, err)
+	assert.Equal(t, 150, n)
+	assert.Equal(t, content[50:200], buf)
+	assert.Equal(t, 2, *gets)
+
+	// the first block is evicted by the third one
+	_, err = r.ReadAt(buf[:1], 250)
+	assert.Nil(t, err)
+	_, err = r.ReadAt(buf[:1], 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, *gets)
+
+	pos, err := r.Seek(-5, io.SeekEnd)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(995), pos)
+	data, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, content[995:], data)
+	n, err = r.Read(buf)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+
+	_, err = r.Seek(-1, io.SeekStart)
+	assert.Equal(t, ErrorSeekOffsetInvalid, err)
+
+	// the object is replaced underneath the reader
+	content = append([]byte(nil), content[:900]...)
+	_, err = r.ReadAt(buf, 600)
+	assert.Equal(t, ErrorObjectChanged, err)
+}
+
+func Test_ObjectReaderZip(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for i := 0; i < 5; i++ {
+		w, _ := zw.Create(fmt.Sprintf("file-%d", i))
+		w.Write(bytes.Repeat([]byte{byte('a' + i)}, 1000*i))
+	}
+	assert.Nil(t, zw.Close())
+
+	content := archive.Bytes()
+	server, _ := newReaderTestServer(&content)
+	defer server.Close()
+
+	r, err := NewObjectReader(newTestClient(server), "bucket", "archive.zip")
+	assert.Nil(t, err)
+	r.BlockSize = 512
+
+	zr, err := zip.NewReader(r, r.Size())
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(zr.File))
+	f, err := zr.File[3].Open()
+	assert.Nil(t, err)
+	data, err := ioutil.ReadAll(f)
+	assert.Nil(t, err)
+	f.Close()
+	assert.Equal(t, bytes.Repeat([]byte{'d'}, 3000), data)
+}
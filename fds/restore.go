@@ -0,0 +1,96 @@
+package fds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type restoreArchivedObjectRequest struct {
+	Days int `json:"days"`
+}
+
+// RestoreStatus is the status of restoring an archived object
+type RestoreStatus struct {
+	// Ongoing is true until the restored copy is readable
+	Ongoing bool
+
+	// Expiry is when the restored copy expires, zero if ongoing
+	Expiry time.Time
+}
+
+// GetRestoreStatus gets the restore status of object metadata, the header is
+// absent if the object is not archived or never restored
+func (metadata *ObjectMetadata) GetRestoreStatus() (*RestoreStatus, error) {
+	v := metadata.Get(HTTPHeaderRestore)
+	if v == "" {
+		return nil, newMetadataError(HTTPHeaderRestore, v, ErrorMetadataNotFound)
+	}
+
+	ongoing, ok := restoreField(v, "ongoing-request")
+	if !ok || (ongoing != "true" && ongoing != "false") {
+		return nil, newMetadataError(HTTPHeaderRestore, v, ErrorMetadataInvalid)
+	}
+	status := &RestoreStatus{Ongoing: ongoing == "true"}
+
+	if expiry, ok := restoreField(v, "expiry-date"); ok {
+		t, err := http.ParseTime(expiry)
+		if err != nil {
+			return nil, newMetadataError(HTTPHeaderRestore, v, ErrorMetadataInvalid)
+		}
+		status.Expiry = t
+	}
+	return status, nil
+}
+
+// restoreField gets the quoted value of key in x-xiaomi-restore header, which
+// is formatted as ongoing-request="false", expiry-date="Fri, 23 Dec 2012 00:00:00 GMT"
+func restoreField(v, key string) (string, bool) {
+	i := strings.Index(v, key+`="`)
+	if i < 0 {
+		return "", false
+	}
+	v = v[i+len(key)+2:]
+
+	j := strings.IndexByte(v, '"')
+	if j < 0 {
+		return "", false
+	}
+	return v[:j], true
+}
+
+// RestoreArchivedObject restores an archived object, the restored copy is readable for days
+func (client *Client) RestoreArchivedObject(bucketName, objectName string, days int) error {
+	return client.RestoreArchivedObjectWithContext(context.Background(), bucketName, objectName, days)
+}
+
+// RestoreArchivedObjectWithContext restores an archived object with context controlling
+func (client *Client) RestoreArchivedObjectWithContext(ctx context.Context, bucketName, objectName string, days int) error {
+	if days <= 0 {
+		return ErrorRestoreDaysNotPositive
+	}
+
+	data, err := json.Marshal(restoreArchivedObjectRequest{Days: days})
+	if err != nil {
+		return err
+	}
+
+	req := &clientRequest{
+		BucketName:         bucketName,
+		ObjectName:         objectName,
+		Method:             HTTPPut,
+		QueryHeaderOptions: restoreObjectOption{},
+		Data:               bytes.NewReader(data),
+	}
+
+	resp, err := client.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
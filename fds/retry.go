@@ -0,0 +1,220 @@
+package fds
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how the Client retries failed requests
+type RetryPolicy struct {
+	// MaxAttempts is the count of attempts including the first one,
+	// retries are disabled if it is smaller than 2
+	MaxAttempts int
+
+	// BaseBackoff is doubled after every attempt until MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// Jitter is the fraction of the backoff which is randomized, from 0 to 1
+	Jitter float64
+
+	// RetryableStatusCodes are the status codes of responses worth a retry,
+	// transport errors are always retried
+	RetryableStatusCodes []int
+}
+
+// DefaultRetryPolicy returns a RetryPolicy with 3 attempts
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		BaseBackoff: 200 * time.Millisecond,
+		MaxBackoff:  5 * time.Second,
+		Jitter:      0.2,
+		RetryableStatusCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+func (policy *RetryPolicy) shouldRetry(attempt int, response *http.Response, err error) bool {
+	if policy == nil || attempt >= policy.MaxAttempts || err == nil {
+		return false
+	}
+	if _, ok := err.(*interceptorError); ok {
+		return false
+	}
+
+	if response == nil {
+		return true
+	}
+	for _, code := range policy.RetryableStatusCodes {
+		if response.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the time to wait before the next attempt, a Retry-After
+// header of 429 and 503 responses takes precedence
+func (policy *RetryPolicy) backoff(attempt int, response *http.Response, c clock, jitter jitterSource) time.Duration {
+	if response != nil && (response.StatusCode == http.StatusTooManyRequests ||
+		response.StatusCode == http.StatusServiceUnavailable) {
+		if d, ok := retryAfter(response.Header.Get(HTTPHeaderRetryAfter), c); ok {
+			return d
+		}
+	}
+
+	d := policy.BaseBackoff
+	for i := 1; i < attempt && (policy.MaxBackoff <= 0 || d < policy.MaxBackoff); i++ {
+		d *= 2
+	}
+	if policy.MaxBackoff > 0 && d > policy.MaxBackoff {
+		d = policy.MaxBackoff
+	}
+
+	if policy.Jitter > 0 {
+		d -= time.Duration(jitter.Float64() * policy.Jitter * float64(d))
+	}
+	return d
+}
+
+func retryAfter(v string, c clock) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := t.Sub(c.Now())
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// bodyRewinder returns a function which rewinds data for the next attempt,
+// or false if the request can not be sent again
+func bodyRewinder(data io.Reader) (func() error, bool) {
+	if data == nil {
+		return func() error { return nil }, true
+	}
+
+	seeker, ok := data.(io.Seeker)
+	if !ok {
+		return nil, false
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, false
+	}
+
+	return func() error {
+		_, err := seeker.Seek(offset, io.SeekStart)
+		return err
+	}, true
+}
+
+// retryableBody returns data of a request which can be retried so that bodyRewinder rewinds
+// it: a *bytes.Buffer is read from its bytes and a reader which can not seek is read into
+// memory if it is at most limit bytes. A larger one is returned to be sent once.
+func retryableBody(data io.Reader, limit int64) (io.Reader, error) {
+	switch v := data.(type) {
+	case nil, io.Seeker:
+		return data, nil
+	case *bytes.Buffer:
+		return bytes.NewReader(v.Next(v.Len())), nil
+	}
+	if limit <= 0 {
+		return data, nil
+	}
+	if n, ok := bodyLength(data); ok && n > limit {
+		// keeps the reader whose length is the Content-Length
+		return data, nil
+	}
+
+	buf, err := ioutil.ReadAll(io.LimitReader(data, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	closer, ok := data.(io.Closer)
+	if int64(len(buf)) <= limit {
+		if ok {
+			// closes the body once it is read, like the transport does
+			closer.Close()
+		}
+		return bytes.NewReader(buf), nil
+	}
+
+	r := io.MultiReader(bytes.NewReader(buf), data)
+	if ok {
+		return struct {
+			io.Reader
+			io.Closer
+		}{r, closer}, nil
+	}
+	return r, nil
+}
+
+// bodyLength is the length of data sent as the Content-Length by doHandleRequestBody
+func bodyLength(data io.Reader) (int64, bool) {
+	switch v := data.(type) {
+	case *io.LimitedReader:
+		return v.N, true
+	case interface{ Len() int }:
+		return int64(v.Len()), true
+	}
+	return 0, false
+}
+
+// notRetriedError is the error of a request which is not retried as its body can not
+// be sent again, it is ErrorBodyNotRewindable
+type notRetriedError struct {
+	err error
+}
+
+func (e *notRetriedError) Error() string {
+	return e.err.Error() + ", " + ErrorBodyNotRewindable.Error()
+}
+
+func (e *notRetriedError) Unwrap() error {
+	return e.err
+}
+
+func (e *notRetriedError) Is(target error) bool {
+	return target == ErrorBodyNotRewindable
+}
+
+func (client *Client) retryBufferSize() int64 {
+	if client.Configuration == nil {
+		return 0
+	}
+	return client.Configuration.RetryBufferSize
+}
+
+type attemptKey struct{}
+
+// RequestAttempt returns the attempt number of a request sent by the Client,
+// which starts from 1
+func RequestAttempt(req *http.Request) int {
+	if attempt, ok := req.Context().Value(attemptKey{}).(int); ok {
+		return attempt
+	}
+	return 0
+}
+
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
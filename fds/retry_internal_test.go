@@ -0,0 +1,262 @@
+package fds
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RetryPolicy(t *testing.T) {
+	var bodies []string
+	failures := 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		if len(bodies) <= failures {
+			w.Header().Set(HTTPHeaderRetryAfter, "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+	client.Configuration.RetryPolicy = DefaultRetryPolicy()
+
+	_, err := client.PutObject(&PutObjectRequest{
+		BucketName: "bucket",
+		ObjectName: "object",
+		Data:       bytes.NewReader([]byte("content")),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"content", "content", "content"}, bodies)
+
+	// a buffer is sent again from its bytes
+	bodies = nil
+	_, err = client.PutObject(&PutObjectRequest{
+		BucketName: "bucket",
+		ObjectName: "object",
+		Data:       bytes.NewBufferString("content"),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"content", "content", "content"}, bodies)
+
+	bodies = nil
+	failures = 3
+	_, err = client.GetObjectMetadata("bucket", "object")
+	assert.Equal(t, http.StatusServiceUnavailable, statusCodeOf(err))
+	assert.Equal(t, 3, len(bodies))
+
+	// appends are not idempotent, so they are never retried
+	bodies = nil
+	failures = 1
+	_, err = client.AppendObject("bucket", "object", 0, bytes.NewReader([]byte("content")))
+	assert.Equal(t, http.StatusServiceUnavailable, statusCodeOf(err))
+	assert.Equal(t, 1, len(bodies))
+}
+
+func Test_RetryPolicyBackoff(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts: 5,
+		BaseBackoff: 100 * time.Millisecond,
+		MaxBackoff:  300 * time.Millisecond,
+	}
+	assert.Equal(t, 100*time.Millisecond, policy.backoff(1, nil, realClock{}, globalJitter{}))
+	assert.Equal(t, 200*time.Millisecond, policy.backoff(2, nil, realClock{}, globalJitter{}))
+	assert.Equal(t, 300*time.Millisecond, policy.backoff(3, nil, realClock{}, globalJitter{}))
+
+	response := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	response.Header.Set(HTTPHeaderRetryAfter, "2")
+	assert.Equal(t, 2*time.Second, policy.backoff(1, response, realClock{}, globalJitter{}))
+
+	policy.Jitter = 0.5
+	d := policy.backoff(2, nil, realClock{}, globalJitter{})
+	assert.True(t, d > 100*time.Millisecond && d <= 200*time.Millisecond)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	assert.Equal(t, 0, RequestAttempt(req))
+	assert.Equal(t, 2, RequestAttempt(req.WithContext(withAttempt(req.Context(), 2))))
+}
+
+// attemptRecorder records the attempt number of every request before sending it
+type attemptRecorder struct {
+	attempts []int
+}
+
+func (recorder *attemptRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder.attempts = append(recorder.attempts, RequestAttempt(req))
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func Test_RequestAttempt(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			w.Header().Set(HTTPHeaderRetryAfter, "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+	client.Configuration.RetryPolicy = DefaultRetryPolicy()
+	recorder := &attemptRecorder{}
+	client.httpClient.Transport = recorder
+
+	assert.Nil(t, client.DeleteObject("bucket", "object"))
+	assert.Equal(t, []int{1, 2, 3}, recorder.attempts)
+
+	recorder.attempts = nil
+	assert.Nil(t, client.DeleteObject("bucket", "object"))
+	assert.Equal(t, []int{1}, recorder.attempts)
+
+	assert.Equal(t, 0, RequestAttempt(httptest.NewRequest(http.MethodGet, "/", nil)))
+}
+
+// fakeClock records the waits and fires them at once
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func Test_RetryBackoffWithFakeClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 2 {
+			w.Header().Set(HTTPHeaderRetryAfter, start.Add(time.Hour).Format(http.TimeFormat))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = 4
+	policy.BaseBackoff = time.Minute
+	policy.MaxBackoff = time.Hour
+	policy.Jitter = 0.5
+
+	fake := &fakeClock{now: start}
+	client := newTestClient(server)
+	client.Configuration.RetryPolicy = policy
+	client.clock = fake
+	client.jitter = newSeededJitter(1)
+
+	begin := time.Now()
+	_, err := client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "object"})
+	assert.Equal(t, http.StatusInternalServerError, statusCodeOf(err))
+	assert.Equal(t, 4, attempts)
+	assert.True(t, time.Since(begin) < 5*time.Second)
+
+	// the jitter is the same as a source of the same seed
+	jitter := newSeededJitter(1)
+	first := time.Minute - time.Duration(jitter.Float64()*0.5*float64(time.Minute))
+	third := 4*time.Minute - time.Duration(jitter.Float64()*0.5*float64(4*time.Minute))
+	assert.Equal(t, []time.Duration{first, time.Hour - first, third}, fake.waits)
+}
+
+func Test_RetryBufferSize(t *testing.T) {
+	var bodies []string
+	var lengths []int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		lengths = append(lengths, r.ContentLength)
+		if len(bodies) < 3 {
+			w.Header().Set(HTTPHeaderRetryAfter, "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+	client.Configuration.RetryPolicy = DefaultRetryPolicy()
+	client.Configuration.RetryBufferSize = int64(len("content"))
+
+	// a reader which can not seek is buffered and sent again with its length
+	body := &closeRecorder{Reader: strings.NewReader("content")}
+	_, err := client.PutObject(&PutObjectRequest{
+		BucketName: "bucket",
+		ObjectName: "object",
+		Data:       body,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"content", "content", "content"}, bodies)
+	assert.Equal(t, []int64{7, 7, 7}, lengths)
+	assert.True(t, body.closed)
+
+	// a larger one is sent once and the error says why it is not retried
+	bodies = nil
+	lengths = nil
+	body = &closeRecorder{Reader: strings.NewReader("content!")}
+	_, err = client.PutObject(&PutObjectRequest{
+		BucketName: "bucket",
+		ObjectName: "object",
+		Data:       body,
+	})
+	assert.True(t, errors.Is(err, ErrorBodyNotRewindable))
+	assert.Equal(t, http.StatusServiceUnavailable, statusCodeOf(err))
+	assert.Contains(t, err.Error(), ErrorBodyNotRewindable.Error())
+	assert.Equal(t, []string{"content!"}, bodies)
+	assert.True(t, body.closed)
+
+	// so is every one which can not seek if the buffering is disabled
+	bodies = nil
+	client.Configuration.RetryBufferSize = 0
+	_, err = client.PutObject(&PutObjectRequest{
+		BucketName: "bucket",
+		ObjectName: "object",
+		Data:       struct{ io.Reader }{strings.NewReader("content")},
+	})
+	assert.True(t, errors.Is(err, ErrorBodyNotRewindable))
+	assert.Equal(t, []string{"content"}, bodies)
+}
+
+// closeRecorder is a body which can not seek and records if it is closed
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
@@ -0,0 +1,28 @@
+package fds
+
+import "fmt"
+
+// StorageClass is the storage class of object
+type StorageClass string
+
+// Storage classes, the bucket default is used if it is empty
+const (
+	StorageClassStandard         StorageClass = "STANDARD"
+	StorageClassInfrequentAccess StorageClass = "STANDARD_IA"
+	StorageClassArchive          StorageClass = "ARCHIVE"
+)
+
+// Validate checks the storage class is empty or a known one
+func (class StorageClass) Validate() error {
+	switch class {
+	case "", StorageClassStandard, StorageClassInfrequentAccess, StorageClassArchive:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrorStorageClassInvalid, string(class))
+	}
+}
+
+// GetStorageClass gets the storage class of object metadata, empty if absent
+func (metadata *ObjectMetadata) GetStorageClass() StorageClass {
+	return StorageClass(metadata.Get(HTTPHeaderStorageClass))
+}
@@ -0,0 +1,100 @@
+package fds
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits of tags
+const (
+	MaxTagKeyLength   = 128
+	MaxTagValueLength = 256
+	MaxObjectTags     = 10
+	MaxBucketTags     = 50
+)
+
+type taggingOption struct {
+	Tagging string `param:"tagging" header:"-"`
+}
+
+// Tag is a key value pair attached to object or bucket
+type Tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Tags keeps the tags in the order they are set
+type Tags []Tag
+
+type tagging struct {
+	Tags Tags `json:"tags"`
+}
+
+// Get returns the value of key
+func (tags Tags) Get(key string) (string, bool) {
+	for _, tag := range tags {
+		if tag.Key == key {
+			return tag.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set replaces the value of key in place, or appends it if key is absent
+func (tags *Tags) Set(key, value string) {
+	for i := range *tags {
+		if (*tags)[i].Key == key {
+			(*tags)[i].Value = value
+			return
+		}
+	}
+	*tags = append(*tags, Tag{Key: key, Value: value})
+}
+
+// Delete removes key from tags
+func (tags *Tags) Delete(key string) {
+	kept := (*tags)[:0]
+	for _, tag := range *tags {
+		if tag.Key != key {
+			kept = append(kept, tag)
+		}
+	}
+	*tags = kept
+}
+
+// String encodes tags as the value of x-xiaomi-tagging header
+func (tags Tags) String() string {
+	pairs := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		pairs = append(pairs, url.QueryEscape(tag.Key)+"="+url.QueryEscape(tag.Value))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// Validate checks tags of object against the limits
+func (tags Tags) Validate() error {
+	return tags.validate(MaxObjectTags)
+}
+
+func (tags Tags) validate(max int) error {
+	if len(tags) > max {
+		return fmt.Errorf("%w: %d tags, at most %d", ErrorTagsTooMany, len(tags), max)
+	}
+
+	keys := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if tag.Key == "" || utf8.RuneCountInString(tag.Key) > MaxTagKeyLength {
+			return fmt.Errorf("%w: %q", ErrorTagKeyInvalid, tag.Key)
+		}
+		if utf8.RuneCountInString(tag.Value) > MaxTagValueLength {
+			return fmt.Errorf("%w: %q", ErrorTagValueTooLong, tag.Key)
+		}
+		if keys[tag.Key] {
+			return fmt.Errorf("%w: %q", ErrorTagKeyDuplicated, tag.Key)
+		}
+		keys[tag.Key] = true
+	}
+	return nil
+}
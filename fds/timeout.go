@@ -0,0 +1,206 @@
+package fds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Default timeouts of ClientConfiguration
+const (
+	DefaultRequestTimeout        = time.Minute
+	DefaultTotalOperationTimeout = 10 * time.Minute
+	DefaultResponseHeaderTimeout = 30 * time.Second
+	DefaultBodyIdleTimeout       = time.Minute
+)
+
+type requestTimeoutKey struct{}
+
+type bodyIdleTimeoutKey struct{}
+
+type totalOperationTimeoutKey struct{}
+
+type operationTimeoutKey struct{}
+
+// WithRequestTimeout returns a context whose requests override RequestTimeout of the configuration, 0 disables it
+func WithRequestTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, requestTimeoutKey{}, d)
+}
+
+// WithTotalOperationTimeout returns a context whose requests override TotalOperationTimeout
+// of the configuration, 0 disables it
+func WithTotalOperationTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, totalOperationTimeoutKey{}, d)
+}
+
+// WithBodyIdleTimeout returns a context whose streamed responses override BodyIdleTimeout
+// of the configuration, 0 disables it
+func WithBodyIdleTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, bodyIdleTimeoutKey{}, d)
+}
+
+// attemptTimeout is the timeout of an attempt, a streamed one is bounded by the
+// stricter ResponseHeaderTimeout until its headers arrive
+func (client *Client) attemptTimeout(ctx context.Context, streamed bool) time.Duration {
+	d := client.requestTimeout(ctx)
+	if !streamed || client.Configuration == nil {
+		return d
+	}
+	if header := client.Configuration.ResponseHeaderTimeout; header > 0 && (d <= 0 || header < d) {
+		return header
+	}
+	return d
+}
+
+func (client *Client) bodyIdleTimeout(ctx context.Context) time.Duration {
+	if d, ok := ctx.Value(bodyIdleTimeoutKey{}).(time.Duration); ok {
+		return d
+	}
+	if client.Configuration == nil {
+		return 0
+	}
+	return client.Configuration.BodyIdleTimeout
+}
+
+func (client *Client) requestTimeout(ctx context.Context) time.Duration {
+	if d, ok := ctx.Value(requestTimeoutKey{}).(time.Duration); ok {
+		return d
+	}
+	if client.Configuration == nil {
+		return 0
+	}
+	return client.Configuration.RequestTimeout
+}
+
+func (client *Client) totalOperationTimeout(ctx context.Context) time.Duration {
+	if d, ok := ctx.Value(totalOperationTimeoutKey{}).(time.Duration); ok {
+		return d
+	}
+	if client.Configuration == nil {
+		return 0
+	}
+	return client.Configuration.TotalOperationTimeout
+}
+
+// withOperationTimeout returns a context whose request bodies restart t when they are sent
+func withOperationTimeout(ctx context.Context, t *timeout) context.Context {
+	return context.WithValue(ctx, operationTimeoutKey{}, t)
+}
+
+func operationTimeoutOf(ctx context.Context) *timeout {
+	t, _ := ctx.Value(operationTimeoutKey{}).(*timeout)
+	return t
+}
+
+// timeout cancels a context after d unless it is stopped before, which unlike
+// context.WithTimeout lets the body of a streamed response outlive it
+type timeout struct {
+	d       time.Duration
+	timer   *time.Timer
+	expired int32
+}
+
+// withTimeout returns a context canceled by cancel or after d, the timeout is nil if d is not positive
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc, *timeout) {
+	ctx, cancel := context.WithCancel(ctx)
+	if d <= 0 {
+		return ctx, cancel, nil
+	}
+
+	t := &timeout{d: d}
+	t.timer = time.AfterFunc(d, func() {
+		atomic.StoreInt32(&t.expired, 1)
+		cancel()
+	})
+	return ctx, cancel, t
+}
+
+// reset restarts the timeout unless it is expired or stopped
+func (t *timeout) reset() {
+	if t != nil && t.timer.Stop() {
+		t.timer.Reset(t.d)
+	}
+}
+
+func (t *timeout) stop() {
+	if t != nil {
+		t.timer.Stop()
+	}
+}
+
+func (t *timeout) isExpired() bool {
+	return t != nil && atomic.LoadInt32(&t.expired) == 1
+}
+
+// progressBody resets the timeouts of a request and of its operation whenever its
+// body is read, so that sending a large body is bounded by the time without progress
+type progressBody struct {
+	io.ReadCloser
+	timeout   *timeout
+	operation *timeout
+}
+
+func (body *progressBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	if n > 0 {
+		body.timeout.reset()
+		body.operation.reset()
+	}
+	return n, err
+}
+
+// cancelBody cancels the context of a response once its body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancelBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
+
+// idleBody fails the reads of a streamed response body once a read gets no data for d,
+// the time between the reads of the caller is not counted
+type idleBody struct {
+	io.ReadCloser
+	d       time.Duration
+	timer   *time.Timer
+	expired int32
+}
+
+// newIdleBody returns body whose idle reads are canceled by cancel
+func newIdleBody(body io.ReadCloser, d time.Duration, cancel context.CancelFunc) *idleBody {
+	b := &idleBody{ReadCloser: body, d: d}
+	b.timer = time.AfterFunc(d, func() {
+		atomic.StoreInt32(&b.expired, 1)
+		cancel()
+	})
+	b.timer.Stop()
+	return b
+}
+
+func (body *idleBody) Read(p []byte) (int, error) {
+	if atomic.LoadInt32(&body.expired) == 1 {
+		return 0, body.err()
+	}
+	body.timer.Reset(body.d)
+	n, err := body.ReadCloser.Read(p)
+	body.timer.Stop()
+	if err != nil && atomic.LoadInt32(&body.expired) == 1 {
+		return n, body.err()
+	}
+	return n, err
+}
+
+func (body *idleBody) Close() error {
+	body.timer.Stop()
+	return body.ReadCloser.Close()
+}
+
+func (body *idleBody) err() error {
+	return fmt.Errorf("%w after %v", ErrorBodyIdleTimeout, body.d)
+}
@@ -0,0 +1,197 @@
+package fds
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowReader returns a byte of data every interval
+type slowReader struct {
+	data     string
+	interval time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, io.EOF
+	}
+	time.Sleep(r.interval)
+	n := copy(p[:1], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func Test_RequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bucket/slow-headers":
+			time.Sleep(200 * time.Millisecond)
+		case "/bucket/slow-body":
+			w.Write([]byte("hello "))
+			w.(http.Flusher).Flush()
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte("world"))
+		case "/bucket/upload":
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Write([]byte(`{"objectName":"` + string(body) + `"}`))
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(server)
+	assert.Equal(t, DefaultRequestTimeout, client.Configuration.RequestTimeout)
+	assert.Equal(t, DefaultTotalOperationTimeout, client.Configuration.TotalOperationTimeout)
+	client.Configuration.RequestTimeout = 50 * time.Millisecond
+
+	_, err := client.GetObjectMetadata("bucket", "slow-headers")
+	assert.True(t, errors.Is(err, ErrorRequestTimeout), err)
+
+	// a context overrides the configuration
+	_, err = client.GetObjectMetadataWithContext(WithRequestTimeout(context.Background(), 0), "bucket", "slow-headers")
+	assert.Nil(t, err)
+
+	// the body of a streamed GET outlives the timeout
+	body, err := client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "slow-body"})
+	assert.Nil(t, err)
+	content, err := ioutil.ReadAll(body)
+	body.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", string(content))
+
+	// sending a body restarts the timeout
+	result, err := client.PutObject(&PutObjectRequest{
+		BucketName: "bucket",
+		ObjectName: "upload",
+		Data:       &slowReader{data: "uploaded", interval: 20 * time.Millisecond},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "uploaded", result.ObjectName)
+
+	// a canceled context is not a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.GetObjectMetadataWithContext(ctx, "bucket", "slow-headers")
+	assert.True(t, errors.Is(err, context.Canceled), err)
+}
+
+func Test_TotalOperationTimeout(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Write([]byte(`{"objectName":"` + string(body) + `"}`))
+			return
+		}
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client := newTestClient(server)
+	client.Configuration.RetryPolicy = &RetryPolicy{
+		MaxAttempts:          100,
+		BaseBackoff:          20 * time.Millisecond,
+		MaxBackoff:           20 * time.Millisecond,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	}
+	client.Configuration.TotalOperationTimeout = 100 * time.Millisecond
+
+	_, err := client.GetObjectMetadata("bucket", "object")
+	assert.True(t, errors.Is(err, ErrorTotalOperationTimeout), err)
+	assert.True(t, atomic.LoadInt32(&attempts) > 1)
+	assert.True(t, atomic.LoadInt32(&attempts) < 100)
+
+	atomic.StoreInt32(&attempts, 0)
+	client.Configuration.RetryPolicy.MaxAttempts = 3
+	ctx := WithTotalOperationTimeout(context.Background(), 0)
+	_, err = client.ListObjectsWithContext(ctx, &ListObjectsRequest{BucketName: "bucket"})
+	assert.False(t, errors.Is(err, ErrorTotalOperationTimeout))
+	assert.True(t, strings.Contains(err.Error(), "503"), err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+
+	// a slow upload longer than the timeout is not cut while its body makes progress,
+	// without a retry policy the body is sent as it is read, like a file
+	client.Configuration.RetryPolicy = nil
+	result, err := client.PutObject(&PutObjectRequest{
+		BucketName: "bucket",
+		ObjectName: "upload",
+		Data:       &slowReader{data: "slowly uploaded", interval: 20 * time.Millisecond},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "slowly uploaded", result.ObjectName)
+}
+
+func Test_StreamedResponseTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bucket/slow-headers":
+			time.Sleep(200 * time.Millisecond)
+		case "/bucket/stalled-body":
+			w.Write([]byte("hello "))
+			w.(http.Flusher).Flush()
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte("world"))
+		case "/bucket/slow-body":
+			for _, b := range []byte("hello world") {
+				w.Write([]byte{b})
+				w.(http.Flusher).Flush()
+				time.Sleep(20 * time.Millisecond)
+			}
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(server)
+	assert.Equal(t, DefaultResponseHeaderTimeout, client.Configuration.ResponseHeaderTimeout)
+	assert.Equal(t, DefaultBodyIdleTimeout, client.Configuration.BodyIdleTimeout)
+	client.Configuration.ResponseHeaderTimeout = 50 * time.Millisecond
+	client.Configuration.BodyIdleTimeout = 100 * time.Millisecond
+
+	// the headers of a streamed GET are bounded by the shorter header timeout
+	_, err := client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "slow-headers"})
+	assert.True(t, errors.Is(err, ErrorRequestTimeout), err)
+	client.Configuration.ResponseHeaderTimeout = 0
+	_, err = client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "slow-headers"})
+	assert.Nil(t, err)
+
+	// a body which makes progress is read although it takes longer than every timeout
+	body, err := client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "slow-body"})
+	assert.Nil(t, err)
+	content, err := ioutil.ReadAll(body)
+	body.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", string(content))
+
+	// a stalled one fails once no data arrives for the idle timeout
+	body, err = client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "stalled-body"})
+	assert.Nil(t, err)
+	content, err = ioutil.ReadAll(body)
+	body.Close()
+	assert.True(t, errors.Is(err, ErrorBodyIdleTimeout), err)
+	assert.Equal(t, "hello ", string(content))
+
+	// the time between the reads of the caller is not idle
+	body, err = client.GetObject(&GetObjectRequest{BucketName: "bucket", ObjectName: "slow-body"})
+	assert.Nil(t, err)
+	time.Sleep(200 * time.Millisecond)
+	content, err = ioutil.ReadAll(body)
+	body.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", string(content))
+
+	// a context overrides the idle timeout
+	ctx := WithBodyIdleTimeout(context.Background(), 0)
+	body, err = client.GetObjectWithContext(ctx, &GetObjectRequest{BucketName: "bucket", ObjectName: "stalled-body"})
+	assert.Nil(t, err)
+	content, err = ioutil.ReadAll(body)
+	body.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", string(content))
+}
@@ -0,0 +1,79 @@
+package fds
+
+import "context"
+
+// Attributes of the spans
+const (
+	AttributeBucket        = "fds.bucket"
+	AttributeObject        = "fds.object"
+	AttributeMethod        = "http.method"
+	AttributeStatusCode    = "http.status_code"
+	AttributeRequestID     = "fds.request_id"
+	AttributeRequestBytes  = "fds.request_bytes"
+	AttributeResponseBytes = "fds.response_bytes"
+	AttributeAttempt       = "fds.attempt"
+	AttributeError         = "error"
+)
+
+// EventRetry is the event of a span when a failed attempt is retried
+const EventRetry = "retry"
+
+// Attribute is an attribute of a span, Value is a string, bool, int or int64
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span is a span started by a TraceProvider
+type Span interface {
+	SetAttributes(attributes ...Attribute)
+	AddEvent(name string, attributes ...Attribute)
+}
+
+// TraceProvider traces the operations of the Client and the manager, the context returned
+// by StartSpan carries the span so that the spans started with it are its children.
+// See the otelfds module for OpenTelemetry.
+type TraceProvider interface {
+	StartSpan(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span)
+	EndSpan(span Span, err error)
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(attributes ...Attribute) {}
+
+func (nopSpan) AddEvent(name string, attributes ...Attribute) {}
+
+// StartSpan starts a span of provider and returns the function ending it,
+// the span does nothing if provider is nil
+func StartSpan(ctx context.Context, provider TraceProvider, name string, attributes ...Attribute) (context.Context, Span, func(err error)) {
+	if provider == nil {
+		return ctx, nopSpan{}, func(error) {}
+	}
+
+	ctx, span := provider.StartSpan(ctx, name, attributes...)
+	return ctx, span, func(err error) {
+		provider.EndSpan(span, err)
+	}
+}
+
+type spanKey struct{}
+
+// withSpan returns a context carrying span of the Client, which records the attempts of a request
+func withSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func spanOf(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return nopSpan{}
+}
+
+func (client *Client) traceProvider() TraceProvider {
+	if client.Configuration == nil {
+		return nil
+	}
+	return client.Configuration.TraceProvider
+}
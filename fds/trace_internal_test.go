@@ -0,0 +1,132 @@
+package fds
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedSpan struct {
+	mu         *sync.Mutex
+	name       string
+	parent     *recordedSpan
+	attributes map[string]interface{}
+	events     []string
+	err        error
+	ended      bool
+}
+
+func (span *recordedSpan) SetAttributes(attributes ...Attribute) {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	for _, a := range attributes {
+		span.attributes[a.Key] = a.Value
+	}
+}
+
+func (span *recordedSpan) AddEvent(name string, attributes ...Attribute) {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	span.events = append(span.events, name)
+}
+
+type recordedSpanKey struct{}
+
+// recordingTracer keeps the spans started, whose parents are the spans of the contexts
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (tracer *recordingTracer) StartSpan(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span) {
+	span := &recordedSpan{mu: &tracer.mu, name: name, attributes: map[string]interface{}{}}
+	span.parent, _ = ctx.Value(recordedSpanKey{}).(*recordedSpan)
+	span.SetAttributes(attributes...)
+
+	tracer.mu.Lock()
+	tracer.spans = append(tracer.spans, span)
+	tracer.mu.Unlock()
+	return context.WithValue(ctx, recordedSpanKey{}, span), span
+}
+
+func (tracer *recordingTracer) EndSpan(span Span, err error) {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	recorded := span.(*recordedSpan)
+	recorded.err = err
+	recorded.ended = true
+}
+
+func Test_TraceProvider(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HTTPHeaderRequestID, "request-id")
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/bucket/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	tracer := &recordingTracer{}
+	client := newTestClient(server)
+	client.Configuration.TraceProvider = tracer
+	client.Configuration.RetryPolicy = &RetryPolicy{
+		MaxAttempts:          2,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	}
+	client.clock = &fakeClock{now: time.Now()}
+
+	ctx, parent := tracer.StartSpan(context.Background(), "parent")
+	_, err := client.PutObjectWithContext(ctx, &PutObjectRequest{
+		BucketName: "bucket",
+		ObjectName: "object",
+		Data:       strings.NewReader("data"),
+	})
+	assert.Nil(t, err)
+	_, err = client.GetObjectMetadata("bucket", "missing")
+	assert.NotNil(t, err)
+
+	assert.Equal(t, 3, len(tracer.spans))
+	put := tracer.spans[1]
+	assert.Equal(t, "fds.PUT", put.name)
+	assert.Equal(t, parent, put.parent)
+	assert.True(t, put.ended)
+	assert.Nil(t, put.err)
+	assert.Equal(t, []string{EventRetry}, put.events)
+	assert.Equal(t, map[string]interface{}{
+		AttributeBucket:        "bucket",
+		AttributeObject:        "object",
+		AttributeMethod:        "PUT",
+		AttributeStatusCode:    http.StatusOK,
+		AttributeRequestID:     "request-id",
+		AttributeRequestBytes:  int64(4),
+		AttributeResponseBytes: int64(2),
+	}, put.attributes)
+
+	metadata := tracer.spans[2]
+	assert.Equal(t, "fds.GET", metadata.name)
+	assert.Nil(t, metadata.parent)
+	assert.True(t, metadata.ended)
+	assert.Equal(t, err, metadata.err)
+	assert.Equal(t, http.StatusNotFound, metadata.attributes[AttributeStatusCode])
+	assert.Nil(t, metadata.events)
+
+	// without a provider the spans do nothing
+	_, span, end := StartSpan(context.Background(), nil, "nop")
+	span.SetAttributes(Attribute{AttributeBucket, "bucket"})
+	span.AddEvent(EventRetry)
+	end(nil)
+}
@@ -0,0 +1,87 @@
+package fds
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// MaxUserMetadataSize is the limit of the total size of keys and encoded values of user metadata
+const MaxUserMetadataSize = 2048
+
+// userMetadataCharset is the charset of the RFC 2047 encoded values
+const userMetadataCharset = "utf-8"
+
+// UserMetadata are x-xiaomi-meta-* headers without the prefix, keys are lowercase and
+// values which are not printable ASCII are sent RFC 2047 encoded
+type UserMetadata map[string]string
+
+// Validate checks the keys and the total size of user metadata
+func (metadata UserMetadata) Validate() error {
+	size := 0
+	for k, v := range metadata {
+		if !validUserMetadataKey(k) {
+			return fmt.Errorf("%w: %q", ErrorUserMetadataKeyInvalid, k)
+		}
+		size += len(k) + len(encodeUserMetadataValue(v))
+	}
+	if size > MaxUserMetadataSize {
+		return fmt.Errorf("%w: %d bytes, at most %d", ErrorUserMetadataTooLarge, size, MaxUserMetadataSize)
+	}
+	return nil
+}
+
+// header returns a copy of h with the user metadata encoded, h is returned as-is if there is none
+func (metadata UserMetadata) header(h http.Header) http.Header {
+	if len(metadata) == 0 {
+		return h
+	}
+
+	result := make(http.Header, len(h)+len(metadata))
+	for k, v := range h {
+		result[k] = v
+	}
+	for k, v := range metadata {
+		result.Set(XiaomiMetaPrefix+k, encodeUserMetadataValue(v))
+	}
+	return result
+}
+
+func validUserMetadataKey(k string) bool {
+	if k == "" || strings.EqualFold(XiaomiMetaPrefix+k, HTTPHeaderContentMetadataLength) {
+		return false
+	}
+	for _, c := range k {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeUserMetadataValue encodes v with RFC 2047 unless it is printable ASCII which
+// can not be mistaken for an encoded word
+func encodeUserMetadataValue(v string) string {
+	plain := !strings.HasPrefix(v, "=?")
+	for i := 0; plain && i < len(v); i++ {
+		plain = v[i] >= ' ' && v[i] <= '~'
+	}
+	if plain {
+		return v
+	}
+	return "=?" + userMetadataCharset + "?b?" + base64.StdEncoding.EncodeToString([]byte(v)) + "?="
+}
+
+// decodeUserMetadataValue decodes the RFC 2047 encoded v, it is kept as-is if invalid
+func decodeUserMetadataValue(v string) string {
+	if !strings.HasPrefix(v, "=?") {
+		return v
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(v)
+	if err != nil {
+		return v
+	}
+	return decoded
+}
@@ -0,0 +1,102 @@
+package fds
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newUserMetadataTestServer keeps the x-xiaomi-meta-* headers of the last PUT and returns them as metadata
+func newUserMetadataTestServer() *httptest.Server {
+	var mu sync.Mutex
+	stored := http.Header{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPut {
+			stored = http.Header{}
+			for k, v := range r.Header {
+				if strings.HasPrefix(strings.ToLower(k), XiaomiMetaPrefix) {
+					stored[k] = v
+				}
+			}
+			w.Write([]byte("{}"))
+			return
+		}
+		for k, v := range stored {
+			w.Header()[k] = v
+		}
+	}))
+}
+
+func Test_UserMetadataRoundTrip(t *testing.T) {
+	server := newUserMetadataTestServer()
+	defer server.Close()
+	client := newTestClient(server)
+
+	userMetadata := UserMetadata{
+		"plain":   "hello world",
+		"unicode": "你好, 世界",
+		"encoded": "=?utf-8?q?looks_encoded?=",
+		"newline": "a\nb",
+	}
+	_, err := client.PutObject(&PutObjectRequest{
+		BucketName:   "bucket",
+		ObjectName:   "object",
+		Data:         strings.NewReader("data"),
+		UserMetadata: userMetadata,
+	})
+	assert.Nil(t, err)
+
+	md, err := client.GetObjectMetadata("bucket", "object")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string(userMetadata), md.GetUserMetadata())
+	assert.Equal(t, "hello world", md.Get(XiaomiMetaPrefix+"plain"))
+
+	_, err = client.InitMultipartUpload(&InitMultipartUploadRequest{
+		BucketName:   "bucket",
+		ObjectName:   "multipart",
+		UserMetadata: UserMetadata{"unicode": "ünïcödé"},
+	})
+	assert.Nil(t, err)
+
+	md, err = client.GetObjectMetadata("bucket", "multipart")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"unicode": "ünïcödé"}, md.GetUserMetadata())
+
+	md = NewObjectMetadata()
+	md.SetUserMetadata(userMetadata)
+	assert.Equal(t, map[string]string(userMetadata), md.GetUserMetadata())
+}
+
+func Test_UserMetadataValidate(t *testing.T) {
+	assert.Nil(t, UserMetadata(nil).Validate())
+	assert.Nil(t, UserMetadata{"a-b_c.1": "v"}.Validate())
+
+	for _, k := range []string{"", "Upper", "with space", "content-length", "键"} {
+		err := UserMetadata{k: "v"}.Validate()
+		assert.True(t, errors.Is(err, ErrorUserMetadataKeyInvalid), k)
+	}
+
+	assert.Nil(t, UserMetadata{"k": strings.Repeat("v", MaxUserMetadataSize-1)}.Validate())
+	err := UserMetadata{"k": strings.Repeat("v", MaxUserMetadataSize)}.Validate()
+	assert.True(t, errors.Is(err, ErrorUserMetadataTooLarge))
+
+	// the encoded size counts, which is larger than the unicode value
+	err = UserMetadata{"k": strings.Repeat("你", MaxUserMetadataSize/4)}.Validate()
+	assert.True(t, errors.Is(err, ErrorUserMetadataTooLarge))
+
+	client := New("ak", "sk", nil)
+	_, err = client.PutObject(&PutObjectRequest{
+		BucketName:   "bucket",
+		ObjectName:   "object",
+		Data:         strings.NewReader("data"),
+		UserMetadata: UserMetadata{"k": strings.Repeat("v", MaxUserMetadataSize)},
+	})
+	assert.True(t, errors.Is(err, ErrorUserMetadataTooLarge))
+}